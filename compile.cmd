@@ -8,6 +8,9 @@ SET OUTPUT=%CD%\bin
 rem %GOEXECUTABLE% get -u -v golang.org/x/text/encoding/charmap
 call :COMPILE SafeExperiments
 call :COMPILE DirectExperiments
+%GOEXECUTABLE% build -o %OUTPUT%\irbis-gateway.exe -v irbis-gateway
+%GOEXECUTABLE% build -o %OUTPUT%\irbis-z3950.exe -v irbis-z3950
+%GOEXECUTABLE% build -o %OUTPUT%\irbis.exe -v irbis-cli
 
 goto :DONE
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"./irbis"
+	"context"
 	"os"
 )
 
@@ -25,15 +26,15 @@ func main() {
 	}
 	defer func() { _ = writer.Close() }()
 
-	maxMfn := reader.GetMaxMfn()
-	for mfn := 1; mfn < maxMfn; mfn++ {
-		record, err := reader.ReadRecord(mfn)
-		if err != nil || record == nil {
-			continue
-		}
-		err = record.ExportPlainText(writer)
+	stream := reader.Scan(context.Background(), &irbis.ScanOptions{MemoryMap: true})
+	defer stream.Close()
+	for stream.Next() {
+		err = stream.Record().ExportPlainText(writer)
 		if err != nil {
 			panic(err)
 		}
 	}
+	if err = stream.Err(); err != nil {
+		panic(err)
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"./irbis"
+	"context"
 	"os"
 	"sort"
 	"strconv"
@@ -27,14 +28,12 @@ func main() {
 	}
 	defer func() { _ = writer.Close() }()
 
-	maxMfn := reader.GetMaxMfn()
-	list := make([]string, 0, maxMfn)
+	list := make([]string, 0, reader.GetMaxMfn())
 
-	for mfn := 1; mfn < maxMfn; mfn++ {
-		record, err := reader.ReadRecord(mfn)
-		if err != nil || record == nil {
-			continue
-		}
+	stream := reader.Scan(context.Background(), &irbis.ScanOptions{MemoryMap: true})
+	defer stream.Close()
+	for stream.Next() {
+		record := stream.Record()
 		index := record.FM(903)
 		countText := record.FM(999)
 		if len(index) == 0 || len(countText) == 0 {
@@ -47,6 +46,9 @@ func main() {
 		line := index + "\t" + strconv.Itoa(count)
 		list = append(list, line)
 	}
+	if err = stream.Err(); err != nil {
+		panic(err)
+	}
 
 	sort.Strings(list)
 	for _, line := range list {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"./irbis"
+	"context"
 	"os"
 	"time"
 )
@@ -36,20 +37,26 @@ func main() {
 
 	maxMfn := connection.GetMaxMfn(connection.Database)
 	expression := `"I=0" + "I=2"` // Невыполненные и зарезервированные
-	found := connection.SearchAll(expression)
-	if len(found) == maxMfn {
+	found := connection.SearchCount(expression)
+	if found == maxMfn {
 		println("No truncation needed, exiting")
-     		return
+		return
 	}
 
-	// TODO ReadAllRecords
-	goodRecords := connection.ReadRecords(found)
-	println("Good records loaded:", len(goodRecords))
-	for i := range goodRecords {
-		record := &goodRecords[i]
+	var goodRecords []irbis.MarcRecord
+	stream := connection.SearchStream(context.Background(), expression, nil)
+	for stream.Next() {
+		record := stream.Record()
 		record.Reset()
 		record.Database = connection.Database
+		goodRecords = append(goodRecords, *record)
+	}
+	stream.Close()
+	if stream.Err() != nil {
+		println("Error while loading records:", stream.Err().Error())
+		return
 	}
+	println("Good records loaded:", len(goodRecords))
 
 	connection.TruncateDatabase(connection.Database)
 	if connection.GetMaxMfn(connection.Database) > 1 {
@@ -57,9 +64,16 @@ func main() {
 		return
 	}
 
-	// TODO WriteAllRecords
-	connection.WriteRecords(goodRecords)
-	println("Good records restored")
+	// Один поток, чтобы записи получили MFN в прежнем порядке
+	options := &irbis.StreamOptions{Workers: 1}
+	results := connection.WriteRecordsBatched(context.Background(), goodRecords, options)
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	println("Good records restored:", len(results)-failed, "failed:", failed)
 
 	elapsed := time.Since(start)
 	println("Elapsed time:", elapsed.String())
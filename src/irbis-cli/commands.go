@@ -0,0 +1,977 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"irbis"
+	"os"
+	"strings"
+)
+
+// readRecords Чтение записей с сервера либо из локальной базы.
+func (current *session) readRecords(mfnList []int) ([]irbis.MarcRecord, error) {
+	if current.access != nil {
+		return irbis.NewDirectRecordSource(current.access).ReadRecords(mfnList)
+	}
+	result := current.connection.ReadRecords(mfnList)
+	return result, current.failure("read")
+}
+
+// maxMfn Максимальный MFN записи в базе данных.
+func (current *session) maxMfn() (int, error) {
+	if current.access != nil {
+		return current.access.GetMaxMfn(), nil
+	}
+	// Сервер выдаёт MFN, который получит следующая запись
+	result := current.connection.GetMaxMfn(current.database) - 1
+	return result, current.failure("max MFN")
+}
+
+// findCodec Кодировка по имени (пустое имя -- кодировка по умолчанию).
+func findCodec(name string) (irbis.Codec, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+	result := irbis.FindCodec(name, false)
+	if result == nil {
+		return nil, &usageError{"unknown encoding: " + name}
+	}
+	return result, nil
+}
+
+// openInput Открытие входного файла ("-" или пустое имя -- stdin).
+func openInput(name string) (io.ReadCloser, error) {
+	if len(name) == 0 || name == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+//===================================================================
+
+func runSearch(args []string) error {
+	opts := newOptions("search", serverOnly)
+	format := opts.flags.String("format", "", "format for record descriptions, e.g. @brief")
+	limit := opts.flags.Int("limit", 0, "maximum number of records (0 -- all)")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() != 1 {
+		return &usageError{"search expression required"}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	expression := opts.flags.Arg(0)
+	if len(*format) == 0 {
+		found := current.connection.SearchAll(expression)
+		if err = current.failure("search"); err != nil {
+			return err
+		}
+		if *limit > 0 && len(found) > *limit {
+			found = found[:*limit]
+		}
+		rows := make([][]interface{}, len(found))
+		for i, mfn := range found {
+			rows[i] = []interface{}{mfn}
+		}
+		return current.out.table([]string{"mfn"}, rows)
+	}
+
+	parameters := irbis.NewSearchParameters()
+	parameters.Database = current.database
+	parameters.Expression = expression
+	parameters.Format = *format
+	parameters.NumberOfRecords = *limit
+	found := current.connection.SearchEx(parameters)
+	if err = current.failure("search"); err != nil {
+		return err
+	}
+	rows := make([][]interface{}, len(found))
+	for i, line := range found {
+		rows[i] = []interface{}{line.Mfn, line.Description}
+	}
+	return current.out.table([]string{"mfn", "description"}, rows)
+}
+
+func runRead(args []string) error {
+	opts := newOptions("read", serverOrLocal)
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	mfnList, err := parseMfnList(opts.flags.Args())
+	if err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	records, err := current.readRecords(mfnList)
+	if err != nil {
+		return err
+	}
+	writer, err := newRecordWriter(opts.output, os.Stdout, nil)
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		if err = writer.Write(&records[i]); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func runWrite(args []string) error {
+	opts := newOptions("write", serverOnly)
+	input := opts.flags.String("input", "text", "input format: text, json or iso")
+	encoding := opts.flags.String("encoding", "", "encoding of ISO 2709 input (default windows-1251)")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() > 1 {
+		return &usageError{"too many arguments"}
+	}
+	codec, err := findCodec(*encoding)
+	if err != nil {
+		return err
+	}
+
+	file, err := openInput(opts.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	read, err := newRecordReader(*input, file, codec)
+	if err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	var rows [][]interface{}
+	for {
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		record.Database = current.database
+		current.connection.WriteRecord(record)
+		if err = current.failure("write"); err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{record.Mfn, record.Version})
+	}
+	return current.out.table([]string{"mfn", "version"}, rows)
+}
+
+func runFormat(args []string) error {
+	opts := newOptions("format", serverOnly)
+	format := opts.flags.String("format", "", "format (name of PFT file with @ or format text)")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if len(*format) == 0 {
+		return &usageError{"format (-format) required"}
+	}
+	mfnList, err := parseMfnList(opts.flags.Args())
+	if err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	rows := make([][]interface{}, 0, len(mfnList))
+	for _, mfn := range mfnList {
+		text := current.connection.FormatMfn(*format, mfn)
+		if err = current.failure("format"); err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{mfn, strings.TrimRight(text, "\r\n")})
+	}
+	if opts.output == "text" {
+		for _, row := range rows {
+			if err = current.out.text(row[1].(string) + "\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return current.out.table([]string{"mfn", "text"}, rows)
+}
+
+func runTerms(args []string) error {
+	opts := newOptions("terms", serverOrLocal)
+	prefix := opts.flags.String("prefix", "", "list only terms with the prefix, e.g. A=")
+	limit := opts.flags.Int("limit", 100, "maximum number of terms (0 -- all)")
+	reverse := opts.flags.Bool("reverse", false, "list terms in reverse order")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() > 1 {
+		return &usageError{"too many arguments"}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	start := *prefix
+	if opts.flags.NArg() == 1 {
+		start = opts.flags.Arg(0)
+	}
+	parameters := &irbis.TermParameters{Database: current.database,
+		StartTerm: start, ReverseOrder: *reverse}
+	var iterator *irbis.TermIterator
+	if current.access != nil {
+		iterator = irbis.NewDirectTermIterator(current.access, parameters)
+	} else {
+		iterator = irbis.NewTermIterator(current.connection, parameters)
+	}
+	iterator.Prefix = *prefix
+
+	var rows [][]interface{}
+	for (*limit <= 0 || len(rows) < *limit) && iterator.Next() {
+		term := iterator.Term()
+		rows = append(rows, []interface{}{term.Count, term.Text})
+	}
+	if iterator.Err() != nil {
+		return iterator.Err()
+	}
+	return current.out.table([]string{"count", "text"}, rows)
+}
+
+func runPostings(args []string) error {
+	opts := newOptions("postings", serverOrLocal)
+	limit := opts.flags.Int("limit", 0, "maximum number of postings per term (0 -- all)")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() == 0 {
+		return &usageError{"term required"}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	var rows [][]interface{}
+	for _, term := range opts.flags.Args() {
+		parameters := &irbis.PostingParameters{Database: current.database, Term: term}
+		var iterator *irbis.PostingIterator
+		if current.access != nil {
+			iterator = irbis.NewDirectPostingIterator(current.access, parameters)
+		} else {
+			iterator = irbis.NewPostingIterator(current.connection, parameters)
+		}
+
+		count := 0
+		for (*limit <= 0 || count < *limit) && iterator.Next() {
+			posting := iterator.Posting()
+			rows = append(rows, []interface{}{term, posting.Mfn, posting.Tag,
+				posting.Occurrence, posting.Count})
+			count++
+		}
+		if iterator.Err() != nil {
+			return iterator.Err()
+		}
+	}
+	return current.out.table([]string{"term", "mfn", "tag", "occurrence", "count"}, rows)
+}
+
+func runDbInfo(args []string) error {
+	opts := newOptions("dbinfo", serverOrLocal)
+	list := opts.flags.Bool("list", false, "list server databases")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	if *list {
+		if current.connection == nil {
+			return &usageError{"-list requires a server connection"}
+		}
+		databases := current.connection.ListDatabases("")
+		if err = current.failure("list databases"); err != nil {
+			return err
+		}
+		rows := make([][]interface{}, len(databases))
+		for i, database := range databases {
+			rows[i] = []interface{}{database.Name, database.Description, database.ReadOnly}
+		}
+		return current.out.table([]string{"name", "description", "readOnly"}, rows)
+	}
+
+	var info irbis.DatabaseInfo
+	if current.access != nil {
+		info.Name = current.database
+		info.MaxMfn = current.access.GetMaxMfn()
+	} else {
+		found := current.connection.GetDatabaseInfo(current.database)
+		if err = current.failure("database info"); err != nil {
+			return err
+		}
+		if found == nil {
+			return errors.New("can't get database info")
+		}
+		info = *found
+		info.Name = current.database
+	}
+
+	properties := [][]interface{}{
+		{"name", info.Name},
+		{"maxMfn", info.MaxMfn},
+		{"logicallyDeleted", len(info.LogicallyDeletedRecords)},
+		{"physicallyDeleted", len(info.PhysicallyDeletedRecords)},
+		{"nonActualized", len(info.NonActualizedRecords)},
+		{"locked", len(info.LockedRecords)},
+		{"databaseLocked", info.DatabaseLocked},
+	}
+	if opts.output == "json" {
+		object := make(map[string]interface{}, len(properties))
+		for _, property := range properties {
+			object[property[0].(string)] = property[1]
+		}
+		return current.out.json(object)
+	}
+	return current.out.table([]string{"property", "value"}, properties)
+}
+
+func runUsers(args []string) error {
+	opts := newOptions("users", serverOnly)
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	users := current.connection.GetUserList()
+	if err = current.failure("user list"); err != nil {
+		return err
+	}
+	rows := make([][]interface{}, len(users))
+	for i, user := range users {
+		rows[i] = []interface{}{user.Number, user.Name, user.Cataloger, user.Reader,
+			user.Circulation, user.Acquisitions, user.Provision, user.Administrator}
+	}
+	return current.out.table([]string{"number", "name", "cataloger", "reader",
+		"circulation", "acquisitions", "provision", "administrator"}, rows)
+}
+
+func runProcesses(args []string) error {
+	opts := newOptions("processes", serverOnly)
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	processes := current.connection.ListProcesses()
+	if err = current.failure("process list"); err != nil {
+		return err
+	}
+	rows := make([][]interface{}, len(processes))
+	for i, process := range processes {
+		rows[i] = []interface{}{process.Number, process.IPAddress, process.Name,
+			process.ClientId, process.Workstation, process.Started, process.LastCommand,
+			process.CommandNumber, process.ProcessId, process.State}
+	}
+	return current.out.table([]string{"number", "address", "name", "clientId", "workstation",
+		"started", "lastCommand", "commandNumber", "processId", "state"}, rows)
+}
+
+func runStat(args []string) error {
+	opts := newOptions("stat", serverOnly)
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	stat := current.connection.GetServerStat()
+	if err = current.failure("server stat"); err != nil {
+		return err
+	}
+	header := []string{"number", "address", "port", "name", "id", "workstation",
+		"registered", "acknowledged", "lastCommand", "commandNumber"}
+	rows := make([][]interface{}, len(stat.RunningClients))
+	for i, client := range stat.RunningClients {
+		rows[i] = []interface{}{client.Number, client.IPAddress, client.Port, client.Name,
+			client.Id, client.Workstation, client.Registered, client.Acknowledged,
+			client.LastCommand, client.CommandNumber}
+	}
+
+	if opts.output == "json" {
+		clients := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			clients[i] = make(map[string]interface{}, len(header))
+			for j, name := range header {
+				clients[i][name] = row[j]
+			}
+		}
+		return current.out.json(map[string]interface{}{
+			"clientCount":       stat.ClientCount,
+			"totalCommandCount": stat.TotalCommandCount,
+			"clients":           clients,
+		})
+	}
+	if opts.output == "text" {
+		err = current.out.text(fmt.Sprintf("Clients: %d, total commands: %d\n\n",
+			stat.ClientCount, stat.TotalCommandCount))
+		if err != nil {
+			return err
+		}
+	}
+	return current.out.table(header, rows)
+}
+
+func runGbl(args []string) error {
+	opts := newOptions("gbl", serverOnly)
+	file := opts.flags.String("file", "", "name of the GBL file on the server")
+	search := opts.flags.String("search", "", "process records found by the expression")
+	mfn := opts.flags.String("mfn", "", "process records with the MFN list, e.g. 1-100,205")
+	batch := opts.flags.Int("batch", 100, "number of records per request")
+	actualize := opts.flags.Bool("actualize", true, "actualize records")
+	autoin := opts.flags.Bool("autoin", false, "run autoin.gbl")
+	formal := opts.flags.Bool("formal", false, "apply formal control")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if len(*file) == 0 {
+		return &usageError{"GBL file (-file) required"}
+	}
+
+	settings := &irbis.GblSettings{Filename: *file, SearchExpression: *search,
+		Actualize: *actualize, Autoin: *autoin, FormalControl: *formal}
+	if len(*mfn) != 0 {
+		var err error
+		if settings.MfnList, err = parseMfnList([]string{*mfn}); err != nil {
+			return err
+		}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	settings.Database = current.database
+	if len(settings.MfnList) == 0 && len(settings.SearchExpression) == 0 {
+		maxMfn, err := current.maxMfn()
+		if err != nil {
+			return err
+		}
+		settings.MinMfn, settings.MaxMfn = 1, maxMfn
+	}
+
+	result, err := current.connection.GlobalCorrectionBatched(settings, *batch,
+		func(done, total int, _ *irbis.GblResult) bool {
+			fmt.Fprintf(os.Stderr, "\r%d/%d", done, total)
+			return true
+		})
+	fmt.Fprintln(os.Stderr)
+	if result == nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, result)
+
+	rows := make([][]interface{}, len(result.Records))
+	for i, item := range result.Records {
+		outcome := "unchanged"
+		switch item.Outcome {
+		case irbis.GBL_CHANGED:
+			outcome = "changed"
+		case irbis.GBL_ERROR:
+			outcome = "error"
+		}
+		rows[i] = []interface{}{item.Mfn, outcome, item.Message}
+	}
+	// Протокол уже выполненных порций выводится и при ошибке
+	if failure := current.out.table([]string{"mfn", "outcome", "message"}, rows); failure != nil {
+		return failure
+	}
+	return err
+}
+
+func runExport(args []string) error {
+	opts := newOptions("export", serverOrLocal)
+	search := opts.flags.String("search", "", "export records found by the expression (server only)")
+	format := opts.flags.String("format", "text", "record format: text, json, csv or iso")
+	encoding := opts.flags.String("encoding", "", "encoding of ISO 2709 output (default windows-1251)")
+	outName := opts.flags.String("out", "", "output file (default stdout)")
+	deleted := opts.flags.Bool("deleted", false, "export logically deleted records too")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	codec, err := findCodec(*encoding)
+	if err != nil {
+		return err
+	}
+	if len(*search) != 0 && len(opts.local) != 0 {
+		return &usageError{"-search requires a server connection"}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	file := os.Stdout
+	if len(*outName) != 0 {
+		if file, err = os.Create(*outName); err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+	}
+	writer, err := newRecordWriter(*format, file, codec)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	if current.access != nil {
+		// Локальная база просматривается целиком
+		stream := current.access.Scan(context.Background(),
+			&irbis.ScanOptions{Deleted: *deleted, MemoryMap: true})
+		defer stream.Close()
+		for stream.Next() {
+			if err = writer.Write(stream.Record()); err != nil {
+				return err
+			}
+			count++
+		}
+		if err = stream.Err(); err != nil {
+			return err
+		}
+	} else {
+		var mfnList []int
+		if len(*search) != 0 {
+			mfnList = current.connection.SearchAll(*search)
+			if err = current.failure("search"); err != nil {
+				return err
+			}
+		} else {
+			maxMfn, err := current.maxMfn()
+			if err != nil {
+				return err
+			}
+			for mfn := 1; mfn <= maxMfn; mfn++ {
+				mfnList = append(mfnList, mfn)
+			}
+		}
+
+		for start := 0; start < len(mfnList); start += irbis.DefaultStreamBatchSize {
+			end := start + irbis.DefaultStreamBatchSize
+			if end > len(mfnList) {
+				end = len(mfnList)
+			}
+			records, err := current.readRecords(mfnList[start:end])
+			if err != nil {
+				return err
+			}
+			for i := range records {
+				if records[i].IsDeleted() && !*deleted {
+					continue
+				}
+				if err = writer.Write(&records[i]); err != nil {
+					return err
+				}
+				count++
+			}
+		}
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Exported:", count)
+	return nil
+}
+
+func runImport(args []string) error {
+	opts := newOptions("import", serverOnly)
+	format := opts.flags.String("format", "text", "record format: text, json or iso")
+	encoding := opts.flags.String("encoding", "", "encoding of ISO 2709 input (default windows-1251)")
+	batch := opts.flags.Int("batch", irbis.DefaultStreamBatchSize, "number of records per request")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() != 1 {
+		return &usageError{"input file required"}
+	}
+	codec, err := findCodec(*encoding)
+	if err != nil {
+		return err
+	}
+
+	file, err := openInput(opts.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	read, err := newRecordReader(*format, file, codec)
+	if err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	// Записи сохраняются в прежнем порядке
+	options := &irbis.StreamOptions{BatchSize: *batch, Workers: 1}
+	written, failed := 0, 0
+	flush := func(records []irbis.MarcRecord) {
+		for _, result := range current.connection.WriteRecordsBatched(context.Background(), records, options) {
+			if result.Err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "record %d: %v\n", written+failed, result.Err)
+			} else {
+				written++
+			}
+		}
+	}
+
+	var records []irbis.MarcRecord
+	for {
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		record.Reset()
+		record.Database = current.database
+		records = append(records, *record)
+		if len(records) == 10*options.BatchSize {
+			flush(records)
+			records = nil
+		}
+	}
+	flush(records)
+
+	fmt.Fprintln(os.Stderr, "Imported:", written, "failed:", failed)
+	if failed != 0 {
+		return fmt.Errorf("%d records not imported", failed)
+	}
+	return nil
+}
+
+func runCatFile(args []string) error {
+	opts := newOptions("cat-file", serverOrLocal)
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() != 1 {
+		return &usageError{"file specification required (e.g. 2.IBIS.brief.pft)"}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	name := opts.flags.Arg(0)
+	if current.access != nil {
+		filename := current.access.Location().FindFile(name)
+		if len(filename) == 0 {
+			return errors.New("file not found: " + name)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	text := current.connection.ReadTextFile(name)
+	if err = current.failure("read file"); err != nil {
+		return err
+	}
+	if len(text) == 0 {
+		return errors.New("file not found or empty: " + name)
+	}
+	return current.out.text(text)
+}
+
+// progress Вывод хода выполнения длительной операции.
+func progress(done, total int) bool {
+	fmt.Fprintf(os.Stderr, "\r%d/%d", done, total)
+	return true
+}
+
+// printBackupInfo Вывод сведений о резервной копии.
+func printBackupInfo(info *irbis.BackupInfo) {
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Database: %s, max MFN: %d, records: %d, versions: %d, files: %d\n",
+		info.Database, info.MaxMfn, info.Records, info.Versions, len(info.Files))
+}
+
+func runBackup(args []string) error {
+	opts := newOptions("backup", serverOrLocal)
+	history := opts.flags.Bool("history", false, "save previous versions of records")
+	files := opts.flags.Bool("files", true, "save database files (PAR, FST, worksheets, menus, formats)")
+	batch := opts.flags.Int("batch", irbis.DefaultStreamBatchSize, "number of records per request")
+	outName := opts.flags.String("out", "", "archive file (default stdout)")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	file := os.Stdout
+	if len(*outName) != 0 {
+		if file, err = os.Create(*outName); err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+	}
+
+	options := &irbis.BackupOptions{History: *history, Files: *files,
+		BatchSize: *batch, Progress: progress}
+	var info *irbis.BackupInfo
+	if current.access != nil {
+		info, err = current.access.Backup(file, options)
+	} else {
+		info, err = current.connection.BackupDatabase(current.database, file, options)
+	}
+	if err != nil {
+		return err
+	}
+
+	printBackupInfo(info)
+	return nil
+}
+
+func runRestore(args []string) error {
+	opts := newOptions("restore", serverOrLocal)
+	create := opts.flags.Bool("create", false, "create the database on the server")
+	overwrite := opts.flags.Bool("overwrite", false, "truncate a non-empty database (or overwrite local files)")
+	history := opts.flags.Bool("history", false, "restore previous versions of records")
+	files := opts.flags.Bool("files", true, "restore database files (except PAR)")
+	encoding := opts.flags.String("encoding", "", "encoding of the local master file (default utf-8)")
+	batch := opts.flags.Int("batch", irbis.DefaultStreamBatchSize, "number of records per request")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if opts.flags.NArg() != 1 {
+		return &usageError{"archive file required"}
+	}
+	codec, err := findCodec(*encoding)
+	if err != nil {
+		return err
+	}
+
+	file, err := openInput(opts.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	options := &irbis.RestoreOptions{Create: *create, Overwrite: *overwrite, History: *history,
+		Files: *files, Codec: codec, BatchSize: *batch, Progress: progress}
+	var info *irbis.BackupInfo
+	if len(opts.local) != 0 {
+		// Локальная база данных создаётся, поэтому не открывается
+		info, err = irbis.RestoreDirect(opts.local, file, options)
+	} else {
+		var current *session
+		if current, err = opts.open(); err != nil {
+			return err
+		}
+		defer current.close()
+		info, err = current.connection.RestoreDatabase(current.database, file, options)
+	}
+	if err != nil {
+		return err
+	}
+
+	printBackupInfo(info)
+	return nil
+}
+
+func runReplicate(args []string) error {
+	opts := newOptions("replicate", serverOrLocal)
+	targetString := opts.flags.String("target", "", "connection string of the target server")
+	targetDatabase := opts.flags.String("target-db", "", "target database name (default from the target connection string)")
+	search := opts.flags.String("search", "", "copy only records found by the expression (server only)")
+	preserve := opts.flags.Bool("preserve-mfn", false, "keep source MFNs in the target database")
+	newOnly := opts.flags.Bool("new-only", false, "copy only records added since the last run")
+	checkpoint := opts.flags.String("checkpoint", "", "checkpoint file to resume and continue replication")
+	batch := opts.flags.Int("batch", irbis.DefaultStreamBatchSize, "number of records per request")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if len(*targetString) == 0 {
+		return &usageError{"target connection string (-target) required"}
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	targetOpts := newOptions("replicate", serverOnly)
+	targetOpts.connectionString, targetOpts.database = *targetString, *targetDatabase
+	target, err := targetOpts.open()
+	if err != nil {
+		return err
+	}
+	defer target.close()
+
+	var source irbis.Replica
+	if current.access != nil {
+		source = irbis.NewDirectReplica(current.access)
+	} else {
+		source = irbis.NewServerReplica(current.connection, current.database)
+	}
+	replication := irbis.NewReplication(source,
+		irbis.NewServerReplica(target.connection, target.database))
+	replication.Expression = *search
+	replication.PreserveMfn = *preserve
+	replication.NewOnly = *newOnly
+	replication.Checkpoint = *checkpoint
+	replication.BatchSize = *batch
+	replication.Progress = progress
+
+	result, err := replication.Run(context.Background())
+	fmt.Fprintln(os.Stderr)
+	if result != nil {
+		fmt.Fprintln(os.Stderr, result)
+	}
+	return err
+}
+
+func runCheck(args []string) error {
+	opts := newOptions("check", localOnly)
+	postings := opts.flags.Bool("postings", false, "check that dictionary postings refer to existing records")
+	rebuild := opts.flags.Bool("rebuild-xrf", false, "rebuild the XRF file from the master file before checking")
+	limit := opts.flags.Int("limit", 0, "maximum number of reported problems (0 -- no limit)")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if len(opts.local) == 0 {
+		return &usageError{"local database (-local) required"}
+	}
+
+	if *rebuild {
+		count, damaged, err := irbis.RebuildXrf(opts.local)
+		for _, problem := range damaged {
+			fmt.Fprintln(os.Stderr, problem.String())
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "XRF rebuilt: %d records, %d damaged areas skipped\n", count, len(damaged))
+	}
+
+	current, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer current.close()
+
+	result, err := current.access.Verify(&irbis.VerifyOptions{Postings: *postings, MaxProblems: *limit})
+	if err != nil {
+		return err
+	}
+	rows := make([][]interface{}, len(result.Problems))
+	for i, problem := range result.Problems {
+		rows[i] = []interface{}{problem.File, problem.Mfn, problem.Offset, problem.Message}
+	}
+	if len(rows) != 0 {
+		if err = current.out.table([]string{"file", "mfn", "offset", "problem"}, rows); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(os.Stderr, result)
+
+	if !result.Ok() {
+		if result.Overflow {
+			return fmt.Errorf("more than %d problems found", len(result.Problems))
+		}
+		return fmt.Errorf("%d problems found", len(result.Problems))
+	}
+	return nil
+}
+
+func runCompact(args []string) error {
+	opts := newOptions("compact", localOnly)
+	keep := opts.flags.Int("keep", 1, "number of versions to keep for every record")
+	purge := opts.flags.Bool("purge", false, "physically delete logically deleted records")
+	if err := opts.parse(args); err != nil {
+		return err
+	}
+	if len(opts.local) == 0 {
+		return &usageError{"local database (-local) required"}
+	}
+	if *keep < 1 {
+		return &usageError{fmt.Sprintf("bad number of versions: %d", *keep)}
+	}
+
+	result, err := irbis.CompactDatabase(opts.local,
+		&irbis.CompactOptions{KeepVersions: *keep, Purge: *purge, Progress: progress})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, result)
+	return nil
+}
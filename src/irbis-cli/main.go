@@ -0,0 +1,120 @@
+// irbis -- утилита командной строки для работы с сервером ИРБИС64
+// и с файлами баз данных.
+//
+//	irbis search -c "host=127.0.0.1;user=librarian;password=secret;" -d IBIS "K=ПУШКИН"
+//	irbis read -local /irbis64/datai/ibis/ibis -o json 1-10
+//	irbis help
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command Подкоманда утилиты.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands Перечень подкоманд (заполняется в init, поскольку
+// команда help ссылается на сам перечень).
+var commands []command
+
+func init() {
+	commands = []command{
+		{"search", "[options] expression", "search records", runSearch},
+		{"read", "[options] mfn...", "read records", runRead},
+		{"write", "[options] [file]", "write records (new or modified)", runWrite},
+		{"format", "[options] -format pft mfn...", "format records on the server", runFormat},
+		{"terms", "[options] [start]", "list dictionary terms", runTerms},
+		{"postings", "[options] term...", "list term postings", runPostings},
+		{"dbinfo", "[options]", "list databases or show database information", runDbInfo},
+		{"users", "[options]", "list registered users", runUsers},
+		{"processes", "[options]", "list server processes", runProcesses},
+		{"stat", "[options]", "show server statistics", runStat},
+		{"gbl", "[options] -file name.gbl", "run global correction", runGbl},
+		{"export", "[options] [-out file]", "export records to ISO 2709, text, JSON or CSV", runExport},
+		{"import", "[options] file", "import records from ISO 2709, text or JSON", runImport},
+		{"backup", "[options] [-out file]", "back up a database to a compressed archive", runBackup},
+		{"restore", "[options] archive", "restore a database from a backup archive", runRestore},
+		{"replicate", "[options] -target connection", "copy new and changed records to another database", runReplicate},
+		{"check", "-local path [options]", "check integrity of local database files", runCheck},
+		{"compact", "-local path [options]", "compact a local database and purge deleted records", runCompact},
+		{"cat-file", "[options] specification", "print server or database file", runCatFile},
+		{"help", "[command]", "show help", runHelp},
+	}
+}
+
+// usageError Ошибка в аргументах командной строки.
+type usageError struct {
+	message string
+}
+
+func (err *usageError) Error() string {
+	return err.message
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: irbis <command> [options] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, item := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", item.name, item.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'irbis help <command>' for command options.")
+}
+
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
+	item := findCommand(args[0])
+	if item == nil || item.name == "help" {
+		return &usageError{"unknown command: " + args[0]}
+	}
+	return item.run([]string{"-h"})
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	item := findCommand(os.Args[1])
+	if item == nil {
+		fmt.Fprintln(os.Stderr, "irbis: unknown command:", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	err := item.run(os.Args[2:])
+	switch err.(type) {
+	case nil:
+	case *usageError:
+		fmt.Fprintln(os.Stderr, "irbis "+item.name+":", err)
+		fmt.Fprintln(os.Stderr, "Usage: irbis", item.name, item.args)
+		os.Exit(2)
+	default:
+		if err == flag.ErrHelp {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "irbis "+item.name+":", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"irbis"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// output Вывод результатов в текстовом виде, JSON или CSV.
+type output struct {
+	format string
+	writer io.Writer
+}
+
+func newOutput(format string, writer io.Writer) (*output, error) {
+	switch format {
+	case "text", "json", "csv":
+		return &output{format: format, writer: writer}, nil
+	}
+	return nil, &usageError{"unknown output format: " + format}
+}
+
+// table Вывод таблицы. В JSON таблица выводится как массив
+// объектов, ключами которых служат названия столбцов.
+func (out *output) table(header []string, rows [][]interface{}) error {
+	switch out.format {
+	case "json":
+		items := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			items[i] = make(map[string]interface{}, len(header))
+			for j, name := range header {
+				items[i][name] = row[j]
+			}
+		}
+		return out.json(items)
+
+	case "csv":
+		writer := csv.NewWriter(out.writer)
+		_ = writer.Write(header)
+		for _, row := range rows {
+			_ = writer.Write(stringRow(row))
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	writer := tabwriter.NewWriter(out.writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(stringRow(row), "\t"))
+	}
+	return writer.Flush()
+}
+
+// json Вывод произвольного значения в JSON.
+func (out *output) json(value interface{}) error {
+	encoder := json.NewEncoder(out.writer)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(value)
+}
+
+// text Вывод строки текста (в JSON -- строкового значения).
+func (out *output) text(text string) error {
+	if out.format == "json" {
+		return out.json(text)
+	}
+	_, err := io.WriteString(out.writer, text)
+	return err
+}
+
+func stringRow(row []interface{}) []string {
+	result := make([]string, len(row))
+	for i, value := range row {
+		result[i] = fmt.Sprint(value)
+	}
+	return result
+}
+
+//===================================================================
+
+// Представление записи в JSON (совпадает с HTTP-шлюзом).
+
+type subFieldJson struct {
+	Code  string `json:"code"`
+	Value string `json:"value"`
+}
+
+type fieldJson struct {
+	Tag       int            `json:"tag"`
+	Value     string         `json:"value,omitempty"`
+	Subfields []subFieldJson `json:"subfields,omitempty"`
+}
+
+type recordJson struct {
+	Database string      `json:"database,omitempty"`
+	Mfn      int         `json:"mfn"`
+	Version  int         `json:"version"`
+	Status   int         `json:"status"`
+	Fields   []fieldJson `json:"fields"`
+}
+
+func newRecordJson(record *irbis.MarcRecord) recordJson {
+	result := recordJson{Database: record.Database, Mfn: record.Mfn,
+		Version: record.Version, Status: record.Status, Fields: []fieldJson{}}
+	for _, field := range record.Fields {
+		item := fieldJson{Tag: field.Tag, Value: field.Value}
+		for _, subfield := range field.Subfields {
+			item.Subfields = append(item.Subfields,
+				subFieldJson{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		result.Fields = append(result.Fields, item)
+	}
+	return result
+}
+
+func (item *recordJson) toRecord() (*irbis.MarcRecord, error) {
+	result := irbis.NewMarcRecord()
+	result.Database, result.Mfn, result.Version, result.Status =
+		item.Database, item.Mfn, item.Version, item.Status
+	for _, field := range item.Fields {
+		if field.Tag <= 0 {
+			return nil, fmt.Errorf("bad field tag %d", field.Tag)
+		}
+		added := result.Add(field.Tag, field.Value)
+		for _, subfield := range field.Subfields {
+			code, size := utf8.DecodeRuneInString(subfield.Code)
+			if size == 0 || size != len(subfield.Code) {
+				return nil, fmt.Errorf("bad subfield code %q in field %d", subfield.Code, field.Tag)
+			}
+			added.Add(code, subfield.Value)
+		}
+	}
+	return result, nil
+}
+
+//===================================================================
+
+// recordWriter Вывод последовательности записей.
+type recordWriter interface {
+	Write(record *irbis.MarcRecord) error
+	Close() error
+}
+
+// newRecordWriter Вывод записей в формате text (текстовый формат
+// ИРБИС), json, csv (по строке на поле) или iso (ISO 2709
+// в указанной кодировке).
+func newRecordWriter(format string, writer io.Writer, codec irbis.Codec) (recordWriter, error) {
+	switch format {
+	case "text":
+		return &textRecordWriter{writer: writer}, nil
+	case "json":
+		return &jsonRecordWriter{writer: writer}, nil
+	case "csv":
+		result := &csvRecordWriter{writer: csv.NewWriter(writer)}
+		_ = result.writer.Write([]string{"mfn", "status", "tag", "value"})
+		return result, nil
+	case "iso":
+		return &isoRecordWriter{irbis.NewIsoWriter(writer, codec)}, nil
+	}
+	return nil, &usageError{"unknown record format: " + format}
+}
+
+type textRecordWriter struct {
+	writer io.Writer
+}
+
+func (writer *textRecordWriter) Write(record *irbis.MarcRecord) error {
+	_, err := io.WriteString(writer.writer, record.ToPlainText()+"*****\n")
+	return err
+}
+
+func (writer *textRecordWriter) Close() error {
+	return nil
+}
+
+type jsonRecordWriter struct {
+	writer io.Writer
+	count  int
+}
+
+func (writer *jsonRecordWriter) Write(record *irbis.MarcRecord) error {
+	data, err := json.Marshal(newRecordJson(record))
+	if err != nil {
+		return err
+	}
+	prefix := ",\n"
+	if writer.count == 0 {
+		prefix = "[\n"
+	}
+	writer.count++
+	_, err = io.WriteString(writer.writer, prefix+string(data))
+	return err
+}
+
+func (writer *jsonRecordWriter) Close() error {
+	text := "\n]\n"
+	if writer.count == 0 {
+		text = "[]\n"
+	}
+	_, err := io.WriteString(writer.writer, text)
+	return err
+}
+
+type csvRecordWriter struct {
+	writer *csv.Writer
+}
+
+func (writer *csvRecordWriter) Write(record *irbis.MarcRecord) error {
+	for _, field := range record.Fields {
+		_ = writer.writer.Write([]string{strconv.Itoa(record.Mfn),
+			strconv.Itoa(record.Status), strconv.Itoa(field.Tag), field.EncodeBody()})
+	}
+	return writer.writer.Error()
+}
+
+func (writer *csvRecordWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+type isoRecordWriter struct {
+	writer *irbis.IsoWriter
+}
+
+func (writer *isoRecordWriter) Write(record *irbis.MarcRecord) error {
+	return writer.writer.Write(record)
+}
+
+func (writer *isoRecordWriter) Close() error {
+	return nil
+}
+
+//===================================================================
+
+// newRecordReader Чтение записей в формате text, json или iso.
+// Функция чтения по достижении конца потока возвращает io.EOF.
+func newRecordReader(format string, reader io.Reader, codec irbis.Codec) (func() (*irbis.MarcRecord, error), error) {
+	switch format {
+	case "text":
+		return irbis.NewPlainTextReader(reader).Read, nil
+
+	case "iso":
+		return irbis.NewIsoReader(reader, codec).Read, nil
+
+	case "json":
+		decoder := json.NewDecoder(bufio.NewReader(reader))
+		var items []recordJson
+		if err := decoder.Decode(&items); err != nil {
+			return nil, err
+		}
+		index := 0
+		return func() (*irbis.MarcRecord, error) {
+			if index >= len(items) {
+				return nil, io.EOF
+			}
+			index++
+			return items[index-1].toRecord()
+		}, nil
+	}
+	return nil, &usageError{"unknown record format: " + format}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"irbis"
+	"strings"
+	"testing"
+)
+
+func TestParseMfnList_1(t *testing.T) {
+	result, err := parseMfnList([]string{"1,5", "10-12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 5 || result[0] != 1 || result[1] != 5 || result[4] != 12 {
+		t.Fatal(result)
+	}
+
+	for _, bad := range []string{"0", "abc", "5-3", "1-x"} {
+		if _, err = parseMfnList([]string{bad}); err == nil {
+			t.Fatal(bad)
+		}
+	}
+	if _, err = parseMfnList(nil); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestOutput_Table_1(t *testing.T) {
+	header := []string{"mfn", "text"}
+	rows := [][]interface{}{{1, "first"}, {2, "second, with comma"}}
+
+	var buffer bytes.Buffer
+	out, _ := newOutput("json", &buffer)
+	if err := out.table(header, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), `"mfn": 2`) ||
+		!strings.Contains(buffer.String(), `"text": "first"`) {
+		t.Fatal(buffer.String())
+	}
+
+	buffer.Reset()
+	out, _ = newOutput("csv", &buffer)
+	if err := out.table(header, rows); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != "mfn,text\n1,first\n2,\"second, with comma\"\n" {
+		t.Fatal(buffer.String())
+	}
+
+	buffer.Reset()
+	out, _ = newOutput("text", &buffer)
+	if err := out.table(header, rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buffer.String(), "mfn  text\n1    first\n") {
+		t.Fatal(buffer.String())
+	}
+
+	if _, err := newOutput("xml", &buffer); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestRecordWriter_Json_1(t *testing.T) {
+	record := irbis.NewMarcRecord()
+	record.Mfn = 3
+	record.Add(200, "").Add('a', "Война и мир").Add('f', "Толстой")
+	record.Add(920, "PAZK")
+
+	for _, format := range []string{"json", "text", "iso"} {
+		var buffer bytes.Buffer
+		writer, err := newRecordWriter(format, &buffer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+		if err = writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+		if err = writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := newRecordReader(format, &buffer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for {
+			copied, err := read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(format, err)
+			}
+			if copied.FSM(200, 'a') != "Война и мир" || copied.FM(920) != "PAZK" {
+				t.Fatal(format, copied)
+			}
+			count++
+		}
+		if count != 2 {
+			t.Fatal(format, count)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"irbis"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Способы доступа к данным, допустимые для подкоманды.
+const (
+	serverOnly = iota
+	serverOrLocal
+	localOnly
+)
+
+// options Общие параметры подкоманд.
+type options struct {
+	flags            *flag.FlagSet
+	access           int
+	connectionString string
+	local            string
+	database         string
+	output           string
+}
+
+// newOptions Набор флагов подкоманды с общими параметрами:
+// строкой подключения (по умолчанию из переменной окружения
+// IRBIS_CONNECTION), путём к локальной базе данных,
+// именем базы данных и форматом вывода.
+func newOptions(name string, access int) *options {
+	result := &options{flags: flag.NewFlagSet(name, flag.ContinueOnError), access: access}
+	if access != localOnly {
+		result.flags.StringVar(&result.connectionString, "c", os.Getenv("IRBIS_CONNECTION"),
+			"connection string (host=...;port=...;user=...;password=...;db=...;)")
+	}
+	if access != serverOnly {
+		result.flags.StringVar(&result.local, "local", "",
+			"path to the local database master file (instead of a server connection)")
+	}
+	result.flags.StringVar(&result.database, "d", "", "database name")
+	result.flags.StringVar(&result.output, "o", "text", "output format: text, json or csv")
+	return result
+}
+
+// parse Разбор аргументов подкоманды.
+func (opts *options) parse(args []string) error {
+	opts.flags.SetOutput(os.Stderr)
+	if err := opts.flags.Parse(args); err != nil {
+		return err
+	}
+	if _, err := newOutput(opts.output, os.Stdout); err != nil {
+		return err
+	}
+	return nil
+}
+
+// session Подключение к серверу либо открытая локальная база.
+type session struct {
+	connection *irbis.Connection
+	access     *irbis.DirectAccess
+	database   string
+	out        *output
+}
+
+// open Подключение к серверу либо открытие локальной базы данных.
+func (opts *options) open() (*session, error) {
+	out, err := newOutput(opts.output, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.local) != 0 {
+		access, err := irbis.OpenDatabase(opts.local)
+		if err != nil {
+			return nil, err
+		}
+		return &session{access: access, database: access.Location().Name, out: out}, nil
+	}
+	if opts.access == localOnly {
+		return nil, &usageError{"local database (-local) required"}
+	}
+
+	if len(opts.connectionString) == 0 {
+		if opts.access == serverOrLocal {
+			return nil, &usageError{"connection string (-c) or local database (-local) required"}
+		}
+		return nil, &usageError{"connection string (-c) required"}
+	}
+
+	connection := irbis.NewConnection()
+	connection.ParseConnectionString(opts.connectionString)
+	if len(opts.database) != 0 {
+		connection.Database = opts.database
+	}
+	if !connection.Connect() {
+		if connection.LastError < 0 {
+			return nil, errors.New("can't connect: " + irbis.DescribeError(connection.LastError))
+		}
+		return nil, errors.New("can't connect to " + connection.Host)
+	}
+
+	return &session{connection: connection, database: connection.Database, out: out}, nil
+}
+
+// close Отключение от сервера либо закрытие локальной базы.
+func (current *session) close() {
+	if current.connection != nil {
+		current.connection.Disconnect()
+	}
+	if current.access != nil {
+		current.access.Close()
+	}
+}
+
+// failure Ошибка последней операции на сервере.
+func (current *session) failure(operation string) error {
+	if current.connection != nil && current.connection.LastError < 0 {
+		return fmt.Errorf("%s: %s", operation, irbis.DescribeError(current.connection.LastError))
+	}
+	return nil
+}
+
+// parseMfnList Разбор списка MFN вида "1 5 10-20" (а также "1,5,10-20").
+func parseMfnList(args []string) (result []int, err error) {
+	for _, arg := range args {
+		for _, item := range strings.Split(arg, ",") {
+			if len(item) == 0 {
+				continue
+			}
+			bounds := strings.SplitN(item, "-", 2)
+			first, err1 := strconv.Atoi(bounds[0])
+			last := first
+			var err2 error
+			if len(bounds) == 2 {
+				last, err2 = strconv.Atoi(bounds[1])
+			}
+			if err1 != nil || err2 != nil || first <= 0 || last < first {
+				return nil, &usageError{"bad MFN: " + item}
+			}
+			for mfn := first; mfn <= last; mfn++ {
+				result = append(result, mfn)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, &usageError{"MFN list required"}
+	}
+	return
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"irbis"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Credentials Учётные данные пользователя ИРБИС.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// connectionString Строка подключения от имени пользователя.
+func (credentials Credentials) connectionString(server string) string {
+	result := strings.TrimSpace(server)
+	if len(result) != 0 && !strings.HasSuffix(result, ";") {
+		result += ";"
+	}
+	return result + "user=" + credentials.Username + ";password=" + credentials.Password + ";"
+}
+
+// httpUser Пользователь шлюза, аутентифицируемый по схеме Basic.
+type httpUser struct {
+	password    string
+	credentials Credentials
+}
+
+// Config Настройки шлюза.
+type Config struct {
+	// Listen Адрес, на котором шлюз принимает HTTP-запросы.
+	Listen string
+
+	// Server Строка подключения к серверу ИРБИС64 (без логина и пароля).
+	Server string
+
+	// PoolSize Количество подключений на одного пользователя ИРБИС.
+	PoolSize int
+
+	// Timeout Максимальное время ожидания свободного подключения.
+	Timeout time.Duration
+
+	// MaxPools Максимальное количество одновременно открытых пулов
+	// (при превышении закрывается давно не использовавшийся пул).
+	MaxPools int
+
+	// PoolIdleTime Время простоя, по истечении которого пул закрывается.
+	PoolIdleTime time.Duration
+
+	// PassThrough Передавать учётные данные Basic серверу ИРБИС как есть.
+	PassThrough bool
+
+	// Anonymous Учётные данные для запросов без аутентификации
+	// (nil -- такие запросы отклоняются).
+	Anonymous *Credentials
+
+	tokens map[string]Credentials
+	users  map[string]httpUser
+}
+
+// NewConfig Настройки по умолчанию.
+func NewConfig() *Config {
+	return &Config{
+		Listen:       ":8080",
+		Server:       "host=127.0.0.1;port=6666;arm=C;",
+		PoolSize:     irbis.DefaultPoolSize,
+		Timeout:      30 * time.Second,
+		MaxPools:     100,
+		PoolIdleTime: 10 * time.Minute,
+		tokens:       make(map[string]Credentials),
+		users:        make(map[string]httpUser),
+	}
+}
+
+// ReadConfig Загрузка настроек из INI-файла:
+//
+//	[Gateway]
+//	Listen=:8080
+//	Server=host=127.0.0.1;port=6666;arm=C;
+//	PoolSize=4
+//	Timeout=30
+//	MaxPools=100
+//	PoolIdleTime=600
+//	PassThrough=0
+//	Anonymous=reader,secret
+//
+//	[Tokens]
+//	; Bearer-токен=логин ИРБИС,пароль ИРБИС
+//	0123456789abcdef=librarian,secret
+//
+//	[Users]
+//	; HTTP-логин=HTTP-пароль,логин ИРБИС,пароль ИРБИС
+//	mobile=mobile-password,reader,secret
+//
+// Пароли не должны содержать запятых и точек с запятой.
+func ReadConfig(filename string) (*Config, error) {
+	ini, err := irbis.ReadIniFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(ini)
+}
+
+// ParseConfig Разбор настроек, загруженных из INI-файла.
+func ParseConfig(ini *irbis.IniFile) (*Config, error) {
+	result := NewConfig()
+	result.Listen = ini.GetValue("Gateway", "Listen", result.Listen)
+	result.Server = ini.GetValue("Gateway", "Server", result.Server)
+	result.PoolSize = ini.GetInt("Gateway", "PoolSize", result.PoolSize)
+	seconds := ini.GetInt("Gateway", "Timeout", int(result.Timeout/time.Second))
+	result.Timeout = time.Duration(seconds) * time.Second
+	result.MaxPools = ini.GetInt("Gateway", "MaxPools", result.MaxPools)
+	seconds = ini.GetInt("Gateway", "PoolIdleTime", int(result.PoolIdleTime/time.Second))
+	result.PoolIdleTime = time.Duration(seconds) * time.Second
+	result.PassThrough = ini.GetBool("Gateway", "PassThrough", false)
+
+	if anonymous := ini.GetList("Gateway", "Anonymous"); len(anonymous) != 0 {
+		if len(anonymous) != 2 {
+			return nil, errors.New("bad Anonymous value: login and password expected")
+		}
+		result.Anonymous = &Credentials{Username: anonymous[0], Password: anonymous[1]}
+	}
+
+	if section := ini.FindSection("Tokens"); section != nil {
+		for _, token := range section.Keys() {
+			items := section.GetList(token)
+			if len(items) != 2 {
+				return nil, errors.New("bad token " + token + ": login and password expected")
+			}
+			result.tokens[token] = Credentials{Username: items[0], Password: items[1]}
+		}
+	}
+
+	if section := ini.FindSection("Users"); section != nil {
+		for _, name := range section.Keys() {
+			items := section.GetList(name)
+			if len(items) != 3 {
+				return nil, errors.New("bad user " + name + ": password, login and password expected")
+			}
+			result.users[strings.ToLower(name)] = httpUser{password: items[0],
+				credentials: Credentials{Username: items[1], Password: items[2]}}
+		}
+	}
+
+	return result, nil
+}
+
+// Authenticate Определение учётных данных ИРБИС для HTTP-запроса.
+// Возвращает false, если запрос не прошёл аутентификацию.
+func (config *Config) Authenticate(request *http.Request) (Credentials, bool) {
+	header := request.Header.Get("Authorization")
+	if len(header) == 0 {
+		if config.Anonymous != nil {
+			return *config.Anonymous, true
+		}
+		return Credentials{}, false
+	}
+
+	const bearer = "Bearer "
+	if len(header) > len(bearer) && strings.EqualFold(header[:len(bearer)], bearer) {
+		token := strings.TrimSpace(header[len(bearer):])
+		for known, credentials := range config.tokens {
+			if sameSecret(known, token) {
+				return credentials, true
+			}
+		}
+		return Credentials{}, false
+	}
+
+	name, password, ok := request.BasicAuth()
+	if !ok || len(name) == 0 {
+		return Credentials{}, false
+	}
+
+	if user, found := config.users[strings.ToLower(name)]; found {
+		if sameSecret(user.password, password) {
+			return user.credentials, true
+		}
+		return Credentials{}, false
+	}
+
+	// Логин и пароль не должны нарушать строку подключения
+	// и запрос к серверу ИРБИС
+	if config.PassThrough && validText(name+password) && !strings.ContainsAny(name+password, ";") {
+		return Credentials{Username: name, Password: password}, true
+	}
+
+	return Credentials{}, false
+}
+
+// sameSecret Сравнение паролей за время, не зависящее от их содержимого.
+func sameSecret(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
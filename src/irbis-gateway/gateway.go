@@ -0,0 +1,683 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"irbis"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ограничения на размер выдачи и запроса.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 1000
+	maxBodySize     = 1 << 20
+)
+
+// Gateway HTTP-шлюз к серверу ИРБИС64. Для каждого пользователя
+// ИРБИС создаётся собственный пул подключений. Пул запоминается
+// только после того, как сервер принял логин и пароль; пулы,
+// которыми давно не пользовались, закрываются.
+type Gateway struct {
+	config *Config
+	pools  map[Credentials]*userPool
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+// userPool Пул подключений одного пользователя ИРБИС.
+type userPool struct {
+	pool        *irbis.ConnectionPool
+	credentials Credentials
+	lastUsed    time.Time
+	busy        int // количество обрабатываемых запросов
+}
+
+// NewGateway Конструктор шлюза.
+func NewGateway(config *Config) *Gateway {
+	return &Gateway{config: config, pools: make(map[Credentials]*userPool), now: time.Now}
+}
+
+// Close Закрытие всех пулов подключений.
+func (gateway *Gateway) Close() {
+	gateway.mutex.Lock()
+	defer gateway.mutex.Unlock()
+	for credentials, entry := range gateway.pools {
+		entry.pool.Close()
+		delete(gateway.pools, credentials)
+	}
+}
+
+// acquire Получение подключения от имени пользователя ИРБИС.
+// Новый пул запоминается лишь после успешного подключения.
+// По окончании работы подключение возвращается в entry.pool,
+// после чего вызывается release.
+func (gateway *Gateway) acquire(ctx context.Context,
+	credentials Credentials) (entry *userPool, connection *irbis.Connection, err error) {
+	gateway.mutex.Lock()
+	entry = gateway.pools[credentials]
+	if entry != nil {
+		entry.busy++
+	}
+	gateway.mutex.Unlock()
+
+	if entry != nil {
+		connection, err = entry.pool.Acquire(ctx)
+		if err != nil {
+			gateway.release(entry)
+			return nil, nil, err
+		}
+		return entry, connection, nil
+	}
+
+	pool := irbis.NewConnectionPool(credentials.connectionString(gateway.config.Server),
+		gateway.config.PoolSize)
+	connection, err = pool.Acquire(ctx)
+	if err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+
+	entry = &userPool{pool: pool, credentials: credentials, busy: 1}
+	gateway.mutex.Lock()
+	if gateway.pools[credentials] == nil {
+		// Иначе пул успел создать параллельный запрос,
+		// наш будет закрыт по окончании этого запроса
+		entry.lastUsed = gateway.now()
+		gateway.pools[credentials] = entry
+	}
+	expired := gateway.evict()
+	gateway.mutex.Unlock()
+	closePools(expired)
+
+	return entry, connection, nil
+}
+
+// release Окончание обработки запроса, получившего подключение
+// с помощью acquire. Пул, не сохранённый в gateway.pools,
+// закрывается после окончания последнего запроса.
+func (gateway *Gateway) release(entry *userPool) {
+	gateway.mutex.Lock()
+	entry.busy--
+	entry.lastUsed = gateway.now()
+	orphan := entry.busy == 0 && gateway.pools[entry.credentials] != entry
+	expired := gateway.evict()
+	if orphan {
+		expired = append(expired, entry.pool)
+	}
+	gateway.mutex.Unlock()
+	closePools(expired)
+}
+
+// evict Исключение пулов, простаивающих дольше PoolIdleTime,
+// а также давно не использовавшихся пулов сверх MaxPools.
+// Пулы, занятые обработкой запросов, не исключаются.
+// Вызывается при заблокированном мьютексе, исключённые пулы
+// необходимо закрыть.
+func (gateway *Gateway) evict() (expired []*irbis.ConnectionPool) {
+	now := gateway.now()
+	var oldest *userPool
+	for credentials, entry := range gateway.pools {
+		if entry.busy != 0 {
+			continue
+		}
+		if gateway.config.PoolIdleTime > 0 && now.Sub(entry.lastUsed) > gateway.config.PoolIdleTime {
+			delete(gateway.pools, credentials)
+			expired = append(expired, entry.pool)
+			continue
+		}
+		if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+			oldest = entry
+		}
+	}
+
+	if gateway.config.MaxPools > 0 && len(gateway.pools) > gateway.config.MaxPools && oldest != nil {
+		delete(gateway.pools, oldest.credentials)
+		expired = append(expired, oldest.pool)
+	}
+
+	return expired
+}
+
+// closePools Закрытие исключённых пулов.
+func closePools(pools []*irbis.ConnectionPool) {
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// acquireStatus HTTP-статус ответа при неудачной попытке получить
+// подключение: 403, если сервер ИРБИС отверг логин или пароль.
+func acquireStatus(err error) int {
+	if serverError, ok := err.(*irbis.ServerError); ok {
+		switch serverError.Code {
+		case -3333, -4444:
+			return http.StatusForbidden
+		}
+	}
+	return http.StatusServiceUnavailable
+}
+
+// request Контекст обработки одного HTTP-запроса.
+type request struct {
+	writer     http.ResponseWriter
+	request    *http.Request
+	connection *irbis.Connection
+	database   string
+}
+
+// ServeHTTP Разбор пути и вызов соответствующего обработчика.
+func (gateway *Gateway) ServeHTTP(writer http.ResponseWriter, httpRequest *http.Request) {
+	parts := strings.Split(strings.Trim(httpRequest.URL.Path, "/"), "/")
+	if len(parts) == 2 && (parts[0] == "sru" || parts[0] == "oai") {
+		gateway.serveProtocol(writer, httpRequest, parts[0], parts[1])
+		return
+	}
+	if len(parts) < 2 || parts[0] != "api" {
+		writeError(writer, http.StatusNotFound, "not found", 0)
+		return
+	}
+	parts = parts[1:]
+
+	if len(parts) == 1 && parts[0] == "openapi.json" {
+		if checkMethod(writer, httpRequest, http.MethodGet) {
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_, _ = writer.Write([]byte(openApiSpec))
+		}
+		return
+	}
+
+	var handler func(*request)
+	var methods []string
+	switch {
+	case len(parts) == 1 && parts[0] == "stat":
+		handler, methods = handleStat, []string{http.MethodGet}
+	case len(parts) == 1 && parts[0] == "databases":
+		handler, methods = handleDatabases, []string{http.MethodGet}
+	case len(parts) == 2 && parts[0] == "databases":
+		handler, methods = handleDatabase, []string{http.MethodGet}
+	case len(parts) == 3 && parts[0] == "databases":
+		switch parts[2] {
+		case "search":
+			handler, methods = handleSearch, []string{http.MethodGet}
+		case "records":
+			handler, methods = handleCreateRecord, []string{http.MethodPost}
+		case "terms":
+			handler, methods = handleTerms, []string{http.MethodGet}
+		case "postings":
+			handler, methods = handlePostings, []string{http.MethodGet}
+		}
+	case len(parts) == 4 && parts[0] == "databases" && parts[2] == "records":
+		methods = []string{http.MethodGet, http.MethodPut, http.MethodDelete}
+		switch httpRequest.Method {
+		case http.MethodPut:
+			handler = handleUpdateRecord
+		case http.MethodDelete:
+			handler = handleDeleteRecord
+		default:
+			handler = handleReadRecord
+		}
+	}
+
+	if handler == nil {
+		writeError(writer, http.StatusNotFound, "not found", 0)
+		return
+	}
+	if !checkMethod(writer, httpRequest, methods...) {
+		return
+	}
+
+	current := &request{writer: writer, request: httpRequest}
+	if len(parts) > 1 {
+		current.database = parts[1]
+		if !validText(current.database) {
+			writeError(writer, http.StatusBadRequest, "bad database name", 0)
+			return
+		}
+	}
+
+	credentials, ok := gateway.authenticate(writer, httpRequest)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(httpRequest.Context(), gateway.config.Timeout)
+	defer cancel()
+	entry, connection, err := gateway.acquire(ctx, credentials)
+	if err != nil {
+		writeError(writer, acquireStatus(err), err.Error(), 0)
+		return
+	}
+	defer gateway.release(entry)
+	defer entry.pool.Release(connection)
+
+	if len(current.database) != 0 {
+		connection.Database = current.database
+	}
+	current.connection = connection
+	handler(current)
+}
+
+// authenticate Аутентификация запроса. При неудаче клиенту
+// выдаётся ответ 401.
+func (gateway *Gateway) authenticate(writer http.ResponseWriter,
+	request *http.Request) (Credentials, bool) {
+	credentials, ok := gateway.config.Authenticate(request)
+	if !ok {
+		writer.Header().Set("WWW-Authenticate", `Basic realm="IRBIS"`)
+		writeError(writer, http.StatusUnauthorized, "authentication required", 0)
+	}
+	return credentials, ok
+}
+
+// serveProtocol Обработка запроса SRU или OAI-PMH
+// к указанной базе данных.
+func (gateway *Gateway) serveProtocol(writer http.ResponseWriter, request *http.Request,
+	protocol, database string) {
+	if !validText(database) {
+		writeError(writer, http.StatusBadRequest, "bad database name", 0)
+		return
+	}
+	credentials, ok := gateway.authenticate(writer, request)
+	if !ok {
+		return
+	}
+
+	// Проверяем учётные данные до того, как запрос попадёт
+	// к серверу протокола; подключение остаётся в пуле
+	ctx, cancel := context.WithTimeout(request.Context(), gateway.config.Timeout)
+	entry, connection, err := gateway.acquire(ctx, credentials)
+	cancel()
+	if err != nil {
+		writeError(writer, acquireStatus(err), err.Error(), 0)
+		return
+	}
+	entry.pool.Release(connection)
+	defer gateway.release(entry)
+
+	if protocol == "sru" {
+		irbis.NewSruServer(entry.pool, database).ServeHTTP(writer, request)
+	} else {
+		irbis.NewOaiServer(irbis.NewServerRecordSource(entry.pool, database)).ServeHTTP(writer, request)
+	}
+}
+
+// checkMethod Проверка допустимости HTTP-метода.
+func checkMethod(writer http.ResponseWriter, request *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	writer.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(writer, http.StatusMethodNotAllowed, "method not allowed", 0)
+	return false
+}
+
+// validText Строка не должна содержать управляющих символов,
+// иначе она нарушит построчный протокол ИРБИС.
+func validText(text string) bool {
+	return !strings.ContainsAny(text, "\r\n\x00")
+}
+
+func writeJson(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(value)
+}
+
+func writeError(writer http.ResponseWriter, status int, message string, code int) {
+	writeJson(writer, status, errorJson{Error: message, Code: code})
+}
+
+// failIrbis Выдача ошибки, которую вернул сервер ИРБИС.
+func (current *request) failIrbis() {
+	code := current.connection.LastError
+	if code >= 0 {
+		writeError(current.writer, http.StatusBadGateway, "IRBIS server communication error", 0)
+		return
+	}
+
+	status := http.StatusBadGateway
+	switch code {
+	case -100000:
+		// Сетевая ошибка: подключение не возвращается в пул
+		current.connection.Connected = false
+	case -100, -140, -601, -605:
+		status = http.StatusNotFound
+	case -600, -603:
+		status = http.StatusGone
+	case -300, -301, -602:
+		status = http.StatusConflict
+	}
+	writeError(current.writer, status, irbis.DescribeError(code), code)
+}
+
+// intParam Целочисленный параметр запроса.
+func (current *request) intParam(name string, defaultValue, minValue, maxValue int) (int, bool) {
+	text := current.request.URL.Query().Get(name)
+	if len(text) == 0 {
+		return defaultValue, true
+	}
+	result, err := strconv.Atoi(text)
+	if err != nil || result < minValue || result > maxValue {
+		writeError(current.writer, http.StatusBadRequest, "bad parameter "+name, 0)
+		return 0, false
+	}
+	return result, true
+}
+
+// textParam Текстовый параметр запроса.
+func (current *request) textParam(name string) (string, bool) {
+	result := current.request.URL.Query().Get(name)
+	if !validText(result) {
+		writeError(current.writer, http.StatusBadRequest, "bad parameter "+name, 0)
+		return "", false
+	}
+	return result, true
+}
+
+// mfnParam MFN, заданный в пути запроса.
+func (current *request) mfnParam() (int, bool) {
+	parts := strings.Split(strings.Trim(current.request.URL.Path, "/"), "/")
+	result, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil || result <= 0 {
+		writeError(current.writer, http.StatusBadRequest, "bad MFN", 0)
+		return 0, false
+	}
+	return result, true
+}
+
+//===================================================================
+
+func handleStat(current *request) {
+	stat := current.connection.GetServerStat()
+	if current.connection.LastError < 0 {
+		current.failIrbis()
+		return
+	}
+	writeJson(current.writer, http.StatusOK, newStatJson(&stat))
+}
+
+//===================================================================
+
+func handleDatabases(current *request) {
+	databases := current.connection.ListDatabases("")
+	if databases == nil && current.connection.LastError < 0 {
+		current.failIrbis()
+		return
+	}
+	result := make([]databaseJson, 0, len(databases))
+	for i := range databases {
+		result = append(result, newDatabaseJson(&databases[i]))
+	}
+	writeJson(current.writer, http.StatusOK, result)
+}
+
+//===================================================================
+
+func handleDatabase(current *request) {
+	info := current.connection.GetDatabaseInfo(current.database)
+	if info == nil {
+		current.failIrbis()
+		return
+	}
+	writeJson(current.writer, http.StatusOK, newDatabaseJson(info))
+}
+
+//===================================================================
+
+func handleSearch(current *request) {
+	expression, ok := current.textParam("q")
+	if !ok {
+		return
+	}
+	if len(strings.TrimSpace(expression)) == 0 {
+		writeError(current.writer, http.StatusBadRequest, "parameter q is required", 0)
+		return
+	}
+	format, ok := current.textParam("format")
+	if !ok {
+		return
+	}
+	first, ok := current.intParam("first", 1, 1, int(^uint32(0)>>1))
+	if !ok {
+		return
+	}
+	limit, ok := current.intParam("limit", defaultPageSize, 1, maxPageSize)
+	if !ok {
+		return
+	}
+
+	connection := current.connection
+	total := connection.SearchCount(expression)
+	if connection.LastError < 0 {
+		current.failIrbis()
+		return
+	}
+
+	result := searchJson{Total: total, First: first, Items: []foundJson{}}
+	if first <= total {
+		parameters := irbis.NewSearchParameters()
+		parameters.Expression = expression
+		parameters.FirstRecord = first
+		parameters.NumberOfRecords = limit
+		parameters.Format = format
+		found := connection.SearchEx(parameters)
+		if connection.LastError < 0 {
+			current.failIrbis()
+			return
+		}
+		for _, line := range found {
+			result.Items = append(result.Items,
+				foundJson{Mfn: line.Mfn, Description: line.Description})
+		}
+	}
+	writeJson(current.writer, http.StatusOK, result)
+}
+
+//===================================================================
+
+func handleReadRecord(current *request) {
+	mfn, ok := current.mfnParam()
+	if !ok {
+		return
+	}
+	format, ok := current.textParam("format")
+	if !ok {
+		return
+	}
+
+	connection := current.connection
+	if len(format) != 0 {
+		text := connection.FormatMfn(format, mfn)
+		if connection.LastError < 0 {
+			current.failIrbis()
+			return
+		}
+		writeJson(current.writer, http.StatusOK, formattedJson{Mfn: mfn, Text: text})
+		return
+	}
+
+	record := connection.ReadRecord(mfn)
+	if record == nil {
+		current.failIrbis()
+		return
+	}
+	writeJson(current.writer, http.StatusOK, newRecordJson(record))
+}
+
+//===================================================================
+
+// readBody Разбор записи, переданной в теле запроса.
+func (current *request) readBody() *irbis.MarcRecord {
+	body := http.MaxBytesReader(current.writer, current.request.Body, maxBodySize)
+	var data recordJson
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
+		writeError(current.writer, http.StatusBadRequest, "bad record: "+err.Error(), 0)
+		return nil
+	}
+	record, err := data.toRecord()
+	if err != nil {
+		writeError(current.writer, http.StatusBadRequest, "bad record: "+err.Error(), 0)
+		return nil
+	}
+	record.Database = current.database
+	return record
+}
+
+// writeRecord Сохранение записи на сервере с выдачей результата.
+func (current *request) writeRecord(record *irbis.MarcRecord, status int) {
+	if current.connection.WriteRecord(record) == 0 {
+		current.failIrbis()
+		return
+	}
+	if status == http.StatusCreated {
+		current.writer.Header().Set("Location", "/api/databases/"+
+			current.database+"/records/"+strconv.Itoa(record.Mfn))
+	}
+	writeJson(current.writer, status, newRecordJson(record))
+}
+
+func handleCreateRecord(current *request) {
+	record := current.readBody()
+	if record == nil {
+		return
+	}
+	record.Mfn = 0
+	record.Version = 0
+	current.writeRecord(record, http.StatusCreated)
+}
+
+func handleUpdateRecord(current *request) {
+	mfn, ok := current.mfnParam()
+	if !ok {
+		return
+	}
+	record := current.readBody()
+	if record == nil {
+		return
+	}
+	record.Mfn = mfn
+	current.writeRecord(record, http.StatusOK)
+}
+
+func handleDeleteRecord(current *request) {
+	mfn, ok := current.mfnParam()
+	if !ok {
+		return
+	}
+
+	connection := current.connection
+	record := connection.ReadRecord(mfn)
+	if record == nil {
+		if connection.LastError == -600 || connection.LastError == -603 {
+			// Запись уже удалена
+			current.writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		current.failIrbis()
+		return
+	}
+
+	if !record.IsDeleted() {
+		record.Status |= irbis.LOGICALLY_DELETED
+		if connection.WriteRecord(record) == 0 {
+			current.failIrbis()
+			return
+		}
+	}
+	current.writer.WriteHeader(http.StatusNoContent)
+}
+
+//===================================================================
+
+func handleTerms(current *request) {
+	start, ok := current.textParam("start")
+	if !ok {
+		return
+	}
+	prefix, ok := current.textParam("prefix")
+	if !ok {
+		return
+	}
+	count, ok := current.intParam("count", defaultPageSize, 1, maxPageSize)
+	if !ok {
+		return
+	}
+	reverse := current.request.URL.Query().Get("reverse")
+
+	parameters := &irbis.TermParameters{Database: current.database, StartTerm: start,
+		ReverseOrder: reverse == "1" || reverse == "true"}
+	iterator := irbis.NewTermIterator(current.connection, parameters)
+	iterator.Prefix = prefix
+	iterator.PageSize = count
+	result := []termJson{}
+	for len(result) < count && iterator.Next() {
+		term := iterator.Term()
+		result = append(result, termJson{Text: term.Text, Count: term.Count})
+	}
+	if iterator.Err() != nil {
+		current.failIrbis()
+		return
+	}
+	writeJson(current.writer, http.StatusOK, result)
+}
+
+//===================================================================
+
+func handlePostings(current *request) {
+	query := current.request.URL.Query()
+	terms := query["term"]
+	if len(terms) == 0 {
+		writeError(current.writer, http.StatusBadRequest, "parameter term is required", 0)
+		return
+	}
+	for _, term := range terms {
+		if !validText(term) {
+			writeError(current.writer, http.StatusBadRequest, "bad parameter term", 0)
+			return
+		}
+	}
+	format, ok := current.textParam("format")
+	if !ok {
+		return
+	}
+	first, ok := current.intParam("first", 1, 1, int(^uint32(0)>>1))
+	if !ok {
+		return
+	}
+	count, ok := current.intParam("count", defaultPageSize, 1, maxPageSize)
+	if !ok {
+		return
+	}
+
+	parameters := irbis.NewPostingParameters()
+	parameters.Database = current.database
+	parameters.FirstPosting = first
+	parameters.NumberOfPostings = count
+	parameters.Format = format
+	if len(terms) == 1 {
+		parameters.Term = terms[0]
+	} else {
+		parameters.ListOfTerms = terms
+	}
+
+	result := []postingJson{}
+	iterator := irbis.NewPostingIterator(current.connection, parameters)
+	for len(result) < count && iterator.Next() {
+		posting := iterator.Posting()
+		result = append(result, postingJson{Mfn: posting.Mfn, Tag: posting.Tag,
+			Occurrence: posting.Occurrence, Count: posting.Count, Text: posting.Text})
+	}
+	// Отсутствие термина в словаре -- не ошибка
+	if iterator.Err() != nil && current.connection.LastError != -202 {
+		current.failIrbis()
+		return
+	}
+	writeJson(current.writer, http.StatusOK, result)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"irbis"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig(t *testing.T) *Config {
+	ini := irbis.NewIniFile()
+	ini.Parse([]string{
+		"[Gateway]",
+		"Server=host=example.com;port=6666",
+		"PoolSize=2",
+		"[Tokens]",
+		"secret-token=librarian,secret",
+		"[Users]",
+		"Mobile=mobile-password,reader,password",
+	})
+	config, err := ParseConfig(ini)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestConfig_Authenticate_1(t *testing.T) {
+	config := testConfig(t)
+	if config.PoolSize != 2 || config.Listen != ":8080" {
+		t.FailNow()
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/databases", nil)
+	if _, ok := config.Authenticate(request); ok {
+		t.FailNow()
+	}
+
+	request.Header.Set("Authorization", "Bearer secret-token")
+	credentials, ok := config.Authenticate(request)
+	if !ok || credentials.Username != "librarian" || credentials.Password != "secret" {
+		t.FailNow()
+	}
+	if credentials.connectionString(config.Server) !=
+		"host=example.com;port=6666;user=librarian;password=secret;" {
+		t.Fatal(credentials.connectionString(config.Server))
+	}
+
+	request.Header.Set("Authorization", "Bearer wrong-token")
+	if _, ok = config.Authenticate(request); ok {
+		t.FailNow()
+	}
+
+	request.SetBasicAuth("mobile", "mobile-password")
+	credentials, ok = config.Authenticate(request)
+	if !ok || credentials.Username != "reader" {
+		t.FailNow()
+	}
+
+	request.SetBasicAuth("librarian", "secret")
+	if _, ok = config.Authenticate(request); ok {
+		t.FailNow()
+	}
+	config.PassThrough = true
+	credentials, ok = config.Authenticate(request)
+	if !ok || credentials.Username != "librarian" || credentials.Password != "secret" {
+		t.FailNow()
+	}
+	request.SetBasicAuth("librarian", "secret\r\nC")
+	if _, ok = config.Authenticate(request); ok {
+		t.FailNow()
+	}
+	request.SetBasicAuth("libr\x00arian", "secret")
+	if _, ok = config.Authenticate(request); ok {
+		t.FailNow()
+	}
+}
+
+func TestRecordJson_1(t *testing.T) {
+	record := irbis.NewMarcRecord()
+	record.Mfn = 123
+	record.Add(700, "").Add('a', "Пушкин").Add('b', "А. С.")
+	record.Add(920, "PAZK")
+
+	data, err := json.Marshal(newRecordJson(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"mfn":123,"version":0,"status":0,"fields":[` +
+		`{"tag":700,"subfields":[{"code":"a","value":"Пушкин"},{"code":"b","value":"А. С."}]},` +
+		`{"tag":920,"value":"PAZK"}]}`
+	if string(data) != expected {
+		t.Fatal(string(data))
+	}
+
+	var decoded recordJson
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := decoded.toRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.String() != record.String() {
+		t.Fatal(restored.String())
+	}
+
+	decoded.Fields[0].Subfields[0].Code = "ab"
+	if _, err = decoded.toRecord(); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestGateway_ServeHTTP_1(t *testing.T) {
+	gateway := NewGateway(testConfig(t))
+	defer gateway.Close()
+
+	check := func(method, path string, status int) {
+		recorder := httptest.NewRecorder()
+		gateway.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		if recorder.Code != status {
+			t.Fatal(method, path, recorder.Code)
+		}
+	}
+
+	check(http.MethodGet, "/api/unknown", http.StatusNotFound)
+	check(http.MethodGet, "/api/databases/IBIS/unknown", http.StatusNotFound)
+	check(http.MethodPost, "/api/stat", http.StatusMethodNotAllowed)
+	check(http.MethodPatch, "/api/databases/IBIS/records/1", http.StatusMethodNotAllowed)
+	check(http.MethodGet, "/api/databases", http.StatusUnauthorized)
+	check(http.MethodGet, "/api/databases/IB%0AIS", http.StatusBadRequest)
+	check(http.MethodGet, "/sru/IBIS?query=war", http.StatusUnauthorized)
+	check(http.MethodGet, "/oai/IBIS?verb=Identify", http.StatusUnauthorized)
+
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	var spec map[string]interface{}
+	if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &spec) != nil {
+		t.FailNow()
+	}
+	if _, ok := spec["paths"].(map[string]interface{})["/databases/{db}/records/{mfn}"]; !ok {
+		t.FailNow()
+	}
+}
+
+// fakeIrbisServer Имитация сервера ИРБИС64 на локальном порту:
+// регистрирует любого пользователя с указанным паролем, на прочие
+// команды, кроме отключения, отвечает ошибкой. Выдаёт номер порта.
+func fakeIrbisServer(t *testing.T, password string) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	serve := func(conn net.Conn) {
+		defer func() { _ = conn.Close() }()
+		reader := bufio.NewReader(conn)
+		prefix, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(prefix))
+		buffer := make([]byte, length)
+		if _, err = io.ReadFull(reader, buffer); err != nil {
+			return
+		}
+		lines := strings.Split(string(buffer), "\n")
+		code := "-1"
+		switch lines[0] {
+		case "A":
+			code = "-4444"
+			if lines[11] == password {
+				code = "0\r\n30"
+			}
+		case "B":
+			code = "0"
+		}
+		_, _ = conn.Write([]byte(lines[0] + "\r\n1\r\n1\r\n0\r\n64.2014\r\n\r\n\r\n\r\n\r\n\r\n" + code))
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestGateway_Pools_1(t *testing.T) {
+	config := testConfig(t)
+	config.Server = "host=127.0.0.1;port=" + strconv.Itoa(fakeIrbisServer(t, "secret"))
+	config.PassThrough = true
+	config.MaxPools = 2
+	config.PoolIdleTime = time.Minute
+	gateway := NewGateway(config)
+	defer gateway.Close()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	gateway.now = func() time.Time { return now }
+
+	serve := func(path, name, password string) int {
+		now = now.Add(time.Second)
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.SetBasicAuth(name, password)
+		gateway.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	pooled := func(names ...string) bool {
+		gateway.mutex.Lock()
+		defer gateway.mutex.Unlock()
+		if len(gateway.pools) != len(names) {
+			return false
+		}
+		for _, name := range names {
+			if gateway.pools[Credentials{Username: name, Password: "secret"}] == nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Неверный пароль: 403, пул не сохраняется
+	if code := serve("/api/databases/IBIS/records/1", "first", "wrong"); code != http.StatusForbidden {
+		t.Fatal(code)
+	}
+	if code := serve("/sru/IBIS?query=war", "first", "wrong"); code != http.StatusForbidden {
+		t.Fatal(code)
+	}
+	if !pooled() {
+		t.FailNow()
+	}
+
+	// Сверх MaxPools закрывается давно не использовавшийся пул
+	for _, name := range []string{"first", "second", "first", "third"} {
+		if code := serve("/api/databases/IBIS/records/1", name, "secret"); code == http.StatusForbidden {
+			t.Fatal(name, code)
+		}
+	}
+	if !pooled("first", "third") {
+		t.FailNow()
+	}
+
+	// Простаивающий пул закрывается
+	now = now.Add(2 * time.Minute)
+	serve("/api/databases/IBIS/records/1", "first", "secret")
+	if !pooled("first") {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"irbis"
+	"unicode/utf8"
+)
+
+// Представления объектов ИРБИС в JSON.
+
+type subFieldJson struct {
+	Code  string `json:"code"`
+	Value string `json:"value"`
+}
+
+type fieldJson struct {
+	Tag       int            `json:"tag"`
+	Value     string         `json:"value,omitempty"`
+	Subfields []subFieldJson `json:"subfields,omitempty"`
+}
+
+type recordJson struct {
+	Database string      `json:"database,omitempty"`
+	Mfn      int         `json:"mfn"`
+	Version  int         `json:"version"`
+	Status   int         `json:"status"`
+	Fields   []fieldJson `json:"fields"`
+}
+
+type formattedJson struct {
+	Mfn  int    `json:"mfn"`
+	Text string `json:"text"`
+}
+
+type foundJson struct {
+	Mfn         int    `json:"mfn"`
+	Description string `json:"description,omitempty"`
+}
+
+type searchJson struct {
+	Total int         `json:"total"`
+	First int         `json:"first"`
+	Items []foundJson `json:"items"`
+}
+
+type databaseJson struct {
+	Name                     string `json:"name"`
+	Description              string `json:"description,omitempty"`
+	ReadOnly                 bool   `json:"readOnly,omitempty"`
+	MaxMfn                   int    `json:"maxMfn,omitempty"`
+	LogicallyDeletedRecords  []int  `json:"logicallyDeleted,omitempty"`
+	PhysicallyDeletedRecords []int  `json:"physicallyDeleted,omitempty"`
+	NonActualizedRecords     []int  `json:"nonActualized,omitempty"`
+	LockedRecords            []int  `json:"locked,omitempty"`
+	DatabaseLocked           bool   `json:"databaseLocked,omitempty"`
+}
+
+type termJson struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+type postingJson struct {
+	Mfn        int    `json:"mfn"`
+	Tag        int    `json:"tag"`
+	Occurrence int    `json:"occurrence"`
+	Count      int    `json:"count"`
+	Text       string `json:"text,omitempty"`
+}
+
+type clientJson struct {
+	Number        string `json:"number"`
+	Address       string `json:"address"`
+	Port          string `json:"port"`
+	Name          string `json:"name"`
+	Id            string `json:"id"`
+	Workstation   string `json:"workstation"`
+	Registered    string `json:"registered"`
+	Acknowledged  string `json:"acknowledged"`
+	LastCommand   string `json:"lastCommand"`
+	CommandNumber string `json:"commandNumber"`
+}
+
+type statJson struct {
+	TotalCommandCount int          `json:"totalCommandCount"`
+	ClientCount       int          `json:"clientCount"`
+	Clients           []clientJson `json:"clients"`
+}
+
+type errorJson struct {
+	Error string `json:"error"`
+	Code  int    `json:"code,omitempty"`
+}
+
+func newRecordJson(record *irbis.MarcRecord) *recordJson {
+	result := &recordJson{Database: record.Database, Mfn: record.Mfn,
+		Version: record.Version, Status: record.Status,
+		Fields: make([]fieldJson, 0, len(record.Fields))}
+	for _, field := range record.Fields {
+		item := fieldJson{Tag: field.Tag, Value: field.Value}
+		for _, subfield := range field.Subfields {
+			item.Subfields = append(item.Subfields,
+				subFieldJson{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		result.Fields = append(result.Fields, item)
+	}
+	return result
+}
+
+// toRecord Преобразование в запись ИРБИС с проверкой полей.
+func (record *recordJson) toRecord() (*irbis.MarcRecord, error) {
+	result := irbis.NewMarcRecord()
+	result.Mfn = record.Mfn
+	result.Version = record.Version
+	result.Status = record.Status
+	for _, item := range record.Fields {
+		if item.Tag <= 0 {
+			return nil, errors.New("bad field tag")
+		}
+		field := result.Add(item.Tag, item.Value)
+		for _, subfield := range item.Subfields {
+			if utf8.RuneCountInString(subfield.Code) != 1 {
+				return nil, errors.New("subfield code must be a single character")
+			}
+			code, _ := utf8.DecodeRuneInString(subfield.Code)
+			field.Add(code, subfield.Value)
+		}
+	}
+	return result, nil
+}
+
+func newDatabaseJson(info *irbis.DatabaseInfo) databaseJson {
+	return databaseJson{Name: info.Name, Description: info.Description,
+		ReadOnly: info.ReadOnly, MaxMfn: info.MaxMfn,
+		LogicallyDeletedRecords:  info.LogicallyDeletedRecords,
+		PhysicallyDeletedRecords: info.PhysicallyDeletedRecords,
+		NonActualizedRecords:     info.NonActualizedRecords,
+		LockedRecords:            info.LockedRecords,
+		DatabaseLocked:           info.DatabaseLocked}
+}
+
+func newStatJson(stat *irbis.ServerStat) *statJson {
+	result := &statJson{TotalCommandCount: stat.TotalCommandCount,
+		ClientCount: stat.ClientCount, Clients: []clientJson{}}
+	for _, client := range stat.RunningClients {
+		result.Clients = append(result.Clients, clientJson{Number: client.Number,
+			Address: client.IPAddress, Port: client.Port, Name: client.Name,
+			Id: client.Id, Workstation: client.Workstation,
+			Registered: client.Registered, Acknowledged: client.Acknowledged,
+			LastCommand: client.LastCommand, CommandNumber: client.CommandNumber})
+	}
+	return result
+}
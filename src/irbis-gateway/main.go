@@ -0,0 +1,45 @@
+// irbis-gateway -- HTTP-шлюз, предоставляющий доступ к серверу ИРБИС64
+// в виде REST/JSON API (описание API: /api/openapi.json).
+//
+//	irbis-gateway -config gateway.ini
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	configName := flag.String("config", "gateway.ini", "configuration file")
+	flag.Parse()
+
+	config, err := ReadConfig(*configName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gateway := NewGateway(config)
+	server := &http.Server{Addr: config.Listen, Handler: gateway,
+		ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	log.Println("IRBIS gateway listening on", config.Listen)
+	err = server.ListenAndServe()
+	gateway.Close()
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+// openApiSpec Описание API шлюза в формате OpenAPI 3.0
+// (выдаётся по адресу /api/openapi.json).
+const openApiSpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "IRBIS64 gateway",
+    "description": "REST/JSON access to the IRBIS64 server",
+    "version": "1.0.0"
+  },
+  "servers": [{"url": "/api"}],
+  "security": [{"basic": []}, {"bearer": []}],
+  "paths": {
+    "/databases": {
+      "get": {
+        "summary": "List of databases",
+        "responses": {
+          "200": {"description": "Databases", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Database"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/databases/{db}": {
+      "parameters": [{"$ref": "#/components/parameters/Database"}],
+      "get": {
+        "summary": "Database information",
+        "responses": {
+          "200": {"description": "Database", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Database"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/databases/{db}/search": {
+      "parameters": [{"$ref": "#/components/parameters/Database"}],
+      "get": {
+        "summary": "Search records",
+        "parameters": [
+          {"name": "q", "in": "query", "required": true, "description": "Search expression", "schema": {"type": "string"}},
+          {"name": "first", "in": "query", "description": "First found record (from 1)", "schema": {"type": "integer", "minimum": 1, "default": 1}},
+          {"name": "limit", "in": "query", "description": "Page size", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 20}},
+          {"name": "format", "in": "query", "description": "Format for descriptions, e.g. @brief", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Found records", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SearchResult"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/databases/{db}/records": {
+      "parameters": [{"$ref": "#/components/parameters/Database"}],
+      "post": {
+        "summary": "Create record",
+        "requestBody": {"$ref": "#/components/requestBodies/Record"},
+        "responses": {
+          "201": {"description": "Created record", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Record"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/databases/{db}/records/{mfn}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/Database"},
+        {"name": "mfn", "in": "path", "required": true, "schema": {"type": "integer", "minimum": 1}}
+      ],
+      "get": {
+        "summary": "Read record (or format it)",
+        "parameters": [
+          {"name": "format", "in": "query", "description": "Format the record instead of returning its fields", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Record", "content": {"application/json": {"schema": {"oneOf": [{"$ref": "#/components/schemas/Record"}, {"$ref": "#/components/schemas/Formatted"}]}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Update record",
+        "requestBody": {"$ref": "#/components/requestBodies/Record"},
+        "responses": {
+          "200": {"description": "Updated record", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Record"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Logically delete record",
+        "responses": {
+          "204": {"description": "Record deleted"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/databases/{db}/terms": {
+      "parameters": [{"$ref": "#/components/parameters/Database"}],
+      "get": {
+        "summary": "Read dictionary terms",
+        "parameters": [
+          {"name": "start", "in": "query", "description": "Start term", "schema": {"type": "string"}},
+          {"name": "prefix", "in": "query", "description": "Stop at the first term without this prefix", "schema": {"type": "string"}},
+          {"name": "count", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 20}},
+          {"name": "reverse", "in": "query", "schema": {"type": "boolean", "default": false}}
+        ],
+        "responses": {
+          "200": {"description": "Terms", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Term"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/databases/{db}/postings": {
+      "parameters": [{"$ref": "#/components/parameters/Database"}],
+      "get": {
+        "summary": "Read term postings",
+        "parameters": [
+          {"name": "term", "in": "query", "required": true, "description": "Term (may be repeated)", "schema": {"type": "array", "items": {"type": "string"}}, "explode": true},
+          {"name": "first", "in": "query", "schema": {"type": "integer", "minimum": 1, "default": 1}},
+          {"name": "count", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 1000, "default": 20}},
+          {"name": "format", "in": "query", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "Postings", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Posting"}}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/stat": {
+      "get": {
+        "summary": "Server statistics",
+        "responses": {
+          "200": {"description": "Statistics", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ServerStat"}}}},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "basic": {"type": "http", "scheme": "basic"},
+      "bearer": {"type": "http", "scheme": "bearer"}
+    },
+    "parameters": {
+      "Database": {"name": "db", "in": "path", "required": true, "description": "Database name", "schema": {"type": "string"}}
+    },
+    "requestBodies": {
+      "Record": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Record"}}}}
+    },
+    "responses": {
+      "Error": {"description": "Error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "SubField": {
+        "type": "object",
+        "required": ["code", "value"],
+        "properties": {"code": {"type": "string", "minLength": 1, "maxLength": 1}, "value": {"type": "string"}}
+      },
+      "Field": {
+        "type": "object",
+        "required": ["tag"],
+        "properties": {
+          "tag": {"type": "integer", "minimum": 1},
+          "value": {"type": "string"},
+          "subfields": {"type": "array", "items": {"$ref": "#/components/schemas/SubField"}}
+        }
+      },
+      "Record": {
+        "type": "object",
+        "properties": {
+          "database": {"type": "string", "readOnly": true},
+          "mfn": {"type": "integer"},
+          "version": {"type": "integer"},
+          "status": {"type": "integer"},
+          "fields": {"type": "array", "items": {"$ref": "#/components/schemas/Field"}}
+        }
+      },
+      "Formatted": {
+        "type": "object",
+        "properties": {"mfn": {"type": "integer"}, "text": {"type": "string"}}
+      },
+      "SearchResult": {
+        "type": "object",
+        "properties": {
+          "total": {"type": "integer"},
+          "first": {"type": "integer"},
+          "items": {"type": "array", "items": {"type": "object", "properties": {"mfn": {"type": "integer"}, "description": {"type": "string"}}}}
+        }
+      },
+      "Database": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "description": {"type": "string"},
+          "readOnly": {"type": "boolean"},
+          "maxMfn": {"type": "integer"},
+          "logicallyDeleted": {"type": "array", "items": {"type": "integer"}},
+          "physicallyDeleted": {"type": "array", "items": {"type": "integer"}},
+          "nonActualized": {"type": "array", "items": {"type": "integer"}},
+          "locked": {"type": "array", "items": {"type": "integer"}},
+          "databaseLocked": {"type": "boolean"}
+        }
+      },
+      "Term": {
+        "type": "object",
+        "properties": {"text": {"type": "string"}, "count": {"type": "integer"}}
+      },
+      "Posting": {
+        "type": "object",
+        "properties": {
+          "mfn": {"type": "integer"},
+          "tag": {"type": "integer"},
+          "occurrence": {"type": "integer"},
+          "count": {"type": "integer"},
+          "text": {"type": "string"}
+        }
+      },
+      "ServerStat": {
+        "type": "object",
+        "properties": {
+          "totalCommandCount": {"type": "integer"},
+          "clientCount": {"type": "integer"},
+          "clients": {"type": "array", "items": {"type": "object", "properties": {
+            "number": {"type": "string"}, "address": {"type": "string"}, "port": {"type": "string"},
+            "name": {"type": "string"}, "id": {"type": "string"}, "workstation": {"type": "string"},
+            "registered": {"type": "string"}, "acknowledged": {"type": "string"},
+            "lastCommand": {"type": "string"}, "commandNumber": {"type": "string"}}}}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {"error": {"type": "string"}, "code": {"type": "integer", "description": "IRBIS return code"}}
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,54 @@
+// irbis-z3950 -- сервер Z39.50, предоставляющий доступ к базам
+// данных ИРБИС64 (Init, Search, Present, Scan).
+//
+//	irbis-z3950 -listen :210 -connection "host=127.0.0.1;user=reader;password=secret;" -databases IBIS
+package main
+
+import (
+	"flag"
+	"irbis"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func main() {
+	listen := flag.String("listen", ":210", "listen address")
+	connectionString := flag.String("connection", "", "IRBIS64 connection string")
+	databases := flag.String("databases", "", "comma-separated list of available databases")
+	poolSize := flag.Int("pool", irbis.DefaultPoolSize, "IRBIS64 connection pool size")
+	encoding := flag.String("encoding", "utf-8", "record encoding")
+	flag.Parse()
+
+	if len(*connectionString) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pool := irbis.NewConnectionPool(*connectionString, *poolSize)
+	defer pool.Close()
+
+	server := irbis.NewZ3950Server(pool)
+	server.Codec = irbis.FindCodec(*encoding, false)
+	if server.Codec == nil {
+		log.Fatal("unknown encoding: ", *encoding)
+	}
+	for _, database := range strings.Split(*databases, ",") {
+		if database = strings.TrimSpace(database); len(database) != 0 {
+			server.Databases = append(server.Databases, database)
+		}
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		<-stop
+		_ = server.Close()
+	}()
+
+	log.Println("IRBIS Z39.50 server listening on", *listen)
+	if err := server.ListenAndServe(*listen); err != nil {
+		log.Println(err)
+	}
+}
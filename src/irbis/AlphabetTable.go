@@ -0,0 +1,145 @@
+package irbis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// defaultAlphabet Стандартная таблица алфавитных символов (ISISACW.TAB).
+const defaultAlphabet = `
+038 064 065 066 067 068 069 070 071 072 073 074 075 076 077 078
+079 080 081 082 083 084 085 086 087 088 089 090 097 098 099 100
+101 102 103 104 105 106 107 108 109 110 111 112 113 114 115 116
+117 118 119 120 121 122 128 129 130 131 132 133 134 135 136 137
+138 139 140 141 142 143 144 145 146 147 148 149 150 151 152 153
+154 155 156 157 158 159 160 161 162 163 164 165 166 167 168 169
+170 171 172 173 174 175 176 177 178 179 180 181 182 183 184 185
+186 187 188 189 190 191 192 193 194 195 196 197 198 199 200 201
+202 203 204 205 206 207 208 209 210 211 212 213 214 215 216 217
+218 219 220 221 222 223 224 225 226 227 228 229 230 231 232 233
+234 235 236 237 238 239 240 241 242 243 244 245 246 247 248 249
+250 251 252 253 254 255
+`
+
+// defaultUpperCase Стандартная таблица преобразования
+// в верхний регистр (ISISUCW.TAB).
+const defaultUpperCase = `
+000 001 002 003 004 005 006 007 008 009 010 011 012 013 014 015
+016 017 018 019 020 021 022 023 024 025 026 027 028 028 030 031
+032 033 034 035 036 037 038 039 040 041 042 043 044 045 046 047
+048 049 050 051 052 053 054 055 056 057 058 059 060 061 062 063
+064 065 066 067 068 069 070 071 072 073 074 075 076 077 078 079
+080 081 082 083 084 085 086 087 088 089 090 091 092 093 094 095
+096 065 066 067 068 069 070 071 072 073 074 075 076 077 078 079
+080 081 082 083 084 085 086 087 088 089 090 123 124 125 126 127
+128 129 130 131 132 133 134 135 136 137 138 139 140 141 142 143
+144 145 146 147 148 149 150 151 152 153 154 155 156 157 158 159
+160 161 161 163 164 165 166 167 197 169 170 171 172 173 174 175
+176 177 178 178 165 181 182 183 197 185 170 187 163 189 189 175
+192 193 194 195 196 197 198 199 200 201 202 203 204 205 206 207
+208 209 210 211 212 213 214 215 216 217 218 219 220 221 222 223
+192 193 194 195 196 197 198 199 200 201 202 203 204 205 206 207
+208 209 210 211 212 213 214 215 216 217 218 219 220 221 222 223
+`
+
+// parseTableNumbers Разбор таблицы, состоящей из десятичных кодов
+// символов, разделённых пробелами и переводами строк.
+func parseTableNumbers(text string) (result []byte, err error) {
+	for _, item := range strings.Fields(text) {
+		item = strings.Trim(item, "\x1A")
+		if len(item) == 0 {
+			continue
+		}
+		value, problem := strconv.Atoi(item)
+		if problem != nil || value < 0 || value > 255 {
+			err = errors.New("bad character code in table: " + item)
+			return
+		}
+		result = append(result, byte(value))
+	}
+	return
+}
+
+// AlphabetTable Таблица алфавитных символов (ISISACW.TAB).
+// Символы задаются кодами в кодировке ANSI (Windows-1251).
+type AlphabetTable struct {
+	characters [256]bool
+}
+
+// ParseAlphabetTable Разбор текста таблицы алфавитных символов.
+func ParseAlphabetTable(text string) (*AlphabetTable, error) {
+	codes, err := parseTableNumbers(text)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(AlphabetTable)
+	for _, code := range codes {
+		result.characters[code] = true
+	}
+	return result, nil
+}
+
+// ReadAlphabetTable Загрузка таблицы алфавитных символов с локального диска.
+func ReadAlphabetTable(filename string) (*AlphabetTable, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAlphabetTable(strings.Join(lines, "\n"))
+}
+
+// DefaultAlphabetTable Стандартная таблица алфавитных символов.
+func DefaultAlphabetTable() *AlphabetTable {
+	result, _ := ParseAlphabetTable(defaultAlphabet)
+	return result
+}
+
+// IsAlpha Является ли символ (в кодировке ANSI) алфавитным?
+func (table *AlphabetTable) IsAlpha(c byte) bool {
+	return table.characters[c]
+}
+
+// UpperCaseTable Таблица преобразования символов в верхний регистр
+// (ISISUCW.TAB). Содержит ровно 256 кодов в кодировке ANSI.
+type UpperCaseTable struct {
+	table [256]byte
+}
+
+// ParseUpperCaseTable Разбор текста таблицы преобразования в верхний регистр.
+func ParseUpperCaseTable(text string) (*UpperCaseTable, error) {
+	codes, err := parseTableNumbers(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) != 256 {
+		return nil, errors.New("upper case table must contain 256 codes, got " +
+			strconv.Itoa(len(codes)))
+	}
+
+	result := new(UpperCaseTable)
+	copy(result.table[:], codes)
+	return result, nil
+}
+
+// ReadUpperCaseTable Загрузка таблицы преобразования в верхний регистр
+// с локального диска.
+func ReadUpperCaseTable(filename string) (*UpperCaseTable, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseUpperCaseTable(strings.Join(lines, "\n"))
+}
+
+// DefaultUpperCaseTable Стандартная таблица преобразования в верхний регистр.
+func DefaultUpperCaseTable() *UpperCaseTable {
+	result, _ := ParseUpperCaseTable(defaultUpperCase)
+	return result
+}
+
+// ToUpper Преобразование символа (в кодировке ANSI) в верхний регистр.
+func (table *UpperCaseTable) ToUpper(c byte) byte {
+	return table.table[c]
+}
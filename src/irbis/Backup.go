@@ -0,0 +1,803 @@
+package irbis
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupFileExtensions Расширения файлов базы данных, сохраняемых
+// в резервной копии (PAR-файл сохраняется всегда).
+var BackupFileExtensions = []string{"fst", "ws", "wss", "mnu", "pft", "stw", "tre", "opt"}
+
+// Элементы архива резервной копии: описание копии (INI-файл),
+// файлы базы данных и пакеты записей в протокольном представлении,
+// разделённые пустыми строками. Предыдущие версии записи
+// предшествуют её последней версии.
+const (
+	backupManifest = "backup.ini"
+	backupSection  = "Backup"
+	backupFiles    = "files/"
+	backupRecords  = "records/"
+)
+
+// BackupOptions Параметры резервного копирования базы данных.
+type BackupOptions struct {
+	// History Сохранять предыдущие версии записей.
+	History bool
+
+	// Files Сохранять файлы базы данных: PAR-файл, FST,
+	// рабочие листы, меню, форматы и т. п. (см. BackupFileExtensions).
+	Files bool
+
+	// BatchSize Количество записей, считываемых за одно обращение
+	// и сохраняемых в одном элементе архива.
+	BatchSize int
+
+	// Progress Функция, вызываемая после каждого пакета записей
+	// с количеством обработанных MFN. Если функция возвращает
+	// false, операция прерывается.
+	Progress func(done, total int) bool
+}
+
+// RestoreOptions Параметры восстановления базы данных.
+type RestoreOptions struct {
+	// Create Создать базу данных на сервере перед восстановлением.
+	Create bool
+
+	// Description Описание создаваемой базы данных
+	// (по умолчанию -- её имя).
+	Description string
+
+	// Overwrite Опустошить непустую базу данных на сервере
+	// (либо перезаписать существующие локальные файлы).
+	// Без этого флага восстановление в непустую базу невозможно.
+	Overwrite bool
+
+	// History Восстанавливать предыдущие версии записей,
+	// если они есть в копии.
+	History bool
+
+	// Files Восстанавливать файлы базы данных (кроме PAR-файла,
+	// пути в котором относятся к исходной базе).
+	Files bool
+
+	// Codec Кодировка текста полей в создаваемом MST-файле
+	// (nil -- без перекодировки, т. е. UTF-8).
+	Codec Codec
+
+	// BatchSize Количество записей, сохраняемых за одно обращение.
+	BatchSize int
+
+	// Progress То же, что BackupOptions.Progress.
+	Progress func(done, total int) bool
+}
+
+// BackupInfo Сведения о резервной копии.
+type BackupInfo struct {
+	Database string    // Имя базы данных.
+	MaxMfn   int       // Максимальный MFN на момент копирования.
+	Created  time.Time // Время создания копии.
+	History  bool      // Копия содержит предыдущие версии записей.
+	Records  int       // Количество записей.
+	Versions int       // Количество предыдущих версий записей.
+	Files    []string  // Имена файлов базы данных.
+}
+
+var errBackupCancelled = errors.New("cancelled")
+
+//===================================================================
+
+// backupFile Файл базы данных.
+type backupFile struct {
+	name string
+	text string
+}
+
+// backupSource Источник данных для резервного копирования.
+type backupSource interface {
+	maxMfn() (int, error)
+	readRecords(mfnList []int) ([]MarcRecord, error)
+	readHistory(record *MarcRecord) ([]MarcRecord, error)
+	readFiles() ([]backupFile, error)
+}
+
+// BackupDatabase Резервное копирование указанной базы данных
+// на сервере в сжатый архив (tar.gz). Записи сохраняются вместе
+// с MFN, статусом и номером версии.
+func (connection *Connection) BackupDatabase(database string, writer io.Writer,
+	options *BackupOptions) (*BackupInfo, error) {
+	if !connection.Connected {
+		return nil, errors.New("not connected")
+	}
+	return writeBackup(&serverBackupSource{connection, database}, database, writer, options)
+}
+
+// Backup Резервное копирование базы данных, открытой
+// для прямого доступа (см. Connection.BackupDatabase).
+func (access *DirectAccess) Backup(writer io.Writer, options *BackupOptions) (*BackupInfo, error) {
+	source := &directBackupSource{access, NewDirectRecordSource(access)}
+	return writeBackup(source, access.location.Name, writer, options)
+}
+
+func writeBackup(source backupSource, database string, writer io.Writer,
+	options *BackupOptions) (*BackupInfo, error) {
+	var settings BackupOptions
+	if options != nil {
+		settings = *options
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = DefaultStreamBatchSize
+	}
+
+	maxMfn, err := source.maxMfn()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &BackupInfo{Database: database, MaxMfn: maxMfn,
+		Created: time.Now(), History: settings.History}
+	compressed := gzip.NewWriter(writer)
+	archive := tar.NewWriter(compressed)
+
+	manifest := NewIniFile()
+	section := manifest.GetOrCreateSection(backupSection)
+	section.SetValue("Database", info.Database)
+	section.SetInt("MaxMfn", info.MaxMfn)
+	section.SetValue("Created", info.Created.Format(time.RFC3339))
+	section.SetBool("History", info.History)
+	err = writeBackupEntry(archive, backupManifest, manifest.String(), info.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Files {
+		files, err := source.readFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			err = writeBackupEntry(archive, backupFiles+file.name, file.text, info.Created)
+			if err != nil {
+				return nil, err
+			}
+			info.Files = append(info.Files, file.name)
+		}
+	}
+
+	for first := 1; first <= maxMfn; first += settings.BatchSize {
+		mfnList := make([]int, 0, settings.BatchSize)
+		for mfn := first; mfn <= maxMfn && len(mfnList) < settings.BatchSize; mfn++ {
+			mfnList = append(mfnList, mfn)
+		}
+
+		records, err := source.readRecords(mfnList)
+		if err != nil {
+			return nil, err
+		}
+
+		text := strings.Builder{}
+		for i := range records {
+			record := &records[i]
+			if record.Mfn <= 0 || record.Status&(PHYSICALLY_DELETED|ABSENT) != 0 {
+				continue
+			}
+			if settings.History {
+				history, err := source.readHistory(record)
+				if err != nil {
+					return nil, err
+				}
+				for j := range history {
+					text.WriteString(history[j].Encode("\n") + "\n")
+				}
+				info.Versions += len(history)
+			}
+			text.WriteString(record.Encode("\n") + "\n")
+			info.Records++
+		}
+
+		name := fmt.Sprintf("%s%08d.txt", backupRecords, first)
+		if err = writeBackupEntry(archive, name, text.String(), info.Created); err != nil {
+			return nil, err
+		}
+
+		done := first + len(mfnList) - 1
+		if settings.Progress != nil && !settings.Progress(done, maxMfn) {
+			return nil, errBackupCancelled
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+	if err = compressed.Close(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func writeBackupEntry(archive *tar.Writer, name, text string, modified time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(text)), ModTime: modified}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.WriteString(archive, text)
+	return err
+}
+
+//===================================================================
+
+// serverBackupSource Копирование базы данных на сервере.
+type serverBackupSource struct {
+	connection *Connection
+	database   string
+}
+
+func (source *serverBackupSource) maxMfn() (int, error) {
+	result := source.connection.GetMaxMfn(source.database)
+	if source.connection.LastError < 0 {
+		return 0, errors.New(DescribeError(source.connection.LastError))
+	}
+	// Сервер выдаёт MFN, который получит следующая запись
+	return result - 1, nil
+}
+
+func (source *serverBackupSource) readRecords(mfnList []int) ([]MarcRecord, error) {
+	return source.connection.readRecordsBatch(source.database, mfnList)
+}
+
+func (source *serverBackupSource) readHistory(record *MarcRecord) (result []MarcRecord, err error) {
+	for version := 1; version < record.Version; version++ {
+		var previous *MarcRecord
+		previous, err = source.connection.readRecordVersion(source.database, record.Mfn, version)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			result = append(result, *previous)
+		}
+	}
+	return
+}
+
+func (source *serverBackupSource) readFiles() (result []backupFile, err error) {
+	connection := source.connection
+	par := source.database + ".par"
+	text := connection.ReadTextFile("1.." + par)
+	if connection.LastError < 0 {
+		return nil, errors.New(DescribeError(connection.LastError))
+	}
+	if len(text) != 0 {
+		result = append(result, backupFile{par, text})
+	}
+
+	for _, extension := range BackupFileExtensions {
+		names := connection.ListFiles("2." + source.database + ".*." + extension)
+		if connection.LastError < 0 {
+			return nil, errors.New(DescribeError(connection.LastError))
+		}
+		for _, name := range names {
+			name = filepath.Base(strings.Replace(name, "\\", "/", -1))
+			text = connection.ReadTextFile("2." + source.database + "." + name)
+			if connection.LastError < 0 {
+				return nil, errors.New(DescribeError(connection.LastError))
+			}
+			result = append(result, backupFile{name, text})
+		}
+	}
+
+	return
+}
+
+//===================================================================
+
+// directBackupSource Копирование базы данных, открытой
+// для прямого доступа.
+type directBackupSource struct {
+	access  *DirectAccess
+	records RecordSource
+}
+
+func (source *directBackupSource) maxMfn() (int, error) {
+	return source.access.GetMaxMfn(), nil
+}
+
+func (source *directBackupSource) readRecords(mfnList []int) ([]MarcRecord, error) {
+	return source.records.ReadRecords(mfnList)
+}
+
+// readHistory Предыдущие версии записи по цепочке ссылок в MST-файле.
+func (source *directBackupSource) readHistory(record *MarcRecord) ([]MarcRecord, error) {
+	current, err := source.access.ReadRawRecord(record.Mfn)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []MarcRecord
+	offset := current.Leader.PreviousOffset()
+	for offset > 0 && len(result) < record.Version {
+		previous, err := source.access.mst.ReadRecord(offset)
+		if err != nil {
+			return nil, err
+		}
+		if int(previous.Leader.Mfn) != record.Mfn {
+			break
+		}
+
+		decoded := previous.Decode()
+		decoded.Database = record.Database
+		result = append([]MarcRecord{*decoded}, result...)
+		offset = previous.Leader.PreviousOffset()
+	}
+
+	return result, nil
+}
+
+func (source *directBackupSource) readFiles() (result []backupFile, err error) {
+	location := source.access.location
+	seen := make(map[string]bool)
+	add := func(filename string) error {
+		name := filepath.Base(filename)
+		if seen[strings.ToLower(name)] {
+			return nil
+		}
+		seen[strings.ToLower(name)] = true
+
+		buffer, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		result = append(result, backupFile{name, FromAnsi(buffer)})
+		return nil
+	}
+
+	par := location.Name + ".par"
+	for _, dir := range []string{location.Root, ResolvePath(location.Root, "datai"), filepath.Dir(location.Mst)} {
+		if filename, found := findEntry(dir, par); found {
+			if err = add(filename); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	for _, dir := range []string{location.Pft, filepath.Dir(location.Mst)} {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(entry.Name()), "."))
+			if entry.IsDir() || !containsString(BackupFileExtensions, extension) {
+				continue
+			}
+			if err = add(filepath.Join(dir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return
+}
+
+func containsString(list []string, item string) bool {
+	for _, value := range list {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+//===================================================================
+
+// backupSlot Запись с указанным MFN: предыдущие версии
+// и последняя версия (пустой список -- записи с таким MFN нет).
+type backupSlot struct {
+	mfn      int
+	versions []MarcRecord
+}
+
+// restoreTarget Получатель восстанавливаемых данных.
+type restoreTarget interface {
+	prepare(info *BackupInfo, options *RestoreOptions) error
+	writeFile(name, text string) error
+	writeRecords(slots []backupSlot) error
+	finish(maxMfn int) error
+	close()
+}
+
+// RestoreDatabase Восстановление указанной базы данных на сервере
+// из резервной копии с сохранением нумерации записей. База данных
+// должна быть пустой (см. RestoreOptions.Create и Overwrite).
+// Отсутствующие в копии MFN заполняются пустыми логически
+// удалёнными записями, номера версий назначаются сервером.
+func (connection *Connection) RestoreDatabase(database string, reader io.Reader,
+	options *RestoreOptions) (*BackupInfo, error) {
+	if !connection.Connected {
+		return nil, errors.New("not connected")
+	}
+	target := &serverRestoreTarget{connection: connection, database: database}
+	return readBackup(target, reader, options)
+}
+
+// RestoreDirect Восстановление базы данных из резервной копии
+// в локальные файлы MST и XRF (путь задаётся без расширения,
+// например, "data/ibis") с сохранением нумерации и версий записей.
+// Создаётся пустой поисковый словарь, поэтому все записи помечаются
+// как неактуализированные.
+func RestoreDirect(filename string, reader io.Reader, options *RestoreOptions) (*BackupInfo, error) {
+	target := &directRestoreTarget{filename: filename}
+	return readBackup(target, reader, options)
+}
+
+func readBackup(target restoreTarget, reader io.Reader, options *RestoreOptions) (*BackupInfo, error) {
+	var settings RestoreOptions
+	if options != nil {
+		settings = *options
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = DefaultStreamBatchSize
+	}
+	compressed, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	archive := tar.NewReader(compressed)
+
+	header, err := archive.Next()
+	if err != nil || header.Name != backupManifest {
+		return nil, errors.New("not a database backup")
+	}
+	lines, err := readBackupLines(archive)
+	if err != nil {
+		return nil, err
+	}
+	manifest := NewIniFile()
+	manifest.Parse(lines)
+	section := manifest.GetOrCreateSection(backupSection)
+	info := &BackupInfo{Database: section.GetValue("Database", ""),
+		MaxMfn:  section.GetInt("MaxMfn", -1),
+		History: section.GetBool("History", false)}
+	info.Created, _ = time.Parse(time.RFC3339, section.GetValue("Created", ""))
+	if info.MaxMfn < 0 {
+		return nil, errors.New("bad backup description")
+	}
+
+	defer target.close()
+	if err = target.prepare(info, &settings); err != nil {
+		return nil, err
+	}
+
+	next := 1
+	for {
+		header, err = archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case strings.HasPrefix(header.Name, backupFiles):
+			name := strings.TrimPrefix(header.Name, backupFiles)
+			if len(name) == 0 || name != filepath.Base(name) || strings.ContainsAny(name, "/\\") {
+				return nil, errors.New("bad file name in backup: " + header.Name)
+			}
+			info.Files = append(info.Files, name)
+			if !settings.Files || strings.EqualFold(filepath.Ext(name), ".par") {
+				continue
+			}
+			buffer, err := ioutil.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			if err = target.writeFile(name, string(buffer)); err != nil {
+				return nil, err
+			}
+
+		case strings.HasPrefix(header.Name, backupRecords):
+			lines, err = readBackupLines(archive)
+			if err != nil {
+				return nil, err
+			}
+			slots, err := parseBackupSlots(lines, next, info.MaxMfn, settings.History)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", header.Name, err)
+			}
+			for _, slot := range slots {
+				if len(slot.versions) != 0 {
+					info.Records++
+					info.Versions += len(slot.versions) - 1
+				}
+			}
+			for start := 0; start < len(slots); start += settings.BatchSize {
+				stop := start + settings.BatchSize
+				if stop > len(slots) {
+					stop = len(slots)
+				}
+				if err = target.writeRecords(slots[start:stop]); err != nil {
+					return nil, err
+				}
+			}
+			if len(slots) != 0 {
+				next = slots[len(slots)-1].mfn + 1
+			}
+			if settings.Progress != nil && !settings.Progress(next-1, info.MaxMfn) {
+				return nil, errBackupCancelled
+			}
+		}
+	}
+
+	// Недостающие записи в конце базы
+	var slots []backupSlot
+	for ; next <= info.MaxMfn; next++ {
+		slots = append(slots, backupSlot{mfn: next})
+	}
+	for start := 0; start < len(slots); start += settings.BatchSize {
+		stop := start + settings.BatchSize
+		if stop > len(slots) {
+			stop = len(slots)
+		}
+		if err = target.writeRecords(slots[start:stop]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = target.finish(info.MaxMfn); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func readBackupLines(reader io.Reader) (result []string, err error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		result = append(result, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	err = scanner.Err()
+	return
+}
+
+// parseBackupSlots Разбор пакета записей. Пропущенные MFN, начиная
+// с next, выдаются как пустые. Без history сохраняются только
+// последние версии записей.
+func parseBackupSlots(lines []string, next, maxMfn int, history bool) (result []backupSlot, err error) {
+	var block []string
+	flush := func() error {
+		if len(block) == 0 {
+			return nil
+		}
+		if len(block) < 2 || !strings.Contains(block[0], "#") || !strings.Contains(block[1], "#") {
+			return errors.New("bad record: " + block[0])
+		}
+		record := NewMarcRecord()
+		record.Decode(block)
+		block = nil
+
+		if len(result) != 0 && result[len(result)-1].mfn == record.Mfn {
+			slot := &result[len(result)-1]
+			if history {
+				slot.versions = append(slot.versions, *record)
+			} else {
+				slot.versions[0] = *record
+			}
+			return nil
+		}
+		if record.Mfn < next || record.Mfn > maxMfn {
+			return fmt.Errorf("unexpected MFN %d", record.Mfn)
+		}
+		for ; next < record.Mfn; next++ {
+			result = append(result, backupSlot{mfn: next})
+		}
+		result = append(result, backupSlot{mfn: record.Mfn, versions: []MarcRecord{*record}})
+		next++
+		return nil
+	}
+
+	for _, line := range lines {
+		if len(line) == 0 {
+			if err = flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err = flush(); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+//===================================================================
+
+// serverRestoreTarget Восстановление базы данных на сервере.
+type serverRestoreTarget struct {
+	connection *Connection
+	database   string
+	options    *RestoreOptions
+}
+
+func (target *serverRestoreTarget) failure() error {
+	return errors.New(DescribeError(target.connection.LastError))
+}
+
+func (target *serverRestoreTarget) prepare(info *BackupInfo, options *RestoreOptions) error {
+	connection := target.connection
+	target.options = options
+	if target.options.Create {
+		description := PickOne(target.options.Description, target.database)
+		if !connection.CreateDatabase(target.database, description, true) {
+			return target.failure()
+		}
+	}
+
+	maxMfn := connection.GetMaxMfn(target.database)
+	if connection.LastError < 0 {
+		return target.failure()
+	}
+	if maxMfn > 1 {
+		if !target.options.Overwrite {
+			return errors.New("database is not empty: " + target.database)
+		}
+		if !connection.TruncateDatabase(target.database) {
+			return target.failure()
+		}
+	}
+
+	return nil
+}
+
+func (target *serverRestoreTarget) writeFile(name, text string) error {
+	if !target.connection.WriteTextFile("2."+target.database+"."+name, text) {
+		return target.failure()
+	}
+	return nil
+}
+
+// writeRecords Первые версии записей (либо заглушки на месте
+// отсутствующих) сохраняются одним пакетом как новые, затем
+// последующие версии сохраняются поверх них.
+func (target *serverRestoreTarget) writeRecords(slots []backupSlot) error {
+	connection := target.connection
+	records := make([]MarcRecord, len(slots))
+	for i, slot := range slots {
+		if len(slot.versions) == 0 {
+			records[i].Status = LOGICALLY_DELETED
+		} else {
+			records[i] = slot.versions[0]
+			records[i].Status &= LOGICALLY_DELETED
+		}
+		records[i].Mfn, records[i].Version = 0, 0
+		records[i].Database = target.database
+	}
+
+	if len(records) == 1 {
+		if connection.WriteRecord(&records[0]) == 0 {
+			return target.failure()
+		}
+	} else if err := connection.writeRecordsBatch(records); err != nil {
+		return err
+	}
+
+	for i, slot := range slots {
+		if records[i].Mfn != slot.mfn {
+			return fmt.Errorf("MFN mismatch: expected %d, got %d", slot.mfn, records[i].Mfn)
+		}
+		for j := 1; j < len(slot.versions); j++ {
+			version := slot.versions[j]
+			version.Mfn, version.Version = slot.mfn, records[i].Version
+			version.Status &= LOGICALLY_DELETED
+			version.Database = target.database
+			if connection.WriteRecord(&version) == 0 {
+				return target.failure()
+			}
+			records[i].Version = version.Version
+		}
+	}
+
+	return nil
+}
+
+func (target *serverRestoreTarget) finish(maxMfn int) error {
+	return nil
+}
+
+func (target *serverRestoreTarget) close() {
+}
+
+//===================================================================
+
+// directRestoreTarget Восстановление базы данных в локальные файлы.
+type directRestoreTarget struct {
+	filename string
+	mst      *MstFile
+	xrf      *XrfFile
+}
+
+func (target *directRestoreTarget) prepare(info *BackupInfo, options *RestoreOptions) (err error) {
+	mstName := target.filename + ".mst"
+	if _, err = os.Stat(mstName); err == nil && !options.Overwrite {
+		return errors.New("database already exists: " + mstName)
+	}
+
+	if target.mst, err = CreateMstFile(mstName); err != nil {
+		return
+	}
+	target.mst.Codec = options.Codec
+	if target.xrf, err = CreateXrfFile(target.filename + ".xrf"); err != nil {
+		return
+	}
+
+	return CreateIfpFiles(target.filename+".ifp", target.filename+".l01", target.filename+".n01")
+}
+
+func (target *directRestoreTarget) writeFile(name, text string) error {
+	return WriteAnsiFile(filepath.Join(filepath.Dir(target.filename), name), text)
+}
+
+// writeRecords Версии записи сохраняются в MST-файл по порядку
+// и связываются ссылками на предыдущие версии.
+func (target *directRestoreTarget) writeRecords(slots []backupSlot) error {
+	for _, slot := range slots {
+		if len(slot.versions) == 0 {
+			if err := target.xrf.WriteRecord(slot.mfn, XrfRecord{Status: ABSENT}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var position int64
+		last := len(slot.versions) - 1
+		for i := range slot.versions {
+			version := &slot.versions[i]
+			record := NewMstRecord(version)
+			record.Leader.Mfn = int32(slot.mfn)
+			record.Leader.Status = int32(version.Status &^ LAST_VERSION)
+			if i == last {
+				record.Leader.Status |= LAST_VERSION | NON_ACTUALIZED
+			}
+			record.Leader.SetPreviousOffset(position)
+
+			var err error
+			if position, err = target.mst.AppendRecord(record); err != nil {
+				return err
+			}
+		}
+
+		status := slot.versions[last].Status&LOGICALLY_DELETED | NON_ACTUALIZED
+		if err := target.xrf.WriteRecord(slot.mfn, NewXrfRecord(position, status)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (target *directRestoreTarget) finish(maxMfn int) error {
+	target.mst.Control.NextMfn = int32(maxMfn + 1)
+	return target.mst.WriteControlRecord()
+}
+
+func (target *directRestoreTarget) close() {
+	if target.mst != nil {
+		target.mst.Close()
+	}
+	if target.xrf != nil {
+		target.xrf.Close()
+	}
+}
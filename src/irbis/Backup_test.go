@@ -0,0 +1,254 @@
+package irbis
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeDatabase База данных на поддельном сервере: версии
+// записей (nil -- записи нет) и текстовые файлы.
+type fakeDatabase struct {
+	records [][]MarcRecord
+	files   map[string]string
+}
+
+func (database *fakeDatabase) encode(record *MarcRecord) string {
+	return record.Encode(FirstDelimiter)
+}
+
+// save Сохранение новой записи либо новой версии существующей.
+func (database *fakeDatabase) save(record *MarcRecord) {
+	if record.Mfn == 0 {
+		database.records = append(database.records, nil)
+		record.Mfn = len(database.records)
+	}
+	record.Version = len(database.records[record.Mfn-1]) + 1
+	record.Status &= LOGICALLY_DELETED
+	database.records[record.Mfn-1] = append(database.records[record.Mfn-1], *record.Clone())
+}
+
+func (database *fakeDatabase) handler(command string, params []string) []string {
+	switch command {
+	case "O":
+		return []string{strconv.Itoa(len(database.records) + 1)}
+	case "S":
+		database.records = nil
+		return []string{"0"}
+	case "K":
+		// Поиск по вхождению текста в поле 200^a
+		text := params[1][strings.Index(params[1], "=")+1:]
+		var found []string
+		for i, versions := range database.records {
+			if len(versions) != 0 && strings.Contains(versions[len(versions)-1].FSM(200, 'a'), text) {
+				found = append(found, strconv.Itoa(i+1))
+			}
+		}
+		return append([]string{"0", strconv.Itoa(len(found))}, found...)
+	case "G":
+		count, _ := strconv.Atoi(params[2])
+		result := []string{"0"}
+		for _, line := range params[3 : 3+count] {
+			mfn, _ := strconv.Atoi(line)
+			if mfn <= len(database.records) && len(database.records[mfn-1]) != 0 {
+				versions := database.records[mfn-1]
+				result = append(result, line+"#0"+FirstDelimiter+database.encode(&versions[len(versions)-1]))
+			}
+		}
+		return result
+	case "C":
+		mfn, _ := strconv.Atoi(params[1])
+		version, _ := strconv.Atoi(params[2])
+		if mfn > len(database.records) || version <= 0 || version > len(database.records[mfn-1]) {
+			return []string{"-140"}
+		}
+		record := database.records[mfn-1][version-1]
+		return append([]string{"0"}, strings.Split(record.Encode("\n"), "\n")...)
+	case "D":
+		record := NewMarcRecord()
+		record.Decode(strings.Split(params[3], FullDelimiter))
+		database.save(record)
+		lines := strings.Split(record.Encode(SecondDelimiter), SecondDelimiter)
+		// Код возврата -- новый максимальный MFN
+		maxMfn := strconv.Itoa(len(database.records))
+		return []string{maxMfn, lines[0], strings.Join(lines[1:], SecondDelimiter)}
+	case "6":
+		result := []string{"0"}
+		for _, line := range params[2:] {
+			if len(line) == 0 {
+				continue
+			}
+			record := NewMarcRecord()
+			record.Decode(strings.Split(line, FullDelimiter)[1:])
+			database.save(record)
+			result = append(result, record.Encode(FullDelimiter))
+		}
+		return result
+	case "L":
+		if strings.HasPrefix(params[0], "&") {
+			parts := strings.SplitN(params[0][1:], "&", 2)
+			database.files[parts[0]] = IrbisToDos(parts[1])
+			return []string{"0"}
+		}
+		return []string{DosToIrbis(database.files[params[0]])}
+	case "!":
+		var result []string
+		for name := range database.files {
+			if strings.HasPrefix(name, "2.IBIS.") && strings.HasSuffix(name, params[0][len("2.IBIS.*"):]) {
+				result = append(result, strings.TrimPrefix(name, "2.IBIS."))
+			}
+		}
+		return result
+	}
+	return []string{"-1"}
+}
+
+// newFakeDatabase База данных: запись 1 с тремя версиями,
+// логически удалённая запись 2, физически удалённая запись 3
+// и запись 4.
+func newFakeDatabase() *fakeDatabase {
+	result := &fakeDatabase{files: map[string]string{
+		"1..IBIS.par":      "1=.\\datai\\ibis\\\n",
+		"2.IBIS.ibis.fst":  "200 0 v200^a\n",
+		"2.IBIS.brief.pft": "v200^a\n",
+	}}
+	for mfn := 1; mfn <= 4; mfn++ {
+		record := NewMarcRecord()
+		record.Add(200, "").Add('a', "Title "+strconv.Itoa(mfn))
+		result.save(record)
+	}
+	for version := 2; version <= 3; version++ {
+		record := result.records[0][len(result.records[0])-1].Clone()
+		record.SetSubfield(200, 'a', "Title 1 v"+strconv.Itoa(version))
+		result.save(record)
+	}
+	result.records[1][0].Status = LOGICALLY_DELETED
+	result.records[2] = nil
+	return result
+}
+
+// restoreFakeDatabase Восстановление поддельной базы данных
+// (с историей записей) в локальные файлы.
+func restoreFakeDatabase(t *testing.T, dir string) string {
+	var archive bytes.Buffer
+	_, err := newFakeConnection(newFakeDatabase().handler).BackupDatabase("IBIS", &archive,
+		&BackupOptions{History: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "ibis")
+	if _, err = RestoreDirect(filename, bytes.NewReader(archive.Bytes()), &RestoreOptions{History: true}); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestConnection_BackupDatabase_1(t *testing.T) {
+	source := newFakeDatabase()
+	var archive bytes.Buffer
+	info, err := newFakeConnection(source.handler).BackupDatabase("IBIS", &archive,
+		&BackupOptions{History: true, Files: true, BatchSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.MaxMfn != 4 || info.Records != 3 || info.Versions != 2 || len(info.Files) != 3 {
+		t.Fatal(info)
+	}
+
+	// Восстановление на сервер с сохранением MFN и версий
+	target := &fakeDatabase{files: map[string]string{}}
+	target.save(NewMarcRecord())
+	connection := newFakeConnection(target.handler)
+	if _, err = connection.RestoreDatabase("IBIS", bytes.NewReader(archive.Bytes()),
+		&RestoreOptions{History: true, Files: true}); err == nil {
+		t.Fatal("restored into non-empty database")
+	}
+	restored, err := connection.RestoreDatabase("IBIS", bytes.NewReader(archive.Bytes()),
+		&RestoreOptions{History: true, Files: true, Overwrite: true, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Records != 3 || restored.Versions != 2 || restored.Database != "IBIS" {
+		t.Fatal(restored)
+	}
+	if len(target.records) != 4 || len(target.records[0]) != 3 ||
+		target.records[0][2].FSM(200, 'a') != "Title 1 v3" ||
+		target.records[0][0].FSM(200, 'a') != "Title 1" ||
+		!target.records[1][0].IsDeleted() || target.records[1][0].FSM(200, 'a') != "Title 2" ||
+		!target.records[2][0].IsDeleted() || len(target.records[2][0].Fields) != 0 ||
+		target.records[3][0].FSM(200, 'a') != "Title 4" {
+		t.Fatal(target.records)
+	}
+	if target.files["2.IBIS.ibis.fst"] != "200 0 v200^a\n" || len(target.files) != 2 {
+		t.Fatal(target.files)
+	}
+}
+
+func TestRestoreDirect_1(t *testing.T) {
+	source := newFakeDatabase()
+	var archive bytes.Buffer
+	_, err := newFakeConnection(source.handler).BackupDatabase("IBIS", &archive,
+		&BackupOptions{History: true, Files: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ibis")
+	info, err := RestoreDirect(filename, bytes.NewReader(archive.Bytes()),
+		&RestoreOptions{History: true, Files: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Records != 3 || info.Versions != 2 {
+		t.Fatal(info)
+	}
+	if _, err = RestoreDirect(filename, bytes.NewReader(archive.Bytes()), nil); err == nil {
+		t.Fatal("overwritten existing database")
+	}
+
+	access, err := OpenDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+	if access.GetMaxMfn() != 4 {
+		t.Fatal(access.GetMaxMfn())
+	}
+	records, err := NewDirectRecordSource(access).ReadRecords([]int{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Version != 3 || records[0].FSM(200, 'a') != "Title 1 v3" ||
+		records[1].Mfn != 2 || !records[1].IsDeleted() || records[2].Mfn != 4 {
+		t.Fatal(records)
+	}
+	if terms, err := access.ReadTerms(&TermParameters{NumberOfTerms: 10}); err != nil || len(terms) != 0 {
+		t.Fatal(terms, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "brief.pft")); err != nil || string(data) != "v200^a\n" {
+		t.Fatal(string(data), err)
+	}
+
+	// Повторное копирование из локальной базы -- с историей
+	archive.Reset()
+	info, err = access.Backup(&archive, &BackupOptions{History: true, Files: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Database != "ibis" || info.Records != 3 || info.Versions != 2 || len(info.Files) != 2 {
+		t.Fatal(info)
+	}
+
+	if _, err = RestoreDirect(filename, strings.NewReader("garbage"), nil); err == nil {
+		t.FailNow()
+	}
+}
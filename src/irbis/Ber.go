@@ -0,0 +1,409 @@
+package irbis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Кодирование ASN.1 BER в объёме, необходимом для протокола Z39.50.
+// Поддерживается только определённая форма длины.
+
+// Классы тегов BER.
+const (
+	berUniversal   = byte(0x00)
+	berApplication = byte(0x40)
+	berContext     = byte(0x80)
+)
+
+// Универсальные теги.
+const (
+	berInteger  = 2
+	berOid      = 6
+	berExternal = 8
+	berSequence = 16
+	berVisible  = 26
+)
+
+// berMaxLength Максимальная длина принимаемого элемента.
+const berMaxLength = 16 * 1024 * 1024
+
+// berMaxDepth Максимальная вложенность составных элементов.
+const berMaxDepth = 64
+
+var errBerFormat = errors.New("malformed BER data")
+
+// berNode Элемент BER: примитивный (value) либо составной (children).
+type berNode struct {
+	class       byte
+	constructed bool
+	tag         int
+	value       []byte
+	children    []*berNode
+}
+
+//===================================================================
+
+// readBerHeader Чтение идентификатора и длины элемента.
+func readBerHeader(reader io.ByteReader) (class byte, constructed bool, tag, length int, err error) {
+	var first byte
+	if first, err = reader.ReadByte(); err != nil {
+		return
+	}
+	class = first & 0xC0
+	constructed = first&0x20 != 0
+	tag = int(first & 0x1F)
+	if tag == 0x1F {
+		tag = 0
+		for i := 0; ; i++ {
+			var c byte
+			if c, err = reader.ReadByte(); err != nil {
+				return
+			}
+			if i == 3 {
+				err = errBerFormat
+				return
+			}
+			tag = tag<<7 | int(c&0x7F)
+			if c&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	var c byte
+	if c, err = reader.ReadByte(); err != nil {
+		return
+	}
+	if c&0x80 == 0 {
+		length = int(c)
+		return
+	}
+	count := int(c & 0x7F)
+	if count == 0 || count > 4 {
+		// Неопределённая форма длины не поддерживается
+		err = errBerFormat
+		return
+	}
+	for ; count > 0; count-- {
+		if c, err = reader.ReadByte(); err != nil {
+			return
+		}
+		length = length<<8 | int(c)
+	}
+	if length > berMaxLength {
+		err = errBerFormat
+	}
+	return
+}
+
+// parseBer Разбор элемента из буфера. Возвращает остаток буфера.
+func parseBer(data []byte) (node *berNode, rest []byte, err error) {
+	return parseBerNode(data, berMaxDepth)
+}
+
+// parseBerNode Разбор элемента, вложенность которого
+// не превышает depth уровней.
+func parseBerNode(data []byte, depth int) (node *berNode, rest []byte, err error) {
+	reader := &byteSliceReader{data: data}
+	class, constructed, tag, length, err := readBerHeader(reader)
+	if err != nil {
+		return nil, nil, errBerFormat
+	}
+	if length > len(data)-reader.position {
+		return nil, nil, errBerFormat
+	}
+
+	node = &berNode{class: class, constructed: constructed, tag: tag}
+	body := data[reader.position : reader.position+length]
+	rest = data[reader.position+length:]
+	if !constructed {
+		node.value = body
+		return
+	}
+	if depth <= 1 {
+		return nil, nil, errBerFormat
+	}
+	for len(body) != 0 {
+		var child *berNode
+		if child, body, err = parseBerNode(body, depth-1); err != nil {
+			return nil, nil, err
+		}
+		node.children = append(node.children, child)
+	}
+	return
+}
+
+// readBer Чтение очередного элемента из потока. Элемент
+// длиннее limit байт отвергается до чтения его содержимого.
+func readBer(reader *bufio.Reader, limit int) (*berNode, error) {
+	header := &recordingReader{reader: reader}
+	_, _, _, length, err := readBerHeader(header)
+	if err != nil {
+		if err == io.EOF && len(header.data) == 0 {
+			return nil, io.EOF
+		}
+		if err == errBerFormat {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if len(header.data)+length > limit {
+		return nil, errBerFormat
+	}
+
+	data := make([]byte, len(header.data)+length)
+	copy(data, header.data)
+	if _, err = io.ReadFull(reader, data[len(header.data):]); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	node, _, err := parseBer(data)
+	return node, err
+}
+
+// byteSliceReader Чтение байтов из среза с отслеживанием позиции.
+type byteSliceReader struct {
+	data     []byte
+	position int
+}
+
+func (reader *byteSliceReader) ReadByte() (byte, error) {
+	if reader.position >= len(reader.data) {
+		return 0, io.EOF
+	}
+	reader.position++
+	return reader.data[reader.position-1], nil
+}
+
+// recordingReader Чтение байтов с запоминанием прочитанного.
+type recordingReader struct {
+	reader io.ByteReader
+	data   []byte
+}
+
+func (reader *recordingReader) ReadByte() (byte, error) {
+	c, err := reader.reader.ReadByte()
+	if err == nil {
+		reader.data = append(reader.data, c)
+	}
+	return c, err
+}
+
+//===================================================================
+
+// encode Кодирование элемента.
+func (node *berNode) encode() []byte {
+	body := node.value
+	if node.constructed {
+		body = nil
+		for _, child := range node.children {
+			body = append(body, child.encode()...)
+		}
+	}
+
+	first := node.class
+	if node.constructed {
+		first |= 0x20
+	}
+	var result []byte
+	if node.tag < 0x1F {
+		result = append(result, first|byte(node.tag))
+	} else {
+		result = append(result, first|0x1F)
+		var digits []byte
+		for tag := node.tag; tag != 0; tag >>= 7 {
+			digits = append([]byte{byte(tag & 0x7F)}, digits...)
+		}
+		for i := 0; i < len(digits)-1; i++ {
+			digits[i] |= 0x80
+		}
+		result = append(result, digits...)
+	}
+
+	length := len(body)
+	if length < 0x80 {
+		result = append(result, byte(length))
+	} else {
+		var digits []byte
+		for ; length != 0; length >>= 8 {
+			digits = append([]byte{byte(length)}, digits...)
+		}
+		result = append(result, 0x80|byte(len(digits)))
+		result = append(result, digits...)
+	}
+
+	return append(result, body...)
+}
+
+// find Поиск непосредственного потомка с указанным классом и тегом.
+func (node *berNode) find(class byte, tag int) *berNode {
+	if node == nil {
+		return nil
+	}
+	for _, child := range node.children {
+		if child.class == class && child.tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// first Первый потомок (для явно тегированных элементов).
+func (node *berNode) first() *berNode {
+	if node == nil || len(node.children) == 0 {
+		return nil
+	}
+	return node.children[0]
+}
+
+// intValue Целое значение (0 для отсутствующего элемента).
+func (node *berNode) intValue() int {
+	if node == nil || len(node.value) == 0 {
+		return 0
+	}
+	result := int(int8(node.value[0]))
+	for _, c := range node.value[1:] {
+		result = result<<8 | int(c)
+	}
+	return result
+}
+
+// intOr Целое значение либо значение по умолчанию.
+func (node *berNode) intOr(defaultValue int) int {
+	if node == nil {
+		return defaultValue
+	}
+	return node.intValue()
+}
+
+// boolValue Логическое значение.
+func (node *berNode) boolValue() bool {
+	return node != nil && len(node.value) != 0 && node.value[0] != 0
+}
+
+// stringValue Строковое значение.
+func (node *berNode) stringValue() string {
+	if node == nil {
+		return ""
+	}
+	return string(node.value)
+}
+
+// oidValue Идентификатор объекта в виде "1.2.840.10003.5.10".
+func (node *berNode) oidValue() string {
+	if node == nil || len(node.value) == 0 {
+		return ""
+	}
+	var parts []string
+	value := 0
+	for _, c := range node.value {
+		value = value<<7 | int(c&0x7F)
+		if c&0x80 != 0 {
+			continue
+		}
+		if len(parts) == 0 {
+			first := value / 40
+			if first > 2 {
+				first = 2
+			}
+			parts = append(parts, strconv.Itoa(first), strconv.Itoa(value-first*40))
+		} else {
+			parts = append(parts, strconv.Itoa(value))
+		}
+		value = 0
+	}
+	return strings.Join(parts, ".")
+}
+
+// bitValue Установлен ли бит с указанным номером в битовой строке.
+func (node *berNode) bitValue(bit int) bool {
+	if node == nil || len(node.value) < 2+bit/8 {
+		return false
+	}
+	return node.value[1+bit/8]&(0x80>>uint(bit%8)) != 0
+}
+
+//===================================================================
+
+// berConstructed Составной элемент. Отсутствующие (nil)
+// потомки пропускаются.
+func berConstructed(class byte, tag int, children ...*berNode) *berNode {
+	result := &berNode{class: class, constructed: true, tag: tag}
+	for _, child := range children {
+		if child != nil {
+			result.children = append(result.children, child)
+		}
+	}
+	return result
+}
+
+// berSequenceOf Универсальная последовательность.
+func berSequenceOf(children ...*berNode) *berNode {
+	return berConstructed(berUniversal, berSequence, children...)
+}
+
+// berPrimitive Примитивный элемент.
+func berPrimitive(class byte, tag int, value []byte) *berNode {
+	return &berNode{class: class, tag: tag, value: value}
+}
+
+// berInt Целочисленный элемент.
+func berInt(class byte, tag, value int) *berNode {
+	var result []byte
+	for {
+		result = append([]byte{byte(value)}, result...)
+		if value >= -128 && value < 128 {
+			break
+		}
+		value >>= 8
+	}
+	return berPrimitive(class, tag, result)
+}
+
+// berBool Логический элемент.
+func berBool(class byte, tag int, value bool) *berNode {
+	if value {
+		return berPrimitive(class, tag, []byte{0xFF})
+	}
+	return berPrimitive(class, tag, []byte{0})
+}
+
+// berString Строковый элемент.
+func berString(class byte, tag int, value string) *berNode {
+	return berPrimitive(class, tag, []byte(value))
+}
+
+// berObjectId Идентификатор объекта.
+func berObjectId(class byte, tag int, oid string) *berNode {
+	parts := strings.Split(oid, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		numbers[i], _ = strconv.Atoi(part)
+	}
+	if len(numbers) < 2 {
+		numbers = append(numbers, 0, 0)
+	}
+
+	var result []byte
+	numbers = append([]int{numbers[0]*40 + numbers[1]}, numbers[2:]...)
+	for _, number := range numbers {
+		digits := []byte{byte(number & 0x7F)}
+		for number >>= 7; number != 0; number >>= 7 {
+			digits = append([]byte{byte(number&0x7F) | 0x80}, digits...)
+		}
+		result = append(result, digits...)
+	}
+	return berPrimitive(class, tag, result)
+}
+
+// berBits Битовая строка с указанными установленными битами.
+func berBits(class byte, tag, length int, bits ...int) *berNode {
+	result := make([]byte, 1+(length+7)/8)
+	result[0] = byte(len(result)*8 - 8 - length)
+	for _, bit := range bits {
+		result[1+bit/8] |= 0x80 >> uint(bit%8)
+	}
+	return berPrimitive(class, tag, result)
+}
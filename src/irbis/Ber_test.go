@@ -0,0 +1,80 @@
+package irbis
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestBer_Encode_1(t *testing.T) {
+	node := berConstructed(berContext, 102,
+		berInt(berContext, 120, 1),
+		berInt(berContext, 121, -129),
+		berInt(berContext, 5, 1000000),
+		berObjectId(berUniversal, berOid, Z3950_USMARC),
+		berString(berContext, 45, string(make([]byte, 300))),
+		berBits(berContext, 4, 16, 0, 1, 14))
+	data := node.encode()
+	if data[0] != 0xBF || data[1] != 0x66 {
+		t.Fatal(data[:4])
+	}
+
+	parsed, err := readBer(bufio.NewReader(bytes.NewReader(data)), berMaxLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.tag != 102 || len(parsed.children) != 6 ||
+		parsed.find(berContext, 120).intValue() != 1 ||
+		parsed.find(berContext, 121).intValue() != -129 ||
+		parsed.find(berContext, 5).intValue() != 1000000 ||
+		parsed.find(berUniversal, berOid).oidValue() != Z3950_USMARC ||
+		len(parsed.find(berContext, 45).value) != 300 {
+		t.Fatal(parsed)
+	}
+	bits := parsed.find(berContext, 4)
+	if !bits.bitValue(0) || !bits.bitValue(1) || bits.bitValue(2) || !bits.bitValue(14) {
+		t.Fatal(bits.value)
+	}
+	if !bytes.Equal(parsed.encode(), data) {
+		t.FailNow()
+	}
+}
+
+func TestBer_Read_1(t *testing.T) {
+	data := berSequenceOf(berInt(berUniversal, berInteger, 5)).encode()
+	if _, err := readBer(bufio.NewReader(bytes.NewReader(data[:len(data)-1])), berMaxLength); err == nil {
+		t.FailNow()
+	}
+	if _, _, err := parseBer([]byte{0x30, 0x80, 0x00, 0x00}); err == nil {
+		t.FailNow()
+	}
+	if _, _, err := parseBer([]byte{0x30, 0x03, 0x02, 0x05, 0x01}); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestBer_Read_2(t *testing.T) {
+	nested := func(depth int) []byte {
+		node := berInt(berUniversal, berInteger, 1)
+		for i := 1; i < depth; i++ {
+			node = berSequenceOf(node)
+		}
+		return node.encode()
+	}
+
+	if _, err := readBer(bufio.NewReader(bytes.NewReader(nested(berMaxDepth))), berMaxLength); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBer(bufio.NewReader(bytes.NewReader(nested(berMaxDepth+1))), berMaxLength); err != errBerFormat {
+		t.Fatal(err)
+	}
+	if _, _, err := parseBer(nested(1000)); err != errBerFormat {
+		t.Fatal(err)
+	}
+
+	// Слишком длинный элемент отвергается по заголовку
+	data := berString(berContext, 45, string(make([]byte, 300))).encode()
+	if _, err := readBer(bufio.NewReader(bytes.NewReader(data[:5])), 200); err != errBerFormat {
+		t.Fatal(err)
+	}
+}
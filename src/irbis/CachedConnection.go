@@ -0,0 +1,385 @@
+package irbis
+
+import (
+	"context"
+	"io"
+)
+
+// CachedConnection Подключение к серверу с кэшированием записей,
+// результатов форматирования, количества найденных записей
+// и текстовых файлов. Остальные методы вызываются у Connection
+// без изменений.
+//
+// Изменения, сделанные через CachedConnection (сохранение, удаление
+// и восстановление записей, глобальная корректировка, опустошение,
+// удаление и восстановление базы данных, сохранение и удаление
+// текстовых файлов), сразу отражаются в кэше: сохранённая запись
+// заменяет прежнюю версию, результаты её форматирования и поиска
+// в её базе данных удаляются. Изменения, сделанные другими клиентами,
+// становятся видны по истечении CacheOptions.TTL либо после вызова
+// методов Invalidate* у Cache. Изменённые записи, кроме того,
+// обнаруживаются при CacheOptions.Revalidate.
+//
+//	cache := irbis.NewRecordCache(&irbis.CacheOptions{TTL: time.Minute})
+//	cached := irbis.NewCachedConnection(connection, cache)
+//	record := cached.ReadRecord(123)
+//	fmt.Println(cache.Stats())
+//
+// Один кэш может использоваться несколькими подключениями
+// (например, из пула), каждое подключение -- только одной горутиной.
+type CachedConnection struct {
+	*Connection
+
+	// Cache Кэш.
+	Cache *RecordCache
+}
+
+// NewCachedConnection Подключение с кэшированием поверх указанного
+// (cache == nil -- новый кэш с параметрами по умолчанию).
+func NewCachedConnection(connection *Connection, cache *RecordCache) *CachedConnection {
+	if cache == nil {
+		cache = NewRecordCache(nil)
+	}
+	return &CachedConnection{Connection: connection, Cache: cache}
+}
+
+// succeeded Последняя операция на сервере выполнена успешно,
+// её результат можно поместить в кэш.
+func (cached *CachedConnection) succeeded() bool {
+	return cached.Connected && cached.LastError >= 0
+}
+
+//===================================================================
+
+// ReadRecord Чтение записи по её MFN (из кэша, если она там есть).
+// Выдаётся копия записи, которую можно изменять.
+func (cached *CachedConnection) ReadRecord(mfn int) *MarcRecord {
+	key := recordKey(cacheRecord, cached.Database, mfn, "")
+	value, generation, ok := cached.Cache.get(key)
+	if ok {
+		if cached.fresh(value.(*MarcRecord)) {
+			return value.(*MarcRecord).Clone()
+		}
+		generation = cached.Cache.stale()
+	}
+
+	result := cached.Connection.ReadRecord(mfn)
+	if result != nil && cached.succeeded() {
+		cached.Cache.put(key, result.Clone(), result.Version, generation)
+	}
+	return result
+}
+
+// fresh Проверка актуальности записи, найденной в кэше
+// (только при CacheOptions.Revalidate). Устаревшая запись
+// удаляется из кэша вместе с зависящими от неё данными.
+// Если проверка не удалась, запись также считается устаревшей.
+func (cached *CachedConnection) fresh(record *MarcRecord) bool {
+	if !cached.Cache.options.Revalidate {
+		return true
+	}
+
+	// Отсутствие следующей версии сервер сообщает отрицательным
+	// кодом, который не должен оставаться в LastError после
+	// успешного чтения из кэша.
+	lastError := cached.LastError
+	next, err := cached.readRecordVersion(cached.Database, record.Mfn, record.Version+1)
+	if err != nil {
+		return false
+	}
+	if next != nil {
+		cached.Cache.InvalidateRecord(cached.Database, record.Mfn)
+		return false
+	}
+	cached.LastError = lastError
+	return true
+}
+
+//===================================================================
+
+// FormatMfn Форматирование записи с указанным MFN.
+func (cached *CachedConnection) FormatMfn(format string, mfn int) string {
+	key := recordKey(cacheFormat, cached.Database, mfn, format)
+	value, generation, ok := cached.Cache.get(key)
+	if ok {
+		return value.(string)
+	}
+
+	result := cached.Connection.FormatMfn(format, mfn)
+	if cached.succeeded() {
+		cached.Cache.put(key, result, 0, generation)
+	}
+	return result
+}
+
+//===================================================================
+
+// SearchCount Определение количества записей, соответствующих
+// поисковому выражению.
+func (cached *CachedConnection) SearchCount(expression string) int {
+	key := recordKey(cacheCount, cached.Database, 0, expression)
+	value, generation, ok := cached.Cache.get(key)
+	if ok {
+		return value.(int)
+	}
+
+	result := cached.Connection.SearchCount(expression)
+	if cached.succeeded() {
+		cached.Cache.put(key, result, 0, generation)
+	}
+	return result
+}
+
+//===================================================================
+
+// ReadTextFile Чтение текстового файла с сервера.
+func (cached *CachedConnection) ReadTextFile(specification string) string {
+	key := fileKey(cacheText, specification)
+	value, generation, ok := cached.Cache.get(key)
+	if ok {
+		return value.(string)
+	}
+
+	result := cached.Connection.ReadTextFile(specification)
+	if cached.succeeded() {
+		cached.Cache.put(key, result, 0, generation)
+	}
+	return result
+}
+
+//===================================================================
+
+// ReadTextLines Чтение текстового файла в виде слайса строк.
+// Выдаётся копия слайса, которую можно изменять.
+func (cached *CachedConnection) ReadTextLines(specification string) []string {
+	key := fileKey(cacheLines, specification)
+	value, generation, ok := cached.Cache.get(key)
+	if !ok {
+		lines := cached.Connection.ReadTextLines(specification)
+		if !cached.succeeded() {
+			return lines
+		}
+		cached.Cache.put(key, lines, 0, generation)
+		value = lines
+	}
+
+	return append([]string(nil), value.([]string)...)
+}
+
+//===================================================================
+
+// ReadMenuFile Чтение MNU-файла с сервера.
+func (cached *CachedConnection) ReadMenuFile(specification string) *MenuFile {
+	if !cached.Connected {
+		return nil
+	}
+
+	lines := cached.ReadTextLines(specification)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	result := new(MenuFile)
+	result.Parse(lines)
+
+	return result
+}
+
+//===================================================================
+
+// WriteRecord Сохранение записи на сервере. Сохранённая
+// запись помещается в кэш.
+func (cached *CachedConnection) WriteRecord(record *MarcRecord) int {
+	database := PickOne(record.Database, cached.Database)
+	result := cached.Connection.WriteRecord(record)
+	if result != 0 && record.Mfn > 0 {
+		cached.Cache.InvalidateRecord(database, record.Mfn)
+		cached.Cache.update(recordKey(cacheRecord, database, record.Mfn, ""),
+			record.Clone(), record.Version)
+	}
+	return result
+}
+
+//===================================================================
+
+// WriteRecords Сохранение нескольких записей на сервере.
+// Сохранённые записи помещаются в кэш.
+func (cached *CachedConnection) WriteRecords(records []MarcRecord) bool {
+	if len(records) == 1 {
+		return cached.WriteRecord(&records[0]) != 0
+	}
+
+	databases := make([]string, len(records))
+	for i := range records {
+		databases[i] = PickOne(records[i].Database, cached.Database)
+	}
+	result := cached.Connection.WriteRecords(records)
+	for i := range records {
+		record := &records[i]
+		if record.Mfn <= 0 {
+			// Запись не сохранена, но могла быть сохранена частично
+			cached.Cache.InvalidateDatabase(databases[i])
+			continue
+		}
+		cached.Cache.InvalidateRecord(databases[i], record.Mfn)
+		if result {
+			cached.Cache.update(recordKey(cacheRecord, databases[i], record.Mfn, ""),
+				record.Clone(), record.Version)
+		}
+	}
+	return result
+}
+
+//===================================================================
+
+// DeleteRecord Удаление записи по её MFN. Запись перед удалением
+// считывается с сервера, а не из кэша, чтобы не сохранить
+// устаревшую версию.
+func (cached *CachedConnection) DeleteRecord(mfn int) {
+	record := cached.Connection.ReadRecord(mfn)
+	if record != nil && !record.IsDeleted() {
+		record.Status |= LOGICALLY_DELETED
+		cached.WriteRecord(record)
+	}
+}
+
+//===================================================================
+
+// UndeleteRecord Восстановление записи по её MFN.
+func (cached *CachedConnection) UndeleteRecord(mfn int) *MarcRecord {
+	if !cached.Connected {
+		return nil
+	}
+
+	record := cached.Connection.ReadRecord(mfn)
+	if record == nil {
+		return nil
+	}
+
+	if record.IsDeleted() {
+		record.Status &= 0xFFFE
+		if cached.WriteRecord(record) == 0 {
+			return nil
+		}
+	}
+
+	return record
+}
+
+//===================================================================
+
+// TruncateDatabase Опустошение указанной базы данных.
+func (cached *CachedConnection) TruncateDatabase(database string) bool {
+	result := cached.Connection.TruncateDatabase(database)
+	cached.Cache.InvalidateDatabase(database)
+	return result
+}
+
+//===================================================================
+
+// WriteTextFile Сохранение текстового файла на сервере.
+func (cached *CachedConnection) WriteTextFile(specification, text string) bool {
+	result := cached.Connection.WriteTextFile(specification, text)
+	cached.Cache.InvalidateFile(specification)
+	return result
+}
+
+//===================================================================
+
+// WriteIniFile Сохранение INI-файла на сервере.
+func (cached *CachedConnection) WriteIniFile(specification string, ini *IniFile) bool {
+	return cached.WriteTextFile(specification, ini.String())
+}
+
+//===================================================================
+
+// WriteMenuFile Сохранение MNU-файла на сервере.
+func (cached *CachedConnection) WriteMenuFile(specification string, menu *MenuFile) bool {
+	return cached.WriteTextFile(specification, menu.Encode())
+}
+
+//===================================================================
+
+// WriteRawRecord Сохранение на сервере "сырой" записи.
+func (cached *CachedConnection) WriteRawRecord(record *RawRecord) int {
+	database := PickOne(record.Database, cached.Database)
+	result := cached.Connection.WriteRawRecord(record)
+	cached.Cache.InvalidateRecord(database, record.Mfn)
+	return result
+}
+
+//===================================================================
+
+// WriteRecordsBatched Сохранение большого количества записей пакетами.
+// Из кэша удаляются данные всех баз, в которые сохранялись записи.
+func (cached *CachedConnection) WriteRecordsBatched(ctx context.Context, records []MarcRecord,
+	options *StreamOptions) []RecordWriteResult {
+	databases := make(map[string]bool)
+	for i := range records {
+		databases[PickOne(records[i].Database, cached.Database)] = true
+	}
+	result := cached.Connection.WriteRecordsBatched(ctx, records, options)
+	for database := range databases {
+		cached.Cache.InvalidateDatabase(database)
+	}
+	return result
+}
+
+//===================================================================
+
+// GlobalCorrection Глобальная корректировка.
+func (cached *CachedConnection) GlobalCorrection(settings *GblSettings) []string {
+	result := cached.Connection.GlobalCorrection(settings)
+	cached.Cache.InvalidateDatabase(PickOne(settings.Database, cached.Database))
+	return result
+}
+
+//===================================================================
+
+// GlobalCorrectionEx Глобальная корректировка с разбором протокола.
+func (cached *CachedConnection) GlobalCorrectionEx(settings *GblSettings) (*GblResult, error) {
+	result, err := cached.Connection.GlobalCorrectionEx(settings)
+	cached.Cache.InvalidateDatabase(PickOne(settings.Database, cached.Database))
+	return result, err
+}
+
+//===================================================================
+
+// GlobalCorrectionBatched Глобальная корректировка порциями.
+// Данные базы удаляются из кэша и при ошибке: часть порций
+// могла быть выполнена.
+func (cached *CachedConnection) GlobalCorrectionBatched(settings *GblSettings,
+	batchSize int, progress func(done, total int, batch *GblResult) bool) (*GblResult, error) {
+	result, err := cached.Connection.GlobalCorrectionBatched(settings, batchSize, progress)
+	cached.Cache.InvalidateDatabase(PickOne(settings.Database, cached.Database))
+	return result, err
+}
+
+//===================================================================
+
+// DeleteDatabase Удаление указанной базы данных.
+func (cached *CachedConnection) DeleteDatabase(database string) bool {
+	result := cached.Connection.DeleteDatabase(database)
+	cached.Cache.InvalidateDatabase(database)
+	return result
+}
+
+//===================================================================
+
+// DeleteFile Удаление на сервере указанного файла.
+func (cached *CachedConnection) DeleteFile(fileName string) {
+	cached.Connection.DeleteFile(fileName)
+	cached.Cache.InvalidateFile(fileName)
+}
+
+//===================================================================
+
+// RestoreDatabase Восстановление базы данных из резервной копии.
+// Восстанавливаются и записи, и текстовые файлы базы, поэтому
+// кэш очищается полностью.
+func (cached *CachedConnection) RestoreDatabase(database string, reader io.Reader,
+	options *RestoreOptions) (*BackupInfo, error) {
+	result, err := cached.Connection.RestoreDatabase(database, reader, options)
+	cached.Cache.Clear()
+	return result, err
+}
@@ -0,0 +1,204 @@
+package irbis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newCountingConnection Подключение с кэшированием к поддельной
+// базе данных, подсчитывающее обращения к серверу по командам.
+func newCountingConnection(database *fakeDatabase, counts map[string]int,
+	options *CacheOptions) *CachedConnection {
+	handler := func(command string, params []string) []string {
+		counts[command]++
+		if command == "A" {
+			return []string{"0", "5"}
+		}
+		if command == "C" && params[2] == "" {
+			// Последняя версия записи
+			mfn, _ := strconv.Atoi(params[1])
+			if mfn > 0 && mfn <= len(database.records) {
+				params[2] = strconv.Itoa(len(database.records[mfn-1]))
+			}
+		}
+		return database.handler(command, params)
+	}
+	connection := newFakeConnection(handler)
+	connection.Database = "IBIS"
+	return NewCachedConnection(connection, NewRecordCache(options))
+}
+
+func TestCachedConnection_ReadRecord_1(t *testing.T) {
+	counts := map[string]int{}
+	cached := newCountingConnection(newFakeDatabase(), counts, nil)
+
+	for i := 0; i < 3; i++ {
+		record := cached.ReadRecord(1)
+		if record == nil || record.Version != 3 || record.FSM(200, 'a') != "Title 1 v3" {
+			t.Fatal(record)
+		}
+		// Изменение выданной копии не затрагивает кэш
+		record.SetSubfield(200, 'a', "Changed")
+	}
+	if cached.ReadRecord(3) != nil || cached.ReadRecord(3) != nil {
+		t.FailNow()
+	}
+	if counts["C"] != 3 {
+		t.Fatal(counts)
+	}
+
+	// Сохранение через кэш: новая версия попадает в кэш
+	record := cached.ReadRecord(1)
+	record.SetSubfield(200, 'a', "Title 1 v4")
+	if cached.WriteRecord(record) == 0 || record.Version != 4 {
+		t.Fatal(record)
+	}
+	if actual := cached.ReadRecord(1); actual.Version != 4 || actual.FSM(200, 'a') != "Title 1 v4" {
+		t.Fatal(actual)
+	}
+	if counts["C"] != 3 {
+		t.Fatal(counts)
+	}
+
+	// Удаление читает запись с сервера, кэш обновляется
+	cached.DeleteRecord(4)
+	if actual := cached.ReadRecord(4); actual == nil || !actual.IsDeleted() || actual.Version != 2 {
+		t.Fatal(actual)
+	}
+	if counts["C"] != 4 || counts["D"] != 2 {
+		t.Fatal(counts)
+	}
+
+	stats := cached.Cache.Stats()
+	if stats.Hits != 5 || stats.Misses != 3 {
+		t.Fatal(stats)
+	}
+}
+
+func TestCachedConnection_ReadRecord_2(t *testing.T) {
+	counts := map[string]int{}
+	database := newFakeDatabase()
+	cached := newCountingConnection(database, counts, &CacheOptions{Revalidate: true})
+
+	// Запись не менялась: проверка без повторного чтения
+	for i := 0; i < 2; i++ {
+		if record := cached.ReadRecord(1); record == nil || record.Version != 3 {
+			t.Fatal(record)
+		}
+		if cached.LastError != 0 {
+			t.Fatal(cached.LastError)
+		}
+	}
+	if counts["C"] != 2 {
+		t.Fatal(counts)
+	}
+
+	// Запись изменена другим клиентом
+	changed := database.records[0][2].Clone()
+	changed.SetSubfield(200, 'a', "Changed")
+	database.save(changed)
+	for i := 0; i < 2; i++ {
+		if record := cached.ReadRecord(1); record == nil || record.Version != 4 ||
+			record.FSM(200, 'a') != "Changed" {
+			t.Fatal(record)
+		}
+	}
+	if counts["C"] != 5 {
+		t.Fatal(counts)
+	}
+
+	stats := cached.Cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Stale != 1 {
+		t.Fatal(stats)
+	}
+}
+
+func TestCachedConnection_SearchCount_1(t *testing.T) {
+	counts := map[string]int{}
+	cached := newCountingConnection(newFakeDatabase(), counts, nil)
+
+	for i := 0; i < 2; i++ {
+		if count := cached.SearchCount("K=Title"); count != 3 {
+			t.Fatal(count)
+		}
+		if text := cached.FormatMfn("@brief", 4); text == "" {
+			t.FailNow()
+		}
+		if text := cached.ReadTextFile("2.IBIS.brief.pft"); text != "v200^a\n" {
+			t.Fatal(text)
+		}
+	}
+	if counts["K"] != 1 || counts["G"] != 1 || counts["L"] != 1 {
+		t.Fatal(counts)
+	}
+
+	// Новая запись делает устаревшими результаты поиска
+	record := NewMarcRecord()
+	record.Add(200, "").Add('a', "Title 5")
+	cached.WriteRecord(record)
+	if count := cached.SearchCount("K=Title"); count != 4 {
+		t.Fatal(count)
+	}
+	cached.FormatMfn("@brief", 4)
+	if counts["K"] != 2 || counts["G"] != 1 {
+		t.Fatal(counts)
+	}
+
+	// Сохранение файла через кэш
+	if !cached.WriteTextFile("2.IBIS.brief.pft", "v200^a, v200^e") {
+		t.FailNow()
+	}
+	if text := strings.TrimSpace(cached.ReadTextFile("2.IBIS.brief.pft")); text != "v200^a, v200^e" {
+		t.Fatal(text)
+	}
+	if counts["L"] != 3 {
+		t.Fatal(counts)
+	}
+}
+
+func TestCachedConnection_Invalidate_1(t *testing.T) {
+	counts := map[string]int{}
+	cached := newCountingConnection(newFakeDatabase(), counts, nil)
+	fill := func() {
+		cached.ReadRecord(1)
+		cached.SearchCount("K=Title")
+		cached.ReadTextFile("2.IBIS.brief.pft")
+		if stats := cached.Cache.Stats(); stats.Entries != 3 {
+			t.Fatal(stats)
+		}
+	}
+
+	// Глобальная корректировка (в том числе неудачная)
+	fill()
+	if _, err := cached.GlobalCorrectionEx(&GblSettings{Database: "ibis"}); err == nil {
+		t.FailNow()
+	}
+	if stats := cached.Cache.Stats(); stats.Entries != 1 {
+		t.Fatal(stats)
+	}
+
+	fill()
+	record := NewMarcRecord()
+	record.Add(200, "").Add('a', "Title 5")
+	results := cached.WriteRecordsBatched(context.Background(), []MarcRecord{*record}, nil)
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if stats := cached.Cache.Stats(); stats.Entries != 1 {
+		t.Fatal(stats)
+	}
+
+	fill()
+	cached.DeleteDatabase("IBIS")
+	if stats := cached.Cache.Stats(); stats.Entries != 1 {
+		t.Fatal(stats)
+	}
+
+	fill()
+	cached.DeleteFile("2.ibis.BRIEF.pft")
+	if stats := cached.Cache.Stats(); stats.Entries != 2 {
+		t.Fatal(stats)
+	}
+}
@@ -7,11 +7,14 @@ import (
 // ClientQuery формирует клиентский запрос из запрашиваемых элементов (строк и их фрагментов).
 type ClientQuery struct {
 	chunks [][]byte
+	codec  Codec
+	err    error
 }
 
 // NewClientQuery формирует заголовок клиентского запроса.
 func NewClientQuery(connection *Connection, command string) *ClientQuery {
 	result := ClientQuery{}
+	result.codec = pickCodec(connection.Codec, Win1251Codec)
 	result.AddAnsi(command).NewLine()
 	result.AddAnsi(connection.Workstation).NewLine()
 	result.AddAnsi(command).NewLine()
@@ -30,9 +33,13 @@ func (query *ClientQuery) Add(value int) *ClientQuery {
 	return query.AddAnsi(strconv.Itoa(value))
 }
 
-// AddAnsi добавляет в запрос строку в кодировке ANSI.
+// AddAnsi добавляет в запрос строку в кодировке ANSI
+// (или в кодировке, заданной для подключения).
 func (query *ClientQuery) AddAnsi(text string) *ClientQuery {
-	buf := ToAnsi(text)
+	buf, err := pickCodec(query.codec, Win1251Codec).Encode(text)
+	if err != nil && query.err == nil {
+		query.err = err
+	}
 	query.chunks = append(query.chunks, buf)
 	return query
 }
@@ -78,6 +85,12 @@ func (query *ClientQuery) Encode() [][]byte {
 	return result
 }
 
+// Err выдаёт первую ошибку кодирования строк, возникшую
+// при формировании запроса (nil, если ошибок не было).
+func (query *ClientQuery) Err() error {
+	return query.err
+}
+
 // NewLine добавляет в запрос перевод строки (\n).
 func (query *ClientQuery) NewLine() *ClientQuery {
 	query.chunks = append(query.chunks, []byte{10})
@@ -0,0 +1,158 @@
+package irbis
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codec Кодировка текста: преобразование байтов в строку и обратно.
+type Codec interface {
+	// Name Имя кодировки, например, "windows-1251".
+	Name() string
+
+	// Decode Декодирование байтов в строку.
+	Decode(buffer []byte) (string, error)
+
+	// Encode Кодирование строки в байты.
+	Encode(text string) ([]byte, error)
+}
+
+// CodecReplacement Символ, которым заменяются непредставимые
+// в однобайтовой кодировке символы.
+const CodecReplacement = '?'
+
+// singleByteCodec Однобайтовая кодировка, заданная таблицей.
+type singleByteCodec struct {
+	name    string
+	table   *[256]rune
+	reverse map[rune]byte
+	strict  bool
+}
+
+// NewSingleByteCodec Создание однобайтовой кодировки по таблице
+// перекодировки в Unicode. В строгом режиме (strict) непредставимые
+// символы вызывают ошибку, иначе заменяются на '?'.
+func NewSingleByteCodec(name string, table *[256]rune, strict bool) Codec {
+	result := new(singleByteCodec)
+	result.name = name
+	result.table = table
+	result.strict = strict
+	result.reverse = make(map[rune]byte, 256)
+	for i := 255; i >= 0; i-- {
+		result.reverse[table[i]] = byte(i)
+	}
+	return result
+}
+
+func (codec *singleByteCodec) Name() string {
+	return codec.name
+}
+
+func (codec *singleByteCodec) Decode(buffer []byte) (string, error) {
+	result := strings.Builder{}
+	result.Grow(len(buffer))
+	for _, c := range buffer {
+		result.WriteRune(codec.table[c])
+	}
+	return result.String(), nil
+}
+
+func (codec *singleByteCodec) Encode(text string) ([]byte, error) {
+	result := make([]byte, 0, len(text))
+	for _, c := range text {
+		if c < 0x80 && codec.table[c] == c {
+			result = append(result, byte(c))
+			continue
+		}
+
+		b, ok := codec.reverse[c]
+		if !ok {
+			if codec.strict {
+				return result, errors.New("character " + strconv.QuoteRune(c) +
+					" can't be represented in " + codec.name)
+			}
+			b = CodecReplacement
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// utf8Codec Кодировка UTF-8.
+type utf8Codec struct {
+	strict bool
+}
+
+// NewUtf8Codec Создание кодировки UTF-8. В строгом режиме (strict)
+// некорректные последовательности байтов вызывают ошибку,
+// иначе заменяются на U+FFFD.
+func NewUtf8Codec(strict bool) Codec {
+	return &utf8Codec{strict: strict}
+}
+
+func (codec *utf8Codec) Name() string {
+	return "utf-8"
+}
+
+func (codec *utf8Codec) Decode(buffer []byte) (string, error) {
+	if utf8.Valid(buffer) {
+		return string(buffer), nil
+	}
+	if codec.strict {
+		return "", errors.New("invalid utf-8 sequence")
+	}
+
+	result := strings.Builder{}
+	result.Grow(len(buffer))
+	for len(buffer) != 0 {
+		c, size := utf8.DecodeRune(buffer)
+		result.WriteRune(c)
+		buffer = buffer[size:]
+	}
+	return result.String(), nil
+}
+
+func (codec *utf8Codec) Encode(text string) ([]byte, error) {
+	if codec.strict && !utf8.ValidString(text) {
+		return nil, errors.New("invalid utf-8 string")
+	}
+	return []byte(text), nil
+}
+
+// Стандартные кодировки (непредставимые символы заменяются).
+var (
+	Win1251Codec = NewSingleByteCodec("windows-1251", &_cp1251_to_unicode, false)
+	Cp866Codec   = NewSingleByteCodec("cp866", &_cp866_to_unicode, false)
+	Koi8rCodec   = NewSingleByteCodec("koi8-r", &_koi8r_to_unicode, false)
+	Utf8Codec    = NewUtf8Codec(false)
+)
+
+// FindCodec Поиск кодировки по имени (регистр символов не учитывается).
+// Если кодировка не найдена, возвращается nil.
+func FindCodec(name string, strict bool) Codec {
+	switch strings.Replace(strings.ToLower(strings.TrimSpace(name)), "_", "-", -1) {
+	case "windows-1251", "cp1251", "win1251", "ansi":
+		return NewSingleByteCodec("windows-1251", &_cp1251_to_unicode, strict)
+
+	case "cp866", "ibm866", "866", "dos":
+		return NewSingleByteCodec("cp866", &_cp866_to_unicode, strict)
+
+	case "koi8-r", "koi8r", "koi8":
+		return NewSingleByteCodec("koi8-r", &_koi8r_to_unicode, strict)
+
+	case "utf-8", "utf8":
+		return NewUtf8Codec(strict)
+	}
+
+	return nil
+}
+
+// pickCodec Выдаёт указанную кодировку либо кодировку по умолчанию.
+func pickCodec(codec, defaultCodec Codec) Codec {
+	if codec == nil {
+		return defaultCodec
+	}
+	return codec
+}
@@ -0,0 +1,200 @@
+package irbis
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCodec_1(t *testing.T) {
+	text := "Hello, Привет, Ёлка!"
+	codecs := []Codec{Win1251Codec, Cp866Codec, Koi8rCodec, Utf8Codec}
+	for _, codec := range codecs {
+		encoded, err := codec.Encode(text)
+		if err != nil {
+			t.Fatal(codec.Name(), err)
+		}
+		decoded, err := codec.Decode(encoded)
+		if err != nil || decoded != text {
+			t.Fatal(codec.Name(), decoded)
+		}
+	}
+}
+
+func TestCodec_2(t *testing.T) {
+	encoded, _ := Cp866Codec.Encode("Аа")
+	if !bytes.Equal(encoded, []byte{0x80, 0xA0}) {
+		t.FailNow()
+	}
+	encoded, _ = Koi8rCodec.Encode("Аа")
+	if !bytes.Equal(encoded, []byte{0xE1, 0xC1}) {
+		t.FailNow()
+	}
+	if !bytes.Equal(ToAnsi("Аа"), []byte{0xC0, 0xE0}) {
+		t.FailNow()
+	}
+}
+
+func TestCodec_3(t *testing.T) {
+	encoded, err := Win1251Codec.Encode("A€☺")
+	if err != nil || string(encoded) != "A\x88?" {
+		t.FailNow()
+	}
+	strict := FindCodec("CP1251", true)
+	if _, err = strict.Encode("A☺"); err == nil {
+		t.FailNow()
+	}
+	if _, err = NewUtf8Codec(true).Decode([]byte{0x41, 0xFF}); err == nil {
+		t.FailNow()
+	}
+	decoded, _ := Utf8Codec.Decode([]byte{0x41, 0xFF})
+	if decoded != "A�" {
+		t.FailNow()
+	}
+}
+
+func TestFindCodec_1(t *testing.T) {
+	if FindCodec("IBM866", false).Name() != "cp866" ||
+		FindCodec("koi8_r", false).Name() != "koi8-r" ||
+		FindCodec("UTF8", false).Name() != "utf-8" ||
+		FindCodec("ebcdic", false) != nil {
+		t.FailNow()
+	}
+}
+
+func TestIsoReader_1(t *testing.T) {
+	file, err := os.Open("../../data/test1.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := NewIsoReader(file, nil)
+	count := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(record.Fields) == 0 {
+			t.FailNow()
+		}
+		count++
+	}
+	if count != 81 {
+		t.Fatal(count)
+	}
+}
+
+func TestIsoWriter_1(t *testing.T) {
+	record := NewMarcRecord()
+	record.Add(1, "RU\\IBIS\\1")
+	record.Add(200, "").Add('a', "Заглавие").Add('e', "подзаголовок")
+	record.Add(300, "Примечание")
+
+	buffer := bytes.Buffer{}
+	writer := NewIsoWriter(&buffer, Koi8rCodec)
+	if err := writer.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(record); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewIsoReader(&buffer, Koi8rCodec)
+	for i := 0; i < 2; i++ {
+		clone, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clone.FM(1) != "RU\\IBIS\\1" ||
+			clone.FSM(200, 'e') != "подзаголовок" ||
+			clone.FM(300) != "Примечание" {
+			t.Fatal(clone.String())
+		}
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.FailNow()
+	}
+
+	record.Add(100, "☺")
+	if err := NewIsoWriter(&buffer, FindCodec("cp866", true)).Write(record); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestIsoWriter_2(t *testing.T) {
+	buffer := bytes.Buffer{}
+	writer := NewIsoWriter(&buffer, nil)
+
+	// Тело поля не помещается в 4 цифры справочника
+	record := NewMarcRecord()
+	record.Add(200, strings.Repeat("x", 12000))
+	if err := writer.Write(record); err == nil {
+		t.FailNow()
+	}
+
+	// Метка не помещается в 3 цифры
+	record = NewMarcRecord()
+	record.Add(1200, "Заглавие")
+	if err := writer.Write(record); err == nil {
+		t.FailNow()
+	}
+	record = NewMarcRecord()
+	record.Add(-1, "Заглавие")
+	if err := writer.Write(record); err == nil {
+		t.FailNow()
+	}
+	if buffer.Len() != 0 {
+		t.Fatal(buffer.Len())
+	}
+
+	// Граничные значения допустимы
+	record = NewMarcRecord()
+	record.Add(999, strings.Repeat("x", 9996))
+	if err := writer.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := NewIsoReader(&buffer, nil).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clone.FM(999)) != 9996 {
+		t.Fatal(len(clone.FM(999)))
+	}
+}
+
+func TestIsoReader_3(t *testing.T) {
+	record := NewMarcRecord()
+	record.Add(1, "RU\\IBIS\\1")
+	record.Add(200, "").Add('a', "Заглавие").Add('e', "подзаголовок")
+	buffer := bytes.Buffer{}
+	if err := NewIsoWriter(&buffer, nil).Write(record); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	// Усечённая запись
+	for length := 0; length < len(data)-1; length++ {
+		if _, err := decodeIsoRecord(data[:length], Win1251Codec.Decode); err == nil {
+			t.Fatal(length)
+		}
+	}
+
+	// Испорченные адрес данных и длины элементов справочника
+	for _, damage := range []struct {
+		offset int
+		value  string
+	}{{12, "99999"}, {12, "00025"}, {20, "0"}, {21, "X"}, {27, "9999"}} {
+		broken := append([]byte(nil), data...)
+		copy(broken[damage.offset:], damage.value)
+		if _, err := NewIsoReader(bytes.NewReader(broken), nil).Read(); err == nil {
+			t.Fatal(damage)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package irbis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CompactOptions Параметры сжатия базы данных.
+type CompactOptions struct {
+	// KeepVersions Количество сохраняемых версий каждой записи,
+	// включая последнюю (0 или 1 -- только последняя версия).
+	KeepVersions int
+
+	// Purge Физически удалять логически удалённые записи:
+	// они не переносятся в новый MST-файл, а в XRF-файле
+	// помечаются как физически удалённые.
+	Purge bool
+
+	// Progress Функция, вызываемая после обработки очередной
+	// записи. Если она возвращает false, сжатие прекращается,
+	// исходные файлы остаются без изменений.
+	Progress func(done, total int) bool
+}
+
+// CompactResult Итоги сжатия базы данных.
+type CompactResult struct {
+	MaxMfn   int   // Максимальный MFN.
+	Records  int   // Количество перенесённых записей.
+	Versions int   // Количество перенесённых предыдущих версий.
+	Dropped  int   // Количество отброшенных предыдущих версий.
+	Purged   int   // Количество физически удалённых записей.
+	OldSize  int64 // Размер MST-файла до сжатия.
+	NewSize  int64 // Размер MST-файла после сжатия.
+}
+
+// Reclaimed Количество освобождённых байт.
+func (result *CompactResult) Reclaimed() int64 {
+	return result.OldSize - result.NewSize
+}
+
+func (result *CompactResult) String() string {
+	return fmt.Sprintf("max MFN: %d, records: %d, versions: %d, dropped: %d, purged: %d, "+
+		"reclaimed: %d bytes (%d -> %d)", result.MaxMfn, result.Records, result.Versions,
+		result.Dropped, result.Purged, result.Reclaimed(), result.OldSize, result.NewSize)
+}
+
+var errCompactCancelled = errors.New("compaction cancelled")
+
+//===================================================================
+
+// readMstChain Чтение записи по указанному смещению и не более
+// count - 1 её предыдущих версий (в необработанном виде, начиная
+// с последней версии). Возвращает также общее количество версий.
+func readMstChain(file io.ReaderAt, offset, limit int64, mfn, count int) (result [][]byte, total int, err error) {
+	version := int32(-1)
+	visited := make(map[int64]bool)
+	for offset > 0 {
+		if visited[offset] {
+			return nil, 0, fmt.Errorf("MFN %d: version chain loops", mfn)
+		}
+		visited[offset] = true
+
+		leader, problem := readMstLeader(file, offset, limit)
+		if len(problem) == 0 && int(leader.Mfn) != mfn {
+			problem = fmt.Sprintf("record belongs to MFN %d", leader.Mfn)
+		}
+		if len(problem) == 0 && version >= 0 && leader.Version >= version {
+			problem = fmt.Sprintf("previous version %d is not less than %d", leader.Version, version)
+		}
+		if len(problem) != 0 {
+			return nil, 0, fmt.Errorf("MFN %d at offset %d: %s", mfn, offset, problem)
+		}
+
+		total++
+		if len(result) < count {
+			data := make([]byte, leader.Length)
+			if _, err = file.ReadAt(data, offset); err != nil {
+				return nil, 0, err
+			}
+			result = append(result, data)
+		}
+		version = leader.Version
+		offset = leader.PreviousOffset()
+	}
+	return
+}
+
+// finishCompaction Завершение сжатия, прерванного во время замены
+// файлов: если сохранились прежний MST-файл (".mst.bak") и новый
+// XRF-файл (".xrf.tmp"), новые файлы занимают место прежних.
+// В остальных случаях файлы базы данных согласованы и не меняются.
+func finishCompaction(mstName, xrfName string) error {
+	oldName, mstTemporary, xrfTemporary := mstName+".bak", mstName+".tmp", xrfName+".tmp"
+	if _, err := os.Stat(oldName); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(xrfTemporary); err != nil {
+		return nil
+	}
+
+	if _, err := os.Stat(mstTemporary); err == nil {
+		if err = os.Rename(mstTemporary, mstName); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(xrfTemporary, xrfName); err != nil {
+		return err
+	}
+	return os.Remove(oldName)
+}
+
+// CompactDatabase Сжатие базы данных (путь к файлам задаётся без
+// расширения): MST-файл переписывается заново, в него переносятся
+// только последние версии записей (либо KeepVersions версий),
+// логически удалённые записи по желанию удаляются физически.
+// MFN записей не меняются, поисковый словарь не затрагивается.
+// База данных не должна быть открыта.
+//
+// Новые файлы сначала полностью записываются под именами ".mst.tmp"
+// и ".xrf.tmp", затем прежний MST-файл переименовывается в ".mst.bak",
+// новые файлы занимают место прежних, и лишь после этого ".mst.bak"
+// удаляется. Сжатие, прерванное во время замены, завершается при
+// следующем открытии базы данных (OpenDatabase) либо при следующем
+// сжатии. Сжатие не выполняется, если файл ".mst.bak" уже есть.
+func CompactDatabase(filename string, options *CompactOptions) (*CompactResult, error) {
+	settings := CompactOptions{}
+	if options != nil {
+		settings = *options
+	}
+	if settings.KeepVersions < 1 {
+		settings.KeepVersions = 1
+	}
+
+	mstName, xrfName := filename+".mst", filename+".xrf"
+	if err := finishCompaction(mstName, xrfName); err != nil {
+		return nil, err
+	}
+	oldName := mstName + ".bak"
+	if _, err := os.Stat(oldName); err == nil {
+		return nil, errors.New(oldName + " already exists")
+	}
+
+	mst, err := os.Open(mstName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = mst.Close() }()
+	xrf, err := OpenXrfFile(xrfName)
+	if err != nil {
+		return nil, err
+	}
+	defer xrf.Close()
+
+	info, err := mst.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var control MstControlRecord
+	if err = binary.Read(mst, binary.BigEndian, &control); err != nil {
+		return nil, err
+	}
+	if control.Blocked != 0 {
+		return nil, errors.New("database is locked")
+	}
+	limit := control.NextPosition()
+	if limit < MstControlRecordSize || limit > info.Size() {
+		return nil, fmt.Errorf("free space offset %d is out of file size %d", limit, info.Size())
+	}
+
+	result := &CompactResult{MaxMfn: int(control.NextMfn) - 1, OldSize: info.Size()}
+	mstTemporary, xrfTemporary := mstName+".tmp", xrfName+".tmp"
+	target, err := CreateMstFile(mstTemporary)
+	if err != nil {
+		return nil, err
+	}
+	replacing := false
+	defer func() {
+		if !replacing {
+			target.Close()
+			_ = os.Remove(mstTemporary)
+			_ = os.Remove(xrfTemporary)
+		}
+	}()
+
+	references := bytes.Buffer{}
+	for mfn := 1; mfn <= result.MaxMfn; mfn++ {
+		reference, err := xrf.ReadRecord(mfn)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			reference = XrfRecord{Status: ABSENT}
+		} else if err != nil {
+			return nil, err
+		}
+
+		offset := reference.Offset()
+		switch {
+		case offset == 0 || reference.Status&(PHYSICALLY_DELETED|ABSENT) != 0:
+			reference = XrfRecord{Status: reference.Status}
+		case settings.Purge && reference.Status&LOGICALLY_DELETED != 0:
+			reference = XrfRecord{Status: PHYSICALLY_DELETED}
+			result.Purged++
+		default:
+			versions, total, err := readMstChain(mst, offset, limit, mfn, settings.KeepVersions)
+			if err != nil {
+				return nil, err
+			}
+
+			// Версии переносятся от старых к новым,
+			// чтобы ссылки на предыдущие версии были известны
+			previous := int64(0)
+			for i := len(versions) - 1; i >= 0; i-- {
+				data := versions[i]
+				var leader MstLeader
+				_ = binary.Read(bytes.NewReader(data), binary.BigEndian, &leader)
+				leader.SetPreviousOffset(previous)
+				header := bytes.Buffer{}
+				_ = binary.Write(&header, binary.BigEndian, &leader)
+				copy(data, header.Bytes())
+				if previous, err = target.appendRaw(data); err != nil {
+					return nil, err
+				}
+			}
+
+			reference = NewXrfRecord(previous, int(reference.Status))
+			result.Records++
+			result.Versions += len(versions) - 1
+			result.Dropped += total - len(versions)
+		}
+		_ = binary.Write(&references, binary.BigEndian, &reference)
+
+		if settings.Progress != nil && !settings.Progress(mfn, result.MaxMfn) {
+			return nil, errCompactCancelled
+		}
+	}
+
+	target.Control.NextMfn = control.NextMfn
+	target.Control.MftType = control.MftType
+	if err = target.WriteControlRecord(); err == nil {
+		err = target.file.Sync()
+	}
+	if err == nil {
+		err = writeFileSynced(xrfTemporary, references.Bytes())
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.NewSize = target.Control.NextPosition()
+
+	// Открытые файлы нельзя заменить в Windows
+	target.Close()
+	_ = mst.Close()
+	xrf.Close()
+	if err = os.Rename(mstName, oldName); err != nil {
+		return nil, err
+	}
+	// Начиная с этого момента прерванное сжатие
+	// завершает finishCompaction
+	replacing = true
+	if err = finishCompaction(mstName, xrfName); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,161 @@
+package irbis
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactDatabase_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := restoreFakeDatabase(t, dir)
+
+	// Прерванное сжатие не меняет файлы
+	before, _ := ioutil.ReadFile(filename + ".mst")
+	_, err = CompactDatabase(filename, &CompactOptions{Progress: func(done, total int) bool {
+		return done < 2
+	}})
+	if err == nil {
+		t.FailNow()
+	}
+	after, _ := ioutil.ReadFile(filename + ".mst")
+	if !bytes.Equal(before, after) {
+		t.Fatal("master file changed")
+	}
+
+	result, err := CompactDatabase(filename, &CompactOptions{KeepVersions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MaxMfn != 4 || result.Records != 3 || result.Versions != 1 || result.Dropped != 1 ||
+		result.Purged != 0 || result.Reclaimed() <= 0 {
+		t.Fatal(result)
+	}
+
+	access, err := OpenDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := access.Verify(nil)
+	if err != nil || !verified.Ok() || verified.Versions != 1 {
+		t.Fatal(verified, err)
+	}
+	records, err := NewDirectRecordSource(access).ReadRecords([]int{1, 2, 3, 4})
+	access.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Version != 3 || records[0].FSM(200, 'a') != "Title 1 v3" ||
+		!records[1].IsDeleted() || records[2].FSM(200, 'a') != "Title 4" {
+		t.Fatal(records)
+	}
+}
+
+func TestCompactDatabase_2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := restoreFakeDatabase(t, dir)
+
+	result, err := CompactDatabase(filename, &CompactOptions{Purge: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Records != 2 || result.Versions != 0 || result.Dropped != 2 || result.Purged != 1 {
+		t.Fatal(result)
+	}
+
+	access, err := OpenDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+	if access.GetMaxMfn() != 4 {
+		t.Fatal(access.GetMaxMfn())
+	}
+	verified, err := access.Verify(nil)
+	if err != nil || !verified.Ok() || verified.Records != 2 || verified.Absent != 2 {
+		t.Fatal(verified, err)
+	}
+	records, err := NewDirectRecordSource(access).ReadRecords([]int{1, 2, 3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Mfn != 1 || records[1].Mfn != 4 {
+		t.Fatal(records)
+	}
+}
+
+func TestCompactDatabase_3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := restoreFakeDatabase(t, dir)
+
+	// Новые файлы готовим сжатием копии базы данных
+	copyName := filepath.Join(dir, "copy")
+	for _, extension := range []string{".mst", ".xrf"} {
+		data, err := ioutil.ReadFile(filename + extension)
+		if err == nil {
+			err = ioutil.WriteFile(copyName+extension, data, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = CompactDatabase(copyName, nil); err != nil {
+		t.Fatal(err)
+	}
+	mst, _ := ioutil.ReadFile(copyName + ".mst")
+	xrf, _ := ioutil.ReadFile(copyName + ".xrf")
+
+	// Сжатие прервано после переименования прежнего MST-файла
+	if err = os.Rename(filename+".mst", filename+".mst.bak"); err != nil {
+		t.Fatal(err)
+	}
+	_ = ioutil.WriteFile(filename+".mst.tmp", mst, 0644)
+	_ = ioutil.WriteFile(filename+".xrf.tmp", xrf, 0644)
+
+	access, err := OpenDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := access.Verify(nil)
+	access.Close()
+	if err != nil || !verified.Ok() || verified.Records != 3 || verified.Versions != 0 {
+		t.Fatal(verified, err)
+	}
+	for _, extension := range []string{".mst.bak", ".mst.tmp", ".xrf.tmp"} {
+		if _, err = os.Stat(filename + extension); err == nil {
+			t.Fatal(extension)
+		}
+	}
+
+	// Сжатие прервано после замены MST-файла: завершается
+	// при следующем сжатии, которое затем выполняется как обычно
+	_ = ioutil.WriteFile(filename+".mst.bak", []byte("old"), 0644)
+	_ = ioutil.WriteFile(filename+".xrf.tmp", xrf, 0644)
+	result, err := CompactDatabase(filename, nil)
+	if err != nil || result.Records != 3 || result.Dropped != 0 {
+		t.Fatal(result, err)
+	}
+
+	// Посторонний файл .mst.bak не затирается
+	_ = ioutil.WriteFile(filename+".mst.bak", []byte("mine"), 0644)
+	if _, err = CompactDatabase(filename, nil); err == nil {
+		t.FailNow()
+	}
+	if data, _ := ioutil.ReadFile(filename + ".mst.bak"); string(data) != "mine" {
+		t.Fatal(data)
+	}
+}
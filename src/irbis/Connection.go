@@ -1,10 +1,15 @@
 package irbis
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Connection Подключение к серверу ИРБИС64.
@@ -50,6 +55,10 @@ type Connection struct {
 	// Ini Серверный INI-файл (становится доступен после подключения).
 	Ini *IniFile
 
+	// Codec Кодировка строк ANSI в запросах и ответах
+	// (nil -- Windows-1251).
+	Codec Codec
+
 	// socket Сокет.
 	socket ClientSocket
 
@@ -238,10 +247,18 @@ func (connection *Connection) Disconnect() bool {
 //===================================================================
 
 // Execute Отправка клиентского запроса на сервер
-// и получение ответа от него.
+// и получение ответа от него. После каждого обмена
+// номер запроса QueryId увеличивается на единицу.
 func (connection *Connection) Execute(query *ClientQuery) *ServerResponse {
 	connection.LastError = 0
+	if err := query.Err(); err != nil {
+		log.Println(err)
+		connection.LastError = -2222
+		return nil
+	}
+
 	result := connection.socket.TalkToServer(query)
+	connection.QueryId++
 	if result != nil {
 		result.connection = connection
 	}
@@ -492,6 +509,105 @@ func (connection *Connection) GlobalCorrection(settings *GblSettings) (result []
 		return
 	}
 
+	response := connection.executeGbl(settings, settings.MfnList)
+	if response == nil || !response.CheckReturnCode() {
+		return
+	}
+
+	result = response.ReadRemainingAnsiLines()
+	return
+}
+
+//===================================================================
+
+// GlobalCorrectionEx Глобальная корректировка с разбором протокола.
+// При сбое возвращается ошибка (как и у GlobalCorrectionBatched).
+func (connection *Connection) GlobalCorrectionEx(settings *GblSettings) (*GblResult, error) {
+	if !connection.Connected {
+		return nil, errors.New("not connected")
+	}
+
+	start := time.Now()
+	response := connection.executeGbl(settings, settings.MfnList)
+	if response == nil || !response.CheckReturnCode() {
+		return nil, fmt.Errorf("global correction: %s", DescribeError(connection.LastError))
+	}
+
+	result := new(GblResult)
+	result.Parse(response.ReadRemainingAnsiLines())
+	result.Elapsed = time.Since(start)
+
+	return result, nil
+}
+
+//===================================================================
+
+// GlobalCorrectionBatched Глобальная корректировка большого количества
+// записей порциями по batchSize штук. После каждой порции вызывается
+// функция progress (может быть nil), получающая количество обработанных
+// записей, их общее количество и результат обработки порции.
+// Если progress возвращает false, обработка прерывается.
+// При сбое очередной порции возвращается ошибка вместе с результатом
+// обработки порций, уже выполненных сервером.
+func (connection *Connection) GlobalCorrectionBatched(settings *GblSettings,
+	batchSize int, progress func(done, total int, batch *GblResult) bool) (*GblResult, error) {
+	if !connection.Connected {
+		return nil, errors.New("not connected")
+	}
+
+	mfnList := settings.MfnList
+	if len(mfnList) == 0 && settings.MaxMfn >= settings.MinMfn && settings.MinMfn > 0 {
+		for mfn := settings.MinMfn; mfn <= settings.MaxMfn; mfn++ {
+			mfnList = append(mfnList, mfn)
+		}
+	}
+
+	if len(mfnList) == 0 || batchSize <= 0 {
+		result, err := connection.GlobalCorrectionEx(settings)
+		if err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(result.Processed(), result.Processed(), result)
+		}
+		return result, nil
+	}
+
+	result := new(GblResult)
+	total := len(mfnList)
+	for done := 0; done < total; {
+		end := done + batchSize
+		if end > total {
+			end = total
+		}
+
+		start := time.Now()
+		response := connection.executeGbl(settings, mfnList[done:end])
+		if response == nil || !response.CheckReturnCode() {
+			return result, fmt.Errorf("global correction of records %d-%d of %d: %s",
+				done+1, end, total, DescribeError(connection.LastError))
+		}
+
+		batch := new(GblResult)
+		batch.Parse(response.ReadRemainingAnsiLines())
+		batch.Elapsed = time.Since(start)
+		result.Merge(batch)
+		done = end
+
+		if progress != nil && !progress(done, total, batch) {
+			result.Canceled = done < total
+			break
+		}
+	}
+
+	return result, nil
+}
+
+//===================================================================
+
+// executeGbl Отправка на сервер запроса на глобальную корректировку
+// указанных записей.
+func (connection *Connection) executeGbl(settings *GblSettings, mfnList []int) *ServerResponse {
 	database := PickOne(settings.Database, connection.Database)
 	query := NewClientQuery(connection, "5")
 	query.AddAnsi(database).NewLine()
@@ -514,15 +630,19 @@ func (connection *Connection) GlobalCorrection(settings *GblSettings) (result []
 	query.Add(settings.FirstRecord).NewLine()
 	query.Add(settings.NumberOfRecords).NewLine()
 
-	if len(settings.MfnList) == 0 {
-		count := settings.MaxMfn - settings.MinMfn + 1
-		query.Add(count).NewLine()
-		for mfn := settings.MinMfn; mfn < settings.MaxMfn; mfn++ {
-			query.Add(mfn).NewLine()
+	if len(mfnList) == 0 {
+		if settings.MinMfn > 0 && settings.MaxMfn >= settings.MinMfn {
+			count := settings.MaxMfn - settings.MinMfn + 1
+			query.Add(count).NewLine()
+			for mfn := settings.MinMfn; mfn <= settings.MaxMfn; mfn++ {
+				query.Add(mfn).NewLine()
+			}
+		} else {
+			query.Add(0).NewLine()
 		}
 	} else {
-		query.Add(len(settings.MfnList)).NewLine()
-		for _, mfn := range settings.MfnList {
+		query.Add(len(mfnList)).NewLine()
+		for _, mfn := range mfnList {
 			query.Add(mfn).NewLine()
 		}
 	}
@@ -535,13 +655,7 @@ func (connection *Connection) GlobalCorrection(settings *GblSettings) (result []
 		query.AddAnsi("&").NewLine()
 	}
 
-	response := connection.Execute(query)
-	if response == nil || !response.CheckReturnCode() {
-		return
-	}
-
-	result = response.ReadRemainingAnsiLines()
-	return
+	return connection.Execute(query)
 }
 
 //===================================================================
@@ -623,29 +737,13 @@ func (connection *Connection) ListTerms(prefix string) (result []string) {
 		return
 	}
 
-	prefixLength := len(prefix)
-	startTerm := prefix
-	lastTerm := startTerm
-	flag := true
-	for flag {
-		terms := connection.ReadTerms(startTerm, 512)
-		if len(terms) == 0 {
-			break
+	iterator := NewTermIterator(connection, &TermParameters{StartTerm: prefix})
+	iterator.Prefix = prefix
+	for iterator.Next() {
+		text := iterator.Term().Text
+		if text != prefix {
+			result = append(result, text[len(prefix):])
 		}
-		for _, term := range terms {
-			text := term.Text
-			if !strings.HasPrefix(text, prefix) {
-				flag = false
-				break
-			}
-			if text != startTerm {
-				lastTerm = text
-				text = text[prefixLength:]
-				result = append(result, text)
-			}
-		}
-
-		startTerm = lastTerm
 	}
 
 	return
@@ -712,6 +810,47 @@ func (connection *Connection) ParseConnectionString(connectionString string) {
 
 //===================================================================
 
+// PatchClientIni Изменение значения одного ключа в серверном
+// INI-файле текущего пользователя. Секция и ключ не должны быть
+// пустыми и не должны содержать переводов строки, квадратных скобок
+// и знака равенства (ключ). Если значение совпадает с известным
+// по Connection.Ini, запрос не отправляется. После успешного
+// обновления Connection.Ini также обновляется.
+func (connection *Connection) PatchClientIni(section, key, value string) bool {
+	if !connection.Connected {
+		return false
+	}
+
+	section, key = strings.TrimSpace(section), strings.TrimSpace(key)
+	if len(section) == 0 || len(key) == 0 ||
+		strings.ContainsAny(section, "[]\r\n") ||
+		strings.ContainsAny(key, "[]=;\r\n") ||
+		strings.ContainsAny(value, "\r\n") {
+		return false
+	}
+
+	if connection.Ini != nil {
+		current := connection.Ini.findKey(section, key)
+		if current != nil && current.Find(key).Value == value {
+			return true
+		}
+	}
+
+	lines := []string{"[" + section + "]", key + "=" + value}
+	if !connection.UpdateIniFile(lines) {
+		return false
+	}
+
+	if connection.Ini == nil {
+		connection.Ini = NewIniFile()
+	}
+	connection.Ini.SetValue(section, key, value)
+
+	return true
+}
+
+//===================================================================
+
 func (connection *Connection) PrintTable(definition *TableDefinition) (result string) {
 	if !connection.Connected {
 		return
@@ -821,8 +960,15 @@ func (connection *Connection) ReadParFile(specification string) (result *ParFile
 
 // ReadPostings Считывание постингов из поискового индекса.
 func (connection *Connection) ReadPostings(parameters *PostingParameters) (result []TermPosting) {
+	result, _ = connection.readPostings(parameters)
+	return
+}
+
+// readPostings Считывание постингов с выдачей ошибки
+// (используется в PostingIterator).
+func (connection *Connection) readPostings(parameters *PostingParameters) (result []TermPosting, err error) {
 	if !connection.Connected {
-		return
+		return nil, errors.New("not connected")
 	}
 
 	database := PickOne(parameters.Database, connection.Database)
@@ -842,7 +988,7 @@ func (connection *Connection) ReadPostings(parameters *PostingParameters) (resul
 
 	response := connection.Execute(query)
 	if response == nil || !response.CheckReturnCode() {
-		return
+		return nil, errors.New(DescribeError(connection.LastError))
 	}
 
 	lines := response.ReadRemainingUtfLines()
@@ -907,21 +1053,31 @@ func (connection *Connection) ReadRecordVersion(mfn, version int) *MarcRecord {
 		return nil
 	}
 
+	result, _ := connection.readRecordVersion(connection.Database, mfn, version)
+	return result
+}
+
+// readRecordVersion Чтение указанной версии записи из указанной базы.
+// Если версия не найдена, возвращается nil без ошибки.
+func (connection *Connection) readRecordVersion(database string, mfn, version int) (*MarcRecord, error) {
 	query := NewClientQuery(connection, "C")
-	query.AddAnsi(connection.Database).NewLine()
+	query.AddAnsi(database).NewLine()
 	query.Add(mfn).NewLine()
 	query.Add(version)
 	response := connection.Execute(query)
-	if response == nil || !response.CheckReturnCode() {
-		return nil
+	if response == nil {
+		return nil, errors.New(DescribeError(connection.LastError))
+	}
+	if !response.CheckReturnCode() {
+		return nil, nil
 	}
 
 	result := NewMarcRecord()
 	lines := response.ReadRemainingUtfLines()
 	result.Decode(lines)
-	result.Database = connection.Database
+	result.Database = database
 
-	return result
+	return result, nil
 }
 
 //===================================================================
@@ -941,8 +1097,15 @@ func (connection *Connection) ReadRecords(mfnList []int) (result []MarcRecord) {
 		return
 	}
 
+	result, _ = connection.readRecordsBatch(connection.Database, mfnList)
+	return
+}
+
+// readRecordsBatch Чтение нескольких записей одним запросом
+// с выдачей ошибки.
+func (connection *Connection) readRecordsBatch(database string, mfnList []int) (result []MarcRecord, err error) {
 	query := NewClientQuery(connection, "G")
-	query.AddAnsi(connection.Database).NewLine()
+	query.AddAnsi(database).NewLine()
 	query.AddAnsi(ALL_FORMAT).NewLine()
 	query.Add(len(mfnList)).NewLine()
 	for _, mfn := range mfnList {
@@ -951,7 +1114,7 @@ func (connection *Connection) ReadRecords(mfnList []int) (result []MarcRecord) {
 
 	response := connection.Execute(query)
 	if response == nil || !response.CheckReturnCode() {
-		return
+		return nil, errors.New(DescribeError(connection.LastError))
 	}
 
 	lines := response.ReadRemainingUtfLines()
@@ -964,9 +1127,15 @@ func (connection *Connection) ReadRecords(mfnList []int) (result []MarcRecord) {
 			continue
 		}
 		parts = strings.Split(parts[1], FirstDelimiter)[1:]
+		if len(parts) < 2 {
+			continue
+		}
+		for i := range parts {
+			parts[i] = strings.Trim(parts[i], SecondDelimiter)
+		}
 		record := NewMarcRecord()
-		record.Decode(lines)
-		record.Database = connection.Database
+		record.Decode(parts)
+		record.Database = database
 		result = append(result, *record)
 	}
 
@@ -975,14 +1144,15 @@ func (connection *Connection) ReadRecords(mfnList []int) (result []MarcRecord) {
 
 //===================================================================
 
-// ReadSearchScenario Загрузка сценариев поиска с сервера.
+// ReadSearchScenario Загрузка сценариев поиска с сервера
+// из SCH-файла либо из секции [SEARCH] INI-файла.
 func (connection *Connection) ReadSearchScenario(specification string) (result []SearchScenario) {
-	ini := connection.ReadIniFile(specification)
-	if ini == nil || len(ini.Sections) == 0 {
+	lines := connection.ReadTextLines(specification)
+	if len(lines) == 0 {
 		return
 	}
 
-	result = ParseScenarios(ini)
+	result = parseScenarioLines(specification, lines)
 	return
 }
 
@@ -998,8 +1168,15 @@ func (connection *Connection) ReadTerms(startTerm string, number int) []TermInfo
 
 // ReadTermsEx Получение терминов поискового словаря.
 func (connection *Connection) ReadTermsEx(parameters *TermParameters) (result []TermInfo) {
+	result, _ = connection.readTerms(parameters)
+	return
+}
+
+// readTerms Получение терминов поискового словаря
+// с выдачей ошибки (используется в TermIterator).
+func (connection *Connection) readTerms(parameters *TermParameters) (result []TermInfo, err error) {
 	if !connection.Connected {
-		return
+		return nil, errors.New("not connected")
 	}
 
 	command := "H"
@@ -1016,7 +1193,7 @@ func (connection *Connection) ReadTermsEx(parameters *TermParameters) (result []
 	query.AddAnsi(prepared).NewLine()
 	response := connection.Execute(query)
 	if response == nil || !response.CheckReturnCode(-202, -203, -204) {
-		return
+		return nil, errors.New(DescribeError(connection.LastError))
 	}
 
 	lines := response.ReadRemainingUtfLines()
@@ -1077,12 +1254,53 @@ func (connection *Connection) ReadTreeFile(specification string) (result *TreeFi
 	}
 
 	result = new(TreeFile)
-	result.Parse(lines)
+	if result.Parse(lines) != nil {
+		result = nil
+	}
 	return
 }
 
 //===================================================================
 
+// ReadWorksheet Чтение рабочего листа (WS или WSS) с сервера вместе
+// с подрабочими листами, на которые он ссылается. Подрабочие листы
+// ищутся там же, где и сам рабочий лист.
+func (connection *Connection) ReadWorksheet(specification string) *WsFile {
+	lines := connection.ReadTextLines(specification)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	parts := strings.SplitN(specification, ".", 3)
+	prefix := ""
+	if len(parts) == 3 {
+		prefix = parts[0] + "." + parts[1] + "."
+	}
+
+	result := &WsFile{Name: specification}
+	if strings.HasSuffix(strings.ToLower(specification), ".wss") {
+		if result.ParseWss(lines) != nil {
+			return nil
+		}
+		return result
+	}
+
+	if result.Parse(lines) != nil {
+		return nil
+	}
+
+	err := result.ResolveSubWorksheets(func(name string) []string {
+		return connection.ReadTextLines(prefix + name)
+	})
+	if err != nil {
+		log.Println(err)
+	}
+
+	return result
+}
+
+//===================================================================
+
 // ReloadDictionary Пересоздание словаря для указанной базы данных.
 func (connection *Connection) ReloadDictionary(database string) (result bool) {
 	return connection.ExecuteAnyCommand("Y", database)
@@ -1134,47 +1352,52 @@ func (connection *Connection) SearchAll(expression string) (result []int) {
 		return
 	}
 
-	firstRecord := 1
-	var totalCount int
+	result, _ = connection.searchAll(connection.Database, expression)
+	return
+}
 
+// searchAll Поиск всех записей в указанной базе данных
+// постраничными запросами.
+func (connection *Connection) searchAll(database, expression string) (result []int, err error) {
+	firstRecord := 1
 	for {
-		query := NewClientQuery(connection, "K")
-		query.AddAnsi(connection.Database).NewLine()
-		query.AddUtf(expression).NewLine()
-		query.Add(10000).NewLine()
-		query.Add(firstRecord).NewLine()
-
-		response := connection.Execute(query)
-		if response == nil || !response.CheckReturnCode() {
+		var totalCount int
+		var found []int
+		totalCount, found, err = connection.searchPage(database,
+			expression, firstRecord, 10000)
+		if err != nil || len(found) == 0 {
 			break
 		}
 
-		if firstRecord == 1 {
-			totalCount = response.ReadInteger()
-			if totalCount == 0 {
-				break
-			}
-		} else {
-			_ = response.ReadInteger()
-		}
-
-		lines := response.ReadRemainingUtfLines()
-		if len(lines) == 0 {
+		result = append(result, found...)
+		firstRecord += len(found)
+		if firstRecord > totalCount {
 			break
 		}
-		for _, line := range lines {
-			if len(line) != 0 {
-				mfn, _ := strconv.Atoi(line)
-				result = append(result, mfn)
-				firstRecord++
-			}
-		}
+	}
 
-		if firstRecord >= totalCount {
-			break
-		}
+	return
+}
+
+// searchPage Поиск с выдачей указанной порции найденных MFN
+// и общего количества найденных записей.
+func (connection *Connection) searchPage(database, expression string,
+	firstRecord, numberOfRecords int) (totalCount int, result []int, err error) {
+	query := NewClientQuery(connection, "K")
+	query.AddAnsi(database).NewLine()
+	query.AddUtf(expression).NewLine()
+	query.Add(numberOfRecords).NewLine()
+	query.Add(firstRecord).NewLine()
+
+	response := connection.Execute(query)
+	if response == nil || !response.CheckReturnCode() {
+		return 0, nil, errors.New(DescribeError(connection.LastError))
 	}
 
+	totalCount = response.ReadInteger()
+	lines := response.ReadRemainingUtfLines()
+	result = parseFoundMfn(lines)
+
 	return
 }
 
@@ -1275,6 +1498,27 @@ func (connection *Connection) SearchSingleRecord(expression string) *MarcRecord
 
 //===================================================================
 
+// SearchStream Поиск записей с потоковой выдачей найденных записей.
+// MFN запрашиваются порциями, записи считываются пакетами параллельно
+// (см. StreamOptions, nil -- параметры по умолчанию). По завершении
+// работы с потоком следует вызвать его метод Close.
+func (connection *Connection) SearchStream(ctx context.Context, expression string,
+	options *StreamOptions) *RecordStream {
+	ctx, cancel := context.WithCancel(ctx)
+	result := &RecordStream{records: make(chan *MarcRecord), cancel: cancel}
+	if !connection.Connected {
+		result.err = errors.New("not connected")
+		close(result.records)
+		cancel()
+		return result
+	}
+
+	go result.run(ctx, connection, expression, options.withDefaults())
+	return result
+}
+
+//===================================================================
+
 // ToConnectionString Выдача строки подключения для текущего соеденения
 // (соединение не обязательно должно быть установлено).
 func (connection *Connection) ToConnectionString() string {
@@ -1351,7 +1595,8 @@ func (connection *Connection) UnlockRecords(database string,
 //===================================================================
 
 // UpdateIniFile Обновление строк серверного INI-файла
-// для текущего пользователя.
+// для текущего пользователя. Строки передаются в формате INI-файла:
+// заголовок секции, за которым следуют строки "ключ=значение".
 func (connection *Connection) UpdateIniFile(lines []string) bool {
 	if !connection.Connected {
 		return false
@@ -1365,7 +1610,10 @@ func (connection *Connection) UpdateIniFile(lines []string) bool {
 	for _, line := range lines {
 		query.AddAnsi(line).NewLine()
 	}
-	connection.Execute(query)
+	response := connection.Execute(query)
+	if response == nil {
+		return false
+	}
 
 	return true
 }
@@ -1393,6 +1641,65 @@ func (connection *Connection) UpdateUserList(users []UserInfo) bool {
 
 //===================================================================
 
+// workerPool Пул подключений для параллельного выполнения запросов:
+// заданный в параметрах либо временный, подключения которого
+// регистрируются на сервере с теми же настройками, что и данное
+// (каждое со своим идентификатором клиента и номерами запросов).
+// Нестандартный транспорт (не Tcp4ClientSocket) может не допускать
+// одновременных обращений, поэтому с ним пул состоит из одного
+// подключения и запросы выполняются по очереди.
+// Функция release закрывает временный пул.
+func (connection *Connection) workerPool(options StreamOptions) (pool *ConnectionPool, release func()) {
+	if options.Pool != nil {
+		return options.Pool, func() {}
+	}
+
+	_, tcp := connection.socket.(*Tcp4ClientSocket)
+	size := options.Workers
+	if !tcp {
+		size = 1
+	}
+	pool = NewConnectionPool("", size)
+	pool.factory = func() *Connection {
+		result := NewConnection()
+		result.Host, result.Port = connection.Host, connection.Port
+		result.Username, result.Password = connection.Username, connection.Password
+		result.Database, result.Workstation = connection.Database, connection.Workstation
+		if !tcp {
+			result.socket = connection.socket
+		}
+		return result
+	}
+	return pool, pool.Close
+}
+
+// withWorker Выполнение действия с подключением из пула.
+func withWorker(ctx context.Context, pool *ConnectionPool, action func(worker *Connection) error) error {
+	worker, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer pool.Release(worker)
+	return action(worker)
+}
+
+//===================================================================
+
+// WriteIniFile Сохранение INI-файла на сервере
+// (с сохранением комментариев и порядка строк).
+func (connection *Connection) WriteIniFile(specification string, ini *IniFile) bool {
+	return connection.WriteTextFile(specification, ini.String())
+}
+
+//===================================================================
+
+// WriteMenuFile Сохранение MNU-файла на сервере.
+func (connection *Connection) WriteMenuFile(specification string, menu *MenuFile) bool {
+	return connection.WriteTextFile(specification, menu.Encode())
+}
+
+//===================================================================
+
 // WriteRawRecord Сохранение на сервере "сырой" записи.
 func (connection *Connection) WriteRawRecord(record *RawRecord) int {
 	if !connection.Connected {
@@ -1457,6 +1764,12 @@ func (connection *Connection) WriteRecords(records []MarcRecord) bool {
 		return connection.WriteRecord(&records[0]) != 0
 	}
 
+	return connection.writeRecordsBatch(records) == nil
+}
+
+// writeRecordsBatch Сохранение нескольких записей одним запросом
+// с выдачей ошибки. Записи обновляются по ответу сервера.
+func (connection *Connection) writeRecordsBatch(records []MarcRecord) error {
 	query := NewClientQuery(connection, "6")
 	query.Add(0).NewLine()
 	query.Add(1).NewLine()
@@ -1470,23 +1783,96 @@ func (connection *Connection) WriteRecords(records []MarcRecord) bool {
 	}
 
 	response := connection.Execute(query)
-	if response == nil {
-		return false
+	if response == nil || !response.CheckReturnCode() {
+		return errors.New(DescribeError(connection.LastError))
 	}
 
-	response.GetReturnCode()
-
 	lines := response.ReadRemainingUtfLines()
-	for i := 0; i < len(records); i++ {
+	for i := 0; i < len(records) && i < len(lines); i++ {
 		text := lines[i]
+		if len(text) == 0 {
+			continue
+		}
 		lines := IrbisToLines(text)
+		if len(lines) < 2 {
+			continue
+		}
 		record := &records[i]
 		record.Clear()
 		record.Decode(lines)
 		record.Database = PickOne(record.Database, connection.Database)
 	}
 
-	return true
+	return nil
+}
+
+//===================================================================
+
+// WriteRecordsBatched Сохранение большого количества записей пакетами
+// (см. StreamOptions, nil -- параметры по умолчанию). Записи обновляются
+// по ответу сервера. Возвращает результат для каждой записи.
+// При Workers > 1 новые записи получают MFN не в порядке следования.
+func (connection *Connection) WriteRecordsBatched(ctx context.Context, records []MarcRecord,
+	options *StreamOptions) []RecordWriteResult {
+	settings := options.withDefaults()
+	result := make([]RecordWriteResult, len(records))
+	for i := range result {
+		result[i].Index = i
+	}
+
+	if !connection.Connected {
+		for i := range result {
+			result[i].Err = errors.New("not connected")
+		}
+		return result
+	}
+
+	pool, release := connection.workerPool(settings)
+	defer release()
+
+	jobs := make(chan int)
+	wait := sync.WaitGroup{}
+	for i := 0; i < settings.Workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for start := range jobs {
+				stop := start + settings.BatchSize
+				if stop > len(records) {
+					stop = len(records)
+				}
+
+				err := ctx.Err()
+				if err == nil {
+					err = withWorker(ctx, pool, func(worker *Connection) error {
+						if stop-start > 1 {
+							return worker.writeRecordsBatch(records[start:stop])
+						}
+						if worker.WriteRecord(&records[start]) == 0 {
+							return errors.New(DescribeError(worker.LastError))
+						}
+						return nil
+					})
+				}
+
+				for j := start; j < stop; j++ {
+					result[j].Mfn = records[j].Mfn
+					result[j].Err = err
+					if err == nil && records[j].Mfn <= 0 {
+						result[j].Err = errRecordNotSaved
+					}
+				}
+			}
+		}()
+	}
+
+	for start := 0; start < len(records); start += settings.BatchSize {
+		jobs <- start
+	}
+	close(jobs)
+	wait.Wait()
+
+	return result
 }
 
 //===================================================================
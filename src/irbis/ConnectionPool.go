@@ -0,0 +1,140 @@
+package irbis
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultPoolSize Размер пула подключений по умолчанию.
+const DefaultPoolSize = 4
+
+var errPoolClosed = errors.New("connection pool is closed")
+
+// ServerError Ошибка подключения с кодом ИРБИС64
+// (значение Connection.LastError).
+type ServerError struct {
+	// Code Код ошибки (см. DescribeError).
+	Code int
+}
+
+func (err *ServerError) Error() string {
+	return DescribeError(err.Code)
+}
+
+// ConnectionPool Пул подключений к серверу ИРБИС64 с одинаковыми
+// настройками. Позволяет нескольким горутинам работать с сервером
+// одновременно, не превышая заданного количества подключений.
+//
+//	pool := irbis.NewConnectionPool("host=127.0.0.1;user=librarian;password=secret;", 4)
+//	defer pool.Close()
+//	connection, err := pool.Acquire(ctx)
+//	if err != nil { ... }
+//	defer pool.Release(connection)
+type ConnectionPool struct {
+	// ConnectionString Строка подключения (см. Connection.ParseConnectionString).
+	ConnectionString string
+
+	// Size Максимальное количество одновременных подключений.
+	Size int
+
+	slots   chan struct{}
+	idle    []*Connection
+	mutex   sync.Mutex
+	closed  bool
+	factory func() *Connection
+}
+
+// NewConnectionPool Конструктор: создаёт пул с указанными строкой
+// подключения и размером. Подключения устанавливаются по мере надобности.
+func NewConnectionPool(connectionString string, size int) *ConnectionPool {
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+
+	result := new(ConnectionPool)
+	result.ConnectionString = connectionString
+	result.Size = size
+	result.slots = make(chan struct{}, size)
+	result.factory = NewConnection
+	return result
+}
+
+// Acquire Получение подключения из пула. Если все подключения заняты,
+// ожидает освобождения одного из них (либо отмены контекста).
+// Полученное подключение необходимо вернуть с помощью Release.
+func (pool *ConnectionPool) Acquire(ctx context.Context) (*Connection, error) {
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		<-pool.slots
+		return nil, errPoolClosed
+	}
+	var result *Connection
+	if count := len(pool.idle); count != 0 {
+		result = pool.idle[count-1]
+		pool.idle = pool.idle[:count-1]
+	}
+	pool.mutex.Unlock()
+
+	if result == nil {
+		result = pool.factory()
+		result.ParseConnectionString(pool.ConnectionString)
+		if !result.Connect() {
+			<-pool.slots
+			if result.LastError < 0 {
+				return nil, &ServerError{Code: result.LastError}
+			}
+			return nil, errors.New("can't connect to " + result.Host)
+		}
+	}
+
+	return result, nil
+}
+
+// Release Возврат подключения в пул. Подключение, разорванное
+// вызывающим кодом, в пул не возвращается.
+func (pool *ConnectionPool) Release(connection *Connection) {
+	if connection == nil {
+		return
+	}
+
+	pool.mutex.Lock()
+	keep := !pool.closed && connection.Connected
+	if keep {
+		pool.idle = append(pool.idle, connection)
+	}
+	pool.mutex.Unlock()
+
+	if !keep {
+		connection.Disconnect()
+	}
+	<-pool.slots
+}
+
+// Close Закрытие пула: отключение простаивающих подключений.
+// Занятые подключения отключаются при их возврате в пул.
+func (pool *ConnectionPool) Close() {
+	pool.mutex.Lock()
+	idle := pool.idle
+	pool.idle = nil
+	pool.closed = true
+	pool.mutex.Unlock()
+
+	for _, connection := range idle {
+		connection.Disconnect()
+	}
+}
+
+// IdleCount Количество простаивающих подключений.
+func (pool *ConnectionPool) IdleCount() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return len(pool.idle)
+}
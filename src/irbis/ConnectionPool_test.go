@@ -0,0 +1,68 @@
+package irbis
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFakePool(size int, connects *int32) *ConnectionPool {
+	result := NewConnectionPool("host=fake;user=librarian;password=secret;", size)
+	result.factory = func() *Connection {
+		connection := newFakeConnection(func(command string, params []string) []string {
+			if command == "A" {
+				atomic.AddInt32(connects, 1)
+				return []string{"0", "5", "[MAIN]"}
+			}
+			return []string{"0"}
+		})
+		connection.Connected = false
+		return connection
+	}
+	return result
+}
+
+func TestConnectionPool_1(t *testing.T) {
+	var connects int32
+	pool := newFakePool(2, &connects)
+	first, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || first.Username != "librarian" || !first.Connected {
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = pool.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+
+	pool.Release(first)
+	if pool.IdleCount() != 1 {
+		t.FailNow()
+	}
+	third, err := pool.Acquire(context.Background())
+	if err != nil || third != first || atomic.LoadInt32(&connects) != 2 {
+		t.FailNow()
+	}
+
+	pool.Release(second)
+	pool.Close()
+	if pool.IdleCount() != 0 || second.Connected {
+		t.FailNow()
+	}
+	pool.Release(third)
+	if third.Connected {
+		t.FailNow()
+	}
+	if _, err = pool.Acquire(context.Background()); err != errPoolClosed {
+		t.Fatal(err)
+	}
+}
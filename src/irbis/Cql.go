@@ -0,0 +1,476 @@
+package irbis
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Коды диагностики SRU, возникающие при разборе
+// и трансляции запросов CQL.
+const (
+	CQL_SYNTAX_ERROR          = 10 // Синтаксическая ошибка в запросе.
+	CQL_UNSUPPORTED_INDEX     = 16 // Неподдерживаемый индекс.
+	CQL_UNSUPPORTED_RELATION  = 19 // Неподдерживаемое отношение.
+	CQL_UNSUPPORTED_MODIFIER  = 20 // Неподдерживаемый модификатор.
+	CQL_EMPTY_TERM            = 27 // Пустой термин.
+	CQL_UNSUPPORTED_MASKING   = 28 // Маскирование в середине или начале термина.
+	CQL_UNSUPPORTED_PROXIMITY = 39 // Операция близости не поддерживается.
+	CQL_UNSUPPORTED_SORT      = 80 // Сортировка не поддерживается.
+)
+
+// CqlError Ошибка разбора или трансляции запроса CQL.
+type CqlError struct {
+	// Diagnostic Код диагностики SRU (CQL_SYNTAX_ERROR и т. д.).
+	Diagnostic int
+
+	// Details Подробности (например, имя неподдерживаемого индекса).
+	Details string
+}
+
+func (err *CqlError) Error() string {
+	return "CQL error " + strconv.Itoa(err.Diagnostic) + ": " + err.Details
+}
+
+func cqlError(diagnostic int, details string) error {
+	return &CqlError{Diagnostic: diagnostic, Details: details}
+}
+
+// CqlNode Узел дерева разбора запроса CQL: либо логическая
+// операция над двумя подзапросами, либо поисковое условие.
+type CqlNode struct {
+	// Operator Логическая операция ("and", "or", "not")
+	// либо пустая строка для поискового условия.
+	Operator string
+
+	// Left, Right Операнды логической операции.
+	Left, Right *CqlNode
+
+	// Index Индекс (пустая строка -- cql.serverChoice).
+	Index string
+
+	// Relation Отношение ("=", "==", "any", "all" и т. д.).
+	Relation string
+
+	// Term Поисковый термин (без кавычек, экранирование сохраняется).
+	Term string
+}
+
+func (node *CqlNode) String() string {
+	if len(node.Operator) != 0 {
+		return "(" + node.Left.String() + " " + node.Operator + " " + node.Right.String() + ")"
+	}
+	term := strconv.Quote(node.Term)
+	if len(node.Index) == 0 {
+		return term
+	}
+	return node.Index + " " + node.Relation + " " + term
+}
+
+// cqlToken Лексема запроса CQL.
+type cqlToken struct {
+	text   string
+	quoted bool
+}
+
+// isWord Является ли лексема указанным (без учёта регистра)
+// ключевым словом.
+func (token cqlToken) isWord(words ...string) bool {
+	if token.quoted {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(token.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitCql(query string) (result []cqlToken, err error) {
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '(' || c == ')' || c == '/':
+			result = append(result, cqlToken{text: string(c)})
+			i++
+
+		case c == '=' || c == '<' || c == '>':
+			start := i
+			i++
+			if i < len(runes) && (runes[i] == '=' || (c == '<' && runes[i] == '>')) {
+				i++
+			}
+			result = append(result, cqlToken{text: string(runes[start:i])})
+
+		case c == '"':
+			var text strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					text.WriteRune(runes[i])
+					text.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, cqlError(CQL_SYNTAX_ERROR, "unterminated string")
+			}
+			result = append(result, cqlToken{text: text.String(), quoted: true})
+
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) &&
+				!strings.ContainsRune("()/=<>\"", runes[i]) {
+				i++
+			}
+			result = append(result, cqlToken{text: string(runes[start:i])})
+		}
+	}
+	return
+}
+
+// cqlParser Разбор запроса CQL методом рекурсивного спуска.
+type cqlParser struct {
+	tokens   []cqlToken
+	position int
+}
+
+func (parser *cqlParser) peek(offset int) (cqlToken, bool) {
+	index := parser.position + offset
+	if index >= len(parser.tokens) {
+		return cqlToken{}, false
+	}
+	return parser.tokens[index], true
+}
+
+func (parser *cqlParser) next() (cqlToken, bool) {
+	result, ok := parser.peek(0)
+	if ok {
+		parser.position++
+	}
+	return result, ok
+}
+
+// isSymbolicRelation Является ли лексема отношением
+// вида "=", "<>" и т. п.
+func isSymbolicRelation(token cqlToken) bool {
+	if token.quoted {
+		return false
+	}
+	switch token.text {
+	case "=", "==", "<>", "<", ">", "<=", ">=":
+		return true
+	}
+	return false
+}
+
+// isRelation Является ли лексема отношением.
+func isRelation(token cqlToken) bool {
+	return isSymbolicRelation(token) ||
+		token.isWord("exact", "any", "all", "adj", "within", "encloses", "scr")
+}
+
+func (parser *cqlParser) parseScoped() (*CqlNode, error) {
+	result, err := parser.parseClause()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := parser.peek(0)
+		if !ok || !token.isWord("and", "or", "not", "prox") {
+			return result, nil
+		}
+		parser.position++
+		if token.isWord("prox") {
+			return nil, cqlError(CQL_UNSUPPORTED_PROXIMITY, token.text)
+		}
+		if slash, ok := parser.peek(0); ok && !slash.quoted && slash.text == "/" {
+			return nil, cqlError(CQL_UNSUPPORTED_MODIFIER, token.text)
+		}
+
+		var right *CqlNode
+		right, err = parser.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		result = &CqlNode{Operator: strings.ToLower(token.text), Left: result, Right: right}
+	}
+}
+
+func (parser *cqlParser) parseClause() (*CqlNode, error) {
+	token, ok := parser.next()
+	if !ok {
+		return nil, cqlError(CQL_SYNTAX_ERROR, "unexpected end of query")
+	}
+
+	if !token.quoted && token.text == "(" {
+		result, err := parser.parseScoped()
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := parser.next()
+		if !ok || closing.quoted || closing.text != ")" {
+			return nil, cqlError(CQL_SYNTAX_ERROR, "missing closing parenthesis")
+		}
+		return result, nil
+	}
+
+	if !token.quoted && (token.text == ")" || token.text == "/" || isSymbolicRelation(token)) {
+		return nil, cqlError(CQL_SYNTAX_ERROR, "unexpected "+token.text)
+	}
+
+	if relation, ok := parser.peek(0); ok && isRelation(relation) {
+		term, ok := parser.peek(1)
+		if ok && !term.quoted && term.text == "/" {
+			return nil, cqlError(CQL_UNSUPPORTED_MODIFIER, relation.text)
+		}
+		if ok && (term.quoted || term.text != "(" && term.text != ")" && !isSymbolicRelation(term)) {
+			parser.position += 2
+			return &CqlNode{Index: token.text, Relation: strings.ToLower(relation.text),
+				Term: term.text}, nil
+		}
+		if isSymbolicRelation(relation) {
+			return nil, cqlError(CQL_SYNTAX_ERROR, "missing search term")
+		}
+	}
+
+	return &CqlNode{Relation: "=", Term: token.text}, nil
+}
+
+// ParseCql Разбор запроса на языке CQL (Contextual Query Language).
+// Поддерживаются поисковые условия вида "индекс отношение термин",
+// логические операции and, or, not и скобки.
+func ParseCql(query string) (*CqlNode, error) {
+	tokens, err := splitCql(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, cqlError(CQL_SYNTAX_ERROR, "empty query")
+	}
+
+	parser := &cqlParser{tokens: tokens}
+	result, err := parser.parseScoped()
+	if err != nil {
+		return nil, err
+	}
+
+	if token, ok := parser.peek(0); ok {
+		if token.isWord("sortBy") {
+			return nil, cqlError(CQL_UNSUPPORTED_SORT, token.text)
+		}
+		return nil, cqlError(CQL_SYNTAX_ERROR, "unexpected "+token.text)
+	}
+
+	return result, nil
+}
+
+// CqlIndexes Соответствие индексов CQL префиксам поискового
+// словаря ИРБИС (стандартная база IBIS). Пустой индекс
+// соответствует cql.serverChoice.
+var CqlIndexes = map[string]string{
+	"":                    KEYWORD_PREFIX,
+	"cql.serverchoice":    KEYWORD_PREFIX,
+	"cql.anywhere":        KEYWORD_PREFIX,
+	"cql.keywords":        KEYWORD_PREFIX,
+	"dc.anywhere":         KEYWORD_PREFIX,
+	"dc.title":            TITLE_PREFIX,
+	"dc.creator":          AUTHOR_PREFIX,
+	"dc.author":           AUTHOR_PREFIX,
+	"dc.contributor":      AUTHOR_PREFIX,
+	"dc.subject":          "S=",
+	"dc.publisher":        "O=",
+	"dc.date":             "G=",
+	"dc.language":         "J=",
+	"dc.type":             "V=",
+	"dc.identifier":       INVENTORY_PREFIX,
+	"bath.isbn":           "B=",
+	"bath.issn":           "B=",
+	"bath.name":           AUTHOR_PREFIX,
+	"bath.personalname":   AUTHOR_PREFIX,
+	"bath.corporatename":  COLLECTIVE_PREFIX,
+	"bath.conferencename": COLLECTIVE_PREFIX,
+	"bath.keyterm":        KEYWORD_PREFIX,
+	"bath.publisher":      "O=",
+	"bath.subject":        "S=",
+	"rec.id":              INDEX_PREFIX,
+	"title":               TITLE_PREFIX,
+	"author":              AUTHOR_PREFIX,
+	"creator":             AUTHOR_PREFIX,
+	"subject":             "S=",
+	"isbn":                "B=",
+	"keyword":             KEYWORD_PREFIX,
+}
+
+// CqlTranslator Трансляция запросов CQL в поисковые выражения ИРБИС.
+type CqlTranslator struct {
+	// Indexes Соответствие индексов CQL (в нижнем регистре)
+	// префиксам словаря.
+	Indexes map[string]string
+}
+
+// NewCqlTranslator Транслятор со стандартным набором индексов.
+func NewCqlTranslator() *CqlTranslator {
+	return &CqlTranslator{Indexes: CqlIndexes}
+}
+
+// Prefix Префикс словаря для индекса CQL.
+func (translator *CqlTranslator) Prefix(index string) (string, error) {
+	result, ok := translator.Indexes[strings.ToLower(index)]
+	if !ok {
+		return "", cqlError(CQL_UNSUPPORTED_INDEX, index)
+	}
+	return result, nil
+}
+
+// Translate Трансляция запроса CQL в поисковое выражение ИРБИС.
+func (translator *CqlTranslator) Translate(query string) (string, error) {
+	node, err := ParseCql(query)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := translator.translateNode(node)
+	if err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+func (translator *CqlTranslator) translateNode(node *CqlNode) (result Search, err error) {
+	if len(node.Operator) != 0 {
+		var left, right Search
+		if left, err = translator.translateNode(node.Left); err != nil {
+			return
+		}
+		if right, err = translator.translateNode(node.Right); err != nil {
+			return
+		}
+		switch node.Operator {
+		case "and":
+			result = left.And(right)
+		case "or":
+			result = left.Or(right)
+		default:
+			result = left.Not(right)
+		}
+		return
+	}
+
+	if strings.EqualFold(node.Index, "cql.allRecords") {
+		return All(), nil
+	}
+
+	var prefix string
+	if prefix, err = translator.Prefix(node.Index); err != nil {
+		return
+	}
+
+	relation := node.Relation
+	if relation == "=" || relation == "scr" || relation == "adj" {
+		// Для словаря ключевых слов многословный термин
+		// ищется по всем словам, для прочих -- целиком
+		relation = "=="
+		if prefix == KEYWORD_PREFIX {
+			relation = "all"
+		}
+	}
+
+	var terms []string
+	switch relation {
+	case "==", "exact", "<>":
+		terms = []string{node.Term}
+	case "any", "all":
+		terms = splitCqlWords(node.Term)
+	default:
+		return result, cqlError(CQL_UNSUPPORTED_RELATION, node.Relation)
+	}
+
+	items := make([]interface{}, 0, len(terms))
+	for _, term := range terms {
+		var text string
+		if text, err = irbisTerm(term); err != nil {
+			return
+		}
+		items = append(items, text)
+	}
+	if len(items) == 0 {
+		return result, cqlError(CQL_EMPTY_TERM, node.Index)
+	}
+
+	switch relation {
+	case "all":
+		result = Equals(prefix, items[0])
+		for _, item := range items[1:] {
+			result = result.And(Equals(prefix, item))
+		}
+	case "<>":
+		result = All().Not(Equals(prefix, items...))
+	default:
+		result = Equals(prefix, items...)
+	}
+
+	return
+}
+
+// splitCqlWords Разбиение термина на слова.
+func splitCqlWords(term string) []string {
+	return strings.Fields(term)
+}
+
+// irbisTerm Преобразование термина CQL в термин ИРБИС:
+// снятие экранирования, замена усечения "*" в конце на "$".
+func irbisTerm(term string) (string, error) {
+	var result strings.Builder
+	runes := []rune(strings.TrimSpace(term))
+	truncated := false
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\' && i+1 < len(runes):
+			i++
+			if runes[i] != '"' {
+				result.WriteRune(runes[i])
+			}
+		case c == '*' && i == len(runes)-1 && i != 0:
+			truncated = true
+		case c == '*' || c == '?' || c == '^':
+			return "", cqlError(CQL_UNSUPPORTED_MASKING, term)
+		case c == '"':
+			// Кавычки в термине ИРБИС не допускаются
+		default:
+			result.WriteRune(c)
+		}
+	}
+
+	text := strings.TrimSpace(result.String())
+	if len(text) == 0 {
+		return "", cqlError(CQL_EMPTY_TERM, term)
+	}
+	if truncated {
+		text += "$"
+	}
+	return text, nil
+}
+
+// CqlToIrbis Трансляция запроса CQL в поисковое выражение ИРБИС
+// со стандартным набором индексов (см. CqlIndexes).
+func CqlToIrbis(query string) (string, error) {
+	return NewCqlTranslator().Translate(query)
+}
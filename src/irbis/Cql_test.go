@@ -0,0 +1,64 @@
+package irbis
+
+import "testing"
+
+func TestCqlToIrbis_1(t *testing.T) {
+	cases := []struct{ cql, irbis string }{
+		{`dc.title = "война и мир"`, `"T=война и мир"`},
+		{`война and мир`, `(K=война * K=мир)`},
+		{`"война мир"`, `(K=война * K=мир)`},
+		{`dc.creator = пушкин*`, `A=пушкин$`},
+		{`bath.isbn any "5-01 5-02"`, `(B=5-01 + B=5-02)`},
+		{`(dc.title = a or dc.title = b) not dc.subject = c`, `((T=a + T=b) ^ S=c)`},
+		{`dc.title <> x`, `(I=$ ^ T=x)`},
+		{`DC.Title exact "a \"b\""`, `"T=a b"`},
+		{`cql.allRecords = 1`, `I=$`},
+		{`title all "a b c"`, `((T=a * T=b) * T=c)`},
+	}
+	for _, item := range cases {
+		result, err := CqlToIrbis(item.cql)
+		if err != nil {
+			t.Fatal(item.cql, err)
+		}
+		if result != item.irbis {
+			t.Fatal(item.cql, result)
+		}
+	}
+}
+
+func TestCqlToIrbis_2(t *testing.T) {
+	cases := []struct {
+		cql        string
+		diagnostic int
+	}{
+		{`dc.foo = x`, CQL_UNSUPPORTED_INDEX},
+		{`dc.title < x`, CQL_UNSUPPORTED_RELATION},
+		{`dc.title =/stem x`, CQL_UNSUPPORTED_MODIFIER},
+		{`a prox b`, CQL_UNSUPPORTED_PROXIMITY},
+		{`title = *ar`, CQL_UNSUPPORTED_MASKING},
+		{`dc.title = ""`, CQL_EMPTY_TERM},
+		{`(a`, CQL_SYNTAX_ERROR},
+		{`a )`, CQL_SYNTAX_ERROR},
+		{`dc.title =`, CQL_SYNTAX_ERROR},
+		{`"a`, CQL_SYNTAX_ERROR},
+		{``, CQL_SYNTAX_ERROR},
+		{`a sortBy dc.title`, CQL_UNSUPPORTED_SORT},
+	}
+	for _, item := range cases {
+		_, err := CqlToIrbis(item.cql)
+		cql, ok := err.(*CqlError)
+		if !ok || cql.Diagnostic != item.diagnostic {
+			t.Fatal(item.cql, err)
+		}
+	}
+}
+
+func TestParseCql_1(t *testing.T) {
+	node, err := ParseCql(`dc.title any war and (peace or "a b")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.String() != `(dc.title any "war" and ("peace" or "a b"))` {
+		t.Fatal(node.String())
+	}
+}
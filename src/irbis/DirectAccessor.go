@@ -1,30 +1,60 @@
 package irbis
 
+import (
+	"path/filepath"
+	"strings"
+)
+
 // DirectAccess осуществляет прямой доступ к базам данных.
 type DirectAccess struct {
 	mst      *MstFile
 	xrf      *XrfFile
 	ifp      *IfpFile
 	filename string
+	location *DatabaseLocation
 }
 
 // OpenDatabase открывает базу данных для чтения.
+// Указывается путь к файлам базы без расширения, например, "data/ibis".
+// Сжатие базы данных, прерванное во время замены файлов, при открытии
+// завершается (см. CompactDatabase).
 func OpenDatabase(filename string) (result *DirectAccess, err error) {
+	return openDatabaseAt(newDatabaseLocation(filename))
+}
+
+// OpenDatabaseByName открывает базу данных для чтения,
+// определяя расположение её файлов по PAR-файлу
+// в системном каталоге root.
+func OpenDatabaseByName(root, database string) (result *DirectAccess, err error) {
+	var location *DatabaseLocation
+	location, err = LocateDatabase(root, database)
+	if err != nil {
+		return
+	}
+
+	return openDatabaseAt(location)
+}
+
+func openDatabaseAt(location *DatabaseLocation) (result *DirectAccess, err error) {
+	if err = finishCompaction(location.Mst, location.Xrf); err != nil {
+		return
+	}
+
 	var mst *MstFile
-	mst, err = OpenMstFile(filename + ".mst")
+	mst, err = OpenMstFile(location.Mst)
 	if err != nil {
 		return
 	}
 
 	var xrf *XrfFile
-	xrf, err = OpenXrfFile(filename + ".xrf")
+	xrf, err = OpenXrfFile(location.Xrf)
 	if err != nil {
 		mst.Close()
 		return
 	}
 
 	var ifp *IfpFile
-	ifp, err = OpenIfpFile(filename)
+	ifp, err = OpenIfpFiles(location.Ifp, location.L01, location.N01)
 	if err != nil {
 		mst.Close()
 		xrf.Close()
@@ -32,10 +62,11 @@ func OpenDatabase(filename string) (result *DirectAccess, err error) {
 	}
 
 	result = new(DirectAccess)
-	result.filename = filename
+	result.filename = strings.TrimSuffix(location.Mst, filepath.Ext(location.Mst))
 	result.mst = mst
 	result.xrf = xrf
 	result.ifp = ifp
+	result.location = location
 
 	return
 }
@@ -47,12 +78,62 @@ func (access *DirectAccess) Close() {
 	access.ifp.Close()
 }
 
+// SetCodec задаёт кодировку текста полей записей
+// (nil -- без перекодировки). Для автоматического определения
+// кодировки каждой записи следует передать AutoCodec.
+func (access *DirectAccess) SetCodec(codec Codec) {
+	access.mst.Codec = codec
+}
+
+// SetAutoDetect включает (или выключает) автоматическое
+// определение кодировки записей.
+func (access *DirectAccess) SetAutoDetect(enabled bool) {
+	if enabled {
+		access.mst.Codec = NewAutoCodec(nil)
+	} else {
+		access.mst.Codec = nil
+	}
+}
+
+// SetMemoryMap включает (или выключает) отображение MST- и XRF-файлов
+// в память. Если платформа этого не поддерживает, возвращается ошибка,
+// а файлы по-прежнему читаются обычным образом. Метод нельзя вызывать
+// одновременно с чтением записей.
+func (access *DirectAccess) SetMemoryMap(enabled bool) error {
+	if !enabled {
+		access.mst.unmapMemory()
+		access.xrf.unmapMemory()
+		return nil
+	}
+
+	if err := access.mst.mapMemory(); err != nil {
+		return err
+	}
+	if err := access.xrf.mapMemory(); err != nil {
+		access.mst.unmapMemory()
+		return err
+	}
+	return nil
+}
+
+// Files выдаёт поставщика файлов базы данных
+// (рабочих листов, меню, FST и т. п.).
+func (access *DirectAccess) Files() FileProvider {
+	return access.location
+}
+
+// Location выдаёт расположение файлов базы данных.
+func (access *DirectAccess) Location() *DatabaseLocation {
+	return access.location
+}
+
 // GetMaxMfn получает максимальный MFN для данной базы.
 func (access *DirectAccess) GetMaxMfn() int {
 	return int(access.mst.Control.NextMfn - 1)
 }
 
-// ReadRawRecord считывает запись в сыром виде
+// ReadRawRecord считывает запись в сыром виде. Чтение записей
+// безопасно при одновременном обращении из нескольких горутин.
 func (access *DirectAccess) ReadRawRecord(mfn int) (result *MstRecord, err error) {
 	var xrf XrfRecord
 	xrf, err = access.xrf.ReadRecord(mfn)
@@ -79,3 +160,109 @@ func (access *DirectAccess) ReadRecord(mfn int) (result *MarcRecord, err error)
 	result = mst.Decode()
 	return
 }
+
+// ReadTerms считывает термины поискового словаря
+// (формат, указанный в параметрах, не используется).
+func (access *DirectAccess) ReadTerms(parameters *TermParameters) ([]TermInfo, error) {
+	return access.ifp.ReadTerms(parameters.StartTerm, parameters.NumberOfTerms,
+		parameters.ReverseOrder)
+}
+
+// ReadPostings считывает постинги термина или списка терминов
+// (формат, указанный в параметрах, не используется).
+func (access *DirectAccess) ReadPostings(parameters *PostingParameters) ([]TermPosting, error) {
+	return access.newPostingCursor(parameters).readPage(parameters)
+}
+
+// postingCursor Позиция в цепочках блоков IFP при постраничном
+// чтении постингов, чтобы очередная страница читалась с того
+// места, где закончилась предыдущая.
+type postingCursor struct {
+	access   *DirectAccess
+	terms    []string
+	term     int         // Индекс следующего термина.
+	links    *linkCursor // Ссылки текущего термина (nil -- термин не открыт).
+	position int         // Номер (с 1) следующего постинга.
+}
+
+func (access *DirectAccess) newPostingCursor(parameters *PostingParameters) *postingCursor {
+	terms := parameters.ListOfTerms
+	if len(terms) == 0 {
+		terms = []string{parameters.Term}
+	}
+	return &postingCursor{access: access, terms: terms, position: 1}
+}
+
+// current Курсор ссылок текущего термина либо nil,
+// если термины закончились.
+func (postings *postingCursor) current() (*linkCursor, error) {
+	for postings.links == nil && postings.term < len(postings.terms) {
+		offset, err := postings.access.ifp.findTerm(postings.terms[postings.term])
+		if err != nil {
+			return nil, err
+		}
+		postings.term++
+		if offset >= 0 {
+			postings.links = postings.access.ifp.newLinkCursor(offset)
+		}
+	}
+	return postings.links, nil
+}
+
+// readPage Чтение страницы постингов, начиная с parameters.FirstPosting.
+// Если страница следует за предыдущей, пройденные блоки не перечитываются.
+func (postings *postingCursor) readPage(parameters *PostingParameters) (result []TermPosting, err error) {
+	first := parameters.FirstPosting
+	if first < 1 {
+		first = 1
+	}
+	if first < postings.position {
+		// Возврат назад: начинаем с первого термина
+		postings.term, postings.links, postings.position = 0, nil, 1
+	}
+
+	for postings.position < first {
+		links, err := postings.current()
+		if err != nil || links == nil {
+			return nil, err
+		}
+		rest, err := links.skip(first - postings.position)
+		if err != nil {
+			return nil, err
+		}
+		postings.position = first - rest
+		if rest != 0 {
+			postings.links = nil
+		}
+	}
+
+	count := parameters.NumberOfPostings
+	for count <= 0 || len(result) < count {
+		links, err := postings.current()
+		if err != nil {
+			return nil, err
+		}
+		if links == nil {
+			break
+		}
+
+		wanted := 0
+		if count > 0 {
+			wanted = count - len(result)
+		}
+		page, err := links.read(wanted)
+		if err != nil {
+			return nil, err
+		}
+		if wanted == 0 || len(page) < wanted {
+			postings.links = nil
+		}
+		for _, link := range page {
+			result = append(result, TermPosting{Mfn: int(link.Mfn), Tag: int(link.Tag),
+				Occurrence: int(link.Occurrence), Count: int(link.Index)})
+		}
+		postings.position += len(page)
+	}
+
+	return
+}
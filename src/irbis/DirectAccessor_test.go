@@ -0,0 +1,117 @@
+package irbis
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDirectAccess_ReadRecord_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	access, err := OpenDatabase(restoreFakeDatabase(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+
+	expected := map[int]string{1: "Title 1 v3", 2: "Title 2", 4: "Title 4"}
+	for _, memoryMap := range []bool{false, true} {
+		if err = access.SetMemoryMap(memoryMap); err != nil {
+			t.Fatal(err)
+		}
+
+		// Одновременное чтение из нескольких горутин
+		var group sync.WaitGroup
+		failures := make(chan string, 8)
+		for i := 0; i < 8; i++ {
+			group.Add(1)
+			go func(seed int) {
+				defer group.Done()
+				for j := 0; j < 100; j++ {
+					mfn := []int{1, 2, 4}[(seed+j)%3]
+					record, err := access.ReadRecord(mfn)
+					if err != nil {
+						failures <- err.Error()
+						return
+					}
+					if record.Mfn != mfn || record.FSM(200, 'a') != expected[mfn] {
+						failures <- record.String()
+						return
+					}
+				}
+			}(i)
+		}
+		group.Wait()
+		close(failures)
+		for failure := range failures {
+			t.Fatal(failure)
+		}
+
+		// Физически удалённая запись и запись за пределами XRF
+		if _, err = access.ReadRecord(3); err == nil {
+			t.FailNow()
+		}
+		if _, err = access.ReadRecord(100); err == nil {
+			t.FailNow()
+		}
+	}
+}
+
+func TestDirectAccess_ReadRecord_2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := restoreFakeDatabase(t, dir)
+
+	access, err := OpenDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xrf, err := access.xrf.ReadRecord(4)
+	access.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Испорченные длина записи и смещение полей
+	for _, field := range []struct {
+		offset int64
+		value  uint32
+	}{{4, 0x7FFFFFF0}, {16, 20}} {
+		mst, err := os.OpenFile(filename+".mst", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer := make([]byte, 4)
+		_, _ = mst.ReadAt(buffer, xrf.Offset()+field.offset)
+		saved := append([]byte(nil), buffer...)
+		binary.BigEndian.PutUint32(buffer, field.value)
+		_, err = mst.WriteAt(buffer, xrf.Offset()+field.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		access, err := OpenDatabase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = access.ReadRecord(4); err == nil {
+			t.Fatal(field)
+		}
+		if _, err = access.ReadRecord(1); err != nil {
+			t.Fatal(err)
+		}
+		access.Close()
+
+		_, _ = mst.WriteAt(saved, xrf.Offset()+field.offset)
+		_ = mst.Close()
+	}
+}
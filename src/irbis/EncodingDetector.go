@@ -0,0 +1,154 @@
+package irbis
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Частоты букв русского языка (на тысячу букв).
+var _russianFrequencies = map[rune]float64{
+	'о': 109.7, 'е': 84.5, 'а': 80.1, 'и': 73.5, 'н': 67.0, 'т': 63.2,
+	'с': 54.7, 'р': 47.3, 'в': 45.4, 'л': 44.0, 'к': 34.9, 'м': 32.1,
+	'д': 29.8, 'п': 28.1, 'у': 26.2, 'я': 20.1, 'ы': 19.0, 'ь': 17.4,
+	'г': 17.0, 'з': 16.5, 'б': 15.9, 'ч': 14.4, 'й': 12.1, 'х': 9.7,
+	'ж': 9.4, 'ш': 7.3, 'ю': 6.4, 'ц': 4.8, 'щ': 3.6, 'э': 3.2,
+	'ф': 2.6, 'ъ': 0.4, 'ё': 0.4,
+}
+
+// Штрафы и веса, используемые при оценке однобайтовых кодировок.
+const (
+	detectUpperWeight     = 0.25 // Вес заглавной буквы относительно строчной.
+	detectForeignRune     = -20  // Штраф за символ, не являющийся русской буквой.
+	detectCaseFlipPenalty = -50  // Штраф за заглавную букву после строчной.
+)
+
+// _detectCandidates Однобайтовые кодировки, среди которых ведётся выбор.
+var _detectCandidates = []Codec{Win1251Codec, Cp866Codec, Koi8rCodec}
+
+// DetectEncoding Определение кодировки текста по образцу (полю или записи
+// целиком). Различаются UTF-8, Windows-1251, CP866 и KOI8-R.
+// Возвращается наиболее вероятная кодировка и уверенность в ней
+// (от 0 до 1). Для образца, состоящего только из ASCII-символов,
+// возвращается Windows-1251 с уверенностью 1, т. к. все кодировки
+// декодируют его одинаково.
+func DetectEncoding(sample []byte) (codec Codec, confidence float64) {
+	multibyte, ascii := 0, true
+	for _, b := range sample {
+		if b >= 0x80 {
+			ascii = false
+			if b >= 0xC0 {
+				multibyte++
+			}
+		}
+	}
+	if ascii {
+		return Win1251Codec, 1
+	}
+
+	if utf8.Valid(sample) {
+		// Случайный однобайтовый текст крайне редко оказывается
+		// корректным UTF-8, особенно при нескольких многобайтовых
+		// последовательностях.
+		return Utf8Codec, 1 - math.Pow(0.2, float64(multibyte))
+	}
+
+	best, second := math.Inf(-1), math.Inf(-1)
+	for _, candidate := range _detectCandidates {
+		score := scoreSingleByte(sample, candidate.(*singleByteCodec).table)
+		if score > best {
+			best, second = score, best
+			codec = candidate
+		} else if score > second {
+			second = score
+		}
+	}
+
+	if best <= 0 {
+		return codec, 0
+	}
+	confidence = (best - math.Max(second, 0)) / best
+	return
+}
+
+// scoreSingleByte Оценка правдоподобия того, что образец представляет
+// собой русский текст в кодировке, заданной таблицей.
+func scoreSingleByte(sample []byte, table *[256]rune) (result float64) {
+	previousLower := false
+	for _, b := range sample {
+		c := table[b]
+		if b < 0x80 {
+			previousLower = false
+			continue
+		}
+
+		lower := unicode.ToLower(c)
+		frequency, russian := _russianFrequencies[lower]
+		if !russian {
+			result += detectForeignRune
+			previousLower = false
+			continue
+		}
+
+		if lower == c {
+			result += frequency
+			previousLower = true
+		} else {
+			result += frequency * detectUpperWeight
+			if previousLower {
+				result += detectCaseFlipPenalty
+			}
+			previousLower = false
+		}
+	}
+
+	return
+}
+
+// AutoCodec Кодировка, определяемая автоматически по декодируемым
+// данным. Если уверенность в определении ниже MinConfidence,
+// используется Fallback. Кодирование всегда выполняется в Fallback.
+type AutoCodec struct {
+	// Fallback Кодировка по умолчанию.
+	Fallback Codec
+
+	// MinConfidence Минимальная уверенность, при которой
+	// принимается результат определения.
+	MinConfidence float64
+}
+
+// NewAutoCodec Создание автоматически определяемой кодировки
+// (nil -- по умолчанию Windows-1251).
+func NewAutoCodec(fallback Codec) *AutoCodec {
+	return &AutoCodec{Fallback: pickCodec(fallback, Win1251Codec), MinConfidence: 0.3}
+}
+
+// Detect Выбор кодировки для указанного образца.
+func (codec *AutoCodec) Detect(sample []byte) Codec {
+	detected, confidence := DetectEncoding(sample)
+	if detected == nil || confidence < codec.MinConfidence {
+		return codec.Fallback
+	}
+	return detected
+}
+
+func (codec *AutoCodec) Name() string {
+	return "auto"
+}
+
+func (codec *AutoCodec) Decode(buffer []byte) (string, error) {
+	return codec.Detect(buffer).Decode(buffer)
+}
+
+func (codec *AutoCodec) Encode(text string) ([]byte, error) {
+	return codec.Fallback.Encode(text)
+}
+
+// resolveCodec Если кодировка определяется автоматически,
+// выбирает конкретную кодировку по образцу.
+func resolveCodec(codec Codec, sample []byte) Codec {
+	if auto, ok := codec.(*AutoCodec); ok {
+		return auto.Detect(sample)
+	}
+	return codec
+}
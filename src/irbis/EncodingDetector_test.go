@@ -0,0 +1,87 @@
+package irbis
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+var _detectSamples = []string{
+	"Программирование на языке Go",
+	"ПУШКИН А. С. Евгений Онегин : роман в стихах",
+	"Москва : Наука, 1988. - 320 с.",
+	"Ёжик в тумане",
+	"Рязань",
+}
+
+func TestDetectEncoding_1(t *testing.T) {
+	for _, codec := range []Codec{Win1251Codec, Cp866Codec, Koi8rCodec, Utf8Codec} {
+		for _, sample := range _detectSamples {
+			encoded, _ := codec.Encode(sample)
+			detected, confidence := DetectEncoding(encoded)
+			if detected.Name() != codec.Name() || confidence <= 0 || confidence > 1 {
+				t.Fatal(codec.Name(), sample, detected.Name(), confidence)
+			}
+		}
+	}
+}
+
+func TestDetectEncoding_2(t *testing.T) {
+	detected, confidence := DetectEncoding([]byte("Hello, world"))
+	if detected != Win1251Codec || confidence != 1 {
+		t.FailNow()
+	}
+}
+
+func TestAutoCodec_1(t *testing.T) {
+	codec := NewAutoCodec(Cp866Codec)
+	for _, sample := range _detectSamples {
+		encoded, _ := Koi8rCodec.Encode(sample)
+		decoded, err := codec.Decode(encoded)
+		if err != nil || decoded != sample {
+			t.Fatal(decoded)
+		}
+	}
+	encoded, _ := codec.Encode("Аа")
+	if !bytes.Equal(encoded, []byte{0x80, 0xA0}) {
+		t.FailNow()
+	}
+}
+
+func TestIsoReader_2(t *testing.T) {
+	file, err := os.Open("../../data/test1.iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	buffer := bytes.Buffer{}
+	writer := NewIsoWriter(&buffer, Cp866Codec)
+	reader := NewIsoReader(file, nil)
+	var expected []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, record.String())
+		if err = writer.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader = NewIsoReader(&buffer, NewAutoCodec(nil))
+	for _, text := range expected {
+		record, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.String() != text {
+			t.Fatal(record.String())
+		}
+	}
+}
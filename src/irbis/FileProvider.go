@@ -0,0 +1,175 @@
+package irbis
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider Поставщик файлов базы данных (рабочих листов, меню,
+// FST и т. п.) для читателей, работающих с локальным диском.
+type FileProvider interface {
+	// FindFile Поиск файла по имени. Если файл не найден,
+	// возвращается пустая строка.
+	FindFile(name string) string
+
+	// ReadTextLines Чтение текстового файла в кодировке ANSI.
+	// Если файл не найден, возвращается nil.
+	ReadTextLines(name string) []string
+}
+
+// findEntry Поиск в каталоге файла или подкаталога с указанным
+// именем без учёта регистра символов. Если точное совпадение
+// существует, оно имеет приоритет.
+func findEntry(dir, name string) (string, bool) {
+	exact := filepath.Join(dir, name)
+	if _, err := os.Stat(exact); err == nil {
+		return exact, true
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return exact, false
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), name) {
+			return filepath.Join(dir, entry.Name()), true
+		}
+	}
+
+	return exact, false
+}
+
+// ResolvePath Преобразование пути в стиле Windows (например,
+// ".\datai\ibis\") в локальный путь относительно корневого каталога.
+// Обратные косые черты заменяются на прямые, имена каталогов и файлов
+// сопоставляются без учёта регистра символов. Буква диска
+// отбрасывается, путь в этом случае также считается относительным.
+// Несуществующие компоненты пути остаются как есть.
+func ResolvePath(root, path string) string {
+	path = strings.Replace(strings.TrimSpace(path), "\\", "/", -1)
+	if len(path) > 1 && path[1] == ':' {
+		path = path[2:]
+	}
+
+	result := root
+	for _, part := range strings.Split(path, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			result = filepath.Dir(result)
+		default:
+			result, _ = findEntry(result, part)
+		}
+	}
+
+	return result
+}
+
+// DatabaseLocation Расположение файлов базы данных,
+// вычисленное по PAR-файлу.
+type DatabaseLocation struct {
+	Name string   // Имя базы данных.
+	Root string   // Системный каталог, относительно которого заданы пути.
+	Par  *ParFile // PAR-файл.
+	Mst  string   // Путь к файлу MST.
+	Xrf  string   // Путь к файлу XRF.
+	Ifp  string   // Путь к файлу IFP.
+	L01  string   // Путь к файлу L01.
+	N01  string   // Путь к файлу N01.
+	Pft  string   // Каталог форматов и рабочих листов.
+}
+
+// LocateDatabase Поиск файлов базы данных по PAR-файлу.
+// Файл <database>.par ищется в системном каталоге root,
+// а затем в его подкаталоге DATAI.
+func LocateDatabase(root, database string) (*DatabaseLocation, error) {
+	parName := database + ".par"
+	filename, found := findEntry(root, parName)
+	if !found {
+		datai, _ := findEntry(root, "datai")
+		filename, found = findEntry(datai, parName)
+	}
+	if !found {
+		return nil, errors.New("PAR file not found: " + parName)
+	}
+
+	par, err := ReadParFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(par.Mst) == 0 || len(par.Xrf) == 0 {
+		return nil, errors.New("bad PAR file: " + filename)
+	}
+
+	result := new(DatabaseLocation)
+	result.Name = database
+	result.Root = root
+	result.Par = par
+	result.Mst = result.databaseFile(par.Mst, ".mst")
+	result.Xrf = result.databaseFile(par.Xrf, ".xrf")
+	result.Ifp = result.databaseFile(par.Ifp, ".ifp")
+	result.L01 = result.databaseFile(par.L01, ".l01")
+	result.N01 = result.databaseFile(par.N01, ".n01")
+	result.Pft = ResolvePath(root, par.Pft)
+
+	return result, nil
+}
+
+// newDatabaseLocation Расположение файлов базы данных,
+// заданной путём без расширения (например, "data/ibis").
+func newDatabaseLocation(filename string) *DatabaseLocation {
+	result := new(DatabaseLocation)
+	result.Name = filepath.Base(filename)
+	result.Root = filepath.Dir(filename)
+	result.Par = NewParFile(result.Root)
+	result.Mst = filename + ".mst"
+	result.Xrf = filename + ".xrf"
+	result.Ifp = filename + ".ifp"
+	result.L01 = filename + ".l01"
+	result.N01 = filename + ".n01"
+	result.Pft = result.Root
+
+	return result
+}
+
+func (location *DatabaseLocation) databaseFile(dir, extension string) string {
+	result, _ := findEntry(ResolvePath(location.Root, dir), location.Name+extension)
+	return result
+}
+
+// FindFile Поиск файла базы данных (рабочего листа, меню, FST и т. п.)
+// без учёта регистра символов: сначала в каталоге форматов,
+// затем в каталоге мастер-файла, затем в каталоге DATAI\DEPOSIT.
+func (location *DatabaseLocation) FindFile(name string) string {
+	dirs := []string{
+		location.Pft,
+		filepath.Dir(location.Mst),
+		ResolvePath(location.Root, "datai/deposit"),
+	}
+	for _, dir := range dirs {
+		if result, found := findEntry(dir, name); found {
+			return result
+		}
+	}
+
+	return ""
+}
+
+// ReadTextLines Чтение текстового файла базы данных.
+// Если файл не найден, возвращается nil.
+func (location *DatabaseLocation) ReadTextLines(name string) []string {
+	filename := location.FindFile(name)
+	if len(filename) == 0 {
+		return nil
+	}
+
+	result, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil
+	}
+	return result
+}
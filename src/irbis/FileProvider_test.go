@@ -0,0 +1,88 @@
+package irbis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath_1(t *testing.T) {
+	root := "../../data/irbis64"
+	expected := filepath.Join(root, "datai", "ibis")
+	if ResolvePath(root, `.\DATAI\Ibis\`) != expected ||
+		ResolvePath(root, `C:\DataI\IBIS`) != expected ||
+		ResolvePath(root, `.\datai\ibis\..\IBIS\`) != expected {
+		t.Fatal(ResolvePath(root, `.\DATAI\Ibis\`))
+	}
+	if ResolvePath(root, `.\datai\NoSuchDir\`) != filepath.Join(root, "datai", "NoSuchDir") {
+		t.FailNow()
+	}
+}
+
+func TestLocateDatabase_1(t *testing.T) {
+	root, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+
+	dir := filepath.Join(root, "DATAI", "IBIS")
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	par, _ := ioutil.ReadFile("../../data/ibis.par")
+	files := map[string][]byte{
+		filepath.Join(root, "DATAI", "Ibis.par"): par,
+		filepath.Join(dir, "IBIS.MST"):           nil,
+		filepath.Join(dir, "Ibis.Ws"):            []byte("test"),
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(name, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	location, err := LocateDatabase(root, "ibis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Mst != filepath.Join(dir, "IBIS.MST") ||
+		location.Xrf != filepath.Join(dir, "ibis.xrf") ||
+		location.Pft != dir {
+		t.Fatal(location.Mst, location.Xrf, location.Pft)
+	}
+	if location.FindFile("IBIS.WS") != filepath.Join(dir, "Ibis.Ws") ||
+		location.FindFile("missing.mnu") != "" {
+		t.FailNow()
+	}
+	lines := location.ReadTextLines("ibis.ws")
+	if len(lines) != 1 || lines[0] != "test" {
+		t.Fatal(lines)
+	}
+
+	if _, err = OpenDatabaseByName(root, "IBIS"); err == nil {
+		t.FailNow()
+	}
+	if _, err = LocateDatabase(root, "NOSUCHDB"); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestDatabaseLocation_1(t *testing.T) {
+	location := newDatabaseLocation("../../data/irbis64/datai/ibis/ibis")
+	ws := &WsFile{Name: "IBIS.WS"}
+	if err := ws.Parse(location.ReadTextLines("IBIS.WS")); err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.Pages) == 0 {
+		t.FailNow()
+	}
+	// Подрабочего листа 701.wss в тестовых данных нет
+	if ws.ResolveSubWorksheets(location.ReadTextLines) == nil {
+		t.FailNow()
+	}
+	if len(location.ReadTextLines("IBIS.SCH")) == 0 {
+		t.FailNow()
+	}
+}
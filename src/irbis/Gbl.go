@@ -1,5 +1,11 @@
 package irbis
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
 // GblStatement Оператор глобальной корректировки с параметрами.
 type GblStatement struct {
 	// Command Команда, например, ADD или DEL.
@@ -70,3 +76,181 @@ type GblSettings struct {
 	// Statements Список операторов
 	Statements []GblStatement
 }
+
+// Исход обработки отдельной записи при глобальной корректировке.
+const (
+	GBL_UNCHANGED = 0 // Запись не изменялась
+	GBL_CHANGED   = 1 // Запись изменена
+	GBL_ERROR     = 2 // Ошибка при обработке записи
+)
+
+// GblRecordResult Результат глобальной корректировки отдельной записи.
+type GblRecordResult struct {
+	// Database Имя базы данных.
+	Database string
+
+	// Mfn MFN записи.
+	Mfn int
+
+	// Outcome Исход обработки: GBL_UNCHANGED, GBL_CHANGED или GBL_ERROR.
+	Outcome int
+
+	// Message Сообщение об ошибке (если есть).
+	Message string
+
+	// Text Исходная строка протокола.
+	Text string
+}
+
+// Parse Разбор строки протокола вида "DBN=IBIS#MFN=1#AUTOIN=#UPDUF=0#".
+// Возвращает false, если строка не относится к записи.
+func (item *GblRecordResult) Parse(line string) bool {
+	if !strings.HasPrefix(strings.ToUpper(line), "DBN=") {
+		return false
+	}
+
+	item.Text = line
+	item.Outcome = GBL_UNCHANGED
+	updated := false
+	for _, part := range strings.Split(line, "#") {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(pair[1])
+		switch strings.ToUpper(strings.TrimSpace(pair[0])) {
+		case "DBN":
+			item.Database = value
+
+		case "MFN":
+			item.Mfn, _ = strconv.Atoi(value)
+
+		case "UPDUF":
+			code, err := strconv.Atoi(value)
+			if err == nil {
+				if code < 0 {
+					item.Outcome = GBL_ERROR
+					item.Message = DescribeError(code)
+				} else {
+					updated = true
+				}
+			}
+
+		case "GBL":
+			if len(value) != 0 {
+				item.Outcome = GBL_ERROR
+				item.Message = value
+			}
+		}
+	}
+
+	if updated && item.Outcome != GBL_ERROR {
+		item.Outcome = GBL_CHANGED
+	}
+
+	return item.Mfn != 0
+}
+
+// Changed Запись была изменена?
+func (item *GblRecordResult) Changed() bool {
+	return item.Outcome == GBL_CHANGED
+}
+
+// Failed Обработка записи завершилась ошибкой?
+func (item *GblRecordResult) Failed() bool {
+	return item.Outcome == GBL_ERROR
+}
+
+func (item *GblRecordResult) String() string {
+	return item.Text
+}
+
+// GblResult Результат глобальной корректировки.
+type GblResult struct {
+	// Records Результаты по отдельным записям.
+	Records []GblRecordResult
+
+	// Log Вывод оператора PUTLOG и прочие строки протокола,
+	// не относящиеся к конкретной записи.
+	Log []string
+
+	// Changed Количество измененных записей.
+	Changed int
+
+	// Unchanged Количество записей, оставшихся без изменений.
+	Unchanged int
+
+	// Errors Количество записей, обработанных с ошибкой.
+	Errors int
+
+	// Elapsed Затраченное время.
+	Elapsed time.Duration
+
+	// Canceled Обработка была прервана пользователем.
+	Canceled bool
+}
+
+// Parse Разбор ответа сервера.
+func (result *GblResult) Parse(lines []string) {
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+
+		item := GblRecordResult{}
+		if item.Parse(line) {
+			result.add(item)
+		} else {
+			result.Log = append(result.Log, line)
+		}
+	}
+}
+
+func (result *GblResult) add(item GblRecordResult) {
+	result.Records = append(result.Records, item)
+	switch item.Outcome {
+	case GBL_CHANGED:
+		result.Changed++
+	case GBL_ERROR:
+		result.Errors++
+	default:
+		result.Unchanged++
+	}
+}
+
+// Merge Добавление результатов очередной порции записей.
+func (result *GblResult) Merge(other *GblResult) {
+	if other == nil {
+		return
+	}
+
+	for _, item := range other.Records {
+		result.add(item)
+	}
+	result.Log = append(result.Log, other.Log...)
+	result.Elapsed += other.Elapsed
+}
+
+// Processed Общее количество обработанных записей.
+func (result *GblResult) Processed() int {
+	return len(result.Records)
+}
+
+// Failures Записи, обработанные с ошибкой.
+func (result *GblResult) Failures() (failures []GblRecordResult) {
+	for _, item := range result.Records {
+		if item.Failed() {
+			failures = append(failures, item)
+		}
+	}
+	return
+}
+
+func (result *GblResult) String() string {
+	return "Processed: " + strconv.Itoa(result.Processed()) +
+		", changed: " + strconv.Itoa(result.Changed) +
+		", unchanged: " + strconv.Itoa(result.Unchanged) +
+		", errors: " + strconv.Itoa(result.Errors) +
+		", elapsed: " + result.Elapsed.String()
+}
@@ -0,0 +1,107 @@
+package irbis
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestGblRecordResult_Parse_1(t *testing.T) {
+	item := GblRecordResult{}
+	if !item.Parse("DBN=IBIS#MFN=12#AUTOIN=#UPDUF=0#") {
+		t.FailNow()
+	}
+	if item.Database != "IBIS" || item.Mfn != 12 || !item.Changed() {
+		t.FailNow()
+	}
+}
+
+func TestGblRecordResult_Parse_2(t *testing.T) {
+	item := GblRecordResult{}
+	if !item.Parse("DBN=IBIS#MFN=3#GBL=Ошибка в формате") {
+		t.FailNow()
+	}
+	if !item.Failed() || item.Message != "Ошибка в формате" {
+		t.FailNow()
+	}
+}
+
+func TestGblRecordResult_Parse_3(t *testing.T) {
+	item := GblRecordResult{}
+	if item.Parse("Произвольная строка PUTLOG") {
+		t.FailNow()
+	}
+}
+
+func TestGblResult_Parse_1(t *testing.T) {
+	lines := []string{
+		"DBN=IBIS#MFN=1#AUTOIN=#UPDUF=0#",
+		"DBN=IBIS#MFN=2#AUTOIN=#",
+		"Запись 3 пропущена",
+		"DBN=IBIS#MFN=3#UPDUF=-600#",
+		"",
+	}
+	result := GblResult{}
+	result.Parse(lines)
+	if result.Processed() != 3 || result.Changed != 1 ||
+		result.Unchanged != 1 || result.Errors != 1 {
+		t.FailNow()
+	}
+	if len(result.Log) != 1 || len(result.Failures()) != 1 {
+		t.FailNow()
+	}
+}
+
+func TestConnection_GlobalCorrectionBatched_1(t *testing.T) {
+	// Сервер обрабатывает записи 1-4 и отказывает на записи 5
+	connection := newFakeConnection(func(command string, params []string) []string {
+		if command != "5" {
+			return []string{"-1"}
+		}
+		count, _ := strconv.Atoi(params[6])
+		result := []string{"0"}
+		for _, line := range params[7 : 7+count] {
+			if line == "5" {
+				return []string{"-140"}
+			}
+			result = append(result, "DBN=IBIS#MFN="+line+"#UPDUF=0#")
+		}
+		return result
+	})
+	settings := &GblSettings{Database: "IBIS", Filename: "test.gbl", MinMfn: 1, MaxMfn: 6}
+	batches := 0
+	result, err := connection.GlobalCorrectionBatched(settings, 2,
+		func(done, total int, batch *GblResult) bool {
+			batches++
+			return true
+		})
+	if err == nil || result == nil || batches != 2 {
+		t.Fatal(err)
+	}
+	if result.Processed() != 4 || result.Changed != 4 || result.Records[3].Mfn != 4 {
+		t.Fatal(result)
+	}
+}
+
+func TestConnection_GlobalCorrectionEx_1(t *testing.T) {
+	connection := newFakeConnection(func(command string, params []string) []string {
+		if params[0] == "BAD" {
+			return []string{"-140"}
+		}
+		return []string{"0", "DBN=IBIS#MFN=1#AUTOIN=#UPDUF=0#"}
+	})
+	result, err := connection.GlobalCorrectionEx(&GblSettings{Database: "IBIS", Filename: "test.gbl"})
+	if err != nil || result == nil || result.Changed != 1 {
+		t.Fatal(result, err)
+	}
+
+	// Сбой сообщается ошибкой, как и у GlobalCorrectionBatched
+	result, err = connection.GlobalCorrectionEx(&GblSettings{Database: "BAD", Filename: "test.gbl"})
+	if err == nil || result != nil || connection.LastError != -140 {
+		t.Fatal(result, err)
+	}
+
+	connection.Connected = false
+	if _, err = connection.GlobalCorrectionEx(&GblSettings{Database: "IBIS"}); err == nil {
+		t.FailNow()
+	}
+}
@@ -1,9 +1,13 @@
 package irbis
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"sync"
 )
 
 const InvertedBlockSize = 2050048
@@ -30,21 +34,31 @@ type NodeItem struct {
 	HighOffset int32
 }
 
+// Offset смещение списка ссылок в IFP-файле (для элементов L01).
+func (item *NodeItem) Offset() int64 {
+	return (int64(item.HighOffset) << 32) + int64(uint32(item.LowOffset))
+}
+
 // NodeLeader - лидер записи в L01/N01-файле.
 type NodeLeader struct {
 	Number     int32
 	Previous   int32
 	Next       int32
-	TermCount  int32
-	FreeOffset int32
+	TermCount  int16
+	FreeOffset int16
 }
 
 // NodeRecord - запись в L01/N01-файлах.
 type NodeRecord struct {
 	Leader NodeLeader
 	Items  []NodeItem
+	Keys   []string // Ключи (термины) в кодировке UTF-8.
 }
 
+// SpecialPostingMarker Признак специального блока IFP,
+// содержащего ссылки на блоки с постингами (для частых терминов).
+const SpecialPostingMarker = -1001
+
 type IfpControlRecord struct {
 	NextOffsetLow  int32
 	NextOffsetHigh int32
@@ -71,25 +85,34 @@ type IfpFile struct {
 	ifpFile *os.File
 	l01File *os.File
 	n01File *os.File
+	root    int32
+	mutex   sync.Mutex       // Защищает root.
+	Control IfpControlRecord // Управляющая запись.
 }
 
 // OpenIfpFile открывает файлы IFP, L01, N01
 func OpenIfpFile(filename string) (result *IfpFile, err error) {
+	return OpenIfpFiles(filename+".ifp", filename+".l01", filename+".n01")
+}
+
+// OpenIfpFiles открывает файлы IFP, L01, N01,
+// расположенные, возможно, в разных каталогах.
+func OpenIfpFiles(ifpName, l01Name, n01Name string) (result *IfpFile, err error) {
 	var ifp *os.File
-	ifp, err = os.Open(filename + ".ifp")
+	ifp, err = os.Open(ifpName)
 	if err != nil {
 		return
 	}
 
 	var l01 *os.File
-	l01, err = os.Open(filename + ".l01")
+	l01, err = os.Open(l01Name)
 	if err != nil {
 		_ = ifp.Close()
 		return
 	}
 
 	var n01 *os.File
-	n01, err = os.Open(filename + ".n01")
+	n01, err = os.Open(n01Name)
 	if err != nil {
 		_ = ifp.Close()
 		_ = l01.Close()
@@ -100,6 +123,11 @@ func OpenIfpFile(filename string) (result *IfpFile, err error) {
 	result.ifpFile = ifp
 	result.l01File = l01
 	result.n01File = n01
+	err = binary.Read(io.NewSectionReader(ifp, 0, 20), binary.BigEndian, &result.Control)
+	if err != nil {
+		result.Close()
+		result = nil
+	}
 
 	return
 }
@@ -111,18 +139,346 @@ func (ifp *IfpFile) Close() {
 	_ = ifp.n01File.Close()
 }
 
-func (ifp *IfpFile) readNode(leaf bool, file *os.File, offset int64) (result *NodeRecord) {
-	_, err := file.Seek(offset, io.SeekStart)
-	if err != nil {
-		panic(err)
+// ReadNode читает запись с указанным номером (отсчёт от 1)
+// из L01-файла (leaf) или N01-файла.
+func (ifp *IfpFile) ReadNode(leaf bool, number int32) (result *NodeRecord, err error) {
+	file := ifp.n01File
+	if leaf {
+		file = ifp.l01File
 	}
 
-	leader := new(NodeLeader)
-	err = binary.Read(file, binary.BigEndian, &leader)
+	buffer := make([]byte, NodeRecordSize)
+	_, err = file.ReadAt(buffer, int64(number-1)*NodeRecordSize)
 	if err != nil {
-		panic(err)
+		return
 	}
 
 	result = new(NodeRecord)
+	reader := bytes.NewReader(buffer)
+	if err = binary.Read(reader, binary.BigEndian, &result.Leader); err != nil {
+		return nil, err
+	}
+
+	count := int(result.Leader.TermCount)
+	if count < 0 || 16+count*12 > NodeRecordSize {
+		return nil, errors.New("bad node record")
+	}
+	result.Items = make([]NodeItem, count)
+	if err = binary.Read(reader, binary.BigEndian, &result.Items); err != nil {
+		return nil, err
+	}
+
+	result.Keys = make([]string, count)
+	for i, item := range result.Items {
+		start, stop := int(item.KeyOffset), int(item.KeyOffset)+int(item.Length)
+		if start < 0 || stop > NodeRecordSize || start > stop {
+			return nil, errors.New("bad node record")
+		}
+		result.Keys[i] = string(buffer[start:stop])
+	}
+
+	return
+}
+
+// findRoot номер корневой записи N01. ИРБИС хранит его в поле
+// Number лидера первой записи N01 (у остальных записей там их
+// собственный номер). Если N01 пуст, возвращается 0.
+func (ifp *IfpFile) findRoot() (int32, error) {
+	ifp.mutex.Lock()
+	defer ifp.mutex.Unlock()
+	if ifp.root != 0 {
+		return ifp.root, nil
+	}
+
+	first, err := ifp.ReadNode(false, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(first.Items) == 0 {
+		return 0, nil
+	}
+
+	root := first.Leader.Number
+	if root < 1 || root > ifp.Control.NodeBlockCount {
+		return 0, errors.New("bad N01 root reference")
+	}
+	if root != 1 {
+		node, err := ifp.ReadNode(false, root)
+		if err != nil {
+			return 0, err
+		}
+		if node.Leader.Number != root || node.Leader.Previous != -1 || node.Leader.Next != -1 {
+			return 0, errors.New("bad N01 root record")
+		}
+	}
+	ifp.root = root
+
+	return root, nil
+}
+
+// findLeaf поиск записи L01, в которой находится (или должен
+// находиться) указанный термин.
+func (ifp *IfpFile) findLeaf(term string) (*NodeRecord, error) {
+	root, err := ifp.findRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	link := int32(-1)
+	for number, depth := root, 0; number > 0; depth++ {
+		if depth > 32 {
+			return nil, errors.New("N01 tree is too deep")
+		}
+
+		node, err := ifp.ReadNode(false, number)
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Items) == 0 {
+			break
+		}
+
+		index := 0
+		for i, key := range node.Keys {
+			if key <= term {
+				index = i
+			} else {
+				break
+			}
+		}
+
+		link = node.Items[index].LowOffset
+		number = link
+	}
+
+	return ifp.ReadNode(true, -link)
+}
+
+// readTotal общее количество ссылок для термина.
+func (ifp *IfpFile) readTotal(offset int64) (int, error) {
+	var leader IfpRecordLeader
+	err := binary.Read(io.NewSectionReader(ifp.ifpFile, offset, 20), binary.BigEndian, &leader)
+	return int(leader.TotalLinkCount), err
+}
+
+// linkCursor Последовательное чтение ссылок термина по цепочке
+// блоков IFP без повторного чтения уже пройденных блоков.
+type linkCursor struct {
+	ifp     *IfpFile
+	offset  int64      // Смещение следующего блока (-1 -- блоков больше нет).
+	links   []TermLink // Непрочитанные ссылки текущего блока.
+	visited int
+}
+
+// newLinkCursor Курсор, начинающий с блока по указанному смещению.
+func (ifp *IfpFile) newLinkCursor(offset int64) *linkCursor {
+	return &linkCursor{ifp: ifp, offset: offset}
+}
+
+// nextBlock Переход к следующему блоку с постингами. Если skip
+// не меньше количества ссылок в блоке, ссылки не считываются.
+// Возвращает количество ссылок в блоке (-1 -- блоков больше нет).
+func (cursor *linkCursor) nextBlock(skip int) (int, error) {
+	for cursor.offset >= 0 {
+		cursor.visited++
+		if cursor.visited > 1000000 {
+			return 0, errors.New("IFP block chain is too long")
+		}
+
+		var leader IfpRecordLeader
+		section := io.NewSectionReader(cursor.ifp.ifpFile, cursor.offset, 1<<62)
+		if err := binary.Read(section, binary.BigEndian, &leader); err != nil {
+			return 0, err
+		}
+
+		if leader.LowOffset == SpecialPostingMarker && leader.HighOffset == SpecialPostingMarker {
+			// Специальный блок: переходим к первому блоку с постингами,
+			// дальше блоки связаны обычным образом
+			var first struct {
+				Link TermLink
+				Low  int32
+				High int32
+			}
+			if err := binary.Read(section, binary.BigEndian, &first); err != nil {
+				return 0, err
+			}
+			cursor.offset = (int64(first.High) << 32) + int64(uint32(first.Low))
+			continue
+		}
+
+		count := int(leader.BlockLinkCount)
+		if count < 0 || count > 1000000 {
+			return 0, errors.New("bad IFP block")
+		}
+		cursor.links = nil
+		if skip < count {
+			cursor.links = make([]TermLink, count)
+			if err := binary.Read(section, binary.BigEndian, &cursor.links); err != nil {
+				return 0, err
+			}
+		}
+
+		cursor.offset = (int64(leader.HighOffset) << 32) + int64(uint32(leader.LowOffset))
+		if leader.LowOffset == -1 && leader.HighOffset == -1 {
+			cursor.offset = -1
+		}
+		return count, nil
+	}
+
+	return -1, nil
+}
+
+// skip Пропуск указанного количества ссылок. Целиком пропускаемые
+// блоки не считываются. Возвращает количество ссылок, которые
+// не удалось пропустить из-за окончания цепочки.
+func (cursor *linkCursor) skip(count int) (int, error) {
+	for count > 0 {
+		if len(cursor.links) != 0 {
+			n := count
+			if n > len(cursor.links) {
+				n = len(cursor.links)
+			}
+			cursor.links = cursor.links[n:]
+			count -= n
+			continue
+		}
+
+		length, err := cursor.nextBlock(count)
+		if err != nil || length < 0 {
+			return count, err
+		}
+		if len(cursor.links) == 0 {
+			count -= length
+		}
+	}
+	return 0, nil
+}
+
+// read Чтение не более count ссылок (count <= 0 -- всех оставшихся).
+func (cursor *linkCursor) read(count int) (result []TermLink, err error) {
+	for count <= 0 || len(result) < count {
+		if len(cursor.links) == 0 {
+			length, err := cursor.nextBlock(0)
+			if err != nil {
+				return nil, err
+			}
+			if length < 0 {
+				break
+			}
+			continue
+		}
+
+		n := len(cursor.links)
+		if count > 0 && n > count-len(result) {
+			n = count - len(result)
+		}
+		result = append(result, cursor.links[:n]...)
+		cursor.links = cursor.links[n:]
+	}
 	return
 }
+
+// readLinks чтение всех ссылок, начиная с блока по указанному смещению.
+func (ifp *IfpFile) readLinks(offset int64) ([]TermLink, error) {
+	return ifp.newLinkCursor(offset).read(0)
+}
+
+// findTerm Смещение первого блока ссылок для указанного термина.
+// Если термин не найден, возвращается -1.
+func (ifp *IfpFile) findTerm(term string) (int64, error) {
+	leaf, err := ifp.findLeaf(term)
+	if err != nil {
+		return -1, err
+	}
+
+	for i, key := range leaf.Keys {
+		if key == term {
+			return leaf.Items[i].Offset(), nil
+		}
+	}
+
+	return -1, nil
+}
+
+// ReadLinks чтение всех ссылок для указанного термина.
+// Если термин не найден, возвращается nil.
+func (ifp *IfpFile) ReadLinks(term string) ([]TermLink, error) {
+	offset, err := ifp.findTerm(term)
+	if err != nil || offset < 0 {
+		return nil, err
+	}
+
+	return ifp.readLinks(offset)
+}
+
+// ReadTerms чтение не более count терминов, начиная с указанного
+// (в прямом или обратном порядке).
+func (ifp *IfpFile) ReadTerms(start string, count int, reverse bool) (result []TermInfo, err error) {
+	leaf, err := ifp.findLeaf(start)
+	if err != nil {
+		return nil, err
+	}
+
+	for visited := 0; len(result) < count; visited++ {
+		length := len(leaf.Items)
+		for j := 0; j < length && len(result) < count; j++ {
+			i := j
+			if reverse {
+				i = length - 1 - j
+			}
+			key := leaf.Keys[i]
+			if (!reverse && key < start) || (reverse && key > start) {
+				continue
+			}
+
+			total, err := ifp.readTotal(leaf.Items[i].Offset())
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, TermInfo{Count: total, Text: key})
+		}
+
+		next := leaf.Leader.Next
+		if reverse {
+			next = leaf.Leader.Previous
+		}
+		if next <= 0 || visited > int(ifp.Control.LeafBlockCount) {
+			break
+		}
+		if leaf, err = ifp.ReadNode(true, next); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// IfpControlRecordSize Размер управляющей записи IFP-файла в байтах.
+const IfpControlRecordSize = 20
+
+// CreateIfpFiles создаёт пустой поисковый словарь: IFP-файл
+// с управляющей записью, а также N01 и L01, каждый из которых
+// содержит единственную пустую запись. Существующие файлы
+// перезаписываются.
+func CreateIfpFiles(ifpName, l01Name, n01Name string) error {
+	control := IfpControlRecord{NextOffsetLow: IfpControlRecordSize,
+		NodeBlockCount: 1, LeafBlockCount: 1}
+	buffer := bytes.Buffer{}
+	_ = binary.Write(&buffer, binary.BigEndian, &control)
+	if err := ioutil.WriteFile(ifpName, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	leader := NodeLeader{Number: 1, Previous: -1, Next: -1, FreeOffset: 16}
+	buffer.Reset()
+	_ = binary.Write(&buffer, binary.BigEndian, &leader)
+	node := make([]byte, NodeRecordSize)
+	copy(node, buffer.Bytes())
+	for _, filename := range []string{l01Name, n01Name} {
+		if err := ioutil.WriteFile(filename, node, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
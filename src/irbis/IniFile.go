@@ -1,27 +1,70 @@
 package irbis
 
 import (
+	"strconv"
 	"strings"
 )
 
+// Виды изменений в INI-файле (см. IniFile.Diff).
+const (
+	INI_ADDED   = 1 // Ключ добавлен.
+	INI_REMOVED = 2 // Ключ удалён.
+	INI_CHANGED = 3 // Значение ключа изменено.
+)
+
+// IniLine Строка INI-файла. Строки без ключа (комментарии
+// и пустые строки) хранят исходный текст в Comment.
 type IniLine struct {
-	Key   string
-	Value string
+	Key     string
+	Value   string
+	Comment string
+
+	text string // Исходный текст строки с ключом (с пробелами вокруг '=').
+}
+
+// parseIniLine Разбор строки вида "ключ=значение".
+func parseIniLine(line string) (key, value string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] == ';' || trimmed[0] == '#' {
+		return
+	}
+	parts := strings.SplitN(trimmed, "=", 2)
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+		return
+	}
+	return strings.TrimSpace(parts[0]), parts[1], true
+}
+
+// IsComment Является ли строка комментарием (или пустой строкой).
+func (line *IniLine) IsComment() bool {
+	return len(line.Key) == 0
 }
 
 func (line *IniLine) String() string {
+	if line.IsComment() {
+		return line.Comment
+	}
+	// Неизменённая строка выводится в исходном виде
+	if key, value, ok := parseIniLine(line.text); ok && key == line.Key && value == line.Value {
+		return line.text
+	}
 	return line.Key + "=" + line.Value
 }
 
+// IniSection Секция INI-файла. Секция с пустым именем содержит
+// строки, предшествующие первому заголовку секции.
 type IniSection struct {
 	Name  string
 	Lines []IniLine
+
+	header string // Исходный текст заголовка.
 }
 
 func (section *IniSection) Find(key string) *IniLine {
 	for i := range section.Lines {
-		if SameString(section.Lines[i].Key, key) {
-			return &section.Lines[i]
+		line := &section.Lines[i]
+		if !line.IsComment() && SameString(line.Key, key) {
+			return line
 		}
 	}
 	return nil
@@ -35,10 +78,69 @@ func (section *IniSection) GetValue(key, defaultValue string) string {
 	return line.Value
 }
 
+// GetInt Получение целочисленного значения. Если ключ отсутствует
+// или значение не является числом, возвращается значение по умолчанию.
+func (section *IniSection) GetInt(key string, defaultValue int) int {
+	result, err := strconv.Atoi(strings.TrimSpace(section.GetValue(key, "")))
+	if err != nil {
+		return defaultValue
+	}
+	return result
+}
+
+// GetBool Получение логического значения ("1", "true", "yes", "on",
+// "y", "t" либо "0", "false", "no", "off", "n", "f"; регистр символов
+// не учитывается). В прочих случаях возвращается значение по умолчанию.
+func (section *IniSection) GetBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(strings.TrimSpace(section.GetValue(key, ""))) {
+	case "1", "true", "yes", "on", "y", "t":
+		return true
+	case "0", "false", "no", "off", "n", "f":
+		return false
+	}
+	return defaultValue
+}
+
+// GetList Получение списка значений, разделённых запятыми
+// или точками с запятой. Пустые элементы отбрасываются.
+func (section *IniSection) GetList(key string) (result []string) {
+	value := section.GetValue(key, "")
+	items := strings.FieldsFunc(value, func(c rune) bool {
+		return c == ',' || c == ';'
+	})
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if len(item) != 0 {
+			result = append(result, item)
+		}
+	}
+	return
+}
+
+// Keys Ключи секции в порядке их следования.
+func (section *IniSection) Keys() (result []string) {
+	for i := range section.Lines {
+		if !section.Lines[i].IsComment() {
+			result = append(result, section.Lines[i].Key)
+		}
+	}
+	return
+}
+
+// Remove Удаление всех строк с указанным ключом.
 func (section *IniSection) Remove(key string) {
-	// TODO implement
+	lines := section.Lines[:0]
+	for _, line := range section.Lines {
+		if line.IsComment() || !SameString(line.Key, key) {
+			lines = append(lines, line)
+		}
+	}
+	section.Lines = lines
 }
 
+// SetValue Установка значения ключа. Новый ключ добавляется
+// перед завершающими секцию пустыми строками. Пустое значение
+// удаляет ключ.
 func (section *IniSection) SetValue(key, value string) {
 	if len(value) == 0 {
 		section.Remove(key)
@@ -47,21 +149,46 @@ func (section *IniSection) SetValue(key, value string) {
 		if item != nil {
 			item.Value = value
 		} else {
-			item = new(IniLine)
-			section.Lines = append(section.Lines, *item)
-			item = &section.Lines[len(section.Lines)-1]
-			item.Key = key
-			item.Value = value
+			index := len(section.Lines)
+			for index > 0 && section.Lines[index-1].isBlank() {
+				index--
+			}
+			section.Lines = append(section.Lines, IniLine{})
+			copy(section.Lines[index+1:], section.Lines[index:])
+			section.Lines[index] = IniLine{Key: key, Value: value}
 		}
 	}
 }
 
+// SetInt Установка целочисленного значения ключа.
+func (section *IniSection) SetInt(key string, value int) {
+	section.SetValue(key, strconv.Itoa(value))
+}
+
+// SetBool Установка логического значения ключа ("1" или "0").
+func (section *IniSection) SetBool(key string, value bool) {
+	if value {
+		section.SetValue(key, "1")
+	} else {
+		section.SetValue(key, "0")
+	}
+}
+
+func (line *IniLine) isBlank() bool {
+	return line.IsComment() && len(strings.TrimSpace(line.Comment)) == 0
+}
+
 func (section *IniSection) String() string {
 	var result strings.Builder
 	if len(section.Name) != 0 {
-		result.WriteString("[")
-		result.WriteString(section.Name)
-		result.WriteString("]")
+		if header := strings.TrimSpace(section.header); len(header) > 1 &&
+			strings.TrimSpace(header[1:len(header)-1]) == section.Name {
+			result.WriteString(section.header)
+		} else {
+			result.WriteString("[")
+			result.WriteString(section.Name)
+			result.WriteString("]")
+		}
 		result.WriteString("\n")
 	}
 	for i := range section.Lines {
@@ -71,6 +198,11 @@ func (section *IniSection) String() string {
 	return result.String()
 }
 
+// IniFile INI-файл. Сохраняет порядок секций и ключей,
+// комментарии, пустые строки, регистр символов и исходный вид
+// неизменённых строк. Повторяющиеся заголовки секций сохраняются;
+// значения ищутся во всех одноимённых секциях, при повторе ключа
+// действует последнее определение.
 type IniFile struct {
 	Sections []IniSection
 }
@@ -79,6 +211,24 @@ func NewIniFile() *IniFile {
 	return &IniFile{}
 }
 
+// ReadIniFile Загрузка INI-файла с локального диска.
+func ReadIniFile(filename string) (*IniFile, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Завершающий перевод строки не порождает пустой строки
+	if count := len(lines); count != 0 && len(lines[count-1]) == 0 {
+		lines = lines[:count-1]
+	}
+
+	result := NewIniFile()
+	result.Parse(lines)
+	return result, nil
+}
+
+// FindSection Поиск первой секции с указанным именем.
 func (file *IniFile) FindSection(name string) *IniSection {
 	for i := range file.Sections {
 		section := &file.Sections[i]
@@ -89,59 +239,214 @@ func (file *IniFile) FindSection(name string) *IniSection {
 	return nil
 }
 
+// GetOrCreateSection Поиск секции с указанным именем. Если секция
+// не найдена, она добавляется в конец файла (отделяясь от предыдущей
+// пустой строкой).
 func (file *IniFile) GetOrCreateSection(name string) *IniSection {
 	result := file.FindSection(name)
 	if result == nil {
-		result = new(IniSection)
-		file.Sections = append(file.Sections, *result)
-		result = &file.Sections[len(file.Sections)-1]
-		result.Name = name
+		count := len(file.Sections)
+		if count != 0 {
+			previous := &file.Sections[count-1]
+			lines := len(previous.Lines)
+			if lines != 0 && !previous.Lines[lines-1].isBlank() {
+				previous.Lines = append(previous.Lines, IniLine{})
+			}
+		}
+		file.Sections = append(file.Sections, IniSection{Name: name})
+		result = &file.Sections[count]
 	}
 	return result
 }
 
+// findKey Поиск последней секции с указанным именем, содержащей
+// ключ (с учётом повторяющихся заголовков секций).
+func (file *IniFile) findKey(sectionName, key string) *IniSection {
+	for i := len(file.Sections) - 1; i >= 0; i-- {
+		section := &file.Sections[i]
+		if SameString(section.Name, sectionName) && section.Find(key) != nil {
+			return section
+		}
+	}
+	return nil
+}
+
+// sectionKeys Ключи (без повторов) всех секций с указанным именем.
+func (file *IniFile) sectionKeys(sectionName string) (result []string) {
+	seen := make(map[string]bool)
+	for i := range file.Sections {
+		if !SameString(file.Sections[i].Name, sectionName) {
+			continue
+		}
+		for _, key := range file.Sections[i].Keys() {
+			if upper := strings.ToUpper(key); !seen[upper] {
+				seen[upper] = true
+				result = append(result, key)
+			}
+		}
+	}
+	return
+}
+
 func (file *IniFile) GetValue(sectionName, key, defaultValue string) string {
-	section := file.FindSection(sectionName)
+	section := file.findKey(sectionName, key)
 	if section != nil {
 		return section.GetValue(key, defaultValue)
 	}
 	return defaultValue
 }
 
+// GetInt Получение целочисленного значения ключа.
+func (file *IniFile) GetInt(sectionName, key string, defaultValue int) int {
+	section := file.findKey(sectionName, key)
+	if section != nil {
+		return section.GetInt(key, defaultValue)
+	}
+	return defaultValue
+}
+
+// GetBool Получение логического значения ключа.
+func (file *IniFile) GetBool(sectionName, key string, defaultValue bool) bool {
+	section := file.findKey(sectionName, key)
+	if section != nil {
+		return section.GetBool(key, defaultValue)
+	}
+	return defaultValue
+}
+
+// GetList Получение списка значений ключа.
+func (file *IniFile) GetList(sectionName, key string) []string {
+	section := file.findKey(sectionName, key)
+	if section != nil {
+		return section.GetList(key)
+	}
+	return nil
+}
+
+// Parse Разбор текста INI-файла. Комментарии (строки, начинающиеся
+// с ';' или '#'), пустые строки и повторяющиеся заголовки секций
+// сохраняются.
 func (file *IniFile) Parse(lines []string) {
 	var section *IniSection = nil
 	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
+		line = strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) > 1 && trimmed[0] == '[' && trimmed[len(trimmed)-1] == ']' {
+			name := strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			file.Sections = append(file.Sections, IniSection{Name: name, header: line})
+			section = &file.Sections[len(file.Sections)-1]
 			continue
 		}
-		if line[0] == '[' {
-			name := line[1 : len(line)-1]
-			section = file.GetOrCreateSection(name)
-		} else if section != nil {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				item := IniLine{parts[0], parts[1]}
-				section.Lines = append(section.Lines, item)
-			}
+
+		if section == nil {
+			// Строки до первой секции
+			file.Sections = append(file.Sections, IniSection{})
+			section = &file.Sections[len(file.Sections)-1]
 		}
+
+		item := IniLine{Comment: line}
+		if key, value, ok := parseIniLine(line); ok {
+			item = IniLine{Key: key, Value: value, text: line}
+		}
+		section.Lines = append(section.Lines, item)
 	}
 }
 
+// SetValue Установка значения ключа в той из одноимённых секций,
+// где действует его последнее определение, либо в первой из них.
+// Пустое значение удаляет ключ.
 func (file *IniFile) SetValue(sectionName, key, value string) {
-	section := file.GetOrCreateSection(sectionName)
+	if len(value) == 0 {
+		for i := range file.Sections {
+			if SameString(file.Sections[i].Name, sectionName) {
+				file.Sections[i].Remove(key)
+			}
+		}
+		return
+	}
+
+	section := file.findKey(sectionName, key)
+	if section == nil {
+		section = file.GetOrCreateSection(sectionName)
+	}
 	section.SetValue(key, value)
 }
 
+// Save Сохранение INI-файла на локальный диск.
+func (file *IniFile) Save(filename string) error {
+	return WriteAnsiFile(filename, file.String())
+}
+
 func (file *IniFile) String() string {
 	result := strings.Builder{}
-	first := true
 	for i := range file.Sections {
-		if !first {
-			result.WriteString("\n")
-		}
 		result.WriteString(file.Sections[i].String())
-		first = false
 	}
 	return result.String()
 }
+
+// IniChange Изменение ключа INI-файла.
+type IniChange struct {
+	Kind     int    // Вид изменения: INI_ADDED, INI_REMOVED или INI_CHANGED.
+	Section  string // Имя секции.
+	Key      string // Ключ.
+	OldValue string // Прежнее значение.
+	NewValue string // Новое значение.
+}
+
+func (change *IniChange) String() string {
+	prefix := "[" + change.Section + "] " + change.Key
+	switch change.Kind {
+	case INI_ADDED:
+		return "+ " + prefix + "=" + change.NewValue
+	case INI_REMOVED:
+		return "- " + prefix + "=" + change.OldValue
+	}
+	return "* " + prefix + "=" + change.OldValue + " -> " + change.NewValue
+}
+
+// Diff Изменения, превращающие данный INI-файл в other.
+// Имена секций и ключей сравниваются без учёта регистра,
+// комментарии не учитываются, одноимённые секции объединяются.
+func (file *IniFile) Diff(other *IniFile) (result []IniChange) {
+	for _, name := range file.sectionNames() {
+		for _, key := range file.sectionKeys(name) {
+			oldValue := file.GetValue(name, key, "")
+			if other.findKey(name, key) == nil {
+				result = append(result, IniChange{Kind: INI_REMOVED,
+					Section: name, Key: key, OldValue: oldValue})
+				continue
+			}
+
+			newValue := other.GetValue(name, key, "")
+			if newValue != oldValue {
+				result = append(result, IniChange{Kind: INI_CHANGED,
+					Section: name, Key: key,
+					OldValue: oldValue, NewValue: newValue})
+			}
+		}
+	}
+
+	for _, name := range other.sectionNames() {
+		for _, key := range other.sectionKeys(name) {
+			if file.findKey(name, key) == nil {
+				result = append(result, IniChange{Kind: INI_ADDED,
+					Section: name, Key: key,
+					NewValue: other.GetValue(name, key, "")})
+			}
+		}
+	}
+
+	return
+}
+
+// sectionNames Имена секций без повторов в порядке следования.
+func (file *IniFile) sectionNames() (result []string) {
+	for i := range file.Sections {
+		name := file.Sections[i].Name
+		if file.FindSection(name) == &file.Sections[i] {
+			result = append(result, name)
+		}
+	}
+	return
+}
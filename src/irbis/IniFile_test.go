@@ -0,0 +1,187 @@
+package irbis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const _iniText = `; Leading comment
+[Main]
+; Database settings
+DBNNAMECAT=dbnam3.mnu
+Count=5
+Enabled=Yes
+
+[Private]
+List=one, two;three,,
+`
+
+func TestIniFile_1(t *testing.T) {
+	ini := NewIniFile()
+	ini.Parse(strings.Split(strings.TrimSuffix(_iniText, "\n"), "\n"))
+	if ini.String() != _iniText {
+		t.Fatal(ini.String())
+	}
+	if ini.GetValue("MAIN", "dbnnamecat", "") != "dbnam3.mnu" ||
+		ini.GetInt("Main", "Count", 0) != 5 ||
+		ini.GetInt("Main", "Enabled", -1) != -1 ||
+		!ini.GetBool("Main", "Enabled", false) ||
+		!ini.GetBool("Main", "Missing", true) {
+		t.FailNow()
+	}
+	list := ini.GetList("Private", "List")
+	if len(list) != 3 || list[0] != "one" || list[2] != "three" {
+		t.Fatal(list)
+	}
+	if keys := ini.FindSection("Main").Keys(); len(keys) != 3 || keys[0] != "DBNNAMECAT" {
+		t.Fatal(keys)
+	}
+}
+
+func TestIniFile_2(t *testing.T) {
+	ini := NewIniFile()
+	ini.Parse(strings.Split(_iniText, "\n"))
+	ini.SetValue("Main", "New", "1")
+	ini.SetValue("Main", "Count", "")
+	ini.SetValue("Other", "Key", "Value")
+	expected := `; Leading comment
+[Main]
+; Database settings
+DBNNAMECAT=dbnam3.mnu
+Enabled=Yes
+New=1
+
+[Private]
+List=one, two;three,,
+
+[Other]
+Key=Value
+`
+	if ini.String() != expected {
+		t.Fatal(ini.String())
+	}
+}
+
+func TestIniFile_3(t *testing.T) {
+	first := NewIniFile()
+	first.Parse(strings.Split(_iniText, "\n"))
+	second := NewIniFile()
+	second.Parse(strings.Split(_iniText, "\n"))
+	if len(first.Diff(second)) != 0 {
+		t.FailNow()
+	}
+
+	second.SetValue("main", "count", "6")
+	second.SetValue("Main", "Enabled", "")
+	second.SetValue("Private", "Added", "x")
+	changes := first.Diff(second)
+	if len(changes) != 3 ||
+		changes[0].Kind != INI_CHANGED || changes[0].NewValue != "6" ||
+		changes[1].Kind != INI_REMOVED || changes[1].Key != "Enabled" ||
+		changes[2].Kind != INI_ADDED || changes[2].Section != "Private" {
+		t.Fatal(changes)
+	}
+	if changes[0].String() != "* [Main] Count=5 -> 6" {
+		t.Fatal(changes[0].String())
+	}
+}
+
+func TestIniFile_4(t *testing.T) {
+	ini, err := ReadIniFile("../../data/inifile1.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ini.GetInt("Private", "FourthParameter", 0) != 4 {
+		t.FailNow()
+	}
+
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	filename := filepath.Join(dir, "clone.ini")
+	ini.SetValue("Main", "Name", "Значение")
+	if err = ini.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := ReadIniFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.String() != ini.String() || clone.GetValue("Main", "Name", "") != "Значение" {
+		t.Fatal(clone.String())
+	}
+}
+
+func TestIniFile_5(t *testing.T) {
+	text := `[Main]
+Name = First
+ Count=1
+
+[ Other ]
+Key=Value
+
+[MAIN]
+Extra =  2
+`
+	ini := NewIniFile()
+	ini.Parse(strings.Split(strings.TrimSuffix(text, "\n"), "\n"))
+	if ini.String() != text {
+		t.Fatal(ini.String())
+	}
+	if len(ini.Sections) != 3 || ini.GetValue("Main", "Extra", "") != "  2" ||
+		ini.GetValue("Other", "Key", "") != "Value" {
+		t.Fatal(ini.Sections)
+	}
+
+	// Изменённая строка записывается заново, остальные -- как были
+	ini.SetValue("main", "extra", "3")
+	ini.SetValue("Main", "Count", "")
+	expected := strings.Replace(strings.Replace(text, "Extra =  2", "Extra=3", 1), " Count=1\n", "", 1)
+	if ini.String() != expected {
+		t.Fatal(ini.String())
+	}
+
+	other := NewIniFile()
+	other.Parse(strings.Split(expected, "\n"))
+	if changes := ini.Diff(other); len(changes) != 0 {
+		t.Fatal(changes)
+	}
+}
+
+func TestConnection_PatchClientIni_1(t *testing.T) {
+	var sent []string
+	connection := newFakeConnection(func(command string, params []string) []string {
+		if command == "8" {
+			sent = append(sent, strings.Join(params, "|"))
+		}
+		return []string{"0"}
+	})
+	connection.Ini = NewIniFile()
+	connection.Ini.Parse(strings.Split("[Main]\nName=First\nCount=1\n\n[Main]\nName=Second", "\n"))
+
+	// Действует определение из последней одноимённой секции
+	if connection.Ini.GetValue("Main", "Name", "") != "Second" {
+		t.FailNow()
+	}
+	if !connection.PatchClientIni("Main", "Name", "Second") || len(sent) != 0 {
+		t.Fatal(sent)
+	}
+	if !connection.PatchClientIni("Main", "Name", "Third") || len(sent) != 1 {
+		t.Fatal(sent)
+	}
+	if connection.Ini.GetValue("Main", "Name", "") != "Third" ||
+		connection.Ini.Sections[0].Find("Name").Value != "First" ||
+		connection.Ini.Sections[1].Find("Name").Value != "Third" {
+		t.Fatal(connection.Ini.String())
+	}
+	if !connection.PatchClientIni("Main", "Count", "2") ||
+		connection.Ini.Sections[0].Find("Count").Value != "2" {
+		t.Fatal(connection.Ini.String())
+	}
+}
@@ -1,6 +1,7 @@
 package irbis
 
 import (
+	"errors"
 	"io"
 	"strings"
 )
@@ -48,41 +49,73 @@ func (field *RecordField) decodeBody(body string) {
 	}
 }
 
-func ReadIsoRecord(reader io.Reader, decoder func([]byte) string) *MarcRecord {
-	result := NewMarcRecord()
-
+// readIsoBuffer считывает из потока очередную ISO-запись целиком.
+// В конце потока возвращается io.EOF.
+func readIsoBuffer(reader io.Reader) ([]byte, error) {
 	// считываем длину записи
 	marker := make([]byte, 5)
-	if _, err := reader.Read(marker); err != nil {
-		panic(err)
+	if _, err := io.ReadFull(reader, marker); err != nil {
+		return nil, err
 	}
 
 	// а затем и ее остаток
 	recordLength := ParseInt32(marker)
+	if recordLength <= IsoMarkerLength {
+		return nil, errors.New("bad ISO record length")
+	}
 	record := make([]byte, recordLength)
-	if _, err := reader.Read(record[len(marker):]); err != nil {
-		panic(err)
+	copy(record, marker)
+	if _, err := io.ReadFull(reader, record[len(marker):]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
 	}
 
 	// Простая проверка, что мы имеем дело с нормальной ISO-записью
 	if record[recordLength-1] != IsoRecordDelimiter {
-		panic("Not ISO record")
+		return nil, errors.New("not ISO record")
 	}
 
+	return record, nil
+}
+
+// decodeIsoRecord декодирует считанную ISO-запись.
+func decodeIsoRecord(record []byte, decoder func([]byte) (string, error)) (*MarcRecord, error) {
+	malformed := errors.New("malformed ISO record")
+	recordLength := len(record)
+	if recordLength <= IsoMarkerLength {
+		return nil, malformed
+	}
+
+	result := NewMarcRecord()
 	lengthOfLength := ParseInt32(record[20:21])
 	lengthOfOffset := ParseInt32(record[21:22])
 	additionalData := ParseInt32(record[22:23])
 	directoryLength := 3 + lengthOfLength + lengthOfOffset + additionalData
 	indicatorLength := ParseInt32(record[10:11])
 	baseAddress := ParseInt32(record[12:17])
+	if lengthOfLength < 1 || lengthOfLength > 9 || lengthOfOffset < 1 || lengthOfOffset > 9 ||
+		additionalData > 9 || indicatorLength > 9 ||
+		baseAddress <= IsoMarkerLength || baseAddress > recordLength {
+		return nil, malformed
+	}
 
 	// Подсчитываем количество полей в записи,
-	// чтобы уменьшить трафик памяти в result.Fields
+	// чтобы уменьшить трафик памяти в result.Fields.
+	// Справочник вместе с разделителем должен
+	// умещаться до начала данных
 	fieldCount := 0
 	for ofs := IsoMarkerLength; ; ofs += directoryLength {
+		if ofs >= baseAddress {
+			return nil, malformed
+		}
 		if record[ofs] == IsoFieldDelimiter {
 			break
 		}
+		if ofs+directoryLength >= baseAddress {
+			return nil, malformed
+		}
 		fieldCount++
 	}
 	result.Fields = make([]*RecordField, 0, fieldCount)
@@ -100,25 +133,153 @@ func ReadIsoRecord(reader io.Reader, decoder func([]byte) string) *MarcRecord {
 		fieldLength := ParseInt32(record[ofs : ofs+lengthOfLength])
 		ofs = directory + 3 + lengthOfLength
 		fieldOffset := baseAddress + ParseInt32(record[ofs:ofs+lengthOfOffset])
+		if fieldLength < 1 || fieldOffset+fieldLength > recordLength {
+			return nil, malformed
+		}
+
 		field := NewRecordField(tag, "")
 		result.Fields = append(result.Fields, field)
 		if tag < 10 {
 			// Фиксированное поле
 			// не может содержать подполей и индикаторов
 			temp := record[fieldOffset : fieldOffset+fieldLength-1]
-			field.Value = decoder(temp)
+			text, err := decoder(temp)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = text
 		} else {
 			// Поле переменной длины
 			// Содержит два однобайтных индикатора
 			// Может содержать подполя
 
 			start := fieldOffset + indicatorLength
-			stop := fieldOffset + fieldLength - indicatorLength + 1
-			temp := record[start:stop]
-			text := decoder(temp)
+			stop := fieldOffset + fieldLength - 1
+			if start >= stop {
+				continue
+			}
+			text, err := decoder(record[start:stop])
+			if err != nil {
+				return nil, err
+			}
 			field.decodeBody(text)
 		}
 	}
 
+	return result, nil
+}
+
+func ReadIsoRecord(reader io.Reader, decoder func([]byte) string) *MarcRecord {
+	record, err := readIsoBuffer(reader)
+	if err != nil {
+		panic(err)
+	}
+
+	result, err := decodeIsoRecord(record, func(buffer []byte) (string, error) {
+		return decoder(buffer), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
 	return result
 }
+
+// IsoReader считывает записи в формате ISO 2709 из потока.
+type IsoReader struct {
+	reader io.Reader
+	codec  Codec
+}
+
+// NewIsoReader создает читателя ISO-записей в указанной кодировке
+// (nil -- Windows-1251). Для автоматического определения кодировки
+// каждой записи следует передать AutoCodec.
+func NewIsoReader(reader io.Reader, codec Codec) *IsoReader {
+	return &IsoReader{reader: reader, codec: pickCodec(codec, Win1251Codec)}
+}
+
+// Read считывает очередную запись.
+// По достижении конца потока возвращается io.EOF.
+func (iso *IsoReader) Read() (*MarcRecord, error) {
+	record, err := readIsoBuffer(iso.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Автоматически определяемая кодировка выбирается
+	// по всем полям записи сразу
+	codec := resolveCodec(iso.codec, record[IsoMarkerLength:])
+	return decodeIsoRecord(record, codec.Decode)
+}
+
+// IsoWriter записывает записи в формате ISO 2709 в поток.
+type IsoWriter struct {
+	writer io.Writer
+	codec  Codec
+}
+
+// NewIsoWriter создает писателя ISO-записей в указанной кодировке
+// (nil -- Windows-1251).
+func NewIsoWriter(writer io.Writer, codec Codec) *IsoWriter {
+	return &IsoWriter{writer: writer, codec: pickCodec(codec, Win1251Codec)}
+}
+
+// Write записывает запись в поток.
+func (iso *IsoWriter) Write(record *MarcRecord) error {
+	// Сначала кодируем тела полей
+	bodies := make([][]byte, len(record.Fields))
+	bodyLength := 0
+	for i, field := range record.Fields {
+		if field.Tag < 0 || field.Tag > 999 {
+			return errors.New("ISO field tag out of range")
+		}
+		body := strings.Builder{}
+		if field.Tag >= 10 {
+			body.WriteString("  ") // индикаторы
+		}
+		body.WriteString(field.Value)
+		for _, subfield := range field.Subfields {
+			body.WriteByte(IsoSubfieldDelimiter)
+			body.WriteRune(subfield.Code)
+			body.WriteString(subfield.Value)
+		}
+		encoded, err := iso.codec.Encode(body.String())
+		if err != nil {
+			return err
+		}
+		bodies[i] = append(encoded, IsoFieldDelimiter)
+		if len(bodies[i]) > 9999 {
+			return errors.New("ISO field too long")
+		}
+		bodyLength += len(bodies[i])
+	}
+
+	// Затем формируем маркер, справочник и поля
+	const directoryLength = 12
+	baseAddress := IsoMarkerLength + len(record.Fields)*directoryLength + 1
+	recordLength := baseAddress + bodyLength + 1
+	if recordLength > 99999 {
+		return errors.New("ISO record too long")
+	}
+
+	buffer := make([]byte, recordLength)
+	encodeInt32(buffer, 0, 5, recordLength)
+	encodeText(buffer, 5, "nam2 22")
+	encodeInt32(buffer, 12, 5, baseAddress)
+	encodeText(buffer, 17, " i 450 ")
+
+	directory := IsoMarkerLength
+	position := baseAddress
+	for i, field := range record.Fields {
+		encodeInt32(buffer, directory, 3, field.Tag)
+		encodeInt32(buffer, directory+3, 4, len(bodies[i]))
+		encodeInt32(buffer, directory+7, 5, position-baseAddress)
+		directory += directoryLength
+		position += copy(buffer[position:], bodies[i])
+	}
+	buffer[directory] = IsoFieldDelimiter
+	buffer[recordLength-1] = IsoRecordDelimiter
+
+	_, err := iso.writer.Write(buffer)
+	return err
+}
@@ -0,0 +1,157 @@
+package irbis
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MARCXML_NAMESPACE Пространство имён MARCXML.
+const MARCXML_NAMESPACE = "http://www.loc.gov/MARC21/slim"
+
+// xmlEscape Экранирование текста для вставки в XML.
+func xmlEscape(text string) string {
+	var result strings.Builder
+	_ = xml.EscapeText(&result, []byte(text))
+	return result.String()
+}
+
+// tagText Метка поля в виде трёх цифр.
+func tagText(tag int) string {
+	return fmt.Sprintf("%03d", tag)
+}
+
+// MarcXml Представление записи в формате MARCXML (элемент record).
+// Поля с метками меньше 10 выводятся как controlfield, остальные --
+// как datafield с пустыми индикаторами. Значение поля до первого
+// подполя выводится как подполе 'a'. Если в записи нет поля 1,
+// MFN выводится в controlfield 001.
+func MarcXml(record *MarcRecord) string {
+	status := 'n'
+	if record.IsDeleted() {
+		status = 'd'
+	}
+
+	var result strings.Builder
+	result.WriteString(`<record xmlns="` + MARCXML_NAMESPACE + `">`)
+	result.WriteString("<leader>00000" + string(status) + "am a2200000 i 4500</leader>")
+	if record.Mfn != 0 && !record.HaveField(1) {
+		result.WriteString(`<controlfield tag="001">` + strconv.Itoa(record.Mfn) + "</controlfield>")
+	}
+
+	for _, field := range record.Fields {
+		tag := tagText(field.Tag)
+		if field.Tag < 10 {
+			result.WriteString(`<controlfield tag="` + tag + `">`)
+			result.WriteString(xmlEscape(field.Value))
+			result.WriteString("</controlfield>")
+			continue
+		}
+
+		result.WriteString(`<datafield tag="` + tag + `" ind1=" " ind2=" ">`)
+		if len(field.Value) != 0 {
+			result.WriteString(`<subfield code="a">` + xmlEscape(field.Value) + "</subfield>")
+		}
+		for _, subfield := range field.Subfields {
+			result.WriteString(`<subfield code="` + xmlEscape(string(subfield.Code)) + `">`)
+			result.WriteString(xmlEscape(subfield.Value))
+			result.WriteString("</subfield>")
+		}
+		result.WriteString("</datafield>")
+	}
+
+	result.WriteString("</record>")
+	return result.String()
+}
+
+// DcElement Элемент Dublin Core (например, title или creator).
+type DcElement struct {
+	Name  string
+	Value string
+}
+
+// personName Имя лица из полей 700-702 ("Фамилия, инициалы").
+func personName(field *RecordField) string {
+	surname := field.GetFirstSubFieldValue('a')
+	initials := PickOne(field.GetFirstSubFieldValue('b'), field.GetFirstSubFieldValue('g'))
+	if len(surname) == 0 || len(initials) == 0 {
+		return surname
+	}
+	return surname + ", " + initials
+}
+
+// DublinCore Отображение библиографической записи (база
+// стандартной структуры IBIS) на элементы Dublin Core.
+func DublinCore(record *MarcRecord) (result []DcElement) {
+	add := func(name, value string) {
+		value = strings.TrimSpace(value)
+		if len(value) != 0 {
+			result = append(result, DcElement{Name: name, Value: value})
+		}
+	}
+
+	for _, field := range record.GetFields(200) {
+		title := field.GetFirstSubFieldValue('a')
+		if other := field.GetFirstSubFieldValue('e'); len(other) != 0 {
+			title += " : " + other
+		}
+		add("title", title)
+	}
+	for _, tag := range []int{700, 701} {
+		for _, field := range record.GetFields(tag) {
+			add("creator", personName(field))
+		}
+	}
+	for _, tag := range []int{710, 711} {
+		for _, field := range record.GetFields(tag) {
+			add("creator", field.GetFirstSubFieldValue('a'))
+		}
+	}
+	for _, field := range record.GetFields(702) {
+		add("contributor", personName(field))
+	}
+	for _, value := range record.FSMA(606, 'a') {
+		add("subject", value)
+	}
+	for _, field := range record.GetFields(610) {
+		add("subject", field.GetValueOrFirstSubField())
+	}
+	for _, value := range record.FMA(331) {
+		add("description", value)
+	}
+	for _, value := range record.FSMA(210, 'c') {
+		add("publisher", value)
+	}
+	for _, value := range record.FSMA(210, 'd') {
+		add("date", value)
+	}
+	add("type", "Text")
+	for _, value := range record.FSMA(10, 'a') {
+		add("identifier", "ISBN "+value)
+	}
+	for _, value := range record.FSMA(11, 'a') {
+		add("identifier", "ISSN "+value)
+	}
+	for _, value := range record.FMA(101) {
+		add("language", value)
+	}
+
+	return
+}
+
+// dublinCoreXml Представление элементов Dublin Core в XML
+// с указанным корневым элементом.
+func dublinCoreXml(elements []DcElement, root, namespace string) string {
+	prefix := root[:strings.IndexByte(root, ':')]
+	var result strings.Builder
+	result.WriteString("<" + root + ` xmlns:` + prefix + `="` + namespace + `"`)
+	result.WriteString(` xmlns:dc="http://purl.org/dc/elements/1.1/">`)
+	for _, element := range elements {
+		result.WriteString("<dc:" + element.Name + ">")
+		result.WriteString(xmlEscape(element.Value))
+		result.WriteString("</dc:" + element.Name + ">")
+	}
+	result.WriteString("</" + root + ">")
+	return result.String()
+}
@@ -0,0 +1,32 @@
+package irbis
+
+import "os"
+
+// mappedReader Чтение файла, начало которого может быть
+// отображено в память. За пределами отображения данные
+// читаются из самого файла. Безопасно при одновременном
+// использовании из нескольких горутин.
+type mappedReader struct {
+	file   *os.File
+	mapped []byte
+}
+
+func (reader mappedReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset >= 0 && offset+int64(len(buffer)) <= int64(len(reader.mapped)) {
+		return copy(buffer, reader.mapped[offset:]), nil
+	}
+	return reader.file.ReadAt(buffer, offset)
+}
+
+// slice Фрагмент файла указанной длины. Из отображения в память
+// данные не копируются, поэтому фрагмент нельзя изменять.
+func (reader mappedReader) slice(offset int64, length int) ([]byte, error) {
+	if offset >= 0 && offset+int64(length) <= int64(len(reader.mapped)) {
+		return reader.mapped[offset : offset+int64(length)], nil
+	}
+	result := make([]byte, length)
+	if _, err := reader.file.ReadAt(result, offset); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,20 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package irbis
+
+import (
+	"errors"
+	"os"
+)
+
+// mapFile Отображение файлов в память на данной платформе
+// не поддерживается, файлы читаются обычным образом.
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("memory mapping is not supported")
+}
+
+// unmapFile Освобождение памяти, полученной от mapFile.
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package irbis
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mapFile Отображение начала файла указанного размера
+// в память (только для чтения).
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("can't map empty file")
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file is too large to map")
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile Освобождение памяти, полученной от mapFile.
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
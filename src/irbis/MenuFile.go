@@ -1,9 +1,20 @@
 package irbis
 
 import (
+	"sort"
 	"strings"
 )
 
+// Режимы поиска элементов меню (см. MenuFile.Find).
+const (
+	MENU_EXACT       = 0 // Точное совпадение кода.
+	MENU_IGNORE_CASE = 1 // Совпадение кода без учёта регистра символов.
+	MENU_PREFIX      = 2 // Код начинается с указанного префикса (без учёта регистра).
+)
+
+// MenuStopMarker Строка, завершающая MNU-файл.
+const MenuStopMarker = "*****"
+
 // MenuEntry представляет собой пару строк в MNU-файле.
 type MenuEntry struct {
 	Code    string // Условный код
@@ -21,10 +32,24 @@ func (entry *MenuEntry) String() string {
 	return entry.Code + " - " + entry.Comment
 }
 
+// MenuFile MNU-файл -- справочник, состоящий из пар строк
+// "код -- комментарий" и завершающийся строкой "*****".
 type MenuFile struct {
 	Entries []*MenuEntry
 }
 
+// ReadMenuFile Загрузка MNU-файла с локального диска.
+func ReadMenuFile(filename string) (*MenuFile, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(MenuFile)
+	result.Parse(lines)
+	return result, nil
+}
+
 func (menu *MenuFile) Add(code, comment string) *MenuFile {
 	entry := NewMenuEntry(code, comment)
 	menu.Entries = append(menu.Entries, entry)
@@ -64,6 +89,35 @@ func (menu *MenuFile) GetEntry(code string) *MenuEntry {
 	return nil
 }
 
+// Find Поиск элементов меню по коду в указанном режиме
+// (MENU_EXACT, MENU_IGNORE_CASE или MENU_PREFIX).
+func (menu *MenuFile) Find(code string, mode int) (result []*MenuEntry) {
+	upper := strings.ToUpper(code)
+	for _, entry := range menu.Entries {
+		var found bool
+		switch mode {
+		case MENU_EXACT:
+			found = entry.Code == code
+		case MENU_IGNORE_CASE:
+			found = SameString(entry.Code, code)
+		case MENU_PREFIX:
+			found = strings.HasPrefix(strings.ToUpper(entry.Code), upper)
+		}
+		if found {
+			result = append(result, entry)
+		}
+	}
+	return
+}
+
+// Codes Коды всех элементов меню в порядке их следования.
+func (menu *MenuFile) Codes() (result []string) {
+	for _, entry := range menu.Entries {
+		result = append(result, entry.Code)
+	}
+	return
+}
+
 func (menu *MenuFile) GetValue(code, defaultValue string) string {
 	entry := menu.GetEntry(code)
 	if entry == nil {
@@ -77,21 +131,107 @@ func (menu *MenuFile) Parse(lines []string) {
 	length := len(lines)
 	for i := 0; i < length; i += 2 {
 		code := lines[i]
-		if len(code) == 0 || strings.HasPrefix(code, "*****") {
+		if len(code) == 0 || strings.HasPrefix(code, MenuStopMarker) {
 			break
 		}
-		comment := lines[i+1]
+		comment := ""
+		if i+1 < length {
+			comment = lines[i+1]
+		}
 		entry := NewMenuEntry(code, comment)
 		menu.Entries = append(menu.Entries, entry)
 	}
 }
 
+// Remove Удаление всех элементов с указанным кодом
+// (регистр символов не учитывается). Возвращает true,
+// если хотя бы один элемент был удалён.
+func (menu *MenuFile) Remove(code string) bool {
+	entries := menu.Entries[:0]
+	for _, entry := range menu.Entries {
+		if !SameString(entry.Code, code) {
+			entries = append(entries, entry)
+		}
+	}
+	removed := len(entries) != len(menu.Entries)
+	menu.Entries = entries
+	return removed
+}
+
+// Update Изменение комментария к коду. Если элемента
+// с таким кодом нет, он добавляется в конец меню.
+func (menu *MenuFile) Update(code, comment string) *MenuFile {
+	found := menu.Find(code, MENU_IGNORE_CASE)
+	if len(found) == 0 {
+		return menu.Add(code, comment)
+	}
+	for _, entry := range found {
+		entry.Comment = comment
+	}
+	return menu
+}
+
+// Deduplicate Удаление элементов с повторяющимися кодами
+// (регистр символов и концевые пробелы не учитываются).
+// Остаётся первый из повторяющихся элементов.
+// Возвращает количество удалённых элементов.
+func (menu *MenuFile) Deduplicate() int {
+	seen := make(map[string]bool, len(menu.Entries))
+	entries := menu.Entries[:0]
+	for _, entry := range menu.Entries {
+		key := strings.ToUpper(strings.TrimSpace(entry.Code))
+		if !seen[key] {
+			seen[key] = true
+			entries = append(entries, entry)
+		}
+	}
+	removed := len(menu.Entries) - len(entries)
+	menu.Entries = entries
+	return removed
+}
+
+// SortByCode Сортировка меню по кодам (без учёта регистра).
+func (menu *MenuFile) SortByCode() *MenuFile {
+	sort.SliceStable(menu.Entries, func(i, j int) bool {
+		return strings.ToUpper(menu.Entries[i].Code) < strings.ToUpper(menu.Entries[j].Code)
+	})
+	return menu
+}
+
+// SortByComment Сортировка меню по комментариям (без учёта регистра).
+func (menu *MenuFile) SortByComment() *MenuFile {
+	sort.SliceStable(menu.Entries, func(i, j int) bool {
+		return strings.ToUpper(menu.Entries[i].Comment) < strings.ToUpper(menu.Entries[j].Comment)
+	})
+	return menu
+}
+
+// Encode Текст меню в формате MNU-файла.
+func (menu *MenuFile) Encode() string {
+	result := strings.Builder{}
+	for _, entry := range menu.Entries {
+		result.WriteString(entry.Code)
+		result.WriteString("\n")
+		result.WriteString(entry.Comment)
+		result.WriteString("\n")
+	}
+	result.WriteString(MenuStopMarker)
+	result.WriteString("\n")
+
+	return result.String()
+}
+
+// Save Сохранение MNU-файла на локальный диск.
+func (menu *MenuFile) Save(filename string) error {
+	return WriteAnsiFile(filename, menu.Encode())
+}
+
 func (menu *MenuFile) String() string {
 	result := strings.Builder{}
 	for _, entry := range menu.Entries {
 		result.WriteString(entry.String() + "\n")
 	}
-	result.WriteString("*****\n")
+	result.WriteString(MenuStopMarker + "\n")
 
 	return result.String()
 }
@@ -0,0 +1,77 @@
+package irbis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMenuFile_1(t *testing.T) {
+	menu, err := ReadMenuFile("../../data/org.mnu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(menu.Entries) != 9 || menu.GetValue("1", "") != "RU" {
+		t.Fatal(len(menu.Entries))
+	}
+
+	text, _ := ioutil.ReadFile("../../data/org.mnu")
+	if menu.Encode() != FromAnsi(text) {
+		t.Fatal(menu.Encode())
+	}
+}
+
+func TestMenuFile_2(t *testing.T) {
+	menu := new(MenuFile)
+	menu.Add("b", "Второй").Add("A", "первый").Add("ab", "Третий").Add("B", "Дубль")
+	if len(menu.Find("a", MENU_EXACT)) != 0 ||
+		len(menu.Find("a", MENU_IGNORE_CASE)) != 1 ||
+		len(menu.Find("a", MENU_PREFIX)) != 2 {
+		t.FailNow()
+	}
+
+	if menu.Deduplicate() != 1 || len(menu.Entries) != 3 {
+		t.FailNow()
+	}
+	if strings.Join(menu.SortByCode().Codes(), ",") != "A,ab,b" {
+		t.Fatal(menu.Codes())
+	}
+	if strings.Join(menu.SortByComment().Codes(), ",") != "b,A,ab" {
+		t.Fatal(menu.Codes())
+	}
+
+	menu.Update("AB", "Изменён").Update("c", "Новый")
+	if menu.GetValue("ab", "") != "Изменён" || menu.GetValue("C", "") != "Новый" {
+		t.FailNow()
+	}
+	if !menu.Remove("B") || menu.Remove("B") || len(menu.Entries) != 3 {
+		t.FailNow()
+	}
+	if menu.Encode() != "A\nпервый\nab\nИзменён\nc\nНовый\n*****\n" {
+		t.Fatal(menu.Encode())
+	}
+}
+
+func TestMenuFile_3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	menu := new(MenuFile)
+	menu.Add("1", "Один").Add("2", "")
+	filename := filepath.Join(dir, "test.mnu")
+	if err = menu.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := ReadMenuFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.Encode() != menu.Encode() {
+		t.Fatal(clone.Encode())
+	}
+}
@@ -1,8 +1,10 @@
 package irbis
 
 import (
+	"bytes"
 	"encoding/binary"
-	"io"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
 )
@@ -87,7 +89,9 @@ type MstControlRecord struct {
 // XrfFile - обёртка над MST-файлом.
 type MstFile struct {
 	file    *os.File
+	mapped  []byte
 	Control MstControlRecord // Управляющая запись.
+	Codec   Codec            // Кодировка текста полей (nil -- без перекодировки).
 }
 
 // OpenXrfFile открывает файл на чтение.
@@ -116,47 +120,211 @@ func (control *MstControlRecord) NextPosition() int64 {
 
 // Close закрывает файл.
 func (mst *MstFile) Close() {
+	mst.unmapMemory()
 	_ = mst.file.Close()
 }
 
-// ReadRecord читает запись по указанному смещению
-func (mst *MstFile) ReadRecord(position int64) (result *MstRecord, err error) {
-	_, err = mst.file.Seek(position, io.SeekStart)
+// reader Чтение файла с учётом отображения в память.
+func (mst *MstFile) reader() mappedReader {
+	return mappedReader{file: mst.file, mapped: mst.mapped}
+}
+
+// mapMemory Отображение занятой части файла в память.
+func (mst *MstFile) mapMemory() error {
+	if mst.mapped != nil {
+		return nil
+	}
+	info, err := mst.file.Stat()
 	if err != nil {
-		return
+		return err
 	}
+	size := mst.Control.NextPosition()
+	if size < MstControlRecordSize || size > info.Size() {
+		size = info.Size()
+	}
+	mst.mapped, err = mapFile(mst.file, size)
+	return err
+}
 
-	result = new(MstRecord)
-	err = binary.Read(mst.file, binary.BigEndian, &result.Leader)
-	if err != nil {
-		result = nil
-		return
+// unmapMemory Отмена отображения файла в память.
+func (mst *MstFile) unmapMemory() {
+	if mst.mapped != nil {
+		_ = unmapFile(mst.mapped)
+		mst.mapped = nil
 	}
+}
 
-	nvf := result.Leader.Nvf
-	result.Dictionary = make([]MstDictionaryEntry, nvf)
-	err = binary.Read(mst.file, binary.BigEndian, &result.Dictionary)
+// ReadRecord читает запись по указанному смещению. Метод можно
+// вызывать одновременно из нескольких горутин.
+func (mst *MstFile) ReadRecord(position int64) (*MstRecord, error) {
+	reader := mst.reader()
+	limit := mst.Control.NextPosition()
+	leader, problem := readMstLeader(reader, position, limit)
+	if len(problem) != 0 {
+		// Файл мог вырасти после открытия
+		if info, err := mst.file.Stat(); err == nil && info.Size() > limit {
+			leader, problem = readMstLeader(reader, position, info.Size())
+		}
+		if len(problem) != 0 {
+			return nil, errors.New("bad MST record: " + problem)
+		}
+	}
+
+	data, err := reader.slice(position, int(leader.Length))
 	if err != nil {
-		result = nil
-		return
+		return nil, err
 	}
 
-	result.Fields = make([]MstField, nvf)
+	return decodeMstRecord(data, mst.Codec)
+}
+
+// decodeMstRecord декодирует MST-запись, целиком считанную
+// в буфер (лидер, словарь и поля), проверяя границы словаря.
+func decodeMstRecord(data []byte, codec Codec) (*MstRecord, error) {
+	if len(data) < MstLeaderSize {
+		return nil, errors.New("MST record is too short")
+	}
+
+	result := new(MstRecord)
+	reader := bytes.NewReader(data)
+	_ = binary.Read(reader, binary.BigEndian, &result.Leader)
+	leader := &result.Leader
+	if leader.Nvf < 0 || leader.Base != MstLeaderSize+leader.Nvf*12 ||
+		leader.Length < leader.Base || int(leader.Length) > len(data) {
+		return nil, fmt.Errorf("bad MST record leader (MFN %d)", leader.Mfn)
+	}
+
+	result.Dictionary = make([]MstDictionaryEntry, leader.Nvf)
+	_ = binary.Read(reader, binary.BigEndian, &result.Dictionary)
+	body := data[leader.Base:leader.Length]
+	codec = resolveCodec(codec, body)
+	result.Fields = make([]MstField, leader.Nvf)
+	for i, entry := range result.Dictionary {
+		if entry.Position < 0 || entry.Length < 0 || int(entry.Position)+int(entry.Length) > len(body) {
+			return nil, fmt.Errorf("bad MST dictionary entry (MFN %d)", leader.Mfn)
+		}
+		raw := body[entry.Position : entry.Position+entry.Length]
+		result.Fields[i].Tag = entry.Tag
+		if codec == nil {
+			result.Fields[i].Text = string(raw)
+		} else {
+			text, err := codec.Decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			result.Fields[i].Text = text
+		}
+	}
 
-	remaining := result.Leader.Length - result.Leader.Base
-	temp := make([]byte, remaining)
-	_, err = mst.file.Read(temp)
+	return result, nil
+}
+
+// MstLeaderSize Размер лидера MST-записи в байтах.
+const MstLeaderSize = 32
+
+// NewMstRecord Преобразование записи в MST-запись. Смещения
+// полей и длина записи вычисляются при кодировании.
+func NewMstRecord(record *MarcRecord) *MstRecord {
+	result := new(MstRecord)
+	result.Leader.Mfn = int32(record.Mfn)
+	result.Leader.Status = int32(record.Status)
+	result.Leader.Version = int32(record.Version)
+	result.Fields = make([]MstField, len(record.Fields))
+	for i, field := range record.Fields {
+		result.Fields[i] = MstField{Tag: int32(field.Tag), Text: field.EncodeBody()}
+	}
+	return result
+}
+
+// SetPreviousOffset Задание ссылки на предыдущую версию записи.
+func (leader *MstLeader) SetPreviousOffset(offset int64) {
+	leader.PreviousLow = int32(offset)
+	leader.PreviousHigh = int32(offset >> 32)
+}
+
+// Encode кодирует запись в формат MST-файла (nil -- без
+// перекодировки), заполняя словарь, Base, Nvf и Length.
+func (record *MstRecord) Encode(codec Codec) ([]byte, error) {
+	nvf := len(record.Fields)
+	record.Dictionary = make([]MstDictionaryEntry, nvf)
+	data := bytes.Buffer{}
+	for i, field := range record.Fields {
+		raw := []byte(field.Text)
+		if codec != nil {
+			var err error
+			if raw, err = codec.Encode(field.Text); err != nil {
+				return nil, err
+			}
+		}
+		record.Dictionary[i] = MstDictionaryEntry{Tag: field.Tag,
+			Position: int32(data.Len()), Length: int32(len(raw))}
+		data.Write(raw)
+	}
+
+	record.Leader.Nvf = int32(nvf)
+	record.Leader.Base = int32(MstLeaderSize + nvf*12)
+	record.Leader.Length = record.Leader.Base + int32(data.Len())
+
+	result := bytes.Buffer{}
+	result.Grow(int(record.Leader.Length))
+	_ = binary.Write(&result, binary.BigEndian, &record.Leader)
+	_ = binary.Write(&result, binary.BigEndian, record.Dictionary)
+	result.Write(data.Bytes())
+	return result.Bytes(), nil
+}
+
+// CreateMstFile создаёт пустой MST-файл (существующий файл
+// перезаписывается) и открывает его на чтение и запись.
+func CreateMstFile(filename string) (result *MstFile, err error) {
+	var file *os.File
+	file, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
+		return
+	}
+
+	result = new(MstFile)
+	result.file = file
+	result.Control.NextMfn = 1
+	result.Control.NextPositionLow = MstControlRecordSize
+	if err = result.WriteControlRecord(); err != nil {
+		_ = file.Close()
 		result = nil
+	}
+
+	return
+}
+
+// WriteControlRecord записывает управляющую запись в начало файла.
+func (mst *MstFile) WriteControlRecord() error {
+	buffer := bytes.Buffer{}
+	_ = binary.Write(&buffer, binary.BigEndian, &mst.Control)
+	_, err := mst.file.WriteAt(buffer.Bytes(), 0)
+	return err
+}
+
+// AppendRecord дописывает запись в свободное место файла
+// и продвигает смещение свободного места в управляющей записи
+// (сама управляющая запись не сохраняется, см. WriteControlRecord).
+// Возвращает смещение, по которому записана запись.
+func (mst *MstFile) AppendRecord(record *MstRecord) (position int64, err error) {
+	var data []byte
+	if data, err = record.Encode(mst.Codec); err != nil {
 		return
 	}
 
-	for i := int32(0); i < nvf; i++ {
-		result.Fields[i].Tag = result.Dictionary[i].Tag
-		ofs := result.Dictionary[i].Position
-		raw := temp[ofs : ofs+result.Dictionary[i].Length]
-		result.Fields[i].Text = string(raw)
+	return mst.appendRaw(data)
+}
+
+// appendRaw дописывает закодированную запись в свободное место
+// файла и продвигает смещение свободного места.
+func (mst *MstFile) appendRaw(data []byte) (position int64, err error) {
+	position = mst.Control.NextPosition()
+	if _, err = mst.file.WriteAt(data, position); err != nil {
+		return
 	}
 
+	next := position + int64(len(data))
+	mst.Control.NextPositionLow = int32(next)
+	mst.Control.NextPositionHigh = int32(next >> 32)
 	return
 }
@@ -0,0 +1,586 @@
+package irbis
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Пространства имён OAI-PMH.
+const (
+	OAI_NAMESPACE    = "http://www.openarchives.org/OAI/2.0/"
+	OAI_DC_NAMESPACE = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+)
+
+// oaiFormat Формат метаданных, выдаваемый OAI-сервером.
+type oaiFormat struct {
+	prefix    string
+	schema    string
+	namespace string
+	encode    func(record *MarcRecord) string
+}
+
+var oaiFormats = []oaiFormat{
+	{
+		prefix:    "oai_dc",
+		schema:    "http://www.openarchives.org/OAI/2.0/oai_dc.xsd",
+		namespace: OAI_DC_NAMESPACE,
+		encode: func(record *MarcRecord) string {
+			return dublinCoreXml(DublinCore(record), "oai_dc:dc", OAI_DC_NAMESPACE)
+		},
+	},
+	{
+		prefix:    "marcxml",
+		schema:    "http://www.loc.gov/standards/marcxml/schema/MARC21slim.xsd",
+		namespace: MARCXML_NAMESPACE,
+		encode:    MarcXml,
+	},
+}
+
+func findOaiFormat(prefix string) *oaiFormat {
+	for i := range oaiFormats {
+		if oaiFormats[i].prefix == prefix {
+			return &oaiFormats[i]
+		}
+	}
+	return nil
+}
+
+// Допустимые аргументы запросов OAI-PMH (кроме verb).
+var oaiArguments = map[string][]string{
+	"Identify":            {},
+	"ListMetadataFormats": {"identifier"},
+	"ListSets":            {"resumptionToken"},
+	"GetRecord":           {"identifier", "metadataPrefix"},
+	"ListIdentifiers":     {"from", "until", "set", "metadataPrefix", "resumptionToken"},
+	"ListRecords":         {"from", "until", "set", "metadataPrefix", "resumptionToken"},
+}
+
+// OaiServer HTTP-обработчик протокола OAI-PMH 2.0 (поставщик данных)
+// для одной базы данных. Идентификатор записи образуется из префикса
+// и MFN, дата -- из заданного поля записи (с точностью до дня).
+// Наборы (sets): база данных целиком и её подмножества по виду
+// документа ("IBIS:05").
+//
+//	pool := irbis.NewConnectionPool("host=127.0.0.1;user=reader;password=secret;", 4)
+//	server := irbis.NewOaiServer(irbis.NewServerRecordSource(pool, "IBIS"))
+//	server.IdentifierPrefix = "oai:library.example.org:IBIS/"
+//	http.Handle("/oai", server)
+type OaiServer struct {
+	// Source Источник записей.
+	Source RecordSource
+
+	// RepositoryName Название репозитория.
+	RepositoryName string
+
+	// BaseUrl Базовый адрес репозитория (пустая строка --
+	// определяется по запросу).
+	BaseUrl string
+
+	// AdminEmail Адрес администратора репозитория.
+	AdminEmail string
+
+	// IdentifierPrefix Префикс идентификаторов записей.
+	IdentifierPrefix string
+
+	// DateTag, DateCode Поле и подполе, содержащие дату последнего
+	// изменения записи в формате ГГГГММДД (берётся последнее повторение).
+	DateTag  int
+	DateCode rune
+
+	// EarliestDatestamp Дата для записей, в которых дата не указана.
+	EarliestDatestamp string
+
+	// KindTag, KindCode Поле и подполе, содержащие вид документа
+	// (0 -- наборы по виду документа не формируются).
+	KindTag  int
+	KindCode rune
+
+	// KindNames Названия видов документов для ListSets.
+	KindNames map[string]string
+
+	// PageSize Количество записей в одном ответе.
+	PageSize int
+
+	// MaxScan Максимальное количество MFN, просматриваемых за один
+	// запрос ListRecords/ListIdentifiers. Записи за этой границей
+	// не выдаются: список считается исчерпанным.
+	MaxScan int
+}
+
+// NewOaiServer Конструктор OAI-сервера с настройками по умолчанию
+// (для базы стандартной структуры IBIS).
+func NewOaiServer(source RecordSource) *OaiServer {
+	return &OaiServer{
+		Source:            source,
+		RepositoryName:    source.Database(),
+		AdminEmail:        "admin@localhost",
+		IdentifierPrefix:  "oai:irbis:" + source.Database() + "/",
+		DateTag:           907,
+		DateCode:          'a',
+		EarliestDatestamp: "1900-01-01",
+		KindTag:           900,
+		KindCode:          'b',
+		KindNames:         map[string]string{},
+		PageSize:          100,
+		MaxScan:           1000,
+	}
+}
+
+// oaiError Ошибка протокола OAI-PMH.
+type oaiError struct {
+	code    string
+	message string
+}
+
+// oaiToken Состояние перебора записей, передаваемое
+// в resumptionToken.
+type oaiToken struct {
+	prefix  string
+	set     string
+	from    string
+	until   string
+	nextMfn int
+}
+
+func (token *oaiToken) encode() string {
+	text := strings.Join([]string{token.prefix, token.set, token.from, token.until,
+		strconv.Itoa(token.nextMfn)}, "\n")
+	return base64.RawURLEncoding.EncodeToString([]byte(text))
+}
+
+func decodeOaiToken(text string) (*oaiToken, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(string(data), "\n")
+	if len(parts) != 5 {
+		return nil, false
+	}
+	result := &oaiToken{prefix: parts[0], set: parts[1], from: parts[2], until: parts[3]}
+	result.nextMfn, err = strconv.Atoi(parts[4])
+	if err != nil || result.nextMfn <= 0 {
+		return nil, false
+	}
+	return result, true
+}
+
+// oaiRequest Контекст обработки одного запроса.
+type oaiRequest struct {
+	writer  http.ResponseWriter
+	request *http.Request
+	verb    string
+	args    url.Values
+	body    strings.Builder
+	status  int // HTTP-статус при сбое источника записей
+}
+
+func (current *oaiRequest) write(parts ...string) {
+	for _, part := range parts {
+		current.body.WriteString(part)
+	}
+}
+
+func (current *oaiRequest) arg(name string) string {
+	return current.args.Get(name)
+}
+
+// sourceFailure Сбой источника записей: вместо ответа OAI-PMH
+// клиент получит HTTP-ошибку 503, чтобы повторить запрос позже.
+func (current *oaiRequest) sourceFailure(err error) *oaiError {
+	current.status = http.StatusServiceUnavailable
+	return &oaiError{"", err.Error()}
+}
+
+// Datestamp Дата записи в формате ГГГГ-ММ-ДД.
+func (server *OaiServer) Datestamp(record *MarcRecord) string {
+	values := record.FSMA(server.DateTag, server.DateCode)
+	for i := len(values) - 1; i >= 0; i-- {
+		value := strings.TrimSpace(values[i])
+		if len(value) >= 8 {
+			if _, err := time.Parse("20060102", value[:8]); err == nil {
+				return value[:4] + "-" + value[4:6] + "-" + value[6:8]
+			}
+		}
+	}
+	return server.EarliestDatestamp
+}
+
+// Sets Наборы, к которым относится запись.
+func (server *OaiServer) Sets(record *MarcRecord) []string {
+	database := server.Source.Database()
+	result := []string{database}
+	if server.KindTag != 0 {
+		kind := strings.TrimSpace(record.FSM(server.KindTag, server.KindCode))
+		if len(kind) != 0 {
+			result = append(result, database+":"+kind)
+		}
+	}
+	return result
+}
+
+// Identifier Идентификатор записи.
+func (server *OaiServer) Identifier(mfn int) string {
+	return server.IdentifierPrefix + strconv.Itoa(mfn)
+}
+
+// parseIdentifier MFN по идентификатору записи (0 -- чужой идентификатор).
+func (server *OaiServer) parseIdentifier(identifier string) int {
+	if !strings.HasPrefix(identifier, server.IdentifierPrefix) {
+		return 0
+	}
+	result, err := strconv.Atoi(identifier[len(server.IdentifierPrefix):])
+	if err != nil || result <= 0 {
+		return 0
+	}
+	return result
+}
+
+// ServeHTTP Обработка запроса OAI-PMH (GET или POST).
+func (server *OaiServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodPost {
+		writer.Header().Set("Allow", "GET, POST")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := &oaiRequest{writer: writer, request: request, args: request.Form}
+	current.verb = current.arg("verb")
+	failure := server.checkArguments(current)
+
+	current.write(`<OAI-PMH xmlns="`, OAI_NAMESPACE, `"`,
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`,
+		` xsi:schemaLocation="`, OAI_NAMESPACE, ` http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd">`)
+	current.write("<responseDate>", time.Now().UTC().Format("2006-01-02T15:04:05Z"), "</responseDate>")
+	current.write("<request")
+	if failure == nil || failure.code != "badVerb" && failure.code != "badArgument" {
+		keys := make([]string, 0, len(current.args))
+		for key := range current.args {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			current.write(" ", key, `="`, xmlEscape(current.arg(key)), `"`)
+		}
+	}
+	current.write(">", xmlEscape(server.baseUrl(request)), "</request>")
+
+	if failure == nil {
+		switch current.verb {
+		case "Identify":
+			server.identify(current)
+		case "ListMetadataFormats":
+			failure = server.listMetadataFormats(current)
+		case "ListSets":
+			failure = server.listSets(current)
+		case "GetRecord":
+			failure = server.getRecord(current)
+		default:
+			failure = server.listRecords(current)
+		}
+	}
+
+	if current.status != 0 {
+		http.Error(writer, failure.message, current.status)
+		return
+	}
+	if failure != nil {
+		current.write(`<error code="`, failure.code, `">`, xmlEscape(failure.message), "</error>")
+	}
+	current.write("</OAI-PMH>")
+
+	writer.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = writer.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n"))
+	_, _ = writer.Write([]byte(current.body.String()))
+}
+
+func (server *OaiServer) baseUrl(request *http.Request) string {
+	if len(server.BaseUrl) != 0 {
+		return server.BaseUrl
+	}
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host + request.URL.Path
+}
+
+// checkArguments Проверка глагола и набора аргументов.
+func (server *OaiServer) checkArguments(current *oaiRequest) *oaiError {
+	allowed, ok := oaiArguments[current.verb]
+	if !ok {
+		return &oaiError{"badVerb", "illegal or missing verb"}
+	}
+	for key, values := range current.args {
+		if len(values) != 1 {
+			return &oaiError{"badArgument", "repeated argument " + key}
+		}
+		if key == "verb" {
+			continue
+		}
+		found := false
+		for _, name := range allowed {
+			found = found || name == key
+		}
+		if !found {
+			return &oaiError{"badArgument", "illegal argument " + key}
+		}
+	}
+
+	if len(current.arg("resumptionToken")) != 0 && len(current.args) != 2 {
+		return &oaiError{"badArgument", "resumptionToken is an exclusive argument"}
+	}
+
+	switch current.verb {
+	case "GetRecord":
+		if len(current.arg("identifier")) == 0 || len(current.arg("metadataPrefix")) == 0 {
+			return &oaiError{"badArgument", "identifier and metadataPrefix are required"}
+		}
+	case "ListIdentifiers", "ListRecords":
+		if len(current.arg("resumptionToken")) == 0 && len(current.arg("metadataPrefix")) == 0 {
+			return &oaiError{"badArgument", "metadataPrefix is required"}
+		}
+		for _, name := range []string{"from", "until"} {
+			value := current.arg(name)
+			if len(value) != 0 {
+				if _, err := time.Parse("2006-01-02", value); err != nil {
+					return &oaiError{"badArgument", "bad " + name + " date (YYYY-MM-DD expected)"}
+				}
+			}
+		}
+		from, until := current.arg("from"), current.arg("until")
+		if len(from) != 0 && len(until) != 0 && from > until {
+			return &oaiError{"badArgument", "from is later than until"}
+		}
+	}
+
+	return nil
+}
+
+func (server *OaiServer) identify(current *oaiRequest) {
+	current.write("<Identify>")
+	current.write("<repositoryName>", xmlEscape(server.RepositoryName), "</repositoryName>")
+	current.write("<baseURL>", xmlEscape(server.baseUrl(current.request)), "</baseURL>")
+	current.write("<protocolVersion>2.0</protocolVersion>")
+	current.write("<adminEmail>", xmlEscape(server.AdminEmail), "</adminEmail>")
+	current.write("<earliestDatestamp>", server.EarliestDatestamp, "</earliestDatestamp>")
+	current.write("<deletedRecord>transient</deletedRecord>")
+	current.write("<granularity>YYYY-MM-DD</granularity>")
+	current.write("</Identify>")
+}
+
+// readRecord Чтение записи по идентификатору.
+func (server *OaiServer) readRecord(current *oaiRequest, identifier string) (*MarcRecord, *oaiError) {
+	mfn := server.parseIdentifier(identifier)
+	if mfn == 0 {
+		return nil, &oaiError{"idDoesNotExist", identifier}
+	}
+	records, err := server.Source.ReadRecords([]int{mfn})
+	if err != nil {
+		return nil, current.sourceFailure(err)
+	}
+	if len(records) == 0 {
+		return nil, &oaiError{"idDoesNotExist", identifier}
+	}
+	return &records[0], nil
+}
+
+func (server *OaiServer) listMetadataFormats(current *oaiRequest) *oaiError {
+	if identifier := current.arg("identifier"); len(identifier) != 0 {
+		if _, failure := server.readRecord(current, identifier); failure != nil {
+			return failure
+		}
+	}
+
+	current.write("<ListMetadataFormats>")
+	for _, format := range oaiFormats {
+		current.write("<metadataFormat><metadataPrefix>", format.prefix, "</metadataPrefix>",
+			"<schema>", format.schema, "</schema>",
+			"<metadataNamespace>", format.namespace, "</metadataNamespace></metadataFormat>")
+	}
+	current.write("</ListMetadataFormats>")
+	return nil
+}
+
+func (server *OaiServer) listSets(current *oaiRequest) *oaiError {
+	if len(current.arg("resumptionToken")) != 0 {
+		return &oaiError{"badResumptionToken", "sets are listed completely"}
+	}
+
+	database := server.Source.Database()
+	current.write("<ListSets>")
+	current.write("<set><setSpec>", xmlEscape(database), "</setSpec><setName>",
+		xmlEscape(server.RepositoryName), "</setName></set>")
+	if server.KindTag != 0 {
+		kinds := make([]string, 0, len(server.KindNames))
+		for kind := range server.KindNames {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			current.write("<set><setSpec>", xmlEscape(database+":"+kind), "</setSpec><setName>",
+				xmlEscape(server.KindNames[kind]), "</setName></set>")
+		}
+	}
+	current.write("</ListSets>")
+	return nil
+}
+
+// writeHeader Вывод заголовка записи.
+func (server *OaiServer) writeHeader(current *oaiRequest, record *MarcRecord) {
+	if record.IsDeleted() {
+		current.write(`<header status="deleted">`)
+	} else {
+		current.write("<header>")
+	}
+	current.write("<identifier>", xmlEscape(server.Identifier(record.Mfn)), "</identifier>")
+	current.write("<datestamp>", server.Datestamp(record), "</datestamp>")
+	for _, set := range server.Sets(record) {
+		current.write("<setSpec>", xmlEscape(set), "</setSpec>")
+	}
+	current.write("</header>")
+}
+
+// writeRecord Вывод записи (для удалённых -- только заголовка).
+func (server *OaiServer) writeRecord(current *oaiRequest, record *MarcRecord, format *oaiFormat) {
+	current.write("<record>")
+	server.writeHeader(current, record)
+	if !record.IsDeleted() {
+		current.write("<metadata>", format.encode(record), "</metadata>")
+	}
+	current.write("</record>")
+}
+
+func (server *OaiServer) getRecord(current *oaiRequest) *oaiError {
+	format := findOaiFormat(current.arg("metadataPrefix"))
+	if format == nil {
+		return &oaiError{"cannotDisseminateFormat", current.arg("metadataPrefix")}
+	}
+	record, failure := server.readRecord(current, current.arg("identifier"))
+	if failure != nil {
+		return failure
+	}
+
+	current.write("<GetRecord>")
+	server.writeRecord(current, record, format)
+	current.write("</GetRecord>")
+	return nil
+}
+
+// matches Соответствует ли запись условиям отбора.
+func (server *OaiServer) matches(record *MarcRecord, token *oaiToken) bool {
+	datestamp := server.Datestamp(record)
+	if len(token.from) != 0 && datestamp < token.from {
+		return false
+	}
+	if len(token.until) != 0 && datestamp > token.until {
+		return false
+	}
+	if len(token.set) != 0 {
+		for _, set := range server.Sets(record) {
+			if set == token.set {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// listRecords Обработка ListIdentifiers и ListRecords: перебор
+// записей порциями по возрастанию MFN.
+func (server *OaiServer) listRecords(current *oaiRequest) *oaiError {
+	token := &oaiToken{prefix: current.arg("metadataPrefix"), set: current.arg("set"),
+		from: current.arg("from"), until: current.arg("until"), nextMfn: 1}
+	if text := current.arg("resumptionToken"); len(text) != 0 {
+		var ok bool
+		if token, ok = decodeOaiToken(text); !ok {
+			return &oaiError{"badResumptionToken", text}
+		}
+	}
+
+	format := findOaiFormat(token.prefix)
+	if format == nil {
+		return &oaiError{"cannotDisseminateFormat", token.prefix}
+	}
+	if len(token.set) != 0 {
+		database := server.Source.Database()
+		if token.set != database && (server.KindTag == 0 || !strings.HasPrefix(token.set, database+":")) {
+			return &oaiError{"noRecordsMatch", "unknown set " + token.set}
+		}
+	}
+
+	maxMfn, err := server.Source.GetMaxMfn()
+	if err != nil {
+		return current.sourceFailure(err)
+	}
+
+	pageSize := server.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	maxScan := server.MaxScan
+	if maxScan <= 0 {
+		maxScan = 10 * pageSize
+	}
+
+	// Продолжение списка начинается с заведомо подходящей записи,
+	// поэтому ни одна порция не оказывается пустой. Если за MaxScan
+	// MFN подходящих записей не нашлось, список считается исчерпанным.
+	var found []MarcRecord
+	nextMfn := 0
+	mfn := token.nextMfn
+	limit := mfn + maxScan
+	for mfn <= maxMfn && mfn < limit && nextMfn == 0 {
+		batch := make([]int, 0, pageSize)
+		for ; mfn <= maxMfn && mfn < limit && len(batch) < pageSize; mfn++ {
+			batch = append(batch, mfn)
+		}
+		records, err := server.Source.ReadRecords(batch)
+		if err != nil {
+			return current.sourceFailure(err)
+		}
+		for i := range records {
+			if !server.matches(&records[i], token) {
+				continue
+			}
+			if len(found) == pageSize {
+				nextMfn = records[i].Mfn
+				break
+			}
+			found = append(found, records[i])
+		}
+	}
+
+	if len(found) == 0 {
+		return &oaiError{"noRecordsMatch", "no records match the request"}
+	}
+
+	current.write("<", current.verb, ">")
+	for i := range found {
+		if current.verb == "ListIdentifiers" {
+			server.writeHeader(current, &found[i])
+		} else {
+			server.writeRecord(current, &found[i], format)
+		}
+	}
+	if nextMfn != 0 {
+		next := *token
+		next.nextMfn = nextMfn
+		current.write("<resumptionToken>", next.encode(), "</resumptionToken>")
+	} else if len(current.arg("resumptionToken")) != 0 {
+		// Последняя порция завершается пустым маркером
+		current.write("<resumptionToken/>")
+	}
+	current.write("</", current.verb, ">")
+	return nil
+}
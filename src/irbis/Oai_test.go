@@ -0,0 +1,242 @@
+package irbis
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeOaiHandler Сервер с пятью записями: третья логически удалена,
+// чётные записи имеют вид документа "05".
+func fakeOaiHandler(command string, params []string) []string {
+	switch command {
+	case "O":
+		return []string{"6"}
+	case "G":
+		count, _ := strconv.Atoi(params[2])
+		result := []string{"0"}
+		for _, line := range params[3 : 3+count] {
+			mfn, _ := strconv.Atoi(line)
+			status := "0"
+			if mfn == 3 {
+				status = "1"
+			}
+			kind := "j"
+			if mfn%2 == 0 {
+				kind = "05"
+			}
+			result = append(result, line+"#0\x1F"+line+"#"+status+"\x1F0#1\x1F"+
+				"200#^aTitle "+line+"\x1F900#^b"+kind+"\x1F907#^a2019010"+line)
+		}
+		return result
+	}
+	return []string{"-1"}
+}
+
+func newFakeOaiServer() *OaiServer {
+	pool := NewConnectionPool("", 1)
+	pool.factory = func() *Connection {
+		return newFakeConnection(fakeOaiHandler)
+	}
+	server := NewOaiServer(NewServerRecordSource(pool, "IBIS"))
+	server.BaseUrl = "http://localhost/oai"
+	server.KindNames["05"] = "Однотомное издание"
+	server.PageSize = 2
+	return server
+}
+
+func oaiGet(t *testing.T, server *OaiServer, query string) string {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/oai?"+query, nil))
+	body := recorder.Body.String()
+
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err, body)
+		}
+	}
+	return body
+}
+
+var oaiTokenRegex = regexp.MustCompile(`<resumptionToken>([^<]+)</resumptionToken>`)
+
+func TestOaiServer_ListRecords_1(t *testing.T) {
+	server := newFakeOaiServer()
+	query := "verb=ListRecords&metadataPrefix=oai_dc"
+	var identifiers []string
+	for pages := 0; pages < 10; pages++ {
+		body := oaiGet(t, server, query)
+		for _, match := range regexp.MustCompile(`<identifier>([^<]+)</identifier>`).FindAllStringSubmatch(body, -1) {
+			identifiers = append(identifiers, match[1])
+		}
+		if strings.Contains(body, "oai:irbis:IBIS/3") &&
+			(!strings.Contains(body, `<header status="deleted"><identifier>oai:irbis:IBIS/3</identifier>`) ||
+				strings.Contains(body, "Title 3")) {
+			t.Fatal(body)
+		}
+		match := oaiTokenRegex.FindStringSubmatch(body)
+		if match == nil {
+			if !strings.Contains(body, "<resumptionToken/>") {
+				t.Fatal(body)
+			}
+			break
+		}
+		query = "verb=ListRecords&resumptionToken=" + match[1]
+	}
+	if strings.Join(identifiers, " ") !=
+		"oai:irbis:IBIS/1 oai:irbis:IBIS/2 oai:irbis:IBIS/3 oai:irbis:IBIS/4 oai:irbis:IBIS/5" {
+		t.Fatal(identifiers)
+	}
+}
+
+func TestOaiServer_ListRecords_2(t *testing.T) {
+	harvest := func(server *OaiServer, query string) (pages []int) {
+		for len(pages) < 10 {
+			body := oaiGet(t, server, query)
+			if strings.Contains(body, `<error code="noRecordsMatch">`) {
+				return
+			}
+			// Схема OAI-PMH требует хотя бы одну запись в порции
+			count := strings.Count(body, "<header")
+			if count == 0 {
+				t.Fatal(body)
+			}
+			pages = append(pages, count)
+			match := oaiTokenRegex.FindStringSubmatch(body)
+			if match == nil {
+				break
+			}
+			query = "verb=ListIdentifiers&resumptionToken=" + match[1]
+		}
+		return
+	}
+
+	// Подходит только MFN 4: за MaxScan MFN она не найдена
+	server := newFakeOaiServer()
+	server.MaxScan = 2
+	query := "verb=ListIdentifiers&metadataPrefix=oai_dc&set=IBIS:05&from=2019-01-04"
+	if pages := harvest(server, query); len(pages) != 0 {
+		t.Fatal(pages)
+	}
+	server.MaxScan = 4
+	if pages := harvest(server, query); len(pages) != 1 || pages[0] != 1 {
+		t.Fatal(pages)
+	}
+
+	// Продолжение указывает на подходящую запись
+	server.PageSize = 1
+	server.MaxScan = 3
+	pages := harvest(server, "verb=ListIdentifiers&metadataPrefix=oai_dc")
+	if len(pages) != 5 {
+		t.Fatal(pages)
+	}
+}
+
+func TestOaiServer_ListIdentifiers_1(t *testing.T) {
+	server := newFakeOaiServer()
+	server.PageSize = 10
+	body := oaiGet(t, server, "verb=ListIdentifiers&metadataPrefix=marcxml&set=IBIS:05&from=2019-01-03")
+	if strings.Count(body, "<header>") != 1 ||
+		!strings.Contains(body, "<identifier>oai:irbis:IBIS/4</identifier><datestamp>2019-01-04</datestamp>"+
+			"<setSpec>IBIS</setSpec><setSpec>IBIS:05</setSpec>") ||
+		strings.Contains(body, "<metadata>") || strings.Contains(body, "resumptionToken") {
+		t.Fatal(body)
+	}
+
+	body = oaiGet(t, server, "verb=ListIdentifiers&metadataPrefix=oai_dc&until=2018-12-31")
+	if !strings.Contains(body, `<error code="noRecordsMatch">`) {
+		t.Fatal(body)
+	}
+}
+
+func TestOaiServer_GetRecord_1(t *testing.T) {
+	server := newFakeOaiServer()
+	body := oaiGet(t, server, "verb=GetRecord&metadataPrefix=marcxml&identifier=oai:irbis:IBIS/2")
+	if !strings.Contains(body, `<datafield tag="200" ind1=" " ind2=" "><subfield code="a">Title 2</subfield>`) {
+		t.Fatal(body)
+	}
+
+	body = oaiGet(t, server, "verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:irbis:IBIS/5")
+	if !strings.Contains(body, "<dc:title>Title 5</dc:title>") {
+		t.Fatal(body)
+	}
+}
+
+func TestOaiServer_Errors_1(t *testing.T) {
+	server := newFakeOaiServer()
+	for query, code := range map[string]string{
+		"":                  "badVerb",
+		"verb=Foo":          "badVerb",
+		"verb=Identify&x=1": "badArgument",
+		"verb=ListRecords":  "badArgument",
+		"verb=ListRecords&metadataPrefix=oai_dc&from=2019":                        "badArgument",
+		"verb=ListRecords&metadataPrefix=mods":                                    "cannotDisseminateFormat",
+		"verb=ListRecords&resumptionToken=xyz":                                    "badResumptionToken",
+		"verb=ListRecords&resumptionToken=xyz&metadataPrefix=oai_dc":              "badArgument",
+		"verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:other:1":             "idDoesNotExist",
+		"verb=GetRecord&metadataPrefix=oai_dc":                                    "badArgument",
+		"verb=ListMetadataFormats&identifier=foo":                                 "idDoesNotExist",
+		"verb=ListSets&resumptionToken=abc":                                       "badResumptionToken",
+		"verb=ListRecords&metadataPrefix=oai_dc&from=2019-02-01&until=2019-01-01": "badArgument",
+	} {
+		body := oaiGet(t, server, query)
+		if !strings.Contains(body, `<error code="`+code+`">`) {
+			t.Fatal(query, body)
+		}
+	}
+}
+
+func TestOaiServer_Errors_2(t *testing.T) {
+	server := newFakeOaiServer()
+	pool := NewConnectionPool("", 1)
+	pool.factory = func() *Connection {
+		connection := newFakeConnection(func(string, []string) []string {
+			return []string{"-100000"}
+		})
+		connection.Connected = false
+		return connection
+	}
+	server.Source = NewServerRecordSource(pool, "IBIS")
+
+	// Недоступность сервера не выдаётся за отсутствие записей
+	for _, query := range []string{
+		"verb=ListRecords&metadataPrefix=oai_dc",
+		"verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:irbis:IBIS/1",
+		"verb=ListMetadataFormats&identifier=oai:irbis:IBIS/1",
+	} {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest("GET", "/oai?"+query, nil))
+		if recorder.Code != http.StatusServiceUnavailable || strings.Contains(recorder.Body.String(), "<error") {
+			t.Fatal(query, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestOaiServer_Identify_1(t *testing.T) {
+	server := newFakeOaiServer()
+	body := oaiGet(t, server, "verb=Identify")
+	if !strings.Contains(body, "<baseURL>http://localhost/oai</baseURL>") ||
+		!strings.Contains(body, "<deletedRecord>transient</deletedRecord>") {
+		t.Fatal(body)
+	}
+
+	body = oaiGet(t, server, "verb=ListSets")
+	if !strings.Contains(body, "<setSpec>IBIS:05</setSpec><setName>Однотомное издание</setName>") {
+		t.Fatal(body)
+	}
+
+	body = oaiGet(t, server, "verb=ListMetadataFormats")
+	if strings.Count(body, "<metadataFormat>") != 2 {
+		t.Fatal(body)
+	}
+}
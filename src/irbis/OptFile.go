@@ -4,8 +4,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// OptWildcard Символ, соответствующий в паттерне любому символу
+// (в том числе отсутствующему в конце значения).
+const OptWildcard = '+'
+
 // OptLine Строка OPT-файла.
 type OptLine struct {
 	// Pattern Паттерн.
@@ -17,7 +22,7 @@ type OptLine struct {
 
 func (opt *OptLine) Parse(text string) bool {
 	rx := regexp.MustCompile(`\s+`)
-	parts := rx.Split(text, 2)
+	parts := rx.Split(strings.TrimSpace(text), 2)
 	if len(parts) != 2 {
 		return false
 	}
@@ -27,6 +32,32 @@ func (opt *OptLine) Parse(text string) bool {
 	return true
 }
 
+// Matches Проверка, соответствует ли значение паттерну.
+// Регистр символов не учитывается. Символ '+' соответствует любому
+// символу, а также отсутствию символа в конце значения.
+func (opt *OptLine) Matches(value string) bool {
+	pattern := []rune(opt.Pattern)
+	testable := []rune(value)
+	if len(testable) > len(pattern) {
+		return false
+	}
+
+	for i, c := range pattern {
+		if i >= len(testable) {
+			if c != OptWildcard {
+				return false
+			}
+			continue
+		}
+
+		if c != OptWildcard && unicode.ToUpper(c) != unicode.ToUpper(testable[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (opt *OptLine) String(width int) string {
 	return RightPad(opt.Pattern, width) + " " + opt.Worksheet
 }
@@ -41,6 +72,10 @@ type OptFile struct {
 
 	// Lines Строки с паттернами.
 	Lines []*OptLine
+
+	// DefaultWorksheet Рабочий лист, указанный в завершающей
+	// строке "*****" (используется, если ни один паттерн не подошёл).
+	DefaultWorksheet string
 }
 
 func NewOptFile() *OptFile {
@@ -51,20 +86,58 @@ func NewOptFile() *OptFile {
 	return result
 }
 
+// ReadOptFile Загрузка OPT-файла с локального диска.
+func ReadOptFile(filename string) (*OptFile, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewOptFile()
+	result.Parse(lines)
+	return result, nil
+}
+
 // GetWorksheet Получение рабочего листа записи.
+// Если подходящий рабочий лист не найден, возвращается пустая строка.
 func (opt *OptFile) GetWorksheet(record *MarcRecord) string {
-	return record.FM(opt.WorksheetTag)
+	return opt.SelectWorksheet(record.FM(opt.WorksheetTag))
+}
+
+// SelectWorksheet Подбор рабочего листа по значению поля.
+// Значение обрезается до длины WorksheetLength и последовательно
+// сравнивается с паттернами. Если ни один из них не подошёл,
+// возвращается рабочий лист по умолчанию (возможно, пустой).
+func (opt *OptFile) SelectWorksheet(value string) string {
+	value = strings.TrimSpace(value)
+	runes := []rune(value)
+	if opt.WorksheetLength > 0 && len(runes) > opt.WorksheetLength {
+		value = string(runes[:opt.WorksheetLength])
+	}
+
+	for _, line := range opt.Lines {
+		if line.Matches(value) {
+			return line.Worksheet
+		}
+	}
+
+	return opt.DefaultWorksheet
 }
 
 func (opt *OptFile) Parse(lines []string) {
-	opt.WorksheetTag, _ = strconv.Atoi(lines[0])
-	opt.WorksheetLength, _ = strconv.Atoi(lines[1])
+	if len(lines) < 2 {
+		return
+	}
+
+	opt.WorksheetTag, _ = strconv.Atoi(strings.TrimSpace(lines[0]))
+	opt.WorksheetLength, _ = strconv.Atoi(strings.TrimSpace(lines[1]))
 	for _, line := range lines[2:] {
-		if len(line) == 0 {
+		if len(strings.TrimSpace(line)) == 0 {
 			continue
 		}
 
 		if strings.HasPrefix(line, "*****") {
+			opt.DefaultWorksheet = strings.TrimSpace(line[5:])
 			break
 		}
 
@@ -75,6 +148,11 @@ func (opt *OptFile) Parse(lines []string) {
 	}
 }
 
+// Save Сохранение OPT-файла на локальный диск.
+func (opt *OptFile) Save(filename string) error {
+	return WriteAnsiFile(filename, opt.String())
+}
+
 func (opt *OptFile) String() string {
 	result := strings.Builder{}
 	result.WriteString(strconv.Itoa(opt.WorksheetTag))
@@ -87,7 +165,12 @@ func (opt *OptFile) String() string {
 		result.WriteString("\n")
 	}
 
-	result.WriteString("*****\n")
+	result.WriteString("*****")
+	if len(opt.DefaultWorksheet) != 0 {
+		result.WriteString(" ")
+		result.WriteString(opt.DefaultWorksheet)
+	}
+	result.WriteString("\n")
 
 	return result.String()
 }
@@ -0,0 +1,57 @@
+package irbis
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+const testOptFile = "../../data/ws31.opt"
+
+func TestOptLine_Matches_1(t *testing.T) {
+	line := OptLine{Pattern: "NJ+++", Worksheet: "NJ31"}
+	if !line.Matches("NJ") || !line.Matches("njk") || !line.Matches("NJKLM") {
+		t.FailNow()
+	}
+	if line.Matches("N") || line.Matches("NJKLMN") || line.Matches("PJ") {
+		t.FailNow()
+	}
+}
+
+func TestOptFile_SelectWorksheet_1(t *testing.T) {
+	opt, err := ReadOptFile(testOptFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.WorksheetTag != 920 || opt.WorksheetLength != 5 || len(opt.Lines) != 14 {
+		t.FailNow()
+	}
+	if opt.SelectWorksheet("J") != "!RPJ51" ||
+		opt.SelectWorksheet("njk") != "!NJ31" ||
+		opt.SelectWorksheet("SPEC") != "SPEC42" ||
+		opt.SelectWorksheet("UNKNOWN") != "PAZK42" ||
+		opt.SelectWorksheet("") != "PAZK42" {
+		t.FailNow()
+	}
+
+	record := NewMarcRecord()
+	record.Add(920, "ASP")
+	if opt.GetWorksheet(record) != "ASP42" {
+		t.FailNow()
+	}
+}
+
+func TestOptFile_SelectWorksheet_2(t *testing.T) {
+	opt := NewOptFile()
+	opt.Parse([]string{"920", "5", "PAZK  PAZK42", "***** DEFAULT"})
+	if opt.SelectWorksheet("PAZK") != "PAZK42" || opt.SelectWorksheet("J") != "DEFAULT" {
+		t.FailNow()
+	}
+}
+
+func TestOptFile_String_1(t *testing.T) {
+	original, _ := ioutil.ReadFile(testOptFile)
+	opt, _ := ReadOptFile(testOptFile)
+	if opt.String() != string(original) {
+		t.FailNow()
+	}
+}
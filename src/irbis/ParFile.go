@@ -37,6 +37,18 @@ func NewParFile(mst string) *ParFile {
 	return result
 }
 
+// ReadParFile Загрузка PAR-файла с локального диска.
+func ReadParFile(filename string) (*ParFile, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result := NewParFile("")
+	result.Parse(lines)
+	return result, nil
+}
+
 // Parse Разбор ответа сервера.
 func (par *ParFile) Parse(lines []string) {
 	m := make(map[int]string)
@@ -1,6 +1,9 @@
 package irbis
 
 import (
+	"bufio"
+	"errors"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -31,3 +34,57 @@ func (record *MarcRecord) ToPlainText() string {
 
 	return result.String()
 }
+
+// PlainTextReader считывает записи в текстовом формате
+// (строки "метка#значение", записи разделены строкой "*****").
+type PlainTextReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewPlainTextReader создает читателя текстовых записей (UTF-8).
+func NewPlainTextReader(reader io.Reader) *PlainTextReader {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &PlainTextReader{scanner: scanner}
+}
+
+// Read считывает очередную запись.
+// По достижении конца потока возвращается io.EOF.
+func (reader *PlainTextReader) Read() (*MarcRecord, error) {
+	var result *MarcRecord
+	for reader.scanner.Scan() {
+		reader.line++
+		line := strings.TrimRight(reader.scanner.Text(), "\r")
+		if line == "*****" {
+			if result != nil {
+				return result, nil
+			}
+			continue
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(line, "#", 2)
+		tag, err := strconv.Atoi(parts[0])
+		if len(parts) != 2 || err != nil || tag <= 0 {
+			return nil, errors.New("bad field in line " + strconv.Itoa(reader.line) + ": " + line)
+		}
+		if result == nil {
+			result = NewMarcRecord()
+		}
+		field := result.Add(tag, "")
+		if len(parts[1]) != 0 {
+			field.DecodeBody(parts[1])
+		}
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, io.EOF
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package irbis
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPlainTextReader_Read_1(t *testing.T) {
+	first := NewMarcRecord()
+	first.Add(200, "").Add('a', "Война и мир").Add('f', "Толстой")
+	first.Add(920, "PAZK")
+	second := NewMarcRecord()
+	second.Add(700, "").Add('a', "Пушкин")
+	text := first.ToPlainText() + "*****\r\n\n" + second.ToPlainText() + "*****\n" + "300#\n"
+
+	reader := NewPlainTextReader(strings.NewReader(text))
+	var records []*MarcRecord
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 3 ||
+		records[0].FSM(200, 'f') != "Толстой" || records[0].FM(920) != "PAZK" ||
+		records[1].FSM(700, 'a') != "Пушкин" ||
+		len(records[2].Fields) != 1 || records[2].Fields[0].Tag != 300 {
+		t.Fatal(records)
+	}
+
+	reader = NewPlainTextReader(strings.NewReader("abc#def\n"))
+	if _, err := reader.Read(); err == nil || err == io.EOF {
+		t.Fatal(err)
+	}
+}
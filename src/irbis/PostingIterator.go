@@ -0,0 +1,99 @@
+package irbis
+
+// DefaultPostingPageSize Количество постингов, запрашиваемых
+// итератором за один раз (по умолчанию).
+const DefaultPostingPageSize = 1024
+
+// PostingIterator Последовательный перебор постингов термина
+// (или списка терминов) с автоматической подкачкой страниц.
+type PostingIterator struct {
+	// PageSize Количество постингов, запрашиваемых за один раз.
+	PageSize int
+
+	parameters PostingParameters
+	fetch      func(parameters *PostingParameters) ([]TermPosting, error)
+	page       []TermPosting
+	index      int
+	current    TermPosting
+	exhausted  bool
+	done       bool
+	err        error
+}
+
+func newPostingIterator(parameters *PostingParameters,
+	fetch func(parameters *PostingParameters) ([]TermPosting, error)) *PostingIterator {
+	result := &PostingIterator{parameters: *parameters, fetch: fetch}
+	result.PageSize = parameters.NumberOfPostings
+	if result.PageSize <= 0 {
+		result.PageSize = DefaultPostingPageSize
+	}
+	if result.parameters.FirstPosting <= 0 {
+		result.parameters.FirstPosting = 1
+	}
+	return result
+}
+
+// NewPostingIterator Создание итератора постингов, получаемых с сервера.
+func NewPostingIterator(connection *Connection, parameters *PostingParameters) *PostingIterator {
+	return newPostingIterator(parameters, connection.readPostings)
+}
+
+// NewDirectPostingIterator Создание итератора постингов,
+// считываемых непосредственно из файлов базы данных.
+// Каждая страница читается с того места IFP-файла,
+// где закончилась предыдущая.
+func NewDirectPostingIterator(access *DirectAccess, parameters *PostingParameters) *PostingIterator {
+	return newPostingIterator(parameters, access.newPostingCursor(parameters).readPage)
+}
+
+// Next Переход к следующему постингу.
+// Возвращает false, если постингов больше нет или произошла ошибка.
+func (iterator *PostingIterator) Next() bool {
+	for !iterator.done {
+		if iterator.index < len(iterator.page) {
+			iterator.current = iterator.page[iterator.index]
+			iterator.index++
+			return true
+		}
+
+		if iterator.exhausted {
+			iterator.done = true
+			break
+		}
+
+		iterator.fetchPage()
+	}
+
+	return false
+}
+
+func (iterator *PostingIterator) fetchPage() {
+	parameters := iterator.parameters
+	parameters.NumberOfPostings = iterator.PageSize
+	if parameters.NumberOfPostings <= 0 {
+		parameters.NumberOfPostings = DefaultPostingPageSize
+	}
+
+	iterator.page, iterator.err = iterator.fetch(&parameters)
+	iterator.index = 0
+	if iterator.err != nil {
+		iterator.page = nil
+		iterator.done = true
+		return
+	}
+
+	iterator.parameters.FirstPosting += len(iterator.page)
+	if len(iterator.page) < parameters.NumberOfPostings {
+		iterator.exhausted = true
+	}
+}
+
+// Posting Текущий постинг.
+func (iterator *PostingIterator) Posting() TermPosting {
+	return iterator.current
+}
+
+// Err Ошибка, прервавшая перебор (nil, если ошибок не было).
+func (iterator *PostingIterator) Err() error {
+	return iterator.err
+}
@@ -0,0 +1,260 @@
+package irbis
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize Максимальное количество элементов кэша по умолчанию.
+const DefaultCacheSize = 10000
+
+// CacheOptions Параметры кэша.
+type CacheOptions struct {
+	// MaxEntries Максимальное количество элементов. При переполнении
+	// вытесняются давно не использовавшиеся элементы
+	// (0 -- DefaultCacheSize).
+	MaxEntries int
+
+	// TTL Время жизни элемента (0 -- без ограничения).
+	TTL time.Duration
+
+	// Revalidate Проверять актуальность записи, найденной в кэше:
+	// у сервера запрашивается следующая за ней версия (ответ
+	// на такой запрос короче самой записи). Если такая версия
+	// есть, запись считывается заново.
+	Revalidate bool
+}
+
+// CacheStats Статистика обращений к кэшу.
+type CacheStats struct {
+	Hits          int64 // Найдено в кэше.
+	Misses        int64 // Не найдено в кэше (в том числе устаревшие элементы).
+	Evictions     int64 // Вытеснено при переполнении.
+	Invalidations int64 // Удалено при изменении данных на сервере.
+	Stale         int64 // Найдено в кэше, но устарело (см. CacheOptions.Revalidate).
+	Entries       int   // Текущее количество элементов.
+}
+
+// HitRatio Доля обращений, обслуженных кэшем.
+func (stats CacheStats) HitRatio() float64 {
+	total := stats.Hits + stats.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(total)
+}
+
+func (stats CacheStats) String() string {
+	return fmt.Sprintf("hits: %d, misses: %d (%.1f%%), evictions: %d, invalidations: %d, stale: %d, entries: %d",
+		stats.Hits, stats.Misses, 100*stats.HitRatio(), stats.Evictions, stats.Invalidations,
+		stats.Stale, stats.Entries)
+}
+
+// Виды элементов кэша.
+const (
+	cacheRecord = 'R' // Запись.
+	cacheFormat = 'F' // Расформатированная запись.
+	cacheCount  = 'S' // Количество найденных записей.
+	cacheText   = 'T' // Текстовый файл.
+	cacheLines  = 'L' // Текстовый файл, разбитый на строки.
+)
+
+// cacheKey Ключ элемента кэша.
+type cacheKey struct {
+	kind     byte
+	database string
+	mfn      int
+	text     string // Формат, поисковое выражение либо спецификация файла.
+}
+
+// cacheEntry Элемент кэша.
+type cacheEntry struct {
+	key     cacheKey
+	value   interface{}
+	version int // Версия записи (для cacheRecord).
+	expires time.Time
+}
+
+// RecordCache Кэш записей, результатов форматирования и поиска,
+// а также текстовых файлов сервера. Может использоваться
+// одновременно несколькими подключениями (см. CachedConnection),
+// в том числе из разных горутин.
+type RecordCache struct {
+	options    CacheOptions
+	mutex      sync.Mutex
+	entries    map[cacheKey]*list.Element
+	order      *list.List // В начале -- недавно использованные элементы.
+	stats      CacheStats
+	generation uint64 // Увеличивается при каждой инвалидации.
+	now        func() time.Time
+}
+
+// NewRecordCache Создание кэша с указанными параметрами
+// (nil -- параметры по умолчанию).
+func NewRecordCache(options *CacheOptions) *RecordCache {
+	result := &RecordCache{entries: make(map[cacheKey]*list.Element),
+		order: list.New(), now: time.Now}
+	if options != nil {
+		result.options = *options
+	}
+	if result.options.MaxEntries <= 0 {
+		result.options.MaxEntries = DefaultCacheSize
+	}
+	return result
+}
+
+// recordKey Ключ элемента, относящегося к базе данных
+// (имя базы данных не зависит от регистра).
+func recordKey(kind byte, database string, mfn int, text string) cacheKey {
+	return cacheKey{kind: kind, database: strings.ToUpper(database), mfn: mfn, text: text}
+}
+
+// fileKey Спецификации файлов сравниваются без учёта регистра.
+func fileKey(kind byte, specification string) cacheKey {
+	return cacheKey{kind: kind, text: strings.ToUpper(specification)}
+}
+
+// get Поиск элемента. Устаревшие элементы удаляются.
+// Возвращает также текущее поколение кэша, которое
+// следует передать в put при добавлении элемента.
+func (cache *RecordCache) get(key cacheKey) (value interface{}, generation uint64, ok bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, found := cache.entries[key]; found {
+		entry := element.Value.(*cacheEntry)
+		if entry.expires.IsZero() || cache.now().Before(entry.expires) {
+			cache.order.MoveToFront(element)
+			cache.stats.Hits++
+			return entry.value, cache.generation, true
+		}
+		cache.removeElement(element)
+	}
+
+	cache.stats.Misses++
+	return nil, cache.generation, false
+}
+
+// stale Учёт элемента, который был найден get, но оказался
+// устаревшим: обращение считается промахом. Возвращает текущее
+// поколение кэша для передачи в put.
+func (cache *RecordCache) stale() uint64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.stats.Hits--
+	cache.stats.Misses++
+	cache.stats.Stale++
+	return cache.generation
+}
+
+// put Добавление элемента, полученного с сервера. Если с момента
+// обращения к get (generation) данные на сервере изменялись, элемент
+// мог устареть и не добавляется.
+func (cache *RecordCache) put(key cacheKey, value interface{}, version int, generation uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation == cache.generation {
+		cache.store(key, value, version)
+	}
+}
+
+// update Добавление записи, только что сохранённой на сервере.
+func (cache *RecordCache) update(key cacheKey, value interface{}, version int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.store(key, value, version)
+}
+
+// store Добавление элемента с вытеснением давно не использовавшихся.
+// Более новая версия записи, уже находящаяся в кэше, не заменяется
+// старой.
+func (cache *RecordCache) store(key cacheKey, value interface{}, version int) {
+	if element, found := cache.entries[key]; found {
+		if element.Value.(*cacheEntry).version > version {
+			return
+		}
+		cache.removeElement(element)
+	}
+
+	entry := &cacheEntry{key: key, value: value, version: version}
+	if cache.options.TTL > 0 {
+		entry.expires = cache.now().Add(cache.options.TTL)
+	}
+	cache.entries[key] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.options.MaxEntries {
+		cache.removeElement(cache.order.Back())
+		cache.stats.Evictions++
+	}
+}
+
+func (cache *RecordCache) removeElement(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*cacheEntry).key)
+}
+
+// invalidate Удаление элементов, удовлетворяющих условию.
+func (cache *RecordCache) invalidate(match func(key *cacheKey) bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	for key, element := range cache.entries {
+		if match(&key) {
+			cache.removeElement(element)
+			cache.stats.Invalidations++
+		}
+	}
+}
+
+// InvalidateRecord Удаление из кэша записи с указанным MFN,
+// результатов её форматирования, а также результатов поиска
+// в её базе данных.
+func (cache *RecordCache) InvalidateRecord(database string, mfn int) {
+	database = strings.ToUpper(database)
+	cache.invalidate(func(key *cacheKey) bool {
+		if key.database != database {
+			return false
+		}
+		return key.kind == cacheCount || key.mfn == mfn
+	})
+}
+
+// InvalidateDatabase Удаление из кэша всех записей указанной
+// базы данных, результатов их форматирования и поиска.
+func (cache *RecordCache) InvalidateDatabase(database string) {
+	database = strings.ToUpper(database)
+	cache.invalidate(func(key *cacheKey) bool {
+		return key.database == database
+	})
+}
+
+// InvalidateFile Удаление из кэша текстового файла.
+func (cache *RecordCache) InvalidateFile(specification string) {
+	text := strings.ToUpper(specification)
+	cache.invalidate(func(key *cacheKey) bool {
+		return (key.kind == cacheText || key.kind == cacheLines) && key.text == text
+	})
+}
+
+// Clear Удаление из кэша всех элементов.
+func (cache *RecordCache) Clear() {
+	cache.invalidate(func(key *cacheKey) bool {
+		return true
+	})
+}
+
+// Stats Статистика обращений к кэшу.
+func (cache *RecordCache) Stats() CacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	result := cache.stats
+	result.Entries = cache.order.Len()
+	return result
+}
@@ -0,0 +1,77 @@
+package irbis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordCache_Get_1(t *testing.T) {
+	cache := NewRecordCache(&CacheOptions{MaxEntries: 2, TTL: time.Minute})
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	first := recordKey(cacheRecord, "ibis", 1, "")
+	second := recordKey(cacheRecord, "IBIS", 2, "")
+	third := recordKey(cacheRecord, "IBIS", 3, "")
+	_, generation, ok := cache.get(first)
+	if ok {
+		t.FailNow()
+	}
+	cache.put(first, "1", 1, generation)
+	cache.put(second, "2", 1, generation)
+	if value, _, ok := cache.get(recordKey(cacheRecord, "IBIS", 1, "")); !ok || value != "1" {
+		t.Fatal(value)
+	}
+
+	// Вытесняется давно не использовавшаяся запись 2
+	cache.put(third, "3", 1, generation)
+	if _, _, ok = cache.get(second); ok {
+		t.FailNow()
+	}
+	if _, _, ok = cache.get(first); !ok {
+		t.FailNow()
+	}
+
+	// Истечение срока жизни
+	now = now.Add(2 * time.Minute)
+	if _, _, ok = cache.get(third); ok {
+		t.FailNow()
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 3 || stats.Evictions != 1 || stats.Entries != 1 {
+		t.Fatal(stats)
+	}
+}
+
+func TestRecordCache_Put_1(t *testing.T) {
+	cache := NewRecordCache(nil)
+	key := recordKey(cacheRecord, "IBIS", 1, "")
+
+	// Старая версия не заменяет более новую
+	cache.update(key, "v2", 2)
+	_, generation, _ := cache.get(recordKey(cacheRecord, "IBIS", 5, ""))
+	cache.put(key, "v1", 1, generation)
+	if value, _, _ := cache.get(key); value != "v2" {
+		t.Fatal(value)
+	}
+
+	// Данные, прочитанные до изменения на сервере, не кэшируются
+	other := recordKey(cacheFormat, "IBIS", 2, "@brief")
+	cache.InvalidateRecord("ibis", 2)
+	cache.put(other, "stale", 0, generation)
+	if _, _, ok := cache.get(other); ok {
+		t.FailNow()
+	}
+
+	cache.put(recordKey(cacheCount, "IBIS", 0, "K=A"), 10, 0, cache.generation)
+	cache.put(fileKey(cacheText, "2.IBIS.brief.pft"), "v200", 0, cache.generation)
+	cache.InvalidateRecord("IBIS", 1)
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Invalidations != 2 {
+		t.Fatal(stats)
+	}
+	cache.InvalidateFile("2.ibis.BRIEF.pft")
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Fatal(stats)
+	}
+}
@@ -0,0 +1,121 @@
+package irbis
+
+import (
+	"context"
+	"errors"
+)
+
+// RecordSource Источник записей одной базы данных: сервер ИРБИС64
+// либо файлы базы, открытые для прямого доступа.
+type RecordSource interface {
+	// Database Имя базы данных.
+	Database() string
+
+	// GetMaxMfn Максимальный MFN в базе данных.
+	GetMaxMfn() (int, error)
+
+	// ReadRecords Чтение записей с указанными MFN. Отсутствующие
+	// и физически удалённые записи пропускаются, логически
+	// удалённые выдаются с соответствующим статусом.
+	ReadRecords(mfnList []int) ([]MarcRecord, error)
+}
+
+//===================================================================
+
+// serverRecordSource Записи, считываемые с сервера
+// через пул подключений.
+type serverRecordSource struct {
+	pool     *ConnectionPool
+	database string
+}
+
+// NewServerRecordSource Источник записей указанной базы данных
+// на сервере ИРБИС64.
+func NewServerRecordSource(pool *ConnectionPool, database string) RecordSource {
+	return &serverRecordSource{pool: pool, database: database}
+}
+
+func (source *serverRecordSource) Database() string {
+	return source.database
+}
+
+func (source *serverRecordSource) GetMaxMfn() (int, error) {
+	connection, err := source.pool.Acquire(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer source.pool.Release(connection)
+
+	result := connection.GetMaxMfn(source.database)
+	if connection.LastError < 0 {
+		return 0, errors.New(DescribeError(connection.LastError))
+	}
+	// Сервер выдаёт MFN, который получит следующая запись
+	return result - 1, nil
+}
+
+func (source *serverRecordSource) ReadRecords(mfnList []int) ([]MarcRecord, error) {
+	if len(mfnList) == 0 {
+		return nil, nil
+	}
+
+	connection, err := source.pool.Acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer source.pool.Release(connection)
+
+	return connection.readRecordsBatch(source.database, mfnList)
+}
+
+//===================================================================
+
+// directRecordSource Записи, считываемые непосредственно
+// из файлов базы данных.
+type directRecordSource struct {
+	access *DirectAccess
+}
+
+// NewDirectRecordSource Источник записей базы данных,
+// открытой для прямого доступа.
+func NewDirectRecordSource(access *DirectAccess) RecordSource {
+	return &directRecordSource{access: access}
+}
+
+func (source *directRecordSource) Database() string {
+	return source.access.location.Name
+}
+
+func (source *directRecordSource) GetMaxMfn() (int, error) {
+	return source.access.GetMaxMfn(), nil
+}
+
+func (source *directRecordSource) ReadRecords(mfnList []int) (result []MarcRecord, err error) {
+	maxMfn := source.access.GetMaxMfn()
+	for _, mfn := range mfnList {
+		if mfn <= 0 || mfn > maxMfn {
+			continue
+		}
+
+		var xrf XrfRecord
+		xrf, err = source.access.xrf.ReadRecord(mfn)
+		if err != nil {
+			return nil, err
+		}
+		if xrf.Offset() <= 0 || xrf.Status&(PHYSICALLY_DELETED|ABSENT) != 0 {
+			continue
+		}
+
+		var mst *MstRecord
+		mst, err = source.access.mst.ReadRecord(xrf.Offset())
+		if err != nil {
+			return nil, err
+		}
+
+		record := mst.Decode()
+		record.Database = source.Database()
+		result = append(result, *record)
+	}
+
+	return
+}
@@ -0,0 +1,240 @@
+package irbis
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// StreamOptions Параметры потокового чтения и пакетной записи записей.
+type StreamOptions struct {
+	// PageSize Количество MFN, запрашиваемых за один поиск.
+	PageSize int
+
+	// BatchSize Количество записей, считываемых или сохраняемых
+	// за один запрос.
+	BatchSize int
+
+	// Workers Количество одновременно выполняемых запросов.
+	Workers int
+
+	// Pool Пул, из которого берутся подключения для запросов
+	// (nil -- на время работы создаётся пул из Workers подключений
+	// с теми же настройками, что и исходное; при нестандартном
+	// транспорте -- из одного подключения).
+	Pool *ConnectionPool
+}
+
+// Значения параметров потокового чтения по умолчанию.
+const (
+	DefaultStreamPageSize  = 10000
+	DefaultStreamBatchSize = 100
+	DefaultStreamWorkers   = 4
+)
+
+// withDefaults Параметры, в которых незаданные значения
+// заменены значениями по умолчанию.
+func (options *StreamOptions) withDefaults() (result StreamOptions) {
+	if options != nil {
+		result = *options
+	}
+	if result.PageSize <= 0 {
+		result.PageSize = DefaultStreamPageSize
+	}
+	if result.BatchSize <= 0 {
+		result.BatchSize = DefaultStreamBatchSize
+	}
+	if result.Workers <= 0 {
+		result.Workers = DefaultStreamWorkers
+	}
+	return
+}
+
+// RecordStream Поток записей, найденных на сервере.
+// Записи выдаются в порядке, в котором их вернул поиск.
+//
+//	stream := connection.SearchStream(ctx, `"A=ПУШКИН$"`, nil)
+//	defer stream.Close()
+//	for stream.Next() {
+//		fmt.Println(stream.Record())
+//	}
+//	if stream.Err() != nil { ... }
+type RecordStream struct {
+	records chan *MarcRecord
+	cancel  context.CancelFunc
+	current *MarcRecord
+	mutex   sync.Mutex
+	err     error
+}
+
+// Next Переход к следующей записи. Возвращает false, если записей
+// больше нет, произошла ошибка или истёк контекст.
+func (stream *RecordStream) Next() bool {
+	record, ok := <-stream.records
+	if !ok {
+		return false
+	}
+	stream.current = record
+	return true
+}
+
+// Record Текущая запись.
+func (stream *RecordStream) Record() *MarcRecord {
+	return stream.current
+}
+
+// Err Ошибка, прервавшая поток (nil, если ошибок не было).
+// Имеет смысл после того, как Next вернул false.
+func (stream *RecordStream) Err() error {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	return stream.err
+}
+
+// Close Досрочное завершение потока с освобождением ресурсов.
+func (stream *RecordStream) Close() {
+	stream.cancel()
+	for range stream.records {
+		// дочитываем уже полученные записи
+	}
+}
+
+func (stream *RecordStream) fail(err error) {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if stream.err == nil {
+		stream.err = err
+	}
+}
+
+// recordBatch Порция MFN и результат её чтения.
+type recordBatch struct {
+	mfns    []int
+	records []MarcRecord
+	err     error
+	ready   chan struct{}
+}
+
+// run Поиск и чтение записей. Поиск выполняется порциями по PageSize
+// MFN, чтение -- пакетами по BatchSize записей в Workers потоков.
+func (stream *RecordStream) run(ctx context.Context, connection *Connection,
+	expression string, options StreamOptions) {
+	defer stream.cancel()
+	defer close(stream.records)
+
+	database := connection.Database
+	queue := make(chan *recordBatch, options.Workers)
+	jobs := make(chan *recordBatch)
+	pool, release := connection.workerPool(options)
+	workers := sync.WaitGroup{}
+	defer func() {
+		// Временный пул закрывается, когда все запросы завершены
+		go func() {
+			workers.Wait()
+			release()
+		}()
+	}()
+
+	for i := 0; i < options.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for batch := range jobs {
+				batch.err = withWorker(ctx, pool, func(worker *Connection) (err error) {
+					batch.records, err = worker.readRecordsBatch(database, batch.mfns)
+					return
+				})
+				close(batch.ready)
+			}
+		}()
+	}
+
+	// Порции ставятся в очередь в порядке поиска
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		defer close(queue)
+		defer close(jobs)
+
+		first := 1
+		for {
+			var total int
+			var found []int
+			err := withWorker(ctx, pool, func(searcher *Connection) (err error) {
+				total, found, err = searcher.searchPage(database, expression,
+					first, options.PageSize)
+				return
+			})
+			if err != nil {
+				batch := &recordBatch{err: err, ready: make(chan struct{})}
+				close(batch.ready)
+				select {
+				case queue <- batch:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			for start := 0; start < len(found); start += options.BatchSize {
+				stop := start + options.BatchSize
+				if stop > len(found) {
+					stop = len(found)
+				}
+				batch := &recordBatch{mfns: found[start:stop], ready: make(chan struct{})}
+				select {
+				case queue <- batch:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case jobs <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			first += len(found)
+			if len(found) == 0 || first > total {
+				return
+			}
+		}
+	}()
+
+	for batch := range queue {
+		select {
+		case <-batch.ready:
+		case <-ctx.Done():
+			stream.fail(ctx.Err())
+			return
+		}
+
+		if batch.err != nil {
+			stream.fail(batch.err)
+			return
+		}
+
+		for i := range batch.records {
+			select {
+			case stream.records <- &batch.records[i]:
+			case <-ctx.Done():
+				stream.fail(ctx.Err())
+				return
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		stream.fail(err)
+	}
+}
+
+// RecordWriteResult Результат сохранения одной записи
+// (см. Connection.WriteRecordsBatched).
+type RecordWriteResult struct {
+	Index int   // Индекс записи в исходном слайсе.
+	Mfn   int   // MFN, присвоенный записи сервером.
+	Err   error // Ошибка (nil, если запись сохранена).
+}
+
+// errRecordNotSaved Сервер не вернул сохранённую запись.
+var errRecordNotSaved = errors.New("record not saved")
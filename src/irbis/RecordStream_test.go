@@ -0,0 +1,272 @@
+package irbis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSocket Имитация сервера: запрос разбирается на команду
+// и параметры, ответ формируется обработчиком.
+type fakeSocket struct {
+	handler func(command string, params []string) []string
+}
+
+func (socket *fakeSocket) TalkToServer(query *ClientQuery) *ServerResponse {
+	lines := strings.Split(string(bytes.Join(query.chunks, nil)), "\n")
+	body := socket.handler(lines[0], lines[10:])
+	answer := lines[0] + "\r\n1\r\n1\r\n0\r\n64.2014\r\n\r\n\r\n\r\n\r\n\r\n" +
+		strings.Join(body, "\r\n")
+
+	client, server := net.Pipe()
+	go func() {
+		_, _ = server.Write([]byte(answer))
+		_ = server.Close()
+	}()
+	return NewServerResponse(client)
+}
+
+func newFakeConnection(handler func(command string, params []string) []string) *Connection {
+	result := NewConnection()
+	result.Connected = true
+	result.socket = &fakeSocket{handler: handler}
+	return result
+}
+
+func TestConnection_Execute_1(t *testing.T) {
+	socket := &idSocket{fakeSocket: fakeSocket{handler: fakeSearchHandler(1)},
+		queries: make(map[string][]int)}
+	connection := NewConnection()
+	connection.socket = socket
+	if !connection.Connect() {
+		t.FailNow()
+	}
+	connection.NoOp()
+	connection.GetMaxMfn("IBIS")
+	connection.Disconnect()
+
+	// Каждый запрос получает следующий номер
+	ids := socket.queries[strconv.Itoa(connection.ClientId)]
+	if fmt.Sprint(ids) != "[1 2 3 4]" || connection.QueryId != 5 {
+		t.Fatal(ids, connection.QueryId)
+	}
+}
+
+// fakeSearchHandler Сервер, на любой поиск находящий записи 1..total.
+func fakeSearchHandler(total int) func(command string, params []string) []string {
+	return func(command string, params []string) []string {
+		switch command {
+		case "A":
+			return []string{"0", "5"}
+		case "K":
+			count, _ := strconv.Atoi(params[2])
+			first, _ := strconv.Atoi(params[3])
+			result := []string{"0", strconv.Itoa(total)}
+			for mfn := first; mfn < first+count && mfn <= total; mfn++ {
+				result = append(result, strconv.Itoa(mfn))
+			}
+			return result
+		case "G":
+			count, _ := strconv.Atoi(params[2])
+			result := []string{"0"}
+			for _, line := range params[3 : 3+count] {
+				result = append(result, line+"#0\x1F"+line+"#0\x1F0#1\x1F200#^aTitle "+line)
+			}
+			return result
+		}
+		return []string{"-1"}
+	}
+}
+
+func TestSearchStream_1(t *testing.T) {
+	connection := newFakeConnection(fakeSearchHandler(250))
+	options := &StreamOptions{PageSize: 100, BatchSize: 7, Workers: 3}
+	stream := connection.SearchStream(context.Background(), "T=A$", options)
+	defer stream.Close()
+
+	expected := 1
+	for stream.Next() {
+		record := stream.Record()
+		if record.Mfn != expected || record.FSM(200, 'a') != "Title "+strconv.Itoa(expected) {
+			t.Fatal(record.Mfn, expected)
+		}
+		expected++
+	}
+	if stream.Err() != nil || expected != 251 {
+		t.Fatal(expected, stream.Err())
+	}
+}
+
+func TestSearchStream_2(t *testing.T) {
+	connection := newFakeConnection(fakeSearchHandler(1000))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := connection.SearchStream(ctx, "T=A$", &StreamOptions{BatchSize: 10})
+	count := 0
+	for stream.Next() {
+		count++
+		if count == 15 {
+			cancel()
+		}
+	}
+	if stream.Err() != context.Canceled || count >= 1000 {
+		t.Fatal(count, stream.Err())
+	}
+
+	connection = newFakeConnection(func(string, []string) []string { return []string{"-140"} })
+	stream = connection.SearchStream(context.Background(), "T=A$", nil)
+	if stream.Next() || stream.Err() == nil {
+		t.FailNow()
+	}
+	stream.Close()
+}
+
+func TestWriteRecordsBatched_1(t *testing.T) {
+	mutex := sync.Mutex{}
+	nextMfn := 100
+	newMfn := func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		nextMfn++
+		return strconv.Itoa(nextMfn)
+	}
+	connection := newFakeConnection(func(command string, params []string) []string {
+		switch command {
+		case "A":
+			return []string{"0", "5"}
+		case "6":
+			result := []string{"0"}
+			for _, line := range params[2:] {
+				if strings.Contains(line, "999#") {
+					return []string{"-603"}
+				}
+				if len(line) != 0 {
+					result = append(result, newMfn()+"#0\x1F\x1E0#1\x1F\x1E200#^aSaved")
+				}
+			}
+			return result
+		case "D":
+			// Код возврата -- новый максимальный MFN
+			mfn := newMfn()
+			return []string{mfn, mfn + "#0", "0#1\x1E200#^aSaved"}
+		}
+		return []string{"-1"}
+	})
+
+	records := make([]MarcRecord, 5)
+	for i := range records {
+		records[i] = *NewMarcRecord()
+		records[i].Add(200, "").Add('a', "Title")
+	}
+	records[2].Add(999, "bad")
+
+	options := &StreamOptions{BatchSize: 2, Workers: 2}
+	results := connection.WriteRecordsBatched(context.Background(), records, options)
+	if len(results) != 5 {
+		t.FailNow()
+	}
+	for i, result := range results {
+		failed := i == 2 || i == 3
+		if result.Index != i || (result.Err != nil) != failed {
+			t.Fatal(i, result.Err)
+		}
+		if !failed && (result.Mfn <= 100 || records[i].FSM(200, 'a') != "Saved") {
+			t.Fatal(i, result.Mfn)
+		}
+	}
+}
+
+// idSocket Поддельный сервер, запоминающий номера запросов
+// каждого клиента.
+type idSocket struct {
+	fakeSocket
+	mutex   sync.Mutex
+	queries map[string][]int
+}
+
+func (socket *idSocket) TalkToServer(query *ClientQuery) *ServerResponse {
+	lines := strings.Split(string(bytes.Join(query.chunks, nil)), "\n")
+	id, _ := strconv.Atoi(lines[4])
+	socket.mutex.Lock()
+	socket.queries[lines[3]] = append(socket.queries[lines[3]], id)
+	socket.mutex.Unlock()
+	return socket.fakeSocket.TalkToServer(query)
+}
+
+func TestSearchStream_3(t *testing.T) {
+	socket := &idSocket{fakeSocket: fakeSocket{handler: fakeSearchHandler(100)},
+		queries: make(map[string][]int)}
+	connection := newFakeConnection(nil)
+	connection.socket = socket
+	connection.ClientId = 123456
+
+	stream := connection.SearchStream(context.Background(), "T=A$",
+		&StreamOptions{PageSize: 30, BatchSize: 5, Workers: 3})
+	count := 0
+	for stream.Next() {
+		count++
+	}
+	stream.Close()
+	if stream.Err() != nil || count != 100 {
+		t.Fatal(count, stream.Err())
+	}
+
+	// Запросы выполняются подключениями пула (каждое -- отдельный
+	// клиент с последовательными номерами запросов), а не исходным
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+	if len(socket.queries) == 0 || len(socket.queries["123456"]) != 0 {
+		t.Fatal(socket.queries)
+	}
+	for client, ids := range socket.queries {
+		for i, id := range ids {
+			if id != i+1 {
+				t.Fatal(client, ids)
+			}
+		}
+	}
+}
+
+// serialSocket Обнаруживает одновременные обращения к транспорту.
+type serialSocket struct {
+	fakeSocket
+	active     int32
+	concurrent int32
+}
+
+func (socket *serialSocket) TalkToServer(query *ClientQuery) *ServerResponse {
+	if atomic.AddInt32(&socket.active, 1) > 1 {
+		atomic.StoreInt32(&socket.concurrent, 1)
+	}
+	defer atomic.AddInt32(&socket.active, -1)
+	time.Sleep(time.Millisecond)
+	return socket.fakeSocket.TalkToServer(query)
+}
+
+func TestSearchStream_4(t *testing.T) {
+	socket := &serialSocket{fakeSocket: fakeSocket{handler: fakeSearchHandler(50)}}
+	connection := newFakeConnection(nil)
+	connection.socket = socket
+	options := &StreamOptions{PageSize: 20, BatchSize: 3, Workers: 4}
+	stream := connection.SearchStream(context.Background(), "T=A$", options)
+	defer stream.Close()
+
+	count := 0
+	for stream.Next() {
+		count++
+	}
+	if stream.Err() != nil || count != 50 {
+		t.Fatal(count, stream.Err())
+	}
+	// Нестандартный транспорт не используется параллельно
+	if atomic.LoadInt32(&socket.concurrent) != 0 {
+		t.FailNow()
+	}
+}
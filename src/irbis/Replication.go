@@ -0,0 +1,572 @@
+package irbis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Replica База данных, участвующая в репликации:
+// источник либо получатель записей.
+type Replica interface {
+	RecordSource
+
+	// Search Поиск записей. MFN выдаются в порядке возрастания.
+	Search(expression string) ([]int, error)
+
+	// WriteRecords Сохранение записей: записи с нулевым MFN
+	// добавляются, прочие заменяют существующие записи.
+	// MFN и версии записей обновляются.
+	WriteRecords(records []MarcRecord) error
+}
+
+//===================================================================
+
+// serverReplica База данных на сервере ИРБИС64.
+type serverReplica struct {
+	connection *Connection
+	database   string
+}
+
+// NewServerReplica База данных на сервере для репликации.
+// Подключение используется монопольно на время репликации.
+func NewServerReplica(connection *Connection, database string) Replica {
+	return &serverReplica{connection: connection,
+		database: PickOne(database, connection.Database)}
+}
+
+func (replica *serverReplica) Database() string {
+	return replica.database
+}
+
+func (replica *serverReplica) GetMaxMfn() (int, error) {
+	result := replica.connection.GetMaxMfn(replica.database)
+	if replica.connection.LastError < 0 {
+		return 0, errors.New(DescribeError(replica.connection.LastError))
+	}
+	// Сервер выдаёт MFN, который получит следующая запись
+	return result - 1, nil
+}
+
+func (replica *serverReplica) ReadRecords(mfnList []int) ([]MarcRecord, error) {
+	if len(mfnList) == 0 {
+		return nil, nil
+	}
+	records, err := replica.connection.readRecordsBatch(replica.database, mfnList)
+	if err != nil {
+		return nil, err
+	}
+
+	result := records[:0]
+	for _, record := range records {
+		if record.Mfn > 0 && record.Status&(PHYSICALLY_DELETED|ABSENT) == 0 {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+func (replica *serverReplica) Search(expression string) ([]int, error) {
+	result, err := replica.connection.searchAll(replica.database, expression)
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+// WriteRecords Версии заменяемых записей предварительно
+// считываются с сервера, иначе сервер отвергнет запись.
+func (replica *serverReplica) WriteRecords(records []MarcRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var existing []int
+	for i := range records {
+		records[i].Database = replica.database
+		if records[i].Mfn > 0 {
+			existing = append(existing, records[i].Mfn)
+		}
+	}
+	if len(existing) != 0 {
+		current, err := replica.ReadRecords(existing)
+		if err != nil {
+			return err
+		}
+		versions := make(map[int]int, len(current))
+		for _, record := range current {
+			versions[record.Mfn] = record.Version
+		}
+		for i := range records {
+			if records[i].Mfn > 0 {
+				version, found := versions[records[i].Mfn]
+				if !found {
+					return fmt.Errorf("record %d not found in %s", records[i].Mfn, replica.database)
+				}
+				records[i].Version = version
+			}
+		}
+	}
+
+	if len(records) == 1 {
+		if replica.connection.WriteRecord(&records[0]) == 0 {
+			return errors.New(DescribeError(replica.connection.LastError))
+		}
+		return nil
+	}
+	return replica.connection.writeRecordsBatch(records)
+}
+
+//===================================================================
+
+// directReplica База данных, открытая для прямого доступа
+// (только в качестве источника записей).
+type directReplica struct {
+	RecordSource
+}
+
+// NewDirectReplica База данных, открытая для прямого доступа,
+// в качестве источника записей для репликации. Поиск
+// и сохранение записей не поддерживаются.
+func NewDirectReplica(access *DirectAccess) Replica {
+	return &directReplica{NewDirectRecordSource(access)}
+}
+
+func (replica *directReplica) Search(expression string) ([]int, error) {
+	return nil, errors.New("search is not supported for direct access")
+}
+
+func (replica *directReplica) WriteRecords(records []MarcRecord) error {
+	return errors.New("database is opened for reading only: " + replica.Database())
+}
+
+//===================================================================
+
+// ReplicatedRecord Сведения о скопированной записи.
+type ReplicatedRecord struct {
+	Version   int // Версия записи в источнике на момент копирования.
+	TargetMfn int // MFN записи в получателе.
+}
+
+// ReplicationState Состояние репликации, сохраняемое
+// между запусками.
+type ReplicationState struct {
+	Source   string // Имя базы данных -- источника.
+	Target   string // Имя базы данных -- получателя.
+	MaxMfn   int    // Максимальный MFN источника по итогам последнего запуска.
+	Position int    // Последний обработанный MFN прерванного запуска (0 -- запуск завершён).
+
+	// Records Скопированные записи по MFN в источнике.
+	Records map[int]ReplicatedRecord
+}
+
+// NewReplicationState Пустое состояние репликации.
+func NewReplicationState() *ReplicationState {
+	return &ReplicationState{Records: make(map[int]ReplicatedRecord)}
+}
+
+// Файл контрольной точки -- текстовый: заголовок, затем
+// строки "MFN версия MFN-получателя" (нулевой MFN получателя
+// означает, что запись забыта) и "position MFN". Во время
+// запуска строки дописываются в конец файла после каждого
+// пакета, по завершении файл перезаписывается целиком.
+const replicationSignature = "#irbis-replication 1"
+
+// LoadReplicationState Загрузка состояния репликации из файла
+// контрольной точки. Если файла нет, выдаётся пустое состояние.
+func LoadReplicationState(filename string) (*ReplicationState, error) {
+	result := NewReplicationState()
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if number == 1 {
+			if line != replicationSignature {
+				return nil, errors.New("not a replication checkpoint: " + filename)
+			}
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) == 2 {
+			switch parts[0] {
+			case "source":
+				result.Source = parts[1]
+				continue
+			case "target":
+				result.Target = parts[1]
+				continue
+			case "maxmfn":
+				if result.MaxMfn, err = strconv.Atoi(parts[1]); err == nil {
+					continue
+				}
+			case "position":
+				if result.Position, err = strconv.Atoi(parts[1]); err == nil {
+					continue
+				}
+			}
+		}
+		if len(parts) == 3 {
+			mfn, err1 := strconv.Atoi(parts[0])
+			version, err2 := strconv.Atoi(parts[1])
+			target, err3 := strconv.Atoi(parts[2])
+			if err1 == nil && err2 == nil && err3 == nil && mfn > 0 {
+				if target > 0 {
+					result.Records[mfn] = ReplicatedRecord{Version: version, TargetMfn: target}
+				} else {
+					delete(result.Records, mfn)
+				}
+				continue
+			}
+		}
+		return nil, fmt.Errorf("%s(%d): bad line: %s", filename, number, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Save Сохранение состояния репликации в файл контрольной
+// точки. Файл заменяется атомарно.
+func (state *ReplicationState) Save(filename string) error {
+	text := strings.Builder{}
+	text.WriteString(replicationSignature + "\n")
+	if len(state.Source) != 0 {
+		text.WriteString("source " + state.Source + "\n")
+	}
+	if len(state.Target) != 0 {
+		text.WriteString("target " + state.Target + "\n")
+	}
+	text.WriteString("maxmfn " + strconv.Itoa(state.MaxMfn) + "\n")
+	if state.Position != 0 {
+		text.WriteString("position " + strconv.Itoa(state.Position) + "\n")
+	}
+	mfnList := make([]int, 0, len(state.Records))
+	for mfn := range state.Records {
+		mfnList = append(mfnList, mfn)
+	}
+	sort.Ints(mfnList)
+	for _, mfn := range mfnList {
+		record := state.Records[mfn]
+		text.WriteString(fmt.Sprintf("%d %d %d\n", mfn, record.Version, record.TargetMfn))
+	}
+
+	return writeFileAtomically(filename, []byte(text.String()))
+}
+
+// appendChanges Дописывание изменений в файл контрольной точки.
+func (state *ReplicationState) appendChanges(filename string, changed []int) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	text := strings.Builder{}
+	for _, mfn := range changed {
+		record := state.Records[mfn]
+		text.WriteString(fmt.Sprintf("%d %d %d\n", mfn, record.Version, record.TargetMfn))
+	}
+	text.WriteString("position " + strconv.Itoa(state.Position) + "\n")
+	_, err = file.WriteString(text.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//===================================================================
+
+// Replication Копирование записей из одной базы данных в другую.
+// Повторный запуск копирует только новые и изменённые (по номеру
+// версии) записи, а также переносит удаление записей.
+//
+//	replication := irbis.NewReplication(
+//		irbis.NewServerReplica(central, "IBIS"),
+//		irbis.NewServerReplica(branch, "IBIS"))
+//	replication.Checkpoint = "ibis.checkpoint"
+//	result, err := replication.Run(context.Background())
+type Replication struct {
+	Source Replica // Источник записей.
+	Target Replica // Получатель записей.
+
+	// Expression Поисковое выражение, отбирающее копируемые
+	// записи (пустое -- все записи).
+	Expression string
+
+	// PreserveMfn Сохранять MFN записей: запись источника
+	// заменяет запись получателя с тем же MFN, а пропуски
+	// в нумерации заполняются пустыми удалёнными записями.
+	// Иначе новые записи получают очередные MFN получателя,
+	// а соответствие MFN сохраняется в состоянии.
+	PreserveMfn bool
+
+	// NewOnly Копировать только записи, добавленные в источник
+	// после предыдущего запуска (с MFN больше запомненного).
+	NewOnly bool
+
+	// BatchSize Количество записей, обрабатываемых за один запрос.
+	BatchSize int
+
+	// Checkpoint Файл контрольной точки ("" -- состояние
+	// хранится только в поле State).
+	Checkpoint string
+
+	// State Состояние репликации. Если не задано, загружается
+	// из файла контрольной точки.
+	State *ReplicationState
+
+	// Progress Функция, вызываемая после каждого пакета
+	// с количеством обработанных записей. Если функция
+	// возвращает false, репликация прерывается; следующий
+	// запуск продолжит её с прерванного места.
+	Progress func(done, total int) bool
+}
+
+// ReplicationResult Итоги репликации.
+type ReplicationResult struct {
+	Checked int // Проверено записей.
+	Added   int // Добавлено записей.
+	Updated int // Изменено записей (в т. ч. логически удалено).
+	Deleted int // Удалено записей, отсутствующих в источнике.
+}
+
+func (result *ReplicationResult) String() string {
+	return fmt.Sprintf("checked: %d, added: %d, updated: %d, deleted: %d",
+		result.Checked, result.Added, result.Updated, result.Deleted)
+}
+
+// NewReplication Репликация с параметрами по умолчанию.
+func NewReplication(source, target Replica) *Replication {
+	return &Replication{Source: source, Target: target, BatchSize: DefaultStreamBatchSize}
+}
+
+// Run Запуск репликации.
+func (replication *Replication) Run(ctx context.Context) (*ReplicationResult, error) {
+	state := replication.State
+	if state == nil {
+		state = NewReplicationState()
+		if len(replication.Checkpoint) != 0 {
+			var err error
+			if state, err = LoadReplicationState(replication.Checkpoint); err != nil {
+				return nil, err
+			}
+		}
+		replication.State = state
+	}
+
+	source, target := replication.Source.Database(), replication.Target.Database()
+	if (len(state.Source) != 0 && state.Source != source) ||
+		(len(state.Target) != 0 && state.Target != target) {
+		return nil, fmt.Errorf("state belongs to replication %s -> %s", state.Source, state.Target)
+	}
+	state.Source, state.Target = source, target
+	if len(replication.Checkpoint) != 0 {
+		if err := state.Save(replication.Checkpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	sourceMax, err := replication.Source.GetMaxMfn()
+	if err != nil {
+		return nil, err
+	}
+	targetMax, err := replication.Target.GetMaxMfn()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []int
+	if len(replication.Expression) != 0 {
+		if candidates, err = replication.Source.Search(replication.Expression); err != nil {
+			return nil, err
+		}
+	} else {
+		candidates = make([]int, 0, sourceMax)
+		for mfn := 1; mfn <= sourceMax; mfn++ {
+			candidates = append(candidates, mfn)
+		}
+	}
+	// Записи, обработанные прерванным запуском, и старые записи
+	// (если копируются только новые) пропускаются
+	first := state.Position + 1
+	if replication.NewOnly && state.MaxMfn+1 > first {
+		first = state.MaxMfn + 1
+	}
+	candidates = candidates[sort.SearchInts(candidates, first):]
+
+	batchSize := replication.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultStreamBatchSize
+	}
+
+	result := new(ReplicationResult)
+	for start := 0; start < len(candidates); start += batchSize {
+		if err = ctx.Err(); err != nil {
+			return result, err
+		}
+
+		stop := start + batchSize
+		if stop > len(candidates) {
+			stop = len(candidates)
+		}
+		batch := candidates[start:stop]
+		changed, err := replication.copyBatch(batch, &targetMax, result)
+		if err != nil {
+			return result, err
+		}
+
+		state.Position = batch[len(batch)-1]
+		if len(replication.Checkpoint) != 0 {
+			if err = state.appendChanges(replication.Checkpoint, changed); err != nil {
+				return result, err
+			}
+		}
+		if replication.Progress != nil && !replication.Progress(stop, len(candidates)) {
+			return result, errors.New("replication interrupted")
+		}
+	}
+
+	if sourceMax > state.MaxMfn {
+		state.MaxMfn = sourceMax
+	}
+	state.Position = 0
+	if len(replication.Checkpoint) != 0 {
+		if err = state.Save(replication.Checkpoint); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// copyBatch Копирование пакета записей. Возвращает MFN
+// записей, сведения о которых изменились.
+func (replication *Replication) copyBatch(batch []int, targetMax *int,
+	result *ReplicationResult) ([]int, error) {
+	state := replication.State
+	records, err := replication.Source.ReadRecords(batch)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[int]*MarcRecord, len(records))
+	for i := range records {
+		found[records[i].Mfn] = &records[i]
+	}
+
+	var changed []int
+	var writes []MarcRecord // Записи для сохранения в получателе
+	var owners []int        // MFN источника для каждой записи (0 -- заглушка)
+	var removed []int       // MFN получателя для записей, исчезнувших из источника
+	var removedOwners []int
+	for _, mfn := range batch {
+		result.Checked++
+		record := found[mfn]
+		entry, known := state.Records[mfn]
+		if record == nil {
+			if known {
+				removed = append(removed, entry.TargetMfn)
+				removedOwners = append(removedOwners, mfn)
+			}
+			continue
+		}
+		if (known && entry.Version == record.Version) || (!known && record.IsDeleted()) {
+			continue
+		}
+
+		copied := *record
+		copied.Status &= LOGICALLY_DELETED
+		copied.Mfn, copied.Version = 0, 0
+		switch {
+		case known:
+			copied.Mfn = entry.TargetMfn
+		case replication.PreserveMfn && mfn <= *targetMax:
+			copied.Mfn = mfn
+		case replication.PreserveMfn:
+			for ; *targetMax+1 < mfn; *targetMax++ {
+				writes = append(writes, MarcRecord{Status: LOGICALLY_DELETED})
+				owners = append(owners, 0)
+			}
+			*targetMax = mfn
+		}
+		writes = append(writes, copied)
+		owners = append(owners, mfn)
+	}
+
+	if len(removed) != 0 {
+		current, err := replication.Target.ReadRecords(removed)
+		if err != nil {
+			return nil, err
+		}
+		byMfn := make(map[int]*MarcRecord, len(current))
+		for i := range current {
+			byMfn[current[i].Mfn] = &current[i]
+		}
+		for i, mfn := range removed {
+			record := byMfn[mfn]
+			if record == nil || record.IsDeleted() {
+				// Запись уже удалена в получателе
+				delete(state.Records, removedOwners[i])
+				changed = append(changed, removedOwners[i])
+				result.Deleted++
+				continue
+			}
+			record.Status = LOGICALLY_DELETED
+			writes = append(writes, *record)
+			owners = append(owners, -removedOwners[i])
+		}
+	}
+
+	if err = replication.Target.WriteRecords(writes); err != nil {
+		return nil, err
+	}
+	for i := range writes {
+		owner := owners[i]
+		switch {
+		case owner == 0:
+			continue
+		case owner < 0:
+			delete(state.Records, -owner)
+			changed = append(changed, -owner)
+			result.Deleted++
+			continue
+		}
+
+		if writes[i].Mfn <= 0 {
+			return nil, fmt.Errorf("record %d not saved", owner)
+		}
+		if replication.PreserveMfn && writes[i].Mfn != owner {
+			return nil, fmt.Errorf("MFN mismatch: expected %d, got %d", owner, writes[i].Mfn)
+		}
+		if _, known := state.Records[owner]; known {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+		if writes[i].Mfn > *targetMax {
+			*targetMax = writes[i].Mfn
+		}
+		state.Records[owner] = ReplicatedRecord{Version: found[owner].Version, TargetMfn: writes[i].Mfn}
+		changed = append(changed, owner)
+	}
+
+	return changed, nil
+}
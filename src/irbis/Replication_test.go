@@ -0,0 +1,178 @@
+package irbis
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplication_Run_1(t *testing.T) {
+	source := newFakeDatabase()
+	target := &fakeDatabase{files: map[string]string{}}
+	for i := 0; i < 2; i++ {
+		record := NewMarcRecord()
+		record.Add(200, "").Add('a', "Local")
+		target.save(record)
+	}
+
+	replication := NewReplication(NewServerReplica(newFakeConnection(source.handler), "IBIS"),
+		NewServerReplica(newFakeConnection(target.handler), "BRANCH"))
+	replication.BatchSize = 3
+	result, err := replication.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Удалённая запись 2 не копируется, записи 1 и 4 получают MFN 3 и 4
+	if result.Checked != 4 || result.Added != 2 || len(target.records) != 4 ||
+		target.records[2][0].FSM(200, 'a') != "Title 1 v3" ||
+		replication.State.Records[4].TargetMfn != 4 {
+		t.Fatal(result, replication.State)
+	}
+
+	// Изменение, добавление и физическое удаление записей
+	changed := source.records[0][2].Clone()
+	changed.SetSubfield(200, 'a', "Title 1 v4")
+	source.save(changed)
+	added := NewMarcRecord()
+	added.Add(200, "").Add('a', "Title 5")
+	source.save(added)
+	source.records[3] = nil
+
+	result, err = replication.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 1 || result.Updated != 1 || result.Deleted != 1 ||
+		target.records[2][1].FSM(200, 'a') != "Title 1 v4" ||
+		!target.records[3][1].IsDeleted() || target.records[4][0].FSM(200, 'a') != "Title 5" {
+		t.Fatal(result, target.records)
+	}
+	if _, known := replication.State.Records[4]; known {
+		t.Fatal(replication.State)
+	}
+
+	result, err = replication.Run(context.Background())
+	if err != nil || result.Added+result.Updated+result.Deleted != 0 {
+		t.Fatal(result, err)
+	}
+}
+
+func TestReplication_Run_2(t *testing.T) {
+	source := newFakeDatabase()
+	target := &fakeDatabase{files: map[string]string{}}
+	replication := NewReplication(NewServerReplica(newFakeConnection(source.handler), "IBIS"),
+		NewServerReplica(newFakeConnection(target.handler), "IBIS"))
+	replication.PreserveMfn = true
+	if _, err := replication.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Вместо отсутствующих записей 2 и 3 -- пустые удалённые
+	if len(target.records) != 4 || target.records[0][0].FSM(200, 'a') != "Title 1 v3" ||
+		!target.records[1][0].IsDeleted() || len(target.records[2][0].Fields) != 0 ||
+		target.records[3][0].FSM(200, 'a') != "Title 4" {
+		t.Fatal(target.records)
+	}
+
+	// Отбор записей поисковым выражением
+	target = &fakeDatabase{files: map[string]string{}}
+	replication = NewReplication(NewServerReplica(newFakeConnection(source.handler), "IBIS"),
+		NewServerReplica(newFakeConnection(target.handler), "IBIS"))
+	replication.Expression = "T=Title 4"
+	result, err := replication.Run(context.Background())
+	if err != nil || result.Checked != 1 || len(target.records) != 1 ||
+		replication.State.Records[4].TargetMfn != 1 {
+		t.Fatal(result, err)
+	}
+}
+
+func TestReplication_Checkpoint_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpoint := filepath.Join(dir, "ibis.checkpoint")
+
+	source := newFakeDatabase()
+	target := &fakeDatabase{files: map[string]string{}}
+	newReplication := func() *Replication {
+		result := NewReplication(NewServerReplica(newFakeConnection(source.handler), "IBIS"),
+			NewServerReplica(newFakeConnection(target.handler), "BRANCH"))
+		result.BatchSize = 2
+		result.Checkpoint = checkpoint
+		return result
+	}
+
+	// Прерывание после первого пакета
+	replication := newReplication()
+	replication.Progress = func(done, total int) bool {
+		return done < 2
+	}
+	if _, err = replication.Run(context.Background()); err == nil {
+		t.FailNow()
+	}
+
+	state, err := LoadReplicationState(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Position != 2 || len(state.Records) != 1 || state.Records[1].TargetMfn != 1 ||
+		state.Source != "IBIS" || state.Target != "BRANCH" {
+		t.Fatal(state)
+	}
+
+	result, err := newReplication().Run(context.Background())
+	if err != nil || result.Checked != 2 || result.Added != 1 || len(target.records) != 2 {
+		t.Fatal(result, err)
+	}
+	state, err = LoadReplicationState(checkpoint)
+	if err != nil || state.Position != 0 || state.MaxMfn != 4 || len(state.Records) != 2 {
+		t.Fatal(state, err)
+	}
+
+	// Состояние относится к другой паре баз данных
+	other := NewReplication(NewServerReplica(newFakeConnection(source.handler), "OTHER"),
+		NewServerReplica(newFakeConnection(target.handler), "BRANCH"))
+	other.Checkpoint = checkpoint
+	if _, err = other.Run(context.Background()); err == nil {
+		t.FailNow()
+	}
+
+}
+
+func TestReplication_Direct_1(t *testing.T) {
+	var archive bytes.Buffer
+	if _, err := newFakeConnection(newFakeDatabase().handler).BackupDatabase("IBIS", &archive, nil); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = RestoreDirect(filepath.Join(dir, "ibis"), &archive, nil); err != nil {
+		t.Fatal(err)
+	}
+	access, err := OpenDatabase(filepath.Join(dir, "ibis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+
+	// Прямой доступ годится только в качестве источника
+	target := &fakeDatabase{files: map[string]string{}}
+	replication := NewReplication(NewDirectReplica(access),
+		NewServerReplica(newFakeConnection(target.handler), "IBIS"))
+	result, err := replication.Run(context.Background())
+	if err != nil || result.Added != 2 || target.records[0][0].FSM(200, 'a') != "Title 1 v3" {
+		t.Fatal(result, err)
+	}
+
+	replication = NewReplication(replication.Target, NewDirectReplica(access))
+	if _, err = replication.Run(context.Background()); err == nil {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,360 @@
+package irbis
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ScanOptions Параметры последовательного просмотра базы данных.
+type ScanOptions struct {
+	// Physical Выдавать записи в порядке их расположения
+	// в MST-файле (по умолчанию -- в порядке MFN).
+	Physical bool
+
+	// Deleted Выдавать также логически удалённые записи.
+	Deleted bool
+
+	// AllVersions Выдавать также предыдущие версии записей
+	// (в порядке MFN -- от старых версий к последней).
+	AllVersions bool
+
+	// BatchSize Количество записей, декодируемых за один раз.
+	BatchSize int
+
+	// Workers Количество потоков, декодирующих записи.
+	Workers int
+
+	// MemoryMap Отображать MST-файл в память (если платформа
+	// этого не поддерживает, файл читается обычным образом).
+	MemoryMap bool
+}
+
+// scanBatch Порция необработанных записей и результат
+// её декодирования.
+type scanBatch struct {
+	raw     [][]byte
+	records []MarcRecord
+	err     error
+	ready   chan struct{}
+}
+
+// scanner Чтение необработанных записей из MST-файла
+// либо из его отображения в память.
+type scanner struct {
+	reader io.ReaderAt
+	mapped []byte
+	owned  bool // Отображение создано для просмотра.
+	limit  int64
+	xrf    []XrfRecord
+}
+
+// newScanner Подготовка к просмотру: ссылки XRF считываются
+// в память целиком, MST-файл по желанию отображается в память.
+func newScanner(access *DirectAccess, memoryMap bool) (*scanner, error) {
+	result := &scanner{reader: access.mst.file}
+	info, err := access.mst.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	result.limit = access.mst.Control.NextPosition()
+	if result.limit < MstControlRecordSize || result.limit > info.Size() {
+		result.limit = info.Size()
+	}
+	if access.mst.mapped != nil {
+		// Файл уже отображён в память (см. DirectAccess.SetMemoryMap)
+		result.mapped = access.mst.mapped
+		result.reader = bytes.NewReader(result.mapped)
+	} else if memoryMap {
+		if mapped, err := mapFile(access.mst.file, result.limit); err == nil {
+			result.mapped, result.owned = mapped, true
+			result.reader = bytes.NewReader(mapped)
+		}
+	}
+	if result.mapped != nil && int64(len(result.mapped)) < result.limit {
+		result.limit = int64(len(result.mapped))
+	}
+
+	maxMfn := access.GetMaxMfn()
+	if maxMfn < 0 {
+		maxMfn = 0
+	}
+	buffer := make([]byte, maxMfn*XrfRecordSize)
+	count, err := access.xrf.file.ReadAt(buffer, 0)
+	if err != nil && err != io.EOF {
+		result.close()
+		return nil, err
+	}
+	// Недостающие в XRF-файле записи считаются отсутствующими
+	result.xrf = make([]XrfRecord, maxMfn+1)
+	for i := range result.xrf[1:] {
+		result.xrf[i+1].Status = ABSENT
+	}
+	_ = binary.Read(bytes.NewReader(buffer[:count-count%XrfRecordSize]), binary.BigEndian,
+		result.xrf[1:1+count/XrfRecordSize])
+
+	return result, nil
+}
+
+func (scanner *scanner) close() {
+	if scanner.owned {
+		_ = unmapFile(scanner.mapped)
+	}
+	scanner.mapped = nil
+}
+
+// present Запись с указанным MFN существует и, если deleted
+// не задано, не удалена логически.
+func (scanner *scanner) present(mfn int, deleted bool) bool {
+	if mfn <= 0 || mfn >= len(scanner.xrf) {
+		return false
+	}
+	xrf := &scanner.xrf[mfn]
+	if xrf.Offset() <= 0 || xrf.Status&(PHYSICALLY_DELETED|ABSENT) != 0 {
+		return false
+	}
+	return deleted || xrf.Status&LOGICALLY_DELETED == 0
+}
+
+// read Чтение записи целиком по указанному смещению.
+// Из отображения в память данные не копируются.
+func (scanner *scanner) read(offset int64, mfn int) ([]byte, *MstLeader, error) {
+	leader, problem := readMstLeader(scanner.reader, offset, scanner.limit)
+	if len(problem) == 0 && mfn > 0 && int(leader.Mfn) != mfn {
+		problem = fmt.Sprintf("record belongs to MFN %d", leader.Mfn)
+	}
+	if len(problem) != 0 {
+		return nil, nil, fmt.Errorf("MFN %d at offset %d: %s", mfn, offset, problem)
+	}
+	if scanner.mapped != nil {
+		return scanner.mapped[offset : offset+int64(leader.Length)], &leader, nil
+	}
+	data := make([]byte, leader.Length)
+	if _, err := scanner.reader.ReadAt(data, offset); err != nil {
+		return nil, nil, err
+	}
+	return data, &leader, nil
+}
+
+// byMfn Выдача записей в порядке MFN.
+func (scanner *scanner) byMfn(options *ScanOptions, emit func(raw []byte) bool) error {
+	for mfn := 1; mfn < len(scanner.xrf); mfn++ {
+		if !scanner.present(mfn, options.Deleted) {
+			continue
+		}
+		data, leader, err := scanner.read(scanner.xrf[mfn].Offset(), mfn)
+		if err != nil {
+			return err
+		}
+		if !options.AllVersions {
+			if !emit(data) {
+				return nil
+			}
+			continue
+		}
+
+		// Версий не может быть больше, чем номер последней версии
+		versions, top := [][]byte{data}, int(leader.Version)
+		for previous := leader.PreviousOffset(); previous > 0; previous = leader.PreviousOffset() {
+			if len(versions) >= top {
+				return fmt.Errorf("MFN %d: version chain loops", mfn)
+			}
+			if data, leader, err = scanner.read(previous, mfn); err != nil {
+				return err
+			}
+			versions = append(versions, data)
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			if !emit(versions[i]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// physical Выдача записей в порядке расположения в MST-файле.
+func (scanner *scanner) physical(options *ScanOptions, emit func(raw []byte) bool) error {
+	var err error
+	failure := scanMst(scanner.reader, scanner.limit, func(offset int64, leader *MstLeader) bool {
+		mfn := int(leader.Mfn)
+		if !scanner.present(mfn, options.Deleted) {
+			return true
+		}
+		if !options.AllVersions && scanner.xrf[mfn].Offset() != offset {
+			return true
+		}
+		var data []byte
+		if data, _, err = scanner.read(offset, mfn); err != nil {
+			return false
+		}
+		return emit(data)
+	})
+	if failure != nil {
+		return failure
+	}
+	return err
+}
+
+// Scan Последовательный просмотр всех записей базы данных
+// в порядке MFN либо в порядке расположения в MST-файле.
+// Записи декодируются в Workers потоков, но выдаются
+// в порядке просмотра. По умолчанию логически удалённые записи
+// и предыдущие версии записей пропускаются.
+//
+//	stream := access.Scan(ctx, &irbis.ScanOptions{MemoryMap: true})
+//	defer stream.Close()
+//	for stream.Next() {
+//		fmt.Println(stream.Record())
+//	}
+//	if stream.Err() != nil { ... }
+//
+// Во время просмотра база данных не должна закрываться.
+func (access *DirectAccess) Scan(ctx context.Context, options *ScanOptions) *RecordStream {
+	ctx, cancel := context.WithCancel(ctx)
+	result := &RecordStream{records: make(chan *MarcRecord), cancel: cancel}
+	settings := ScanOptions{}
+	if options != nil {
+		settings = *options
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = DefaultStreamBatchSize
+	}
+	if settings.Workers <= 0 {
+		settings.Workers = DefaultStreamWorkers
+	}
+
+	scanner, err := newScanner(access, settings.MemoryMap)
+	if err != nil {
+		result.err = err
+		close(result.records)
+		cancel()
+		return result
+	}
+
+	go result.scan(ctx, access, scanner, settings)
+	return result
+}
+
+// scan Чтение необработанных записей порциями по BatchSize
+// и их декодирование в Workers потоков.
+func (stream *RecordStream) scan(ctx context.Context, access *DirectAccess,
+	scanner *scanner, options ScanOptions) {
+	defer stream.cancel()
+	defer close(stream.records)
+
+	queue := make(chan *scanBatch, options.Workers)
+	jobs := make(chan *scanBatch)
+
+	// Отображение в память освобождается, когда к нему
+	// перестанут обращаться и чтение, и декодирование
+	var users sync.WaitGroup
+	users.Add(options.Workers + 1)
+	go func() {
+		users.Wait()
+		scanner.close()
+	}()
+
+	codec, database := access.mst.Codec, access.location.Name
+	for i := 0; i < options.Workers; i++ {
+		go func() {
+			defer users.Done()
+			for batch := range jobs {
+				batch.records = make([]MarcRecord, 0, len(batch.raw))
+				for _, raw := range batch.raw {
+					record, err := decodeMstRecord(raw, codec)
+					if err != nil {
+						batch.err = err
+						break
+					}
+					decoded := record.Decode()
+					decoded.Database = database
+					batch.records = append(batch.records, *decoded)
+				}
+				close(batch.ready)
+			}
+		}()
+	}
+
+	// Порции ставятся в очередь в порядке просмотра
+	go func() {
+		defer users.Done()
+		defer close(queue)
+		defer close(jobs)
+
+		send := func(batch *scanBatch) bool {
+			select {
+			case queue <- batch:
+			case <-ctx.Done():
+				return false
+			}
+			if batch.err != nil {
+				close(batch.ready)
+				return true
+			}
+			select {
+			case jobs <- batch:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		batch := &scanBatch{ready: make(chan struct{})}
+		emit := func(raw []byte) bool {
+			batch.raw = append(batch.raw, raw)
+			if len(batch.raw) < options.BatchSize {
+				return true
+			}
+			full := batch
+			batch = &scanBatch{ready: make(chan struct{})}
+			return send(full)
+		}
+
+		var err error
+		if options.Physical {
+			err = scanner.physical(&options, emit)
+		} else {
+			err = scanner.byMfn(&options, emit)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if len(batch.raw) != 0 && !send(batch) {
+			return
+		}
+		if err != nil {
+			send(&scanBatch{err: err, ready: make(chan struct{})})
+		}
+	}()
+
+	for batch := range queue {
+		select {
+		case <-batch.ready:
+		case <-ctx.Done():
+			stream.fail(ctx.Err())
+			return
+		}
+
+		for i := range batch.records {
+			select {
+			case stream.records <- &batch.records[i]:
+			case <-ctx.Done():
+				stream.fail(ctx.Err())
+				return
+			}
+		}
+
+		if batch.err != nil {
+			stream.fail(batch.err)
+			return
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		stream.fail(err)
+	}
+}
@@ -0,0 +1,86 @@
+package irbis
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scanAll Список "MFN.версия" записей, выданных при просмотре.
+func scanAll(t *testing.T, access *DirectAccess, options *ScanOptions) string {
+	stream := access.Scan(context.Background(), options)
+	defer stream.Close()
+	var result []string
+	for stream.Next() {
+		record := stream.Record()
+		if record.Database != "ibis" {
+			t.Fatal(record.Database)
+		}
+		result = append(result, strconv.Itoa(record.Mfn)+"."+strconv.Itoa(record.Version))
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(result, " ")
+}
+
+func TestDirectAccess_Scan_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	access, err := OpenDatabase(restoreFakeDatabase(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+
+	for _, memoryMap := range []bool{false, true} {
+		tests := []struct {
+			options  ScanOptions
+			expected string
+		}{
+			{ScanOptions{}, "1.3 4.1"},
+			{ScanOptions{Deleted: true}, "1.3 2.1 4.1"},
+			{ScanOptions{AllVersions: true}, "1.1 1.2 1.3 4.1"},
+			{ScanOptions{Physical: true, Deleted: true}, "1.3 2.1 4.1"},
+			{ScanOptions{Physical: true, AllVersions: true, BatchSize: 1, Workers: 3}, "1.1 1.2 1.3 4.1"},
+		}
+		for _, test := range tests {
+			test.options.MemoryMap = memoryMap
+			if actual := scanAll(t, access, &test.options); actual != test.expected {
+				t.Fatal(test.options, actual)
+			}
+		}
+	}
+}
+
+func TestDirectAccess_Scan_2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	access, err := OpenDatabase(restoreFakeDatabase(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := access.Scan(ctx, &ScanOptions{AllVersions: true, BatchSize: 1, MemoryMap: true})
+	if !stream.Next() {
+		t.Fatal(stream.Err())
+	}
+	cancel()
+	for stream.Next() {
+	}
+	if stream.Err() == nil {
+		t.FailNow()
+	}
+	stream.Close()
+}
@@ -1,6 +1,11 @@
 package irbis
 
-import "strconv"
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
 
 // SearchScenario Сценарий поиска.
 type SearchScenario struct {
@@ -42,6 +47,10 @@ type SearchScenario struct {
 
 	// Format Имя формата показа документов.
 	Format string
+
+	// Tag Метка поля, по которому строится словарь
+	// (задаётся только в SCH-файлах).
+	Tag int
 }
 
 func (section *IniSection) get(name string, index int) string {
@@ -68,7 +77,7 @@ func ParseScenarios(ini *IniFile) (result []SearchScenario) {
 		scenario.Prefix = section.get("Pref", i)
 		scenario.DictionaryType = section.getInt("DictionType", i)
 		scenario.MenuName = section.get("Menu", i)
-		scenario.OldFormat = ""
+		scenario.OldFormat = section.get("F8For", i)
 		scenario.Correction = section.get("ModByDic", i)
 		scenario.Truncation = section.get("Tranc", i)
 		scenario.Hint = section.get("Hint", i)
@@ -81,3 +90,196 @@ func ParseScenarios(ini *IniFile) (result []SearchScenario) {
 
 	return
 }
+
+// schRegex Строка SCH-файла: наименование, метка поля, тип словаря,
+// признак усечения, логика, префикс и (необязательный) хвост.
+var schRegex = regexp.MustCompile(`^(.*\S)\s+(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s+(\S+)(\s+.*)?$`)
+
+// ParseSchFile Разбор SCH-файла (например, ibis.sch).
+// Строки, не соответствующие формату, пропускаются.
+func ParseSchFile(lines []string) (result []SearchScenario) {
+	for _, line := range lines {
+		match := schRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		scenario := SearchScenario{}
+		scenario.Name = strings.TrimSpace(match[1])
+		scenario.Tag, _ = strconv.Atoi(match[2])
+		scenario.DictionaryType, _ = strconv.Atoi(match[3])
+		scenario.Truncation = match[4]
+		scenario.Logic = match[5]
+		scenario.Prefix = match[6]
+		result = append(result, scenario)
+	}
+
+	return
+}
+
+// ReadSearchScenarios Загрузка сценариев поиска с локального диска
+// из SCH-файла либо из секции [SEARCH] INI-файла
+// (формат определяется по расширению).
+func ReadSearchScenarios(filename string) ([]SearchScenario, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseScenarioLines(filename, lines), nil
+}
+
+func parseScenarioLines(filename string, lines []string) []SearchScenario {
+	if strings.HasSuffix(strings.ToLower(filename), ".sch") {
+		return ParseSchFile(lines)
+	}
+
+	ini := NewIniFile()
+	ini.Parse(lines)
+	return ParseScenarios(ini)
+}
+
+// GetLogic Применимые логические операторы в виде константы
+// LOGIC_OR ... LOGIC_OR_AND_NOT_PHRASE. Если логика не задана,
+// подразумевается LOGIC_OR_AND_NOT.
+func (scenario *SearchScenario) GetLogic() int {
+	result, err := strconv.Atoi(strings.TrimSpace(scenario.Logic))
+	if err != nil || result < LOGIC_OR || result > LOGIC_OR_AND_NOT_PHRASE {
+		return LOGIC_OR_AND_NOT
+	}
+	return result
+}
+
+// GetTruncation Исходное положение переключателя "Усечение".
+func (scenario *SearchScenario) GetTruncation() bool {
+	return strings.TrimSpace(scenario.Truncation) == "1"
+}
+
+// scenarioOperators Минимальная логика, необходимая
+// для применения оператора.
+var scenarioOperators = map[string]int{
+	"+":   LOGIC_OR,
+	"*":   LOGIC_OR_AND,
+	"^":   LOGIC_OR_AND_NOT,
+	"(G)": LOGIC_OR_AND_NOT_FIELD,
+	"(F)": LOGIC_OR_AND_NOT_PHRASE,
+}
+
+// tokenizeQuery Разбиение пользовательского ввода на термины
+// и операторы. Операторы должны отделяться пробелами,
+// текст в кавычках считается одним термином.
+func tokenizeQuery(input string) (result []string) {
+	var current []string
+	flush := func() {
+		if len(current) != 0 {
+			result = append(result, strings.Join(current, " "))
+			current = nil
+		}
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		if c == ' ' || c == '\t' {
+			i++
+			continue
+		}
+
+		if c == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			current = append(current, string(runes[i+1:end]))
+			i = end + 1
+			continue
+		}
+
+		end := i
+		for end < len(runes) && runes[end] != ' ' && runes[end] != '\t' {
+			end++
+		}
+		word := string(runes[i:end])
+		i = end
+		if _, ok := scenarioOperators[strings.ToUpper(word)]; ok {
+			flush()
+			result = append(result, strings.ToUpper(word))
+		} else {
+			current = append(current, word)
+		}
+	}
+	flush()
+
+	return
+}
+
+// Compose Построение поискового выражения по пользовательскому вводу
+// с учётом префикса, исходного положения переключателя "Усечение"
+// и применимых логических операторов.
+func (scenario *SearchScenario) Compose(input string) (string, error) {
+	return scenario.ComposeEx(input, scenario.GetTruncation())
+}
+
+// ComposeEx Построение поискового выражения по пользовательскому вводу.
+// Термины разделяются операторами + (ИЛИ), * (И), ^ (НЕТ), (G) (И в поле)
+// и (F) (И в повторении поля), отделёнными пробелами. Слова между
+// операторами образуют один термин. При усечении к каждому термину
+// добавляется символ $.
+func (scenario *SearchScenario) ComposeEx(input string, truncation bool) (string, error) {
+	tokens := tokenizeQuery(input)
+	if len(tokens) == 0 {
+		return "", errors.New("empty search query")
+	}
+
+	logic := scenario.GetLogic()
+	makeTerm := func(text string) string {
+		if truncation && !strings.HasSuffix(text, "$") {
+			text += "$"
+		}
+		return scenario.Prefix + text
+	}
+
+	var result Search
+	operator := ""
+	expectTerm := true
+	for _, token := range tokens {
+		level, isOperator := scenarioOperators[token]
+		if isOperator {
+			if expectTerm {
+				return "", errors.New("misplaced operator " + token)
+			}
+			if level > logic {
+				return "", errors.New("operator " + token + " is not allowed for " + scenario.Name)
+			}
+			operator = token
+			expectTerm = true
+			continue
+		}
+
+		if !expectTerm {
+			return "", errors.New("missing operator before " + token)
+		}
+		term := makeTerm(token)
+		switch operator {
+		case "":
+			result = Equals("", term)
+		case "+":
+			result = result.Or(term)
+		case "*":
+			result = result.And(term)
+		case "^":
+			result = result.Not(term)
+		case "(G)":
+			result = result.SameField(term)
+		case "(F)":
+			result = result.SameRepeat(term)
+		}
+		expectTerm = false
+	}
+
+	if expectTerm {
+		return "", errors.New("query ends with operator")
+	}
+
+	return result.String(), nil
+}
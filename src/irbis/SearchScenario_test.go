@@ -0,0 +1,65 @@
+package irbis
+
+import "testing"
+
+func TestParseSchFile_1(t *testing.T) {
+	scenarios, err := ReadSearchScenarios("../../data/irbis64/datai/ibis/ibis.sch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) != 21 {
+		t.Fatal(len(scenarios))
+	}
+	first := scenarios[0]
+	if first.Name != "Автор" || first.Tag != 700 || first.Prefix != "A=" ||
+		first.GetLogic() != LOGIC_OR_AND_NOT || !first.GetTruncation() {
+		t.FailNow()
+	}
+	date := scenarios[10]
+	if date.Name != "Дата поступления с" || date.Tag != 907 || date.Prefix != "@DP=" {
+		t.FailNow()
+	}
+}
+
+func TestParseScenarios_1(t *testing.T) {
+	scenarios, err := ReadSearchScenarios("../../data/irbis64/datai/ibis/ibis.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) != 73 || scenarios[1].Prefix != "T=" || scenarios[1].OldFormat != "!F8TIT" {
+		t.FailNow()
+	}
+}
+
+func TestSearchScenario_Compose_1(t *testing.T) {
+	scenario := SearchScenario{Name: "Ключевые слова", Prefix: "K=", Truncation: "1"}
+	query, err := scenario.Compose("роман * война ^ \"мир и\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != `((K=роман$ * K=война$) ^ "K=мир и$")` {
+		t.Fatal(query)
+	}
+
+	query, _ = scenario.ComposeEx("Пушкин А.С.", false)
+	if query != `"K=Пушкин А.С."` {
+		t.Fatal(query)
+	}
+}
+
+func TestSearchScenario_Compose_2(t *testing.T) {
+	scenario := SearchScenario{Name: "Год издания", Prefix: "G=", Logic: "0"}
+	query, err := scenario.Compose("2019 + 2020")
+	if err != nil || query != "(G=2019 + G=2020)" {
+		t.Fatal(query, err)
+	}
+	if _, err = scenario.Compose("2019 * 2020"); err == nil {
+		t.FailNow()
+	}
+	if _, err = scenario.Compose("+ 2019"); err == nil {
+		t.FailNow()
+	}
+	if _, err = scenario.Compose(""); err == nil {
+		t.FailNow()
+	}
+}
@@ -83,7 +83,16 @@ func (response *ServerResponse) GetReturnCode() int {
 
 func (response *ServerResponse) ReadAnsi() string {
 	line := response.GetLine()
-	result := FromAnsi(line)
+	return response.decodeAnsi(line)
+}
+
+// decodeAnsi Декодирование строки в кодировке подключения
+// (по умолчанию ANSI).
+func (response *ServerResponse) decodeAnsi(line []byte) string {
+	if response.connection == nil || response.connection.Codec == nil {
+		return FromAnsi(line)
+	}
+	result, _ := response.connection.Codec.Decode(line)
 	return result
 }
 
@@ -103,9 +112,7 @@ func (response *ServerResponse) ReadRemainingAnsiLines() []string {
 
 func (response *ServerResponse) ReadRemainingAnsiText() string {
 	line, _ := ioutil.ReadAll(response.reader)
-	result := FromAnsi(line)
-
-	return result
+	return response.decodeAnsi(line)
 }
 
 func (response *ServerResponse) ReadRemainingUtfLines() []string {
@@ -0,0 +1,510 @@
+package irbis
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Коды диагностики SRU, не связанные с разбором CQL.
+const (
+	SRU_GENERAL_ERROR         = 1  // Общая ошибка системы.
+	SRU_UNSUPPORTED_OPERATION = 4  // Неподдерживаемая операция.
+	SRU_UNSUPPORTED_VERSION   = 5  // Неподдерживаемая версия.
+	SRU_BAD_PARAMETER_VALUE   = 6  // Недопустимое значение параметра.
+	SRU_MISSING_PARAMETER     = 7  // Не задан обязательный параметр.
+	SRU_FIRST_RECORD_RANGE    = 61 // Номер первой записи вне диапазона.
+	SRU_UNKNOWN_SCHEMA        = 66 // Неизвестная схема записей.
+	SRU_UNSUPPORTED_PACKING   = 71 // Неподдерживаемая упаковка записей.
+)
+
+// Идентификаторы схем записей, выдаваемых SRU-сервером.
+const (
+	SRU_MARCXML_SCHEMA = "info:srw/schema/1/marcxml-v1.1"
+	SRU_DC_SCHEMA      = "info:srw/schema/1/dc-v1.1"
+)
+
+var sruMessages = map[int]string{
+	SRU_GENERAL_ERROR:         "General system error",
+	SRU_UNSUPPORTED_OPERATION: "Unsupported operation",
+	SRU_UNSUPPORTED_VERSION:   "Unsupported version",
+	SRU_BAD_PARAMETER_VALUE:   "Unsupported parameter value",
+	SRU_MISSING_PARAMETER:     "Mandatory parameter not supplied",
+	CQL_SYNTAX_ERROR:          "Query syntax error",
+	CQL_UNSUPPORTED_INDEX:     "Unsupported index",
+	CQL_UNSUPPORTED_RELATION:  "Unsupported relation",
+	CQL_UNSUPPORTED_MODIFIER:  "Unsupported relation modifier",
+	CQL_EMPTY_TERM:            "Empty term unsupported",
+	CQL_UNSUPPORTED_MASKING:   "Masking character not supported",
+	CQL_UNSUPPORTED_PROXIMITY: "Proximity not supported",
+	SRU_FIRST_RECORD_RANGE:    "First record position out of range",
+	SRU_UNKNOWN_SCHEMA:        "Unknown schema for retrieval",
+	SRU_UNSUPPORTED_PACKING:   "Unsupported record packing",
+	CQL_UNSUPPORTED_SORT:      "Sort not supported",
+}
+
+// sruDiagnostic Диагностическое сообщение SRU.
+type sruDiagnostic struct {
+	code    int
+	details string
+}
+
+func newSruDiagnostic(err error) *sruDiagnostic {
+	if cql, ok := err.(*CqlError); ok {
+		return &sruDiagnostic{code: cql.Diagnostic, details: cql.Details}
+	}
+	return &sruDiagnostic{code: SRU_GENERAL_ERROR, details: err.Error()}
+}
+
+// sruDialect Особенности версии протокола SRU.
+type sruDialect struct {
+	version        string
+	prefix         string
+	namespace      string
+	scanPrefix     string
+	scanNamespace  string
+	diagNamespace  string
+	packingElement string
+}
+
+var sru12 = &sruDialect{
+	version:        "1.2",
+	prefix:         "srw",
+	namespace:      "http://www.loc.gov/zing/srw/",
+	scanPrefix:     "srw",
+	scanNamespace:  "http://www.loc.gov/zing/srw/",
+	diagNamespace:  "http://www.loc.gov/zing/srw/diagnostic/",
+	packingElement: "recordPacking",
+}
+
+var sru20 = &sruDialect{
+	version:        "2.0",
+	prefix:         "sru",
+	namespace:      "http://docs.oasis-open.org/ns/search-ws/sruResponse",
+	scanPrefix:     "scan",
+	scanNamespace:  "http://docs.oasis-open.org/ns/search-ws/scan",
+	diagNamespace:  "http://docs.oasis-open.org/ns/search-ws/diagnostic",
+	packingElement: "recordXMLEscaping",
+}
+
+// SruServer HTTP-обработчик протокола SRU 1.2/2.0 (операции
+// searchRetrieve, scan и explain) для одной базы данных.
+// Запросы CQL транслируются в поисковые выражения ИРБИС,
+// записи выдаются в формате MARCXML или Dublin Core.
+//
+//	pool := irbis.NewConnectionPool("host=127.0.0.1;user=reader;password=secret;", 4)
+//	http.Handle("/sru/IBIS", irbis.NewSruServer(pool, "IBIS"))
+type SruServer struct {
+	// Pool Пул подключений к серверу ИРБИС64.
+	Pool *ConnectionPool
+
+	// Database Имя базы данных.
+	Database string
+
+	// Title Название базы данных (для операции explain).
+	Title string
+
+	// Translator Транслятор запросов CQL.
+	Translator *CqlTranslator
+
+	// DefaultRecords Количество записей, выдаваемых по умолчанию.
+	DefaultRecords int
+
+	// MaxRecords Максимальное количество записей в одном ответе.
+	MaxRecords int
+
+	// MaxTerms Максимальное количество терминов в ответе на scan.
+	MaxTerms int
+}
+
+// NewSruServer Конструктор SRU-сервера с настройками по умолчанию.
+func NewSruServer(pool *ConnectionPool, database string) *SruServer {
+	return &SruServer{
+		Pool:           pool,
+		Database:       database,
+		Title:          database,
+		Translator:     NewCqlTranslator(),
+		DefaultRecords: 10,
+		MaxRecords:     100,
+		MaxTerms:       100,
+	}
+}
+
+// sruRequest Разобранный запрос SRU.
+type sruRequest struct {
+	writer  http.ResponseWriter
+	request *http.Request
+	dialect *sruDialect
+	body    strings.Builder
+}
+
+func (current *sruRequest) param(name string) string {
+	return current.request.Form.Get(name)
+}
+
+// intParam Целочисленный параметр; при ошибке разбора
+// возвращается диагностика.
+func (current *sruRequest) intParam(name string, defaultValue int) (int, *sruDiagnostic) {
+	text := current.param(name)
+	if len(text) == 0 {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(text)
+	if err != nil || result < 0 {
+		return 0, &sruDiagnostic{code: SRU_BAD_PARAMETER_VALUE, details: name}
+	}
+	return result, nil
+}
+
+func (current *sruRequest) write(parts ...string) {
+	for _, part := range parts {
+		current.body.WriteString(part)
+	}
+}
+
+// element Вывод элемента с экранированным текстом.
+func (current *sruRequest) element(prefix, name, text string) {
+	current.write("<", prefix, ":", name, ">", xmlEscape(text), "</", prefix, ":", name, ">")
+}
+
+func (current *sruRequest) writeDiagnostics(prefix string, diagnostics ...*sruDiagnostic) {
+	if len(diagnostics) == 0 {
+		return
+	}
+	current.write("<", prefix, ":diagnostics>")
+	for _, diagnostic := range diagnostics {
+		current.write(`<diag:diagnostic xmlns:diag="`, current.dialect.diagNamespace, `">`)
+		current.element("diag", "uri", "info:srw/diagnostic/1/"+strconv.Itoa(diagnostic.code))
+		if len(diagnostic.details) != 0 {
+			current.element("diag", "details", diagnostic.details)
+		}
+		current.element("diag", "message", sruMessages[diagnostic.code])
+		current.write("</diag:diagnostic>")
+	}
+	current.write("</", prefix, ":diagnostics>")
+}
+
+func (current *sruRequest) open(prefix, namespace, name string) {
+	current.write("<", prefix, ":", name, " xmlns:", prefix, `="`, namespace, `">`)
+	current.element(prefix, "version", current.dialect.version)
+}
+
+func (current *sruRequest) flush() {
+	current.writer.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	_, _ = current.writer.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n"))
+	_, _ = current.writer.Write([]byte(current.body.String()))
+}
+
+// ServeHTTP Обработка запроса SRU (GET или POST с параметрами формы).
+func (server *SruServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodPost {
+		writer.Header().Set("Allow", "GET, POST")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := &sruRequest{writer: writer, request: request, dialect: sru12}
+	operation := current.param("operation")
+	version := current.param("version")
+	var versionError *sruDiagnostic
+	switch version {
+	case "1.1", "1.2":
+	case "2.0":
+		current.dialect = sru20
+	case "":
+		if len(operation) == 0 {
+			current.dialect = sru20
+		}
+	default:
+		versionError = &sruDiagnostic{code: SRU_UNSUPPORTED_VERSION, details: "1.2"}
+	}
+
+	if len(operation) == 0 {
+		switch {
+		case len(current.param("query")) != 0:
+			operation = "searchRetrieve"
+		case len(current.param("scanClause")) != 0:
+			operation = "scan"
+		default:
+			operation = "explain"
+		}
+	}
+
+	switch {
+	case versionError != nil:
+		server.searchRetrieve(current, versionError)
+	case operation == "searchRetrieve":
+		server.searchRetrieve(current, nil)
+	case operation == "scan":
+		server.scan(current)
+	case operation == "explain":
+		server.explain(current)
+	default:
+		server.searchRetrieve(current,
+			&sruDiagnostic{code: SRU_UNSUPPORTED_OPERATION, details: operation})
+	}
+	current.flush()
+}
+
+// sruSchema Идентификатор схемы записей по её имени.
+func sruSchema(name string) string {
+	switch strings.ToLower(name) {
+	case "", "marcxml", "marc21", "marc", SRU_MARCXML_SCHEMA, MARCXML_NAMESPACE:
+		return SRU_MARCXML_SCHEMA
+	case "dc", "srw_dc", SRU_DC_SCHEMA, "info:srw/schema/1/dc-schema", "http://purl.org/dc/elements/1.1/":
+		return SRU_DC_SCHEMA
+	}
+	return ""
+}
+
+// sruRecordData Запись в указанной схеме.
+func sruRecordData(record *MarcRecord, schema string) string {
+	if schema == SRU_DC_SCHEMA {
+		return dublinCoreXml(DublinCore(record), "srw_dc:dc", "info:srw/schema/1/dc-schema")
+	}
+	return MarcXml(record)
+}
+
+func (server *SruServer) searchRetrieve(current *sruRequest, failure *sruDiagnostic) {
+	prefix := current.dialect.prefix
+	current.open(prefix, current.dialect.namespace, "searchRetrieveResponse")
+
+	var total int
+	var records []MarcRecord
+	var start int
+	if failure == nil {
+		total, records, start, failure = server.search(current)
+	}
+
+	current.element(prefix, "numberOfRecords", strconv.Itoa(total))
+	if len(records) != 0 {
+		schema := sruSchema(current.param("recordSchema"))
+		packing := PickOne(current.param(current.dialect.packingElement), "xml")
+		current.write("<", prefix, ":records>")
+		for i := range records {
+			current.write("<", prefix, ":record>")
+			current.element(prefix, "recordSchema", schema)
+			current.element(prefix, current.dialect.packingElement, packing)
+			data := sruRecordData(&records[i], schema)
+			if packing == "string" {
+				data = xmlEscape(data)
+			}
+			current.write("<", prefix, ":recordData>", data, "</", prefix, ":recordData>")
+			current.element(prefix, "recordPosition", strconv.Itoa(start+i))
+			current.write("</", prefix, ":record>")
+		}
+		current.write("</", prefix, ":records>")
+		if next := start + len(records); next <= total {
+			current.element(prefix, "nextRecordPosition", strconv.Itoa(next))
+		}
+	}
+
+	if failure != nil {
+		current.writeDiagnostics(prefix, failure)
+	}
+	current.write("</", prefix, ":searchRetrieveResponse>")
+}
+
+// search Выполнение поиска и считывание запрошенной порции записей.
+func (server *SruServer) search(current *sruRequest) (total int, records []MarcRecord,
+	start int, failure *sruDiagnostic) {
+	query := current.param("query")
+	if len(strings.TrimSpace(query)) == 0 {
+		return 0, nil, 0, &sruDiagnostic{code: SRU_MISSING_PARAMETER, details: "query"}
+	}
+	if sruSchema(current.param("recordSchema")) == "" {
+		return 0, nil, 0, &sruDiagnostic{code: SRU_UNKNOWN_SCHEMA,
+			details: current.param("recordSchema")}
+	}
+	switch current.param(current.dialect.packingElement) {
+	case "", "xml", "string":
+	default:
+		return 0, nil, 0, &sruDiagnostic{code: SRU_UNSUPPORTED_PACKING,
+			details: current.param(current.dialect.packingElement)}
+	}
+
+	start, failure = current.intParam("startRecord", 1)
+	if failure != nil {
+		return
+	}
+	if start == 0 {
+		return 0, nil, 0, &sruDiagnostic{code: SRU_BAD_PARAMETER_VALUE, details: "startRecord"}
+	}
+	var maximum int
+	maximum, failure = current.intParam("maximumRecords", server.DefaultRecords)
+	if failure != nil {
+		return
+	}
+	if maximum > server.MaxRecords {
+		maximum = server.MaxRecords
+	}
+
+	expression, err := server.Translator.Translate(query)
+	if err != nil {
+		return 0, nil, 0, newSruDiagnostic(err)
+	}
+
+	connection, err := server.Pool.Acquire(current.request.Context())
+	if err != nil {
+		return 0, nil, 0, newSruDiagnostic(err)
+	}
+	defer server.Pool.Release(connection)
+
+	var found []int
+	if maximum == 0 {
+		total, _, err = connection.searchPage(server.Database, expression, 0, 0)
+	} else {
+		total, found, err = connection.searchPage(server.Database, expression, start, maximum)
+	}
+	if err != nil {
+		return 0, nil, 0, newSruDiagnostic(err)
+	}
+	if maximum != 0 && start > total && total != 0 {
+		return total, nil, 0, &sruDiagnostic{code: SRU_FIRST_RECORD_RANGE,
+			details: strconv.Itoa(start)}
+	}
+	if len(found) > maximum {
+		found = found[:maximum]
+	}
+
+	if len(found) != 0 {
+		records, err = connection.readRecordsBatch(server.Database, found)
+		if err != nil {
+			return total, nil, 0, newSruDiagnostic(err)
+		}
+	}
+
+	return
+}
+
+func (server *SruServer) scan(current *sruRequest) {
+	prefix := current.dialect.scanPrefix
+	current.open(prefix, current.dialect.scanNamespace, "scanResponse")
+
+	terms, failure := server.scanTerms(current)
+	if len(terms) != 0 {
+		current.write("<", prefix, ":terms>")
+		for _, term := range terms {
+			current.write("<", prefix, ":term>")
+			current.element(prefix, "value", term.Text)
+			current.element(prefix, "numberOfRecords", strconv.Itoa(term.Count))
+			current.write("</", prefix, ":term>")
+		}
+		current.write("</", prefix, ":terms>")
+	}
+
+	if failure != nil {
+		current.writeDiagnostics(prefix, failure)
+	}
+	current.write("</", prefix, ":scanResponse>")
+}
+
+// scanTerms Термины словаря вокруг заданного в scanClause.
+// Из выдаваемых терминов удаляется префикс индекса.
+func (server *SruServer) scanTerms(current *sruRequest) (result []TermInfo, failure *sruDiagnostic) {
+	clause := current.param("scanClause")
+	if len(strings.TrimSpace(clause)) == 0 {
+		return nil, &sruDiagnostic{code: SRU_MISSING_PARAMETER, details: "scanClause"}
+	}
+	node, err := ParseCql(clause)
+	if err != nil {
+		return nil, newSruDiagnostic(err)
+	}
+	if len(node.Operator) != 0 {
+		return nil, &sruDiagnostic{code: CQL_SYNTAX_ERROR, details: "single term expected"}
+	}
+	termPrefix, err := server.Translator.Prefix(node.Index)
+	if err != nil {
+		return nil, newSruDiagnostic(err)
+	}
+
+	position, failure := current.intParam("responsePosition", 1)
+	if failure != nil {
+		return
+	}
+	maximum, failure := current.intParam("maximumTerms", 20)
+	if failure != nil {
+		return
+	}
+	if maximum > server.MaxTerms {
+		maximum = server.MaxTerms
+	}
+	if position > maximum+1 {
+		position = maximum + 1
+	}
+
+	connection, err := server.Pool.Acquire(current.request.Context())
+	if err != nil {
+		return nil, newSruDiagnostic(err)
+	}
+	defer server.Pool.Release(connection)
+
+	start := termPrefix + strings.TrimSpace(strings.Replace(node.Term, `\`, "", -1))
+	result, err = termsAround(connection, server.Database, termPrefix, start, position, maximum)
+	if err != nil {
+		return nil, newSruDiagnostic(err)
+	}
+
+	return
+}
+
+func (server *SruServer) explain(current *sruRequest) {
+	prefix := current.dialect.prefix
+	current.open(prefix, current.dialect.namespace, "explainResponse")
+
+	host, port, err := net.SplitHostPort(current.request.Host)
+	if err != nil {
+		host, port = current.request.Host, "80"
+	}
+
+	current.write("<", prefix, ":record>")
+	current.element(prefix, "recordSchema", "http://explain.z3950.org/dtd/2.0/")
+	current.element(prefix, current.dialect.packingElement, "xml")
+	current.write("<", prefix, ":recordData>")
+	current.write(`<explain xmlns="http://explain.z3950.org/dtd/2.0/">`)
+	current.write(`<serverInfo protocol="SRU" version="`, current.dialect.version, `">`)
+	current.write("<host>", xmlEscape(host), "</host><port>", xmlEscape(port), "</port>")
+	current.write("<database>", xmlEscape(strings.TrimPrefix(current.request.URL.Path, "/")), "</database>")
+	current.write("</serverInfo>")
+	current.write("<databaseInfo><title>", xmlEscape(server.Title), "</title></databaseInfo>")
+
+	current.write("<indexInfo>")
+	current.write(`<set name="cql" identifier="info:srw/cql-context-set/1/cql-v1.2"/>`)
+	current.write(`<set name="dc" identifier="info:srw/cql-context-set/1/dc-v1.1"/>`)
+	current.write(`<set name="bath" identifier="http://zing.z3950.org/cql/bath/2.0/"/>`)
+	current.write(`<set name="rec" identifier="info:srw/cql-context-set/2/rec-1.1"/>`)
+	var indexes []string
+	for index := range server.Translator.Indexes {
+		if strings.Contains(index, ".") {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Strings(indexes)
+	for _, index := range indexes {
+		dot := strings.IndexByte(index, '.')
+		current.write("<index><title>", xmlEscape(index), "</title><map><name set=\"",
+			xmlEscape(index[:dot]), "\">", xmlEscape(index[dot+1:]), "</name></map></index>")
+	}
+	current.write("</indexInfo>")
+
+	current.write("<schemaInfo>")
+	current.write(`<schema identifier="`, SRU_MARCXML_SCHEMA, `" name="marcxml"><title>MARCXML</title></schema>`)
+	current.write(`<schema identifier="`, SRU_DC_SCHEMA, `" name="dc"><title>Dublin Core</title></schema>`)
+	current.write("</schemaInfo>")
+
+	current.write("<configInfo>")
+	current.write(`<default type="numberOfRecords">`, strconv.Itoa(server.DefaultRecords), "</default>")
+	current.write(`<setting type="maximumRecords">`, strconv.Itoa(server.MaxRecords), "</setting>")
+	current.write(`<default type="retrieveSchema">marcxml</default>`)
+	current.write("</configInfo>")
+	current.write("</explain>")
+	current.write("</", prefix, ":recordData>")
+	current.write("</", prefix, ":record>")
+	current.write("</", prefix, ":explainResponse>")
+}
@@ -0,0 +1,171 @@
+package irbis
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeDictionary Сервер со словарём из указанных терминов
+// и тремя записями, находимыми любым поиском.
+func fakeDictionary(expressions *[]string, terms ...string) func(string, []string) []string {
+	sort.Strings(terms)
+	search := fakeSearchHandler(3)
+	return func(command string, params []string) []string {
+		switch command {
+		case "K":
+			*expressions = append(*expressions, params[1])
+			return search(command, params)
+		case "H", "P":
+			count, _ := strconv.Atoi(params[2])
+			result := []string{"0"}
+			if command == "H" {
+				for _, term := range terms {
+					if term >= params[1] && len(result) <= count {
+						result = append(result, "1#"+term)
+					}
+				}
+			} else {
+				for i := len(terms) - 1; i >= 0; i-- {
+					if terms[i] <= params[1] && len(result) <= count {
+						result = append(result, "1#"+terms[i])
+					}
+				}
+			}
+			return result
+		}
+		return search(command, params)
+	}
+}
+
+func sruGet(t *testing.T, server *SruServer, query string) string {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/sru/IBIS?"+query, nil))
+	body := recorder.Body.String()
+
+	// Ответ должен быть корректным XML
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err, body)
+		}
+	}
+	return body
+}
+
+func newFakeSruServer(expressions *[]string) *SruServer {
+	pool := NewConnectionPool("", 1)
+	pool.factory = func() *Connection {
+		return newFakeConnection(fakeDictionary(expressions, "T=A", "T=B", "T=C", "T=D", "K=X"))
+	}
+	return NewSruServer(pool, "IBIS")
+}
+
+func TestSruServer_SearchRetrieve_1(t *testing.T) {
+	var expressions []string
+	server := newFakeSruServer(&expressions)
+	body := sruGet(t, server, "version=1.2&operation=searchRetrieve&query=dc.title%3Dwar&maximumRecords=2")
+	if len(expressions) != 1 || expressions[0] != "T=war" {
+		t.Fatal(expressions)
+	}
+	if !strings.Contains(body, "<srw:numberOfRecords>3</srw:numberOfRecords>") ||
+		strings.Count(body, "<srw:record>") != 2 ||
+		!strings.Contains(body, "<srw:nextRecordPosition>3</srw:nextRecordPosition>") ||
+		!strings.Contains(body, `<datafield tag="200" ind1=" " ind2=" "><subfield code="a">Title 2</subfield>`) {
+		t.Fatal(body)
+	}
+
+	body = sruGet(t, server, "version=2.0&query=war&startRecord=3&recordSchema=dc&recordXMLEscaping=string")
+	if !strings.Contains(body, "<sru:numberOfRecords>3</sru:numberOfRecords>") ||
+		!strings.Contains(body, "&lt;dc:title&gt;Title 3&lt;/dc:title&gt;") ||
+		!strings.Contains(body, "<sru:recordPosition>3</sru:recordPosition>") ||
+		strings.Contains(body, "nextRecordPosition") {
+		t.Fatal(body)
+	}
+}
+
+func TestSruServer_SearchRetrieve_2(t *testing.T) {
+	var expressions []string
+	server := newFakeSruServer(&expressions)
+	for query, code := range map[string]string{
+		"version=1.2&operation=searchRetrieve&query=dc.foo%3Dx":          "16",
+		"version=1.2&operation=searchRetrieve":                           "7",
+		"version=1.2&operation=searchRetrieve&query=x&recordSchema=mods": "66",
+		"version=1.2&operation=searchRetrieve&query=x&startRecord=10":    "61",
+		"version=1.2&operation=searchRetrieve&query=x&maximumRecords=-1": "6",
+		"version=3.0&operation=searchRetrieve&query=x":                   "5",
+		"version=1.2&operation=update":                                   "4",
+	} {
+		body := sruGet(t, server, query)
+		if !strings.Contains(body, "<diag:uri>info:srw/diagnostic/1/"+code+"</diag:uri>") {
+			t.Fatal(query, body)
+		}
+	}
+}
+
+func TestSruServer_Scan_1(t *testing.T) {
+	var expressions []string
+	server := newFakeSruServer(&expressions)
+	body := sruGet(t, server, "version=1.2&operation=scan&scanClause=dc.title%3DB&responsePosition=2&maximumTerms=3")
+	expected := "<srw:terms>" +
+		"<srw:term><srw:value>A</srw:value><srw:numberOfRecords>1</srw:numberOfRecords></srw:term>" +
+		"<srw:term><srw:value>B</srw:value><srw:numberOfRecords>1</srw:numberOfRecords></srw:term>" +
+		"<srw:term><srw:value>C</srw:value><srw:numberOfRecords>1</srw:numberOfRecords></srw:term>" +
+		"</srw:terms>"
+	if !strings.Contains(body, expected) {
+		t.Fatal(body)
+	}
+
+	body = sruGet(t, server, "version=1.2&operation=scan&scanClause=dc.title%3DC&maximumTerms=5")
+	if strings.Count(body, "<srw:term>") != 2 || strings.Contains(body, "X") {
+		t.Fatal(body)
+	}
+}
+
+func TestSruServer_Explain_1(t *testing.T) {
+	var expressions []string
+	server := newFakeSruServer(&expressions)
+	body := sruGet(t, server, "")
+	if !strings.Contains(body, "<sru:explainResponse") ||
+		!strings.Contains(body, `<name set="dc">title</name>`) ||
+		!strings.Contains(body, SRU_MARCXML_SCHEMA) {
+		t.Fatal(body)
+	}
+}
+
+func TestMarcXml_1(t *testing.T) {
+	record := NewMarcRecord()
+	record.Mfn = 5
+	record.Add(5, "20190101")
+	record.Add(200, "").Add('a', "Война & мир").Add('f', "Толстой")
+	record.Add(700, "").Add('a', "Толстой").Add('b', "Л. Н.")
+	record.Add(10, "").Add('a', "5-01-001234-5")
+	xmlText := MarcXml(record)
+	expected := `<record xmlns="http://www.loc.gov/MARC21/slim">` +
+		`<leader>00000nam a2200000 i 4500</leader>` +
+		`<controlfield tag="001">5</controlfield>` +
+		`<controlfield tag="005">20190101</controlfield>` +
+		`<datafield tag="200" ind1=" " ind2=" "><subfield code="a">Война &amp; мир</subfield>` +
+		`<subfield code="f">Толстой</subfield></datafield>` +
+		`<datafield tag="700" ind1=" " ind2=" "><subfield code="a">Толстой</subfield>` +
+		`<subfield code="b">Л. Н.</subfield></datafield>` +
+		`<datafield tag="010" ind1=" " ind2=" "><subfield code="a">5-01-001234-5</subfield></datafield>` +
+		`</record>`
+	if xmlText != expected {
+		t.Fatal(xmlText)
+	}
+
+	dc := DublinCore(record)
+	if len(dc) != 4 || dc[0].Value != "Война & мир" || dc[1].Value != "Толстой, Л. Н." ||
+		dc[3].Value != "ISBN 5-01-001234-5" {
+		t.Fatal(dc)
+	}
+}
@@ -0,0 +1,101 @@
+package irbis
+
+import (
+	"sort"
+	"strings"
+)
+
+// StopWords Список стоп-слов (STW-файл), не попадающих
+// в поисковый словарь. Слова сравниваются после перевода
+// в верхний регистр по таблице ISISUCW.TAB, как при индексировании.
+type StopWords struct {
+	words map[string]bool
+	upper *UpperCaseTable
+}
+
+// NewStopWords Конструктор, создаёт список из указанных слов
+// со стандартной таблицей перевода в верхний регистр.
+func NewStopWords(words ...string) *StopWords {
+	result := &StopWords{words: make(map[string]bool), upper: DefaultUpperCaseTable()}
+	for _, word := range words {
+		result.Add(word)
+	}
+	return result
+}
+
+// ParseStopWords Разбор STW-файла (по одному слову на строке).
+func ParseStopWords(lines []string) *StopWords {
+	result := NewStopWords()
+	for _, line := range lines {
+		result.Add(line)
+	}
+	return result
+}
+
+// ReadStopWords Загрузка STW-файла с локального диска.
+func ReadStopWords(filename string) (*StopWords, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseStopWords(lines), nil
+}
+
+// SetUpperCase Замена таблицы перевода в верхний регистр
+// (например, загруженной с сервера вместе с ISISACW.TAB).
+// Слова, уже находящиеся в списке, перекодируются.
+func (stop *StopWords) SetUpperCase(table *UpperCaseTable) *StopWords {
+	words := stop.words
+	stop.upper = table
+	stop.words = make(map[string]bool, len(words))
+	for word := range words {
+		stop.words[stop.normalize(word)] = true
+	}
+	return stop
+}
+
+// normalize Перевод слова в верхний регистр по таблице.
+func (stop *StopWords) normalize(word string) string {
+	text := ToAnsi(word)
+	for i, c := range text {
+		text[i] = stop.upper.ToUpper(c)
+	}
+	return FromAnsi(text)
+}
+
+// Add Добавление слова в список.
+func (stop *StopWords) Add(word string) *StopWords {
+	word = strings.TrimSpace(strings.Trim(word, "\x1A"))
+	if len(word) != 0 {
+		stop.words[stop.normalize(word)] = true
+	}
+	return stop
+}
+
+// IsStopWord Является ли слово стоп-словом?
+// Регистр символов не учитывается.
+func (stop *StopWords) IsStopWord(word string) bool {
+	return stop.words[stop.normalize(word)]
+}
+
+// Len Количество слов в списке.
+func (stop *StopWords) Len() int {
+	return len(stop.words)
+}
+
+// String Текстовое представление в формате STW-файла
+// (слова в алфавитном порядке).
+func (stop *StopWords) String() string {
+	words := make([]string, 0, len(stop.words))
+	for word := range stop.words {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	result := strings.Builder{}
+	for _, word := range words {
+		result.WriteString(word)
+		result.WriteString("\n")
+	}
+	return result.String()
+}
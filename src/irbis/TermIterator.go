@@ -0,0 +1,178 @@
+package irbis
+
+import (
+	"strings"
+)
+
+// DefaultTermPageSize Количество терминов, запрашиваемых
+// итератором за один раз (по умолчанию).
+const DefaultTermPageSize = 512
+
+// TermIterator Последовательный перебор терминов поискового словаря
+// с автоматической подкачкой страниц. Порядок перебора (прямой или
+// обратный) задаётся TermParameters.ReverseOrder.
+//
+//	iterator := irbis.NewTermIterator(connection, &irbis.TermParameters{StartTerm: "A="})
+//	iterator.Prefix = "A="
+//	for iterator.Next() {
+//		fmt.Println(iterator.Term())
+//	}
+//	if iterator.Err() != nil { ... }
+type TermIterator struct {
+	// PageSize Количество терминов, запрашиваемых за один раз.
+	PageSize int
+
+	// Prefix Префикс. Перебор прекращается на первом термине,
+	// который не начинается с префикса.
+	Prefix string
+
+	parameters TermParameters
+	fetch      func(parameters *TermParameters) ([]TermInfo, error)
+	page       []TermInfo
+	index      int
+	current    TermInfo
+	started    bool
+	exhausted  bool
+	done       bool
+	err        error
+}
+
+func newTermIterator(parameters *TermParameters,
+	fetch func(parameters *TermParameters) ([]TermInfo, error)) *TermIterator {
+	result := &TermIterator{parameters: *parameters, fetch: fetch}
+	result.PageSize = parameters.NumberOfTerms
+	if result.PageSize <= 0 {
+		result.PageSize = DefaultTermPageSize
+	}
+	return result
+}
+
+// NewTermIterator Создание итератора терминов, получаемых с сервера.
+func NewTermIterator(connection *Connection, parameters *TermParameters) *TermIterator {
+	return newTermIterator(parameters, connection.readTerms)
+}
+
+// NewDirectTermIterator Создание итератора терминов,
+// считываемых непосредственно из файлов базы данных.
+func NewDirectTermIterator(access *DirectAccess, parameters *TermParameters) *TermIterator {
+	return newTermIterator(parameters, access.ReadTerms)
+}
+
+// Next Переход к следующему термину.
+// Возвращает false, если терминов больше нет или произошла ошибка.
+func (iterator *TermIterator) Next() bool {
+	for !iterator.done {
+		if iterator.index < len(iterator.page) {
+			term := iterator.page[iterator.index]
+			iterator.index++
+
+			// Очередная страница начинается с последнего
+			// выданного термина
+			if iterator.started && term.Text == iterator.current.Text {
+				continue
+			}
+
+			if len(iterator.Prefix) != 0 && !strings.HasPrefix(term.Text, iterator.Prefix) {
+				iterator.done = true
+				break
+			}
+
+			iterator.current = term
+			iterator.started = true
+			return true
+		}
+
+		if iterator.exhausted {
+			iterator.done = true
+			break
+		}
+
+		iterator.fetchPage()
+	}
+
+	return false
+}
+
+func (iterator *TermIterator) fetchPage() {
+	parameters := iterator.parameters
+	parameters.NumberOfTerms = iterator.PageSize
+	if parameters.NumberOfTerms < 2 {
+		// При странице из одного термина перебор зациклился бы
+		parameters.NumberOfTerms = 2
+	}
+
+	if iterator.started {
+		parameters.StartTerm = iterator.current.Text
+	} else if len(parameters.StartTerm) == 0 && len(iterator.Prefix) != 0 {
+		parameters.StartTerm = iterator.Prefix
+		if parameters.ReverseOrder {
+			parameters.StartTerm += string(rune(0x10FFFF))
+		}
+	}
+
+	iterator.page, iterator.err = iterator.fetch(&parameters)
+	iterator.index = 0
+	if iterator.err != nil {
+		iterator.page = nil
+		iterator.done = true
+		return
+	}
+
+	if len(iterator.page) < parameters.NumberOfTerms {
+		iterator.exhausted = true
+	}
+}
+
+// Term Текущий термин.
+func (iterator *TermIterator) Term() TermInfo {
+	return iterator.current
+}
+
+// Err Ошибка, прервавшая перебор (nil, если ошибок не было).
+func (iterator *TermIterator) Err() error {
+	return iterator.err
+}
+
+// termsAround Окрестность термина в словаре: position-1 терминов
+// перед начальным термином и далее, всего не более maximum терминов.
+// Перебор ограничивается префиксом, который отбрасывается у терминов.
+func termsAround(connection *Connection, database, prefix, start string,
+	position, maximum int) (result []TermInfo, err error) {
+	collect := func(reverse bool, count int) ([]TermInfo, error) {
+		var terms []TermInfo
+		parameters := &TermParameters{Database: database,
+			StartTerm: start, ReverseOrder: reverse}
+		iterator := NewTermIterator(connection, parameters)
+		iterator.Prefix = prefix
+		iterator.PageSize = count + 1
+		for len(terms) < count && iterator.Next() {
+			term := iterator.Term()
+			if reverse && term.Text >= start {
+				continue
+			}
+			term.Text = term.Text[len(prefix):]
+			terms = append(terms, term)
+		}
+		return terms, iterator.Err()
+	}
+
+	if position > 1 {
+		var before []TermInfo
+		if before, err = collect(true, position-1); err != nil {
+			return nil, err
+		}
+		for i := len(before) - 1; i >= 0; i-- {
+			result = append(result, before[i])
+		}
+	}
+
+	if position <= maximum {
+		var after []TermInfo
+		if after, err = collect(false, maximum-position+1); err != nil {
+			return nil, err
+		}
+		result = append(result, after...)
+	}
+
+	return
+}
@@ -0,0 +1,207 @@
+package irbis
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func openTestIndex(t *testing.T) *DirectAccess {
+	ifp, err := OpenIfpFile("../../data/irbis64/datai/ibis/ibis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DirectAccess{ifp: ifp}
+}
+
+func TestTermIterator_1(t *testing.T) {
+	access := openTestIndex(t)
+	defer access.ifp.Close()
+
+	iterator := NewDirectTermIterator(access, &TermParameters{NumberOfTerms: 100})
+	count, previous := 0, ""
+	for iterator.Next() {
+		text := iterator.Term().Text
+		if text <= previous {
+			t.Fatal(previous, text)
+		}
+		previous = text
+		count++
+	}
+	if iterator.Err() != nil || count != 13440 {
+		t.Fatal(count, iterator.Err())
+	}
+}
+
+func TestTermIterator_2(t *testing.T) {
+	access := openTestIndex(t)
+	defer access.ifp.Close()
+
+	forward := NewDirectTermIterator(access, &TermParameters{})
+	forward.Prefix = "A="
+	forward.PageSize = 10
+	var terms []string
+	for forward.Next() {
+		if forward.Term().Count <= 0 {
+			t.FailNow()
+		}
+		terms = append(terms, forward.Term().Text)
+	}
+	if len(terms) != 433 || terms[0] != "A=11" {
+		t.Fatal(len(terms))
+	}
+
+	reverse := NewDirectTermIterator(access, &TermParameters{ReverseOrder: true})
+	reverse.Prefix = "A="
+	reverse.PageSize = 7
+	var reversed []string
+	for reverse.Next() {
+		reversed = append(reversed, reverse.Term().Text)
+	}
+	sort.Strings(reversed)
+	if strings.Join(reversed, "\n") != strings.Join(terms, "\n") {
+		t.Fatal(len(reversed))
+	}
+
+	terms = nil
+	iterator := NewDirectTermIterator(access, &TermParameters{StartTerm: "K=ПРОГРАММ"})
+	iterator.Prefix = "K=ПРОГ"
+	for iterator.Next() {
+		terms = append(terms, iterator.Term().Text)
+	}
+	if len(terms) != 12 || terms[0] != "K=ПРОГРАММ" {
+		t.Fatal(terms)
+	}
+}
+
+func TestTermIterator_3(t *testing.T) {
+	failure := errors.New("failure")
+	calls := 0
+	iterator := newTermIterator(&TermParameters{NumberOfTerms: 3},
+		func(parameters *TermParameters) ([]TermInfo, error) {
+			calls++
+			if calls == 3 {
+				return nil, failure
+			}
+			return []TermInfo{{1, parameters.StartTerm}, {1, parameters.StartTerm + "A"},
+				{1, parameters.StartTerm + "AA"}}, nil
+		})
+	var terms []string
+	for iterator.Next() {
+		terms = append(terms, iterator.Term().Text)
+	}
+	if iterator.Err() != failure || strings.Join(terms, ",") != ",A,AA,AAA,AAAA" {
+		t.Fatal(terms, iterator.Err())
+	}
+}
+
+func TestPostingIterator_1(t *testing.T) {
+	access := openTestIndex(t)
+	defer access.ifp.Close()
+
+	parameters := &PostingParameters{Term: "CIKLD=ЕН", NumberOfPostings: 100}
+	iterator := NewDirectPostingIterator(access, parameters)
+	count := 0
+	for iterator.Next() {
+		posting := iterator.Posting()
+		if posting.Mfn <= 0 || posting.Tag != 691 {
+			t.Fatal(posting.String())
+		}
+		count++
+	}
+	if iterator.Err() != nil || count != 307 {
+		t.Fatal(count)
+	}
+
+	parameters = &PostingParameters{Term: "CIKLD=ЕН", FirstPosting: 300}
+	postings, err := access.ReadPostings(parameters)
+	if err != nil || len(postings) != 8 {
+		t.Fatal(len(postings))
+	}
+
+	parameters = &PostingParameters{Term: "NO SUCH TERM"}
+	iterator = NewDirectPostingIterator(access, parameters)
+	if iterator.Next() || iterator.Err() != nil {
+		t.FailNow()
+	}
+}
+
+func TestPostingIterator_2(t *testing.T) {
+	access := openTestIndex(t)
+	defer access.ifp.Close()
+
+	terms := []string{"CIKLD=ЕН", "NO SUCH TERM", "CIKLD=ЕН"}
+	all, err := access.ReadPostings(&PostingParameters{ListOfTerms: terms})
+	if err != nil || len(all) != 614 {
+		t.Fatal(len(all), err)
+	}
+
+	// Постраничное чтение продолжается с того же блока IFP
+	paged := access.newPostingCursor(&PostingParameters{ListOfTerms: terms})
+	var links *linkCursor
+	for first := 1; first <= len(all); first += 10 {
+		page, err := paged.readPage(&PostingParameters{FirstPosting: first, NumberOfPostings: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, posting := range page {
+			if posting != all[first-1+i] {
+				t.Fatal(first + i)
+			}
+		}
+		if first > 1 && first < 300 && paged.links != links {
+			t.Fatal(first)
+		}
+		links = paged.links
+	}
+
+	// Пропуск части постингов и возврат к началу
+	for _, first := range []int{307, 1, 500} {
+		page, err := paged.readPage(&PostingParameters{FirstPosting: first, NumberOfPostings: 3})
+		if err != nil || len(page) != 3 || page[0] != all[first-1] || page[2] != all[first+1] {
+			t.Fatal(first, page, err)
+		}
+	}
+}
+
+func TestIfpFile_FindRoot_1(t *testing.T) {
+	access := openTestIndex(t)
+	root, err := access.ifp.findRoot()
+	access.ifp.Close()
+	if err != nil || root != 3 {
+		t.Fatal(root, err)
+	}
+
+	// Ссылка на корень указывает на некорневую запись
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := "../../data/irbis64/datai/ibis/ibis"
+	for _, extension := range []string{".ifp", ".l01", ".n01"} {
+		data, err := ioutil.ReadFile(source + extension)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if extension == ".n01" {
+			binary.BigEndian.PutUint32(data, 4)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, "ibis"+extension), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ifp, err := OpenIfpFile(filepath.Join(dir, "ibis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ifp.Close()
+	if _, err = ifp.ReadLinks("K=ALPHA"); err == nil {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,101 @@
+package irbis
+
+// TermNormalizer Нормализатор терминов: разбивает текст на слова
+// и переводит их в верхний регистр так же, как это делает
+// индексатор ИРБИС (по таблицам ISISACW.TAB и ISISUCW.TAB,
+// с отбрасыванием стоп-слов), чтобы сформированные локально
+// термины совпадали с терминами словаря.
+type TermNormalizer struct {
+	// Alphabet Таблица алфавитных символов.
+	Alphabet *AlphabetTable
+
+	// UpperCase Таблица преобразования в верхний регистр.
+	UpperCase *UpperCaseTable
+
+	// StopWords Стоп-слова (может быть nil). Если UpperCase
+	// отличается от стандартной, её следует передать
+	// и в StopWords.SetUpperCase.
+	StopWords *StopWords
+
+	// MaxLength Максимальная длина термина в байтах (0 -- без ограничения).
+	MaxLength int
+}
+
+// NewTermNormalizer Конструктор, создаёт нормализатор
+// со стандартными таблицами и без стоп-слов.
+func NewTermNormalizer() *TermNormalizer {
+	result := new(TermNormalizer)
+	result.Alphabet = DefaultAlphabetTable()
+	result.UpperCase = DefaultUpperCaseTable()
+	result.MaxLength = MaxTermSize
+	return result
+}
+
+// upper Перевод ANSI-текста в верхний регистр.
+func (normalizer *TermNormalizer) upper(text []byte) []byte {
+	result := make([]byte, len(text))
+	for i, c := range text {
+		result[i] = normalizer.UpperCase.ToUpper(c)
+	}
+	return result
+}
+
+// truncate Обрезка термина до максимальной длины.
+func (normalizer *TermNormalizer) truncate(text []byte) []byte {
+	if normalizer.MaxLength > 0 && len(text) > normalizer.MaxLength {
+		return text[:normalizer.MaxLength]
+	}
+	return text
+}
+
+// ToUpper Перевод текста в верхний регистр по таблице ISISUCW.TAB
+// (например, для терминов, индексируемых по полю целиком).
+func (normalizer *TermNormalizer) ToUpper(text string) string {
+	return FromAnsi(normalizer.upper(ToAnsi(text)))
+}
+
+// Normalize Нормализация термина, индексируемого по полю целиком:
+// перевод в верхний регистр и обрезка до максимальной длины.
+func (normalizer *TermNormalizer) Normalize(text string) string {
+	return FromAnsi(normalizer.truncate(normalizer.upper(ToAnsi(text))))
+}
+
+// SplitWords Разбиение текста на слова (последовательности алфавитных
+// символов) в верхнем регистре. Стоп-слова отбрасываются.
+func (normalizer *TermNormalizer) SplitWords(text string) (result []string) {
+	upper := normalizer.upper(ToAnsi(text))
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := FromAnsi(normalizer.truncate(upper[start:end]))
+		start = -1
+		if normalizer.StopWords != nil && normalizer.StopWords.IsStopWord(word) {
+			return
+		}
+		result = append(result, word)
+	}
+
+	for i, c := range upper {
+		if normalizer.Alphabet.IsAlpha(c) {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			flush(i)
+		}
+	}
+	flush(len(upper))
+
+	return
+}
+
+// Terms Формирование поисковых терминов с указанным префиксом
+// из слов текста (например, Terms("K=", title)).
+func (normalizer *TermNormalizer) Terms(prefix, text string) (result []string) {
+	for _, word := range normalizer.SplitWords(text) {
+		result = append(result, prefix+word)
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package irbis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAlphabetTable_1(t *testing.T) {
+	fromFile, err := ReadAlphabetTable("../../data/isisacw.tab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtin := DefaultAlphabetTable()
+	for c := 0; c < 256; c++ {
+		if fromFile.IsAlpha(byte(c)) != builtin.IsAlpha(byte(c)) {
+			t.Fatal(c)
+		}
+	}
+	if !builtin.IsAlpha('A') || builtin.IsAlpha('1') || builtin.IsAlpha(' ') {
+		t.FailNow()
+	}
+}
+
+func TestUpperCaseTable_1(t *testing.T) {
+	fromFile, err := ReadUpperCaseTable("../../data/isisucw.tab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *fromFile != *DefaultUpperCaseTable() {
+		t.FailNow()
+	}
+	if _, err = ParseUpperCaseTable("001 002"); err == nil {
+		t.FailNow()
+	}
+}
+
+func TestStopWords_1(t *testing.T) {
+	stop, err := ReadStopWords("../../data/ibis.stw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stop.IsStopWord("about") || !stop.IsStopWord("AND") || stop.IsStopWord("ROMAN") {
+		t.FailNow()
+	}
+	if len(strings.Split(strings.TrimSpace(stop.String()), "\n")) != stop.Len() {
+		t.FailNow()
+	}
+}
+
+func TestStopWords_2(t *testing.T) {
+	// Ё переводится в Е так же, как при индексировании
+	stop := NewStopWords("её", "ещё")
+	if !stop.IsStopWord("ЕЕ") || !stop.IsStopWord("Её") || !stop.IsStopWord("еще") {
+		t.FailNow()
+	}
+
+	normalizer := NewTermNormalizer()
+	normalizer.StopWords = stop
+	if words := normalizer.SplitWords("Её ещё нет"); len(words) != 1 || words[0] != "НЕТ" {
+		t.Fatal(words)
+	}
+}
+
+func TestTermNormalizer_SplitWords_1(t *testing.T) {
+	normalizer := NewTermNormalizer()
+	normalizer.StopWords = NewStopWords("и", "the")
+	words := normalizer.SplitWords("Ёжик и Медвежонок: the 2-nd story")
+	if strings.Join(words, " ") != "ЕЖИК МЕДВЕЖОНОК ND STORY" {
+		t.Fatal(words)
+	}
+	terms := normalizer.Terms("K=", "Война и мир")
+	if len(terms) != 2 || terms[0] != "K=ВОЙНА" || terms[1] != "K=МИР" {
+		t.Fatal(terms)
+	}
+}
+
+func TestTermNormalizer_Normalize_1(t *testing.T) {
+	normalizer := NewTermNormalizer()
+	normalizer.MaxLength = 5
+	if normalizer.Normalize("Пушкин А.С.") != "ПУШКИ" {
+		t.FailNow()
+	}
+	if normalizer.ToUpper("ёлка") != "ЕЛКА" {
+		t.FailNow()
+	}
+}
@@ -1,49 +1,86 @@
 package irbis
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// TreeDelimiter Разделитель кода и описания в строке TRE-файла.
+const TreeDelimiter = " - "
+
+// TreeNode Узел дерева (строка TRE-файла).
 type TreeNode struct {
 	Value    string
-	Children []TreeNode
+	Children []*TreeNode
 	level    int
+	parent   *TreeNode
 }
 
+// Add Добавление дочернего узла с указанным значением.
 func (node *TreeNode) Add(value string) *TreeNode {
-	child := TreeNode{Value: value}
+	child := &TreeNode{Value: value, level: node.level + 1, parent: node}
 	node.Children = append(node.Children, child)
 	return node
 }
 
-func (node *TreeNode) String() string {
-	return node.Value
+// Code Код узла (часть значения до разделителя " - ").
+func (node *TreeNode) Code() string {
+	index := strings.Index(node.Value, TreeDelimiter)
+	if index < 0 {
+		return strings.TrimSpace(node.Value)
+	}
+	return strings.TrimSpace(node.Value[:index])
 }
 
-type TreeFile struct {
-	Roots []TreeNode
+// Description Описание узла (часть значения после разделителя " - ").
+func (node *TreeNode) Description() string {
+	index := strings.Index(node.Value, TreeDelimiter)
+	if index < 0 {
+		return ""
+	}
+	return strings.TrimSpace(node.Value[index+len(TreeDelimiter):])
+}
+
+// Level Уровень вложенности узла (у корневых узлов 0).
+func (node *TreeNode) Level() int {
+	return node.level
 }
 
-func arrange1(list []TreeNode, level int) {
-	count := len(list)
-	index := 0
-	for index < count {
-		next := arrange2(list, level, index, count)
-		index = next
+// Parent Родительский узел (у корневых узлов nil).
+func (node *TreeNode) Parent() *TreeNode {
+	return node.parent
+}
+
+// Path Путь от корня дерева до данного узла (включительно).
+func (node *TreeNode) Path() (result []*TreeNode) {
+	for current := node; current != nil; current = current.parent {
+		result = append([]*TreeNode{current}, result...)
 	}
+	return
 }
 
-func arrange2(list []TreeNode, level, index, count int) int {
-	next := index + 1
-	level2 := level + 1
-	parent := list[index]
-	for next < count {
-		child := list[next]
-		if child.level < level {
-			break
-		}
-		if child.level == level2 {
-			parent.Children = append(parent.Children, child)
+// Walk Обход поддерева в глубину, начиная с данного узла.
+// Если visitor возвращает false, обход прекращается.
+func (node *TreeNode) Walk(visitor func(node *TreeNode) bool) bool {
+	if !visitor(node) {
+		return false
+	}
+	for _, child := range node.Children {
+		if !child.Walk(visitor) {
+			return false
 		}
-		next++
 	}
-	return next
+	return true
+}
+
+func (node *TreeNode) String() string {
+	return node.Value
+}
+
+// TreeFile TRE-файл -- древовидный справочник.
+type TreeFile struct {
+	Roots []*TreeNode
 }
 
 func countIndent(text string) (result int) {
@@ -58,57 +95,112 @@ func countIndent(text string) (result int) {
 	return
 }
 
+// AddRoot Добавление корневого узла с указанным значением.
 func (tree *TreeFile) AddRoot(value string) *TreeNode {
-	result := new(TreeNode)
-	result.Value = value
-	tree.Roots = append(tree.Roots, *result)
-	result = &tree.Roots[len(tree.Roots)-1]
+	result := &TreeNode{Value: value}
+	tree.Roots = append(tree.Roots, result)
 	return result
 }
 
-func (tree *TreeFile) Parse(lines []string) {
-	// TODO implement properly
+// Parse Разбор TRE-файла. Уровень вложенности задаётся
+// количеством символов табуляции в начале строки,
+// пустые строки пропускаются.
+func (tree *TreeFile) Parse(lines []string) error {
+	tree.Roots = nil
+	var stack []*TreeNode
+	for number, line := range lines {
+		line = strings.TrimRight(line, "\r\n ")
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		level := countIndent(line)
+		if level > len(stack) {
+			return errors.New("wrong indent at line " + strconv.Itoa(number+1))
+		}
 
-	if len(lines) == 0 {
-		return
+		node := &TreeNode{Value: line[level:], level: level}
+		stack = stack[:level]
+		if level == 0 {
+			tree.Roots = append(tree.Roots, node)
+		} else {
+			parent := stack[level-1]
+			node.parent = parent
+			parent.Children = append(parent.Children, node)
+		}
+		stack = append(stack, node)
 	}
 
-	currentLevel := 0
-	line := lines[0]
-	if countIndent(line) != 0 {
-		panic("Wrong indent")
+	return nil
+}
+
+// ReadTreeFile Загрузка TRE-файла с локального диска.
+func ReadTreeFile(filename string) (*TreeFile, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
 	}
-	list := []TreeNode{{Value: line}}
 
-	maxLevel := 0
-	for _, item := range list {
-		if item.level > maxLevel {
-			maxLevel = item.level
-		}
+	result := new(TreeFile)
+	if err = result.Parse(lines); err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	for _, line := range lines[1:] {
-		if len(line) == 0 {
-			continue
-		}
-		level := countIndent(line)
-		if level > (currentLevel + 1) {
-			panic("Wrong level")
+// Walk Обход всего дерева в глубину.
+// Если visitor возвращает false, обход прекращается.
+func (tree *TreeFile) Walk(visitor func(node *TreeNode) bool) {
+	for _, root := range tree.Roots {
+		if !root.Walk(visitor) {
+			return
 		}
-		currentLevel = level
-		line = line[currentLevel:]
-		node := TreeNode{Value: line, level: currentLevel}
-		list = append(list, node)
 	}
+}
 
-	for level := 0; level < maxLevel; level++ {
-		arrange1(list, level)
-	}
+// Flatten Выдаёт все узлы дерева в порядке обхода
+// (уровень каждого узла доступен через Level).
+func (tree *TreeFile) Flatten() (result []*TreeNode) {
+	tree.Walk(func(node *TreeNode) bool {
+		result = append(result, node)
+		return true
+	})
+	return
+}
 
-	for i := range list {
-		item := list[i]
-		if item.level == 0 {
-			tree.Roots = append(tree.Roots, item)
+// FindNode Поиск узла по коду (регистр символов не учитывается).
+// Если узел не найден, возвращается nil.
+func (tree *TreeFile) FindNode(code string) (result *TreeNode) {
+	code = strings.TrimSpace(code)
+	tree.Walk(func(node *TreeNode) bool {
+		if SameString(node.Code(), code) {
+			result = node
+			return false
 		}
+		return true
+	})
+	return
+}
+
+// Save Сохранение TRE-файла на локальный диск.
+func (tree *TreeFile) Save(filename string) error {
+	return WriteAnsiFile(filename, tree.String())
+}
+
+// String Текстовое представление дерева в формате TRE-файла.
+func (tree *TreeFile) String() string {
+	result := strings.Builder{}
+	for _, root := range tree.Roots {
+		writeTreeNode(&result, root, 0)
+	}
+	return result.String()
+}
+
+func writeTreeNode(result *strings.Builder, node *TreeNode, level int) {
+	result.WriteString(strings.Repeat("\t", level))
+	result.WriteString(node.Value)
+	result.WriteString("\n")
+	for _, child := range node.Children {
+		writeTreeNode(result, child, level+1)
 	}
 }
@@ -0,0 +1,63 @@
+package irbis
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testTreeFile = "../../data/test1.tre"
+
+func TestTreeFile_Parse_1(t *testing.T) {
+	tree, err := ReadTreeFile(testTreeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Roots) != 4 || len(tree.Roots[1].Children) != 3 {
+		t.FailNow()
+	}
+	if len(tree.Flatten()) != 10 {
+		t.FailNow()
+	}
+	node := tree.FindNode("2.2.1")
+	if node == nil || node.Level() != 2 || node.Description() != "Second second first" {
+		t.FailNow()
+	}
+	path := node.Path()
+	if len(path) != 3 || path[0].Code() != "2" || path[1].Code() != "2.2" {
+		t.FailNow()
+	}
+	if tree.FindNode("5") != nil {
+		t.FailNow()
+	}
+}
+
+func TestTreeFile_Parse_2(t *testing.T) {
+	tree := new(TreeFile)
+	if tree.Parse([]string{"\t1 - Wrong"}) == nil {
+		t.FailNow()
+	}
+	if tree.Parse([]string{"1 - First", "\t\t1.1.1 - Wrong"}) == nil {
+		t.FailNow()
+	}
+}
+
+func TestTreeFile_String_1(t *testing.T) {
+	original, _ := ioutil.ReadFile(testTreeFile)
+	tree, _ := ReadTreeFile(testTreeFile)
+	if strings.TrimSpace(tree.String()) != strings.TrimSpace(string(original)) {
+		t.FailNow()
+	}
+}
+
+func TestTreeFile_AddRoot_1(t *testing.T) {
+	tree := new(TreeFile)
+	tree.AddRoot("1 - First").Add("1.1 - Child").Add("1.2 - Child")
+	tree.AddRoot("2 - Second")
+	if tree.String() != "1 - First\n\t1.1 - Child\n\t1.2 - Child\n2 - Second\n" {
+		t.FailNow()
+	}
+	if tree.FindNode("1.2").Parent().Code() != "1" {
+		t.FailNow()
+	}
+}
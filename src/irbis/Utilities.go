@@ -3,6 +3,10 @@ package irbis
 import (
 	"encoding/binary"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -229,11 +233,85 @@ func SameString(left, right string) bool {
 	return strings.EqualFold(left, right)
 }
 
+// SplitLines разбивает текст на строки, учитывая
+// все распространённые варианты перевода строки.
 func SplitLines(text string) []string {
-	// TODO implement properly
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
 	return strings.Split(text, "\n")
 }
 
+// ReadAnsiFile считывает локальный текстовый файл в кодировке ANSI
+// и разбивает его на строки.
+func ReadAnsiFile(filename string) ([]string, error) {
+	buffer, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return SplitLines(FromAnsi(buffer)), nil
+}
+
+// WriteAnsiFile сохраняет текст в локальный файл в кодировке ANSI.
+func WriteAnsiFile(filename, text string) error {
+	return ioutil.WriteFile(filename, ToAnsi(text), 0644)
+}
+
+// writeFileAtomically сохраняет данные во временный файл рядом
+// с указанным и затем переименовывает его, так что файл
+// никогда не остаётся записанным частично.
+func writeFileAtomically(filename string, data []byte) error {
+	temporary, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temporary.Write(data)
+	if err == nil {
+		err = temporary.Chmod(0644)
+	}
+	if err == nil {
+		err = temporary.Sync()
+	}
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(temporary.Name())
+	}
+	return err
+}
+
+// writeFileSynced Запись файла с принудительным сбросом данных на диск.
+func writeFileSynced(filename string, data []byte) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// backupName Имя резервной копии файла, не совпадающее с именами
+// существующих файлов: filename.bak, filename.bak1, filename.bak2...
+func backupName(filename string) string {
+	result := filename + ".bak"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(result); err != nil {
+			return result
+		}
+		result = filename + ".bak" + strconv.Itoa(i)
+	}
+}
+
 func trimLeft(text string) string {
 	index := 0
 	length := len(text)
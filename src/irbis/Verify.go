@@ -0,0 +1,462 @@
+package irbis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// VerifyOptions Параметры проверки целостности базы данных.
+type VerifyOptions struct {
+	// Postings Проверять ссылки поискового словаря
+	// на существующие записи.
+	Postings bool
+
+	// MaxProblems Максимальное количество сообщений
+	// о неисправностях (0 -- без ограничения).
+	MaxProblems int
+}
+
+// VerifyProblem Неисправность, обнаруженная при проверке.
+type VerifyProblem struct {
+	File    string // Расширение файла: "mst", "xrf" или "ifp".
+	Mfn     int    // MFN записи (0 -- не относится к записи).
+	Offset  int64  // Смещение в файле (-1 -- неизвестно).
+	Message string // Описание неисправности.
+}
+
+func (problem *VerifyProblem) String() string {
+	result := problem.File
+	if problem.Mfn > 0 {
+		result += fmt.Sprintf(" MFN %d", problem.Mfn)
+	}
+	if problem.Offset >= 0 {
+		result += fmt.Sprintf(" @%d", problem.Offset)
+	}
+	return result + ": " + problem.Message
+}
+
+// VerifyResult Итоги проверки целостности базы данных.
+type VerifyResult struct {
+	MaxMfn   int             // Максимальный MFN.
+	Records  int             // Количество записей (включая логически удалённые).
+	Deleted  int             // Количество логически удалённых записей.
+	Absent   int             // Количество отсутствующих (физически удалённых) записей.
+	Versions int             // Количество предыдущих версий записей.
+	Terms    int             // Количество проверенных терминов словаря.
+	Postings int             // Количество проверенных ссылок словаря.
+	Problems []VerifyProblem // Обнаруженные неисправности.
+	Overflow bool            // Сообщений больше, чем VerifyOptions.MaxProblems.
+}
+
+// Ok Неисправностей не обнаружено.
+func (result *VerifyResult) Ok() bool {
+	return len(result.Problems) == 0
+}
+
+func (result *VerifyResult) String() string {
+	return fmt.Sprintf("max MFN: %d, records: %d, deleted: %d, absent: %d, versions: %d, "+
+		"terms: %d, postings: %d, problems: %d", result.MaxMfn, result.Records, result.Deleted,
+		result.Absent, result.Versions, result.Terms, result.Postings, len(result.Problems))
+}
+
+//===================================================================
+
+// mstExtent Участок MST-файла, занятый записью.
+type mstExtent struct {
+	offset int64
+	length int64
+	mfn    int
+}
+
+// verifier Состояние проверки.
+type verifier struct {
+	access  *DirectAccess
+	options VerifyOptions
+	result  *VerifyResult
+	limit   int64 // Конец занятой части MST-файла.
+	extents []mstExtent
+}
+
+func (verifier *verifier) report(file string, mfn int, offset int64, format string, args ...interface{}) {
+	result := verifier.result
+	if verifier.options.MaxProblems > 0 && len(result.Problems) >= verifier.options.MaxProblems {
+		result.Overflow = true
+		return
+	}
+	result.Problems = append(result.Problems,
+		VerifyProblem{File: file, Mfn: mfn, Offset: offset, Message: fmt.Sprintf(format, args...)})
+}
+
+// readMstLeader Чтение лидера MST-записи и проверка его согласованности
+// с размером занятой части файла. Возвращает пустую строку либо
+// описание неисправности.
+func readMstLeader(file io.ReaderAt, offset, limit int64) (leader MstLeader, problem string) {
+	if offset < MstControlRecordSize || offset+MstLeaderSize > limit {
+		return leader, fmt.Sprintf("offset %d is out of range", offset)
+	}
+	err := binary.Read(io.NewSectionReader(file, offset, MstLeaderSize), binary.BigEndian, &leader)
+	if err != nil {
+		return leader, "can't read leader: " + err.Error()
+	}
+	switch {
+	case leader.Mfn <= 0:
+		return leader, fmt.Sprintf("bad MFN %d in leader", leader.Mfn)
+	case leader.Nvf < 0 || int64(leader.Nvf)*12 > limit:
+		return leader, fmt.Sprintf("bad number of fields %d", leader.Nvf)
+	case leader.Base != MstLeaderSize+leader.Nvf*12:
+		return leader, fmt.Sprintf("bad base %d for %d fields", leader.Base, leader.Nvf)
+	case leader.Length < leader.Base:
+		return leader, fmt.Sprintf("length %d is less than base %d", leader.Length, leader.Base)
+	case offset+int64(leader.Length) > limit:
+		return leader, fmt.Sprintf("length %d exceeds the file", leader.Length)
+	}
+	return leader, ""
+}
+
+// readMstDictionary Чтение словаря MST-записи и проверка его
+// согласованности с лидером. Возвращает пустую строку либо
+// описание неисправности.
+func readMstDictionary(file io.ReaderAt, offset int64, leader *MstLeader) string {
+	dictionary := make([]MstDictionaryEntry, leader.Nvf)
+	section := io.NewSectionReader(file, offset+MstLeaderSize, int64(leader.Nvf)*12)
+	if err := binary.Read(section, binary.BigEndian, dictionary); err != nil {
+		return "can't read dictionary: " + err.Error()
+	}
+
+	size := leader.Length - leader.Base
+	for i, entry := range dictionary {
+		if entry.Tag <= 0 || entry.Position < 0 || entry.Length < 0 || entry.Position+entry.Length > size {
+			return fmt.Sprintf("bad dictionary entry %d: tag %d, position %d, length %d",
+				i+1, entry.Tag, entry.Position, entry.Length)
+		}
+	}
+	return ""
+}
+
+// checkDictionary Проверка словаря MST-записи.
+func (verifier *verifier) checkDictionary(offset int64, leader *MstLeader) bool {
+	if problem := readMstDictionary(verifier.access.mst.file, offset, leader); len(problem) != 0 {
+		verifier.report("mst", int(leader.Mfn), offset, "%s", problem)
+		return false
+	}
+	return true
+}
+
+// checkRecord Проверка записи и цепочки её предыдущих версий.
+func (verifier *verifier) checkRecord(mfn int, xrf XrfRecord) {
+	file := verifier.access.mst.file
+	offset := xrf.Offset()
+	leader, problem := readMstLeader(file, offset, verifier.limit)
+	if len(problem) != 0 {
+		verifier.report("xrf", mfn, offset, "%s", problem)
+		return
+	}
+	if int(leader.Mfn) != mfn {
+		verifier.report("xrf", mfn, offset, "points to record with MFN %d", leader.Mfn)
+		return
+	}
+	if !verifier.checkDictionary(offset, &leader) {
+		return
+	}
+	if (xrf.Status^leader.Status)&LOGICALLY_DELETED != 0 {
+		verifier.report("xrf", mfn, offset, "deletion status %d differs from MST status %d",
+			xrf.Status, leader.Status)
+	}
+
+	verifier.result.Records++
+	if leader.Status&LOGICALLY_DELETED != 0 {
+		verifier.result.Deleted++
+	}
+	verifier.extents = append(verifier.extents, mstExtent{offset, int64(leader.Length), mfn})
+
+	// Цепочка версий: MFN тот же, версии убывают
+	visited := map[int64]bool{offset: true}
+	version := leader.Version
+	for previous := leader.PreviousOffset(); previous > 0; {
+		if visited[previous] {
+			verifier.report("mst", mfn, previous, "version chain loops")
+			return
+		}
+		visited[previous] = true
+
+		leader, problem = readMstLeader(file, previous, verifier.limit)
+		if len(problem) == 0 && int(leader.Mfn) != mfn {
+			problem = fmt.Sprintf("previous version belongs to MFN %d", leader.Mfn)
+		}
+		if len(problem) == 0 && leader.Version >= version {
+			problem = fmt.Sprintf("previous version %d is not less than %d", leader.Version, version)
+		}
+		if len(problem) != 0 {
+			verifier.report("mst", mfn, previous, "%s", problem)
+			return
+		}
+		if !verifier.checkDictionary(previous, &leader) {
+			return
+		}
+
+		verifier.result.Versions++
+		verifier.extents = append(verifier.extents, mstExtent{previous, int64(leader.Length), mfn})
+		version = leader.Version
+		previous = leader.PreviousOffset()
+	}
+}
+
+// checkExtents Поиск перекрывающихся и потерянных записей
+// (не доступных ни по XRF, ни по цепочкам версий).
+func (verifier *verifier) checkExtents() {
+	extents := verifier.extents
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].offset < extents[j].offset
+	})
+	for i := 1; i < len(extents); i++ {
+		previous := extents[i-1]
+		if previous.offset+previous.length > extents[i].offset {
+			verifier.report("mst", extents[i].mfn, extents[i].offset,
+				"overlaps record %d at offset %d", previous.mfn, previous.offset)
+		}
+	}
+
+	referenced := make(map[int64]bool, len(extents))
+	for _, extent := range extents {
+		referenced[extent.offset] = true
+	}
+	err := scanMst(verifier.access.mst.file, verifier.limit, func(offset int64, leader *MstLeader) bool {
+		if !referenced[offset] {
+			verifier.report("mst", int(leader.Mfn), offset, "orphaned record (version %d)", leader.Version)
+		}
+		return true
+	})
+	if err != nil {
+		verifier.report("mst", 0, -1, "linear scan failed: %v", err)
+	}
+}
+
+// checkPostings Проверка ссылок словаря на существующие записи.
+func (verifier *verifier) checkPostings(exists func(mfn int) bool) {
+	ifp := verifier.access.ifp
+	leaf, err := ifp.findLeaf("")
+	for visited := 0; err == nil; visited++ {
+		if visited > int(ifp.Control.LeafBlockCount) {
+			verifier.report("ifp", 0, -1, "leaf chain loops")
+			return
+		}
+		for i, key := range leaf.Keys {
+			verifier.result.Terms++
+			offset := leaf.Items[i].Offset()
+			links, err := ifp.readLinks(offset)
+			if err != nil {
+				verifier.report("ifp", 0, offset, "term %q: %v", key, err)
+				continue
+			}
+			for _, link := range links {
+				verifier.result.Postings++
+				if !exists(int(link.Mfn)) {
+					verifier.report("ifp", int(link.Mfn), offset,
+						"term %q refers to missing record", key)
+				}
+			}
+		}
+		if leaf.Leader.Next <= 0 {
+			return
+		}
+		leaf, err = ifp.ReadNode(true, leaf.Leader.Next)
+	}
+	verifier.report("ifp", 0, -1, "can't read dictionary: %v", err)
+}
+
+// Verify Проверка целостности файлов базы данных: ссылок XRF,
+// лидеров и словарей MST-записей, цепочек версий, перекрытия
+// и потерянных записей, а также (по желанию) ссылок словаря.
+// Ошибка выдаётся, только если проверку невозможно выполнить.
+func (access *DirectAccess) Verify(options *VerifyOptions) (*VerifyResult, error) {
+	verifier := &verifier{access: access, result: new(VerifyResult)}
+	if options != nil {
+		verifier.options = *options
+	}
+	result := verifier.result
+
+	info, err := access.mst.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	control := access.mst.Control
+	verifier.limit = control.NextPosition()
+	if verifier.limit < MstControlRecordSize || verifier.limit > info.Size() {
+		verifier.report("mst", 0, 0, "free space offset %d is out of file size %d",
+			verifier.limit, info.Size())
+		verifier.limit = info.Size()
+	}
+	if control.NextMfn <= 0 {
+		verifier.report("mst", 0, 0, "bad next MFN %d", control.NextMfn)
+		return result, nil
+	}
+
+	result.MaxMfn = access.GetMaxMfn()
+	info, err = access.xrf.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(result.MaxMfn)*XrfRecordSize {
+		verifier.report("xrf", 0, info.Size(), "file is too short for %d records", result.MaxMfn)
+	}
+
+	present := make([]bool, result.MaxMfn+1)
+	for mfn := 1; mfn <= result.MaxMfn; mfn++ {
+		xrf, err := access.xrf.ReadRecord(mfn)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			result.Absent += result.MaxMfn - mfn + 1
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if xrf.Offset() == 0 || xrf.Status&(PHYSICALLY_DELETED|ABSENT) != 0 {
+			result.Absent++
+			continue
+		}
+
+		records := result.Records
+		verifier.checkRecord(mfn, xrf)
+		present[mfn] = result.Records != records
+	}
+
+	verifier.checkExtents()
+	if verifier.options.Postings {
+		verifier.checkPostings(func(mfn int) bool {
+			return mfn > 0 && mfn <= result.MaxMfn && present[mfn]
+		})
+	}
+
+	return result, nil
+}
+
+//===================================================================
+
+// scanMst Последовательный просмотр записей MST-файла от управляющей
+// записи до конца занятой части. Просмотр прекращается, если функция
+// возвращает false. Ошибка выдаётся, если встретился испорченный лидер.
+func scanMst(file io.ReaderAt, limit int64, handler func(offset int64, leader *MstLeader) bool) error {
+	offset, problem := scanMstFrom(file, MstControlRecordSize, limit, handler)
+	if len(problem) != 0 {
+		return fmt.Errorf("offset %d: %s", offset, problem)
+	}
+	return nil
+}
+
+// scanMstFrom Последовательный просмотр записей MST-файла с указанного
+// смещения до первого испорченного лидера. Возвращает смещение этого
+// лидера и описание неисправности (пустая строка -- просмотр завершён).
+func scanMstFrom(file io.ReaderAt, offset, limit int64,
+	handler func(offset int64, leader *MstLeader) bool) (int64, string) {
+	for offset < limit {
+		leader, problem := readMstLeader(file, offset, limit)
+		if len(problem) != 0 {
+			return offset, problem
+		}
+		if !handler(offset, &leader) {
+			break
+		}
+		offset += int64(leader.Length)
+	}
+	return offset, ""
+}
+
+// findMstLeader Поиск ближайшей за указанным смещением записи
+// с корректными лидером и словарём. Выдаёт limit, если такой
+// записи нет.
+func findMstLeader(file io.ReaderAt, offset, limit int64) int64 {
+	for offset++; offset+MstLeaderSize <= limit; offset++ {
+		leader, problem := readMstLeader(file, offset, limit)
+		if len(problem) == 0 && len(readMstDictionary(file, offset, &leader)) == 0 {
+			return offset
+		}
+	}
+	return limit
+}
+
+// RebuildXrf Восстановление XRF-файла по результатам последовательного
+// просмотра MST-файла (путь к файлам базы задаётся без расширения).
+// Для каждого MFN выбирается версия с наибольшим номером. База данных
+// не должна быть открыта. Прежний XRF-файл сохраняется с расширением
+// ".xrf.bak" (если такой файл уже есть -- ".xrf.bak1" и т. д.).
+//
+// Испорченные участки MST-файла пропускаются: просмотр продолжается
+// с ближайшей записи с корректными лидером и словарём. Пропущенные
+// участки выдаются в damaged. Возвращает также количество найденных
+// записей.
+func RebuildXrf(filename string) (count int, damaged []VerifyProblem, err error) {
+	mst, err := os.Open(filename + ".mst")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = mst.Close() }()
+
+	info, err := mst.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	var control MstControlRecord
+	if err = binary.Read(mst, binary.BigEndian, &control); err != nil {
+		return 0, nil, err
+	}
+	limit := control.NextPosition()
+	if limit < MstControlRecordSize || limit > info.Size() {
+		limit = info.Size()
+	}
+
+	type latest struct {
+		offset  int64
+		version int32
+		status  int32
+	}
+	found := make(map[int]latest)
+	maxMfn := int(control.NextMfn) - 1
+	handler := func(offset int64, leader *MstLeader) bool {
+		mfn := int(leader.Mfn)
+		if current, ok := found[mfn]; !ok || leader.Version >= current.version {
+			found[mfn] = latest{offset, leader.Version, leader.Status}
+		}
+		if mfn > maxMfn {
+			maxMfn = mfn
+		}
+		return true
+	}
+	for offset := int64(MstControlRecordSize); offset < limit; {
+		bad, problem := scanMstFrom(mst, offset, limit, handler)
+		if len(problem) == 0 {
+			break
+		}
+		offset = findMstLeader(mst, bad, limit)
+		damaged = append(damaged, VerifyProblem{File: "mst", Offset: bad,
+			Message: fmt.Sprintf("%s, %d bytes skipped", problem, offset-bad)})
+	}
+
+	buffer := bytes.Buffer{}
+	for mfn := 1; mfn <= maxMfn; mfn++ {
+		record := XrfRecord{Status: ABSENT}
+		if current, ok := found[mfn]; ok {
+			record = NewXrfRecord(current.offset, int(current.status&(LOGICALLY_DELETED|NON_ACTUALIZED)))
+		}
+		_ = binary.Write(&buffer, binary.BigEndian, &record)
+	}
+
+	xrfName := filename + ".xrf"
+	if _, err = os.Stat(xrfName); err == nil {
+		if err = os.Rename(xrfName, backupName(xrfName)); err != nil {
+			return 0, damaged, err
+		}
+	}
+	if err = writeFileAtomically(xrfName, buffer.Bytes()); err != nil {
+		return 0, damaged, err
+	}
+	if int(control.NextMfn) <= maxMfn {
+		return len(found), damaged, errors.New("next MFN in the master file control record is too small")
+	}
+
+	return len(found), damaged, nil
+}
@@ -0,0 +1,162 @@
+package irbis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDirectAccess_Verify_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := restoreFakeDatabase(t, dir)
+
+	verify := func() *VerifyResult {
+		access, err := OpenDatabase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer access.Close()
+		result, err := access.Verify(&VerifyOptions{Postings: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := verify()
+	if !result.Ok() || result.MaxMfn != 4 || result.Records != 3 || result.Deleted != 1 ||
+		result.Absent != 1 || result.Versions != 2 {
+		t.Fatal(result, result.Problems)
+	}
+
+	// Ссылка на запись 4 указывает на запись 1,
+	// сама запись 4 становится потерянной
+	xrf, err := os.OpenFile(filename+".xrf", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, XrfRecordSize)
+	if _, err = xrf.ReadAt(buffer, GetXrfOffset(1)); err == nil {
+		_, err = xrf.WriteAt(buffer, GetXrfOffset(4))
+	}
+	_ = xrf.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result = verify()
+	if result.Ok() || len(result.Problems) != 2 ||
+		!strings.Contains(result.Problems[0].String(), "xrf MFN 4") ||
+		!strings.Contains(result.Problems[1].Message, "orphaned") {
+		t.Fatal(result.Problems)
+	}
+
+	count, damaged, err := RebuildXrf(filename)
+	if err != nil || count != 3 || len(damaged) != 0 {
+		t.Fatal(count, damaged, err)
+	}
+	result = verify()
+	if !result.Ok() || result.Records != 3 || result.Absent != 1 {
+		t.Fatal(result, result.Problems)
+	}
+	if _, err = os.Stat(filename + ".xrf.bak"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirectAccess_Verify_2(t *testing.T) {
+	var archive bytes.Buffer
+	_, err := newFakeConnection(newFakeDatabase().handler).BackupDatabase("IBIS", &archive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ibis")
+	if _, err = RestoreDirect(filename, bytes.NewReader(archive.Bytes()), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Портим количество полей в лидере первой записи
+	mst, err := os.OpenFile(filename+".mst", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 4)
+	binary.BigEndian.PutUint32(buffer, 1000)
+	_, err = mst.WriteAt(buffer, MstControlRecordSize+20)
+	_ = mst.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := OpenDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+	result, err := access.Verify(&VerifyOptions{MaxProblems: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Problems) != 1 || !result.Overflow || result.Problems[0].Mfn != 1 {
+		t.Fatal(result.Problems)
+	}
+}
+
+func TestRebuildXrf_1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irbis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := restoreFakeDatabase(t, dir)
+
+	mst, err := os.OpenFile(filename+".mst", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := mst.Stat()
+	var offsets []int64
+	err = scanMst(mst, info.Size(), func(offset int64, leader *MstLeader) bool {
+		offsets = append(offsets, offset)
+		return true
+	})
+	if err == nil {
+		// Портим MFN в лидере второй по порядку записи MST-файла:
+		// без пересинхронизации следующие за ней записи теряются
+		_, err = mst.WriteAt([]byte{0, 0, 0, 0}, offsets[1])
+	}
+	_ = mst.Close()
+	if err != nil || len(offsets) < 3 {
+		t.Fatal(offsets, err)
+	}
+
+	// Прежняя резервная копия XRF не затирается
+	if err = ioutil.WriteFile(filename+".xrf.bak", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	count, damaged, err := RebuildXrf(filename)
+	if err != nil || count != 3 || len(damaged) != 1 || damaged[0].Offset != offsets[1] ||
+		!strings.Contains(damaged[0].Message, strconv.FormatInt(offsets[2]-offsets[1], 10)+" bytes skipped") {
+		t.Fatal(count, damaged, err)
+	}
+	if data, _ := ioutil.ReadFile(filename + ".xrf.bak"); string(data) != "old" {
+		t.Fatal(data)
+	}
+	if _, err = os.Stat(filename + ".xrf.bak1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,5 +1,11 @@
 package irbis
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
 // WsLine - одна строчка ввода в рабочем листе.
 type WsLine struct {
 	Tag                string // Числовая метка поля.
@@ -12,8 +18,14 @@ type WsLine struct {
 	Hint               string // Подсказка - текст помощи (инструкции), сопровождающий ввод в поле
 	DefaultValue       string // Значение по умолчанию при создании новой записи
 	Reserved           string // Используется при определенных режимах ввода
+
+	Mandatory    bool    // Поле обязательное (в файле не хранится, см. WsFile.SetMandatory)
+	SubWorksheet *WsFile // Подрабочий лист (WSS), если он загружен
 }
 
+// WsLineSize Количество строк, занимаемых одной строчкой ввода в файле.
+const WsLineSize = 10
+
 // Parse разбирает элемент ввода.
 func (ws *WsLine) Parse(lines []string) {
 	ws.Tag = lines[0]
@@ -27,3 +39,437 @@ func (ws *WsLine) Parse(lines []string) {
 	ws.DefaultValue = lines[8]
 	ws.Reserved = lines[9]
 }
+
+// Encode кодирует элемент ввода в строки файла.
+func (ws *WsLine) Encode() []string {
+	return []string{
+		ws.Tag,
+		ws.Title,
+		ws.Repeatable,
+		ws.Help,
+		ws.EditMode,
+		ws.InputInfo,
+		ws.FormalVerification,
+		ws.Hint,
+		ws.DefaultValue,
+		ws.Reserved,
+	}
+}
+
+// IsRepeatable выясняет, является ли поле (подполе) повторяющимся.
+func (ws *WsLine) IsRepeatable() bool {
+	return strings.TrimSpace(ws.Repeatable) == "1"
+}
+
+// referencedFile выдаёт имя файла с указанным расширением,
+// на который ссылается элемент ввода, либо пустую строку.
+func (ws *WsLine) referencedFile(extension string) string {
+	name := strings.TrimSpace(ws.InputInfo)
+	if strings.HasSuffix(strings.ToLower(name), extension) {
+		return name
+	}
+	return ""
+}
+
+// MenuName выдаёт имя справочника (MNU-файла), используемого при вводе,
+// либо пустую строку.
+func (ws *WsLine) MenuName() string {
+	return ws.referencedFile(".mnu")
+}
+
+// SubWorksheetName выдаёт имя подрабочего листа (WSS-файла),
+// либо пустую строку.
+func (ws *WsLine) SubWorksheetName() string {
+	return ws.referencedFile(".wss")
+}
+
+func (ws *WsLine) String() string {
+	return ws.Tag + " " + ws.Title
+}
+
+// WsPage Страница (вкладка) рабочего листа.
+type WsPage struct {
+	Name  string   // Наименование страницы.
+	Lines []WsLine // Строчки ввода.
+}
+
+// WsFile Рабочий лист (WS-файл) либо подрабочий лист (WSS-файл).
+// У подрабочего листа ровно одна страница без названия,
+// а метки строчек ввода являются кодами подполей.
+type WsFile struct {
+	Name  string   // Имя файла.
+	Pages []WsPage // Страницы.
+}
+
+// wsReader Вспомогательная структура для последовательного
+// чтения строк WS-файла.
+type wsReader struct {
+	lines    []string
+	position int
+}
+
+func (reader *wsReader) eof() bool {
+	return reader.position >= len(reader.lines)
+}
+
+func (reader *wsReader) read() string {
+	if reader.eof() {
+		return ""
+	}
+	result := reader.lines[reader.position]
+	reader.position++
+	return result
+}
+
+func (reader *wsReader) readInt() (int, error) {
+	if reader.eof() {
+		return 0, errors.New("unexpected end of worksheet")
+	}
+	line := strings.TrimSpace(reader.read())
+	result, err := strconv.Atoi(line)
+	if err != nil || result < 0 {
+		return 0, errors.New("bad number in worksheet: " + line)
+	}
+	return result, nil
+}
+
+func (reader *wsReader) readLine() (result WsLine, err error) {
+	if reader.eof() {
+		err = errors.New("unexpected end of worksheet")
+		return
+	}
+	chunk := make([]string, WsLineSize)
+	for i := range chunk {
+		chunk[i] = reader.read()
+	}
+	result.Parse(chunk)
+	return
+}
+
+// Parse Разбор WS-файла: количество страниц, их названия,
+// количество строчек ввода на каждой странице, затем сами строчки.
+func (ws *WsFile) Parse(lines []string) error {
+	reader := &wsReader{lines: lines}
+	pageCount, err := reader.readInt()
+	if err != nil {
+		return err
+	}
+
+	ws.Pages = make([]WsPage, pageCount)
+	for i := range ws.Pages {
+		ws.Pages[i].Name = reader.read()
+	}
+
+	lengths := make([]int, pageCount)
+	for i := range lengths {
+		if lengths[i], err = reader.readInt(); err != nil {
+			return err
+		}
+	}
+
+	for i := range ws.Pages {
+		page := &ws.Pages[i]
+		page.Lines = make([]WsLine, lengths[i])
+		for j := range page.Lines {
+			if page.Lines[j], err = reader.readLine(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseWss Разбор WSS-файла (подрабочего листа): количество
+// строчек ввода, затем сами строчки.
+func (ws *WsFile) ParseWss(lines []string) error {
+	reader := &wsReader{lines: lines}
+	count, err := reader.readInt()
+	if err != nil {
+		return err
+	}
+
+	page := WsPage{Lines: make([]WsLine, count)}
+	for i := range page.Lines {
+		if page.Lines[i], err = reader.readLine(); err != nil {
+			return err
+		}
+	}
+	ws.Pages = []WsPage{page}
+
+	return nil
+}
+
+// IsSubWorksheet Является ли рабочий лист подрабочим (WSS)?
+func (ws *WsFile) IsSubWorksheet() bool {
+	return strings.HasSuffix(strings.ToLower(ws.Name), ".wss")
+}
+
+// AllLines Выдаёт строчки ввода со всех страниц.
+func (ws *WsFile) AllLines() (result []*WsLine) {
+	for i := range ws.Pages {
+		page := &ws.Pages[i]
+		for j := range page.Lines {
+			result = append(result, &page.Lines[j])
+		}
+	}
+	return
+}
+
+// FindLine Поиск строчки ввода с указанной меткой (кодом).
+// Если строчка не найдена, возвращается nil.
+func (ws *WsFile) FindLine(tag string) *WsLine {
+	for _, line := range ws.AllLines() {
+		if SameString(strings.TrimSpace(line.Tag), tag) {
+			return line
+		}
+	}
+	return nil
+}
+
+// ResolveSubWorksheets Загрузка подрабочих листов, на которые ссылаются
+// строчки ввода. Функция provider выдаёт строки файла по его имени
+// (например, Connection.ReadTextLines с подходящей спецификацией).
+// Ненайденные подрабочие листы пропускаются, при этом возвращается
+// первая из возникших ошибок.
+func (ws *WsFile) ResolveSubWorksheets(provider func(name string) []string) (err error) {
+	for _, line := range ws.AllLines() {
+		name := line.SubWorksheetName()
+		if len(name) == 0 || line.SubWorksheet != nil {
+			continue
+		}
+
+		lines := provider(name)
+		if len(lines) == 0 {
+			if err == nil {
+				err = errors.New("sub-worksheet not found: " + name)
+			}
+			continue
+		}
+
+		sub := &WsFile{Name: name}
+		if problem := sub.ParseWss(lines); problem != nil {
+			if err == nil {
+				err = errors.New(name + ": " + problem.Error())
+			}
+			continue
+		}
+		line.SubWorksheet = sub
+	}
+
+	return
+}
+
+// Encode Кодирование рабочего листа в строки файла.
+func (ws *WsFile) Encode() (result []string) {
+	if ws.IsSubWorksheet() {
+		lines := ws.AllLines()
+		result = append(result, strconv.Itoa(len(lines)))
+		for _, line := range lines {
+			result = append(result, line.Encode()...)
+		}
+		return
+	}
+
+	result = append(result, strconv.Itoa(len(ws.Pages)))
+	for i := range ws.Pages {
+		result = append(result, ws.Pages[i].Name)
+	}
+	for i := range ws.Pages {
+		result = append(result, strconv.Itoa(len(ws.Pages[i].Lines)))
+	}
+	for i := range ws.Pages {
+		for j := range ws.Pages[i].Lines {
+			result = append(result, ws.Pages[i].Lines[j].Encode()...)
+		}
+	}
+
+	return
+}
+
+// Save Сохранение рабочего листа в локальный файл.
+func (ws *WsFile) Save(filename string) error {
+	return WriteAnsiFile(filename, ws.String())
+}
+
+func (ws *WsFile) String() string {
+	result := strings.Builder{}
+	for _, line := range ws.Encode() {
+		result.WriteString(line)
+		result.WriteString("\n")
+	}
+	return result.String()
+}
+
+// ReadWsFile Загрузка рабочего листа (WS или WSS) с локального диска.
+// Подрабочие листы ищутся в той же директории. Если какой-либо из них
+// не удалось загрузить, возвращается и рабочий лист, и ошибка.
+func ReadWsFile(filename string) (*WsFile, error) {
+	lines, err := ReadAnsiFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WsFile{Name: filename}
+	if result.IsSubWorksheet() {
+		err = result.ParseWss(lines)
+	} else {
+		err = result.Parse(lines)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	directory := ""
+	if index := strings.LastIndexAny(filename, "/\\"); index >= 0 {
+		directory = filename[:index+1]
+	}
+	err = result.ResolveSubWorksheets(func(name string) []string {
+		lines, _ := ReadAnsiFile(directory + name)
+		return lines
+	})
+
+	return result, err
+}
+
+// SetMandatory Пометка полей и подполей как обязательных для Validate
+// (в WS-файле обязательность не хранится). Элемент списка -- метка
+// поля ("200") либо метка поля и код подполя из подрабочего листа
+// ("700^a"). Ненайденные элементы перечисляются в ошибке, остальные
+// помечаются.
+func (ws *WsFile) SetMandatory(items ...string) error {
+	var missing []string
+	for _, item := range items {
+		parts := strings.SplitN(strings.TrimSpace(item), "^", 2)
+		line := ws.FindLine(parts[0])
+		if line != nil && len(parts) == 2 {
+			if line.SubWorksheet == nil {
+				line = nil
+			} else {
+				line = line.SubWorksheet.FindLine(parts[1])
+			}
+		}
+		if line == nil {
+			missing = append(missing, item)
+			continue
+		}
+		line.Mandatory = true
+	}
+
+	if len(missing) != 0 {
+		return errors.New("not found in worksheet: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// WsProblem Нарушение, выявленное при проверке записи по рабочему листу.
+type WsProblem struct {
+	Tag        int    // Метка поля.
+	Occurrence int    // Номер повторения поля (с 1, 0 означает поле в целом).
+	Code       rune   // Код подполя (0, если проблема относится к полю).
+	Message    string // Описание проблемы.
+}
+
+func (problem *WsProblem) String() string {
+	result := strconv.Itoa(problem.Tag)
+	if problem.Occurrence != 0 {
+		result += "/" + strconv.Itoa(problem.Occurrence)
+	}
+	if problem.Code != 0 {
+		result += "^" + string(problem.Code)
+	}
+	return result + ": " + problem.Message
+}
+
+// Validate Проверка записи по рабочему листу: повторяемость полей
+// и подполей, наличие обязательных элементов, соответствие значений
+// справочникам. Функция menus (может быть nil) выдаёт справочник
+// по имени MNU-файла.
+func (ws *WsFile) Validate(record *MarcRecord, menus func(name string) *MenuFile) (result []WsProblem) {
+	cache := make(map[string]*MenuFile)
+	getMenu := func(name string) *MenuFile {
+		if menus == nil || len(name) == 0 {
+			return nil
+		}
+		key := strings.ToLower(name)
+		menu, ok := cache[key]
+		if !ok {
+			menu = menus(name)
+			cache[key] = menu
+		}
+		return menu
+	}
+
+	for _, line := range ws.AllLines() {
+		tag, err := strconv.Atoi(strings.TrimSpace(line.Tag))
+		if err != nil {
+			continue
+		}
+
+		fields := record.GetFields(tag)
+		if len(fields) == 0 && line.Mandatory {
+			result = append(result, WsProblem{Tag: tag,
+				Message: "mandatory field is missing: " + line.Title})
+		}
+		if len(fields) > 1 && !line.IsRepeatable() {
+			result = append(result, WsProblem{Tag: tag,
+				Message: "field is not repeatable: " + line.Title})
+		}
+
+		for index, field := range fields {
+			occurrence := index + 1
+			menu := getMenu(line.MenuName())
+			if menu != nil && len(field.Value) != 0 && menu.GetEntry(field.Value) == nil {
+				result = append(result, WsProblem{Tag: tag, Occurrence: occurrence,
+					Message: "value not found in " + line.MenuName() + ": " + field.Value})
+			}
+
+			if line.SubWorksheet != nil {
+				result = append(result, line.SubWorksheet.validateField(tag, occurrence, field, getMenu)...)
+			}
+		}
+	}
+
+	return
+}
+
+// validateField Проверка подполей одного повторения поля
+// по подрабочему листу.
+func (ws *WsFile) validateField(tag, occurrence int, field *RecordField,
+	getMenu func(name string) *MenuFile) (result []WsProblem) {
+	for _, line := range ws.AllLines() {
+		code := []rune(strings.TrimSpace(line.Tag))
+		if len(code) != 1 {
+			continue
+		}
+
+		var found []*SubField
+		for _, subfield := range field.Subfields {
+			if SameRune(subfield.Code, code[0]) {
+				found = append(found, subfield)
+			}
+		}
+
+		if len(found) == 0 && line.Mandatory {
+			result = append(result, WsProblem{Tag: tag, Occurrence: occurrence, Code: code[0],
+				Message: "mandatory subfield is missing: " + line.Title})
+		}
+		if len(found) > 1 && !line.IsRepeatable() {
+			result = append(result, WsProblem{Tag: tag, Occurrence: occurrence, Code: code[0],
+				Message: "subfield is not repeatable: " + line.Title})
+		}
+
+		menu := getMenu(line.MenuName())
+		if menu == nil {
+			continue
+		}
+		for _, subfield := range found {
+			if len(subfield.Value) != 0 && menu.GetEntry(subfield.Value) == nil {
+				result = append(result, WsProblem{Tag: tag, Occurrence: occurrence, Code: code[0],
+					Message: "value not found in " + line.MenuName() + ": " + subfield.Value})
+			}
+		}
+	}
+
+	return
+}
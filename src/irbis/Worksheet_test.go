@@ -0,0 +1,139 @@
+package irbis
+
+import (
+	"testing"
+)
+
+const testWorksheet = "../../data/irbis64/datai/ibis/ibis.ws"
+
+func TestWsFile_Parse_1(t *testing.T) {
+	lines, err := ReadAnsiFile(testWorksheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := new(WsFile)
+	if err = ws.Parse(lines); err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.Pages) != 3 || ws.Pages[0].Name != "Основное БО" {
+		t.FailNow()
+	}
+	if len(ws.AllLines()) != 25 {
+		t.FailNow()
+	}
+	line := ws.FindLine("920")
+	if line == nil || line.MenuName() != "920.mnu" || line.DefaultValue != "IBIS" {
+		t.FailNow()
+	}
+	if ws.FindLine("700").SubWorksheetName() != "701.wss" {
+		t.FailNow()
+	}
+}
+
+func TestWsFile_Encode_1(t *testing.T) {
+	lines, _ := ReadAnsiFile(testWorksheet)
+	ws := new(WsFile)
+	_ = ws.Parse(lines)
+	encoded := ws.Encode()
+	for i := range encoded {
+		if encoded[i] != lines[i] {
+			t.Fatalf("line %d: %q != %q", i, encoded[i], lines[i])
+		}
+	}
+}
+
+func TestWsFile_ParseWss_1(t *testing.T) {
+	lines := []string{"2",
+		"a", "Фамилия", "0", "", "0", "", "", "", "", "",
+		"g", "Роль", "1", "", "1", "role.mnu", "", "", "", ""}
+	ws := &WsFile{Name: "701.wss"}
+	if err := ws.ParseWss(lines); err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.AllLines()) != 2 || !ws.FindLine("g").IsRepeatable() {
+		t.FailNow()
+	}
+	if len(ws.Encode()) != len(lines) {
+		t.FailNow()
+	}
+}
+
+func TestWsFile_ParseWss_2(t *testing.T) {
+	ws := new(WsFile)
+	if ws.ParseWss([]string{"2", "a"}) == nil {
+		t.FailNow()
+	}
+	if ws.Parse([]string{"x"}) == nil {
+		t.FailNow()
+	}
+}
+
+func TestWsFile_Validate_1(t *testing.T) {
+	sub := &WsFile{Name: "701.wss", Pages: []WsPage{{Lines: []WsLine{
+		{Tag: "a", Repeatable: "0", Mandatory: true},
+		{Tag: "4", Repeatable: "1", InputInfo: "role.mnu"},
+	}}}}
+	ws := &WsFile{Pages: []WsPage{{Lines: []WsLine{
+		{Tag: "700", Repeatable: "0", SubWorksheet: sub},
+		{Tag: "200", Repeatable: "0", Mandatory: true},
+		{Tag: "920", Repeatable: "0", InputInfo: "920.mnu"},
+	}}}}
+	menus := func(name string) *MenuFile {
+		menu := new(MenuFile)
+		if name == "920.mnu" {
+			menu.Add("PAZK", "Книга")
+		} else {
+			menu.Add("070", "Автор")
+		}
+		return menu
+	}
+
+	record := NewMarcRecord()
+	record.Add(700, "").Add('4', "070").Add('a', "Пушкин")
+	record.Add(920, "PAZK")
+	record.Add(200, "").Add('a', "Title")
+	if problems := ws.Validate(record, menus); len(problems) != 0 {
+		t.Fatal(problems)
+	}
+
+	record = NewMarcRecord()
+	record.Add(700, "").Add('4', "999").Add('b', "A.")
+	record.Add(700, "").Add('a', "Лермонтов")
+	record.Add(920, "XXX")
+	problems := ws.Validate(record, menus)
+	// 700 повторяется, 200 отсутствует, 920 не из меню,
+	// в первом 700 нет ^a и ^4 не из меню
+	if len(problems) != 5 {
+		t.Fatal(problems)
+	}
+}
+
+func TestWsFile_SetMandatory_1(t *testing.T) {
+	// Подрабочие листы рядом с тестовым рабочим листом отсутствуют
+	ws, _ := ReadWsFile(testWorksheet)
+	if ws == nil {
+		t.FailNow()
+	}
+	ws.FindLine("700").SubWorksheet = &WsFile{Name: "701.wss", Pages: []WsPage{{Lines: []WsLine{
+		{Tag: "a", Repeatable: "0"},
+		{Tag: "b", Repeatable: "0"},
+	}}}}
+	if err := ws.SetMandatory("200", "700^a", "920", "999^x", "111"); err == nil {
+		t.FailNow()
+	}
+
+	record := NewMarcRecord()
+	record.Add(200, "").Add('a', "Title")
+	record.Add(920, "PAZK")
+	if problems := ws.Validate(record, nil); len(problems) != 0 {
+		t.Fatal(problems)
+	}
+
+	record = NewMarcRecord()
+	record.Add(700, "").Add('b', "A.")
+	problems := ws.Validate(record, nil)
+	// Нет 200, 920 и ^a в поле 700
+	if len(problems) != 3 || problems[0].Tag != 700 || problems[0].Code != 'a' {
+		t.Fatal(problems)
+	}
+}
@@ -1,8 +1,9 @@
 package irbis
 
 import (
+	"bytes"
 	"encoding/binary"
-	"io"
+	"errors"
 	"os"
 )
 
@@ -17,7 +18,8 @@ type XrfRecord struct {
 
 // XrfFile - обёртка над XRF-файлом.
 type XrfFile struct {
-	file *os.File
+	file   *os.File
+	mapped []byte
 }
 
 // OpenXrfFile открывает файл на чтение.
@@ -36,23 +38,82 @@ func OpenXrfFile(filename string) (result *XrfFile, err error) {
 
 // Close закрывает файл.
 func (xrf *XrfFile) Close() {
+	xrf.unmapMemory()
 	_ = xrf.file.Close()
 }
 
+// mapMemory Отображение файла в память.
+func (xrf *XrfFile) mapMemory() error {
+	if xrf.mapped != nil {
+		return nil
+	}
+	info, err := xrf.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	xrf.mapped, err = mapFile(xrf.file, info.Size())
+	return err
+}
+
+// unmapMemory Отмена отображения файла в память.
+func (xrf *XrfFile) unmapMemory() {
+	if xrf.mapped != nil {
+		_ = unmapFile(xrf.mapped)
+		xrf.mapped = nil
+	}
+}
+
 func GetXrfOffset(mfn int) int64 {
 	return int64(mfn-1) * XrfRecordSize
 }
 
+// ReadRecord читает ссылку на запись с указанным MFN. Метод можно
+// вызывать одновременно из нескольких горутин. Если ссылки нет
+// в файле, возвращается io.EOF.
 func (xrf *XrfFile) ReadRecord(mfn int) (result XrfRecord, err error) {
-	offset := GetXrfOffset(mfn)
-	_, err = xrf.file.Seek(offset, io.SeekStart)
-	if err != nil {
+	if mfn <= 0 {
+		return result, errors.New("bad MFN")
+	}
+	reader := mappedReader{file: xrf.file, mapped: xrf.mapped}
+	buffer := make([]byte, XrfRecordSize)
+	if _, err = reader.ReadAt(buffer, GetXrfOffset(mfn)); err != nil {
 		return
 	}
-	err = binary.Read(xrf.file, binary.BigEndian, &result)
+	err = binary.Read(bytes.NewReader(buffer), binary.BigEndian, &result)
 	return
 }
 
 func (xrf *XrfRecord) Offset() int64 {
 	return (int64(xrf.High) << 32) + int64(xrf.Low)
 }
+
+// NewXrfRecord Ссылка на запись по указанному смещению в MST-файле.
+func NewXrfRecord(offset int64, status int) XrfRecord {
+	return XrfRecord{Low: int32(offset), High: int32(offset >> 32), Status: int32(status)}
+}
+
+// CreateXrfFile создаёт пустой XRF-файл (существующий файл
+// перезаписывается) и открывает его на чтение и запись.
+func CreateXrfFile(filename string) (result *XrfFile, err error) {
+	var file *os.File
+	file, err = os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+
+	result = new(XrfFile)
+	result.file = file
+
+	return result, nil
+}
+
+// WriteRecord записывает ссылку на запись с указанным MFN.
+func (xrf *XrfFile) WriteRecord(mfn int, record XrfRecord) error {
+	buffer := bytes.Buffer{}
+	_ = binary.Write(&buffer, binary.BigEndian, &record)
+	_, err := xrf.file.WriteAt(buffer.Bytes(), GetXrfOffset(mfn))
+	return err
+}
@@ -0,0 +1,814 @@
+package irbis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Идентификаторы объектов Z39.50.
+const (
+	Z3950_BIB1_ATTRIBUTES = "1.2.840.10003.3.1"  // Набор атрибутов Bib-1.
+	Z3950_BIB1_DIAGNOSTIC = "1.2.840.10003.4.1"  // Диагностика Bib-1.
+	Z3950_UNIMARC         = "1.2.840.10003.5.1"  // Синтаксис UNIMARC.
+	Z3950_USMARC          = "1.2.840.10003.5.10" // Синтаксис USMARC (MARC 21).
+	Z3950_RUSMARC         = "1.2.840.10003.5.28" // Синтаксис RUSMARC.
+)
+
+// Диагностические коды Bib-1.
+const (
+	BIB1_PERMANENT_ERROR            = 1    // Постоянная ошибка системы.
+	BIB1_TEMPORARY_ERROR            = 2    // Временная ошибка системы.
+	BIB1_UNSUPPORTED_SEARCH         = 3    // Неподдерживаемый поиск.
+	BIB1_TOO_MANY_OPERATORS         = 6    // Слишком много логических операций.
+	BIB1_PRESENT_OUT_OF_RANGE       = 13   // Номер записи вне диапазона.
+	BIB1_RESULT_SET_EXISTS          = 21   // Результат с таким именем уже существует.
+	BIB1_RESULT_SET_MISSING         = 30   // Результат поиска не существует.
+	BIB1_UNSUPPORTED_QUERY_TYPE     = 107  // Неподдерживаемый тип запроса.
+	BIB1_MALFORMED_QUERY            = 108  // Некорректный запрос.
+	BIB1_DATABASE_UNAVAILABLE       = 109  // База данных недоступна.
+	BIB1_UNSUPPORTED_OPERATOR       = 110  // Неподдерживаемый оператор.
+	BIB1_TOO_MANY_DATABASES         = 111  // Указано слишком много баз данных.
+	BIB1_TOO_MANY_RESULT_SETS       = 112  // Создано слишком много результатов поиска.
+	BIB1_UNSUPPORTED_ATTRIBUTE_TYPE = 113  // Неподдерживаемый тип атрибута.
+	BIB1_UNSUPPORTED_USE            = 114  // Неподдерживаемый атрибут Use.
+	BIB1_UNSUPPORTED_RELATION       = 117  // Неподдерживаемый атрибут Relation.
+	BIB1_UNSUPPORTED_STRUCTURE      = 118  // Неподдерживаемый атрибут Structure.
+	BIB1_UNSUPPORTED_TRUNCATION     = 120  // Неподдерживаемый атрибут Truncation.
+	BIB1_UNSUPPORTED_ATTRIBUTE_SET  = 121  // Неподдерживаемый набор атрибутов.
+	BIB1_DATABASE_MISSING           = 235  // База данных не существует.
+	BIB1_UNSUPPORTED_SYNTAX         = 239  // Неподдерживаемый синтаксис записей.
+	BIB1_RECORD_DELETED             = 1028 // Запись удалена.
+)
+
+// Теги PDU Z39.50.
+const (
+	z3950InitRequest     = 20
+	z3950InitResponse    = 21
+	z3950SearchRequest   = 22
+	z3950SearchResponse  = 23
+	z3950PresentRequest  = 24
+	z3950PresentResponse = 25
+	z3950ScanRequest     = 35
+	z3950ScanResponse    = 36
+	z3950Close           = 48
+)
+
+// Причины закрытия сеанса.
+const (
+	z3950CloseFinished      = 0
+	z3950CloseProtocolError = 6
+)
+
+// z3950MessageSize Максимальный размер сообщения.
+const z3950MessageSize = 1024 * 1024
+
+// z3950MaxQueryDepth Максимальная вложенность логических операций в запросе.
+const z3950MaxQueryDepth = 32
+
+var errZ3950Closed = errors.New("Z39.50 server closed")
+
+// Bib1UseAttributes Соответствие атрибутов Use набора Bib-1
+// префиксам поискового словаря ИРБИС (стандартная база IBIS).
+var Bib1UseAttributes = map[int]string{
+	1:    AUTHOR_PREFIX,     // Personal name
+	2:    COLLECTIVE_PREFIX, // Corporate name
+	3:    COLLECTIVE_PREFIX, // Conference name
+	4:    TITLE_PREFIX,      // Title
+	7:    "B=",              // ISBN
+	8:    "B=",              // ISSN
+	12:   INDEX_PREFIX,      // Local number
+	21:   "S=",              // Subject heading
+	31:   "G=",              // Date of publication
+	54:   "J=",              // Code--language
+	1003: AUTHOR_PREFIX,     // Author
+	1004: AUTHOR_PREFIX,     // Author-name personal
+	1005: COLLECTIVE_PREFIX, // Author-name corporate
+	1006: COLLECTIVE_PREFIX, // Author-name conference
+	1007: "B=",              // Identifier--standard
+	1016: KEYWORD_PREFIX,    // Any
+	1018: "O=",              // Publisher
+	1031: "V=",              // Material-type
+	1032: INVENTORY_PREFIX,  // Doc-id
+	1035: KEYWORD_PREFIX,    // Anywhere
+}
+
+// z3950Diagnostic Диагностическое сообщение Bib-1.
+type z3950Diagnostic struct {
+	code    int
+	details string
+}
+
+// encode Кодирование в формате DefaultDiagFormat.
+func (diagnostic *z3950Diagnostic) encode(class byte, tag int) *berNode {
+	return berConstructed(class, tag,
+		berObjectId(berUniversal, berOid, Z3950_BIB1_DIAGNOSTIC),
+		berInt(berUniversal, berInteger, diagnostic.code),
+		berString(berUniversal, berVisible, diagnostic.details))
+}
+
+// Z3950Server Сервер Z39.50 (версии 2 и 3), предоставляющий доступ
+// к базам данных ИРБИС64. Поддерживаются службы Init, Search (запросы
+// типа 1 с атрибутами Bib-1), Present и Scan. Записи выдаются
+// в формате ISO 2709 (синтаксисы USMARC, RUSMARC и UNIMARC).
+//
+//	pool := irbis.NewConnectionPool("host=127.0.0.1;user=reader;password=secret;", 4)
+//	server := irbis.NewZ3950Server(pool)
+//	log.Fatal(server.ListenAndServe(":210"))
+type Z3950Server struct {
+	// Pool Пул подключений к серверу ИРБИС64.
+	Pool *ConnectionPool
+
+	// Databases Доступные базы данных (пустой список -- любые).
+	Databases []string
+
+	// UseAttributes Соответствие атрибутов Use префиксам словаря.
+	UseAttributes map[int]string
+
+	// Codec Кодировка выдаваемых записей (nil -- UTF-8).
+	Codec Codec
+
+	// MaxRecords Максимальное количество записей в одном ответе.
+	MaxRecords int
+
+	// MaxTerms Максимальное количество терминов в ответе на Scan.
+	MaxTerms int
+
+	// MaxResultSets Максимальное количество именованных результатов
+	// поиска в одном сеансе.
+	MaxResultSets int
+
+	// IdleTimeout Время бездействия клиента, после которого
+	// сеанс закрывается (0 -- не ограничено).
+	IdleTimeout time.Duration
+
+	// ImplementationName Название реализации, сообщаемое клиенту.
+	ImplementationName string
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]bool
+	sessions  map[net.Conn]bool
+	closed    bool
+}
+
+// NewZ3950Server Конструктор сервера с настройками по умолчанию.
+func NewZ3950Server(pool *ConnectionPool) *Z3950Server {
+	return &Z3950Server{
+		Pool:               pool,
+		UseAttributes:      Bib1UseAttributes,
+		MaxRecords:         100,
+		MaxTerms:           100,
+		MaxResultSets:      10,
+		IdleTimeout:        10 * time.Minute,
+		ImplementationName: "GoIrbis Z39.50 server",
+		listeners:          make(map[net.Listener]bool),
+		sessions:           make(map[net.Conn]bool),
+	}
+}
+
+// ListenAndServe Приём подключений по указанному адресу.
+func (server *Z3950Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve Приём подключений. Каждый клиент обслуживается
+// в отдельной горутине. Возвращает ошибку после вызова Close.
+func (server *Z3950Server) Serve(listener net.Listener) error {
+	server.mutex.Lock()
+	if server.closed {
+		server.mutex.Unlock()
+		_ = listener.Close()
+		return errZ3950Closed
+	}
+	server.listeners[listener] = true
+	server.mutex.Unlock()
+
+	defer func() {
+		server.mutex.Lock()
+		delete(server.listeners, listener)
+		server.mutex.Unlock()
+		_ = listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.mutex.Lock()
+			closed := server.closed
+			server.mutex.Unlock()
+			if closed {
+				return errZ3950Closed
+			}
+			return err
+		}
+
+		server.mutex.Lock()
+		if server.closed {
+			server.mutex.Unlock()
+			_ = conn.Close()
+			return errZ3950Closed
+		}
+		server.sessions[conn] = true
+		server.mutex.Unlock()
+
+		go server.serveConnection(conn)
+	}
+}
+
+// Close Прекращение приёма подключений и закрытие всех сеансов.
+func (server *Z3950Server) Close() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.closed = true
+	for listener := range server.listeners {
+		_ = listener.Close()
+	}
+	for conn := range server.sessions {
+		_ = conn.Close()
+	}
+	return nil
+}
+
+//===================================================================
+
+// z3950ResultSet Именованный результат поиска.
+type z3950ResultSet struct {
+	database string
+	found    []int
+}
+
+// z3950Session Состояние сеанса с одним клиентом.
+type z3950Session struct {
+	server      *Z3950Server
+	context     context.Context
+	initialized bool
+	resultSets  map[string]*z3950ResultSet
+}
+
+func (server *Z3950Server) serveConnection(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		server.mutex.Lock()
+		delete(server.sessions, conn)
+		server.mutex.Unlock()
+		_ = conn.Close()
+	}()
+
+	session := &z3950Session{server: server, context: ctx,
+		resultSets: make(map[string]*z3950ResultSet)}
+	reader := bufio.NewReader(conn)
+	for {
+		if server.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(server.IdleTimeout))
+		}
+		request, err := readBer(reader, z3950MessageSize)
+		if err != nil {
+			return
+		}
+
+		response, done := session.handle(request)
+		if response != nil {
+			if _, err = conn.Write(response.encode()); err != nil {
+				return
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// handle Обработка PDU. Возвращает ответ и признак завершения сеанса.
+func (session *z3950Session) handle(request *berNode) (*berNode, bool) {
+	if request.class != berContext || !request.constructed ||
+		!session.initialized && request.tag != z3950InitRequest {
+		return closePdu(nil, z3950CloseProtocolError), true
+	}
+
+	switch request.tag {
+	case z3950InitRequest:
+		session.initialized = true
+		return session.init(request), false
+	case z3950SearchRequest:
+		return session.search(request), false
+	case z3950PresentRequest:
+		return session.present(request), false
+	case z3950ScanRequest:
+		return session.scan(request), false
+	case z3950Close:
+		return closePdu(request.find(berContext, 2), z3950CloseFinished), true
+	}
+
+	return closePdu(request.find(berContext, 2), z3950CloseProtocolError), true
+}
+
+// closePdu Формирование PDU Close.
+func closePdu(referenceId *berNode, reason int) *berNode {
+	return berConstructed(berContext, z3950Close, referenceId,
+		berInt(berContext, 211, reason))
+}
+
+func (session *z3950Session) init(request *berNode) *berNode {
+	var versions []int
+	for version := 0; version < 3; version++ {
+		if request.find(berContext, 3).bitValue(version) {
+			versions = append(versions, version)
+		}
+	}
+
+	// search, present, scan, namedResultSets
+	var options []int
+	for _, option := range []int{0, 1, 7, 14} {
+		if request.find(berContext, 4).bitValue(option) {
+			options = append(options, option)
+		}
+	}
+
+	messageSize := request.find(berContext, 5).intOr(z3950MessageSize)
+	if messageSize <= 0 || messageSize > z3950MessageSize {
+		messageSize = z3950MessageSize
+	}
+	recordSize := request.find(berContext, 6).intOr(z3950MessageSize)
+	if recordSize <= 0 || recordSize > z3950MessageSize {
+		recordSize = z3950MessageSize
+	}
+
+	return berConstructed(berContext, z3950InitResponse,
+		request.find(berContext, 2),
+		berBits(berContext, 3, 3, versions...),
+		berBits(berContext, 4, 16, options...),
+		berInt(berContext, 5, messageSize),
+		berInt(berContext, 6, recordSize),
+		berBool(berContext, 12, true),
+		berString(berContext, 110, "GoIrbis"),
+		berString(berContext, 111, session.server.ImplementationName),
+		berString(berContext, 112, "1.0"))
+}
+
+// database Проверка списка баз данных (допускается одна база).
+func (session *z3950Session) database(names *berNode) (string, *z3950Diagnostic) {
+	if names == nil || len(names.children) == 0 {
+		return "", &z3950Diagnostic{BIB1_DATABASE_UNAVAILABLE, ""}
+	}
+	if len(names.children) != 1 {
+		return "", &z3950Diagnostic{BIB1_TOO_MANY_DATABASES, strconv.Itoa(len(names.children))}
+	}
+
+	name := names.children[0].stringValue()
+	if len(name) == 0 || strings.ContainsAny(name, "\r\n\x00") {
+		return "", &z3950Diagnostic{BIB1_DATABASE_MISSING, name}
+	}
+	if len(session.server.Databases) == 0 {
+		return name, nil
+	}
+	for _, database := range session.server.Databases {
+		if strings.EqualFold(database, name) {
+			return database, nil
+		}
+	}
+	return "", &z3950Diagnostic{BIB1_DATABASE_MISSING, name}
+}
+
+func (session *z3950Session) search(request *berNode) *berNode {
+	referenceId := request.find(berContext, 2)
+	name := PickOne(request.find(berContext, 17).stringValue(), "default")
+
+	found, database, failure := session.searchResultSet(request, name)
+	if failure != nil {
+		return berConstructed(berContext, z3950SearchResponse, referenceId,
+			berInt(berContext, 23, 0),
+			berInt(berContext, 24, 0),
+			berInt(berContext, 25, 1),
+			berBool(berContext, 22, false),
+			berInt(berContext, 26, 3), // none
+			failure.encode(berContext, 130))
+	}
+
+	set := &z3950ResultSet{database: database, found: found}
+	session.resultSets[name] = set
+
+	// Сразу выдаём записи, если их немного
+	total := len(found)
+	count := 0
+	if total <= request.find(berContext, 13).intValue() {
+		count = total
+	} else if total < request.find(berContext, 14).intValue() {
+		count = request.find(berContext, 15).intValue()
+	}
+	if count > session.server.MaxRecords {
+		count = session.server.MaxRecords
+	}
+	if count > total {
+		count = total
+	}
+
+	response := berConstructed(berContext, z3950SearchResponse, referenceId,
+		berInt(berContext, 23, total))
+	if count <= 0 {
+		response.children = append(response.children,
+			berInt(berContext, 24, 0),
+			berInt(berContext, 25, 1),
+			berBool(berContext, 22, true))
+		return response
+	}
+
+	records, failure := session.records(set, 1, count, request.find(berContext, 104).oidValue())
+	if failure != nil {
+		response.children = append(response.children,
+			berInt(berContext, 24, 0),
+			berInt(berContext, 25, 1),
+			berBool(berContext, 22, true),
+			berInt(berContext, 27, 5), // failure
+			failure.encode(berContext, 130))
+		return response
+	}
+
+	response.children = append(response.children,
+		berInt(berContext, 24, count),
+		berInt(berContext, 25, count+1),
+		berBool(berContext, 22, true),
+		berInt(berContext, 27, 0), // success
+		records)
+	return response
+}
+
+// searchResultSet Выполнение поиска для запроса Search.
+func (session *z3950Session) searchResultSet(request *berNode, name string) ([]int, string, *z3950Diagnostic) {
+	server := session.server
+	if _, exists := session.resultSets[name]; exists {
+		if !request.find(berContext, 16).boolValue() {
+			return nil, "", &z3950Diagnostic{BIB1_RESULT_SET_EXISTS, name}
+		}
+	} else if len(session.resultSets) >= server.MaxResultSets {
+		return nil, "", &z3950Diagnostic{BIB1_TOO_MANY_RESULT_SETS, strconv.Itoa(server.MaxResultSets)}
+	}
+
+	database, failure := session.database(request.find(berContext, 18))
+	if failure != nil {
+		return nil, "", failure
+	}
+
+	query := request.find(berContext, 21).first()
+	if query == nil || query.class != berContext || query.tag != 1 {
+		return nil, "", &z3950Diagnostic{BIB1_UNSUPPORTED_QUERY_TYPE, ""}
+	}
+	expression, failure := server.translateRpn(query)
+	if failure != nil {
+		return nil, "", failure
+	}
+
+	connection, err := server.Pool.Acquire(session.context)
+	if err != nil {
+		return nil, "", &z3950Diagnostic{BIB1_TEMPORARY_ERROR, err.Error()}
+	}
+	defer server.Pool.Release(connection)
+
+	found, err := connection.searchAll(database, expression)
+	if err != nil {
+		return nil, "", &z3950Diagnostic{BIB1_TEMPORARY_ERROR, err.Error()}
+	}
+	return found, database, nil
+}
+
+func (session *z3950Session) present(request *berNode) *berNode {
+	referenceId := request.find(berContext, 2)
+	fail := func(start int, failure *z3950Diagnostic) *berNode {
+		return berConstructed(berContext, z3950PresentResponse, referenceId,
+			berInt(berContext, 24, 0),
+			berInt(berContext, 25, start),
+			berInt(berContext, 27, 5), // failure
+			failure.encode(berContext, 130))
+	}
+
+	name := PickOne(request.find(berContext, 31).stringValue(), "default")
+	set, ok := session.resultSets[name]
+	if !ok {
+		return fail(0, &z3950Diagnostic{BIB1_RESULT_SET_MISSING, name})
+	}
+
+	start := request.find(berContext, 30).intValue()
+	count := request.find(berContext, 29).intValue()
+	if start < 1 || start > len(set.found) || count < 0 {
+		return fail(start, &z3950Diagnostic{BIB1_PRESENT_OUT_OF_RANGE, strconv.Itoa(start)})
+	}
+
+	status := 0 // success
+	if count > len(set.found)-start+1 {
+		count = len(set.found) - start + 1
+	}
+	if count > session.server.MaxRecords {
+		count = session.server.MaxRecords
+		status = 1 // partial-1
+	}
+
+	records, failure := session.records(set, start, count, request.find(berContext, 104).oidValue())
+	if failure != nil {
+		return fail(start, failure)
+	}
+
+	return berConstructed(berContext, z3950PresentResponse, referenceId,
+		berInt(berContext, 24, count),
+		berInt(berContext, 25, start+count),
+		berInt(berContext, 27, status),
+		records)
+}
+
+// records Формирование списка записей (responseRecords).
+// Отсутствующие записи заменяются диагностикой.
+func (session *z3950Session) records(set *z3950ResultSet, start, count int,
+	syntax string) (*berNode, *z3950Diagnostic) {
+	syntax = PickOne(syntax, Z3950_USMARC)
+	if syntax != Z3950_USMARC && syntax != Z3950_RUSMARC && syntax != Z3950_UNIMARC {
+		return nil, &z3950Diagnostic{BIB1_UNSUPPORTED_SYNTAX, syntax}
+	}
+
+	server := session.server
+	connection, err := server.Pool.Acquire(session.context)
+	if err != nil {
+		return nil, &z3950Diagnostic{BIB1_TEMPORARY_ERROR, err.Error()}
+	}
+	defer server.Pool.Release(connection)
+
+	mfnList := set.found[start-1 : start-1+count]
+	records, err := connection.readRecordsBatch(set.database, mfnList)
+	if err != nil {
+		return nil, &z3950Diagnostic{BIB1_TEMPORARY_ERROR, err.Error()}
+	}
+	byMfn := make(map[int]*MarcRecord, len(records))
+	for i := range records {
+		byMfn[records[i].Mfn] = &records[i]
+	}
+
+	result := berConstructed(berContext, 28)
+	for _, mfn := range mfnList {
+		var record *berNode
+		buffer := bytes.Buffer{}
+		if found, ok := byMfn[mfn]; !ok || found.IsDeleted() {
+			failure := &z3950Diagnostic{BIB1_RECORD_DELETED, strconv.Itoa(mfn)}
+			record = berConstructed(berContext, 2, failure.encode(berUniversal, berSequence))
+		} else if err = NewIsoWriter(&buffer, pickCodec(server.Codec, Utf8Codec)).Write(found); err != nil {
+			failure := &z3950Diagnostic{BIB1_PERMANENT_ERROR, err.Error()}
+			record = berConstructed(berContext, 2, failure.encode(berUniversal, berSequence))
+		} else {
+			record = berConstructed(berContext, 1,
+				berConstructed(berUniversal, berExternal,
+					berObjectId(berUniversal, berOid, syntax),
+					berPrimitive(berContext, 1, buffer.Bytes())))
+		}
+		result.children = append(result.children, berSequenceOf(
+			berString(berContext, 0, set.database),
+			berConstructed(berContext, 1, record)))
+	}
+
+	return result, nil
+}
+
+func (session *z3950Session) scan(request *berNode) *berNode {
+	referenceId := request.find(berContext, 2)
+	terms, position, failure := session.scanTerms(request)
+	if failure != nil {
+		return berConstructed(berContext, z3950ScanResponse, referenceId,
+			berInt(berContext, 3, 0),
+			berInt(berContext, 4, 6), // failure
+			berInt(berContext, 5, 0),
+			berConstructed(berContext, 7,
+				berConstructed(berContext, 2, failure.encode(berUniversal, berSequence))))
+	}
+
+	entries := berConstructed(berContext, 1)
+	for _, term := range terms {
+		entries.children = append(entries.children, berConstructed(berContext, 1,
+			berString(berContext, 45, term.Text),
+			berInt(berContext, 2, term.Count)))
+	}
+
+	return berConstructed(berContext, z3950ScanResponse, referenceId,
+		berInt(berContext, 3, 0),
+		berInt(berContext, 4, 0), // success
+		berInt(berContext, 5, len(terms)),
+		berInt(berContext, 6, position),
+		berConstructed(berContext, 7, entries))
+}
+
+// scanTerms Просмотр словаря для запроса Scan.
+func (session *z3950Session) scanTerms(request *berNode) (result []TermInfo, position int,
+	failure *z3950Diagnostic) {
+	server := session.server
+	database, failure := session.database(request.find(berContext, 3))
+	if failure != nil {
+		return
+	}
+	if oid := request.find(berUniversal, berOid).oidValue(); oid != "" && oid != Z3950_BIB1_ATTRIBUTES {
+		return nil, 0, &z3950Diagnostic{BIB1_UNSUPPORTED_ATTRIBUTE_SET, oid}
+	}
+
+	term, failure := server.parseTerm(request.find(berContext, 102))
+	if failure != nil {
+		return
+	}
+
+	maximum := request.find(berContext, 6).intValue()
+	if maximum > server.MaxTerms {
+		maximum = server.MaxTerms
+	}
+	position = request.find(berContext, 7).intOr(1)
+	if position < 1 {
+		position = 1
+	}
+	if position > maximum+1 {
+		position = maximum + 1
+	}
+
+	connection, err := server.Pool.Acquire(session.context)
+	if err != nil {
+		return nil, 0, &z3950Diagnostic{BIB1_TEMPORARY_ERROR, err.Error()}
+	}
+	defer server.Pool.Release(connection)
+
+	text := strings.ToUpper(term.text)
+	result, err = termsAround(connection, database, term.prefix, term.prefix+text, position, maximum)
+	if err != nil {
+		return nil, 0, &z3950Diagnostic{BIB1_TEMPORARY_ERROR, err.Error()}
+	}
+
+	// Фактическая позиция начального термина
+	position = 1
+	for _, item := range result {
+		if item.Text < text {
+			position++
+		}
+	}
+
+	return
+}
+
+//===================================================================
+
+// z3950Term Термин запроса с разобранными атрибутами Bib-1.
+type z3950Term struct {
+	prefix     string
+	text       string
+	structure  int
+	truncation int
+}
+
+// parseTerm Разбор AttributesPlusTerm.
+func (server *Z3950Server) parseTerm(node *berNode) (result z3950Term, failure *z3950Diagnostic) {
+	termNode := node.find(berContext, 45)
+	if termNode == nil {
+		return result, &z3950Diagnostic{BIB1_MALFORMED_QUERY, "general term expected"}
+	}
+	result.text = strings.TrimSpace(strings.Replace(termNode.stringValue(), `"`, "", -1))
+	result.truncation = 100
+
+	use := 1016
+	if attributes := node.find(berContext, 44); attributes != nil {
+		for _, element := range attributes.children {
+			value := element.find(berContext, 121)
+			if value == nil {
+				return result, &z3950Diagnostic{BIB1_UNSUPPORTED_ATTRIBUTE_TYPE, "complex attribute"}
+			}
+			kind := element.find(berContext, 120).intValue()
+			switch kind {
+			case 1:
+				use = value.intValue()
+			case 2:
+				// Равенство либо релевантность
+				if relation := value.intValue(); relation != 3 && relation != 102 {
+					return result, &z3950Diagnostic{BIB1_UNSUPPORTED_RELATION, strconv.Itoa(relation)}
+				}
+			case 3, 6:
+				// Позиция и полнота не учитываются
+			case 4:
+				result.structure = value.intValue()
+			case 5:
+				result.truncation = value.intValue()
+			default:
+				return result, &z3950Diagnostic{BIB1_UNSUPPORTED_ATTRIBUTE_TYPE, strconv.Itoa(kind)}
+			}
+		}
+	}
+
+	prefix, ok := server.UseAttributes[use]
+	if !ok {
+		return result, &z3950Diagnostic{BIB1_UNSUPPORTED_USE, strconv.Itoa(use)}
+	}
+	result.prefix = prefix
+
+	switch result.structure {
+	case 0, 1, 2, 3, 4, 5, 6, 101, 108:
+	default:
+		return result, &z3950Diagnostic{BIB1_UNSUPPORTED_STRUCTURE, strconv.Itoa(result.structure)}
+	}
+	if result.truncation != 1 && result.truncation != 100 {
+		return result, &z3950Diagnostic{BIB1_UNSUPPORTED_TRUNCATION, strconv.Itoa(result.truncation)}
+	}
+
+	return
+}
+
+// translateRpn Трансляция запроса типа 1 (RPNQuery)
+// в поисковое выражение ИРБИС.
+func (server *Z3950Server) translateRpn(query *berNode) (string, *z3950Diagnostic) {
+	if oid := query.find(berUniversal, berOid).oidValue(); oid != Z3950_BIB1_ATTRIBUTES {
+		return "", &z3950Diagnostic{BIB1_UNSUPPORTED_ATTRIBUTE_SET, oid}
+	}
+	if len(query.children) != 2 {
+		return "", &z3950Diagnostic{BIB1_MALFORMED_QUERY, ""}
+	}
+
+	result, failure := server.translateStructure(query.children[1], z3950MaxQueryDepth)
+	if failure != nil {
+		return "", failure
+	}
+	return result.String(), nil
+}
+
+// translateStructure Трансляция RPNStructure, вложенность
+// логических операций в которой не превышает depth.
+func (server *Z3950Server) translateStructure(node *berNode, depth int) (result Search, failure *z3950Diagnostic) {
+	if node.class != berContext {
+		return result, &z3950Diagnostic{BIB1_MALFORMED_QUERY, ""}
+	}
+
+	switch node.tag {
+	case 0:
+		operand := node.first()
+		if operand == nil || operand.class != berContext || operand.tag != 102 {
+			// Ссылки на результаты поиска не поддерживаются
+			return result, &z3950Diagnostic{BIB1_UNSUPPORTED_SEARCH, "operand"}
+		}
+		return server.translateTerm(operand)
+
+	case 1:
+		if len(node.children) != 3 {
+			return result, &z3950Diagnostic{BIB1_MALFORMED_QUERY, ""}
+		}
+		if depth <= 0 {
+			return result, &z3950Diagnostic{BIB1_TOO_MANY_OPERATORS, "query is nested too deeply"}
+		}
+		var left, right Search
+		if left, failure = server.translateStructure(node.children[0], depth-1); failure != nil {
+			return
+		}
+		if right, failure = server.translateStructure(node.children[1], depth-1); failure != nil {
+			return
+		}
+		operator := node.children[2].first()
+		if operator == nil {
+			return result, &z3950Diagnostic{BIB1_MALFORMED_QUERY, "operator"}
+		}
+		switch operator.tag {
+		case 0:
+			return left.And(right), nil
+		case 1:
+			return left.Or(right), nil
+		case 2:
+			return left.Not(right), nil
+		}
+		return result, &z3950Diagnostic{BIB1_UNSUPPORTED_OPERATOR, strconv.Itoa(operator.tag)}
+	}
+
+	return result, &z3950Diagnostic{BIB1_MALFORMED_QUERY, ""}
+}
+
+// translateTerm Трансляция AttributesPlusTerm. Для словаря ключевых
+// слов многословный термин по умолчанию ищется по всем словам.
+func (server *Z3950Server) translateTerm(node *berNode) (result Search, failure *z3950Diagnostic) {
+	term, failure := server.parseTerm(node)
+	if failure != nil {
+		return
+	}
+
+	words := []string{term.text}
+	if term.structure == 6 || term.structure == 0 && term.prefix == KEYWORD_PREFIX {
+		words = strings.Fields(term.text)
+	}
+	if len(words) == 0 || len(words[0]) == 0 {
+		return result, &z3950Diagnostic{BIB1_MALFORMED_QUERY, "empty term"}
+	}
+
+	for i, word := range words {
+		if term.truncation == 1 {
+			word += "$"
+		}
+		if i == 0 {
+			result = Equals(term.prefix, word)
+		} else {
+			result = result.And(Equals(term.prefix, word))
+		}
+	}
+	return
+}
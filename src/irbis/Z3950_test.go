@@ -0,0 +1,258 @@
+package irbis
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// z3950Client Клиентская сторона сеанса Z39.50 для тестов.
+type z3950Client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newZ3950Client(t *testing.T, expressions *[]string) *z3950Client {
+	pool := NewConnectionPool("", 1)
+	pool.factory = func() *Connection {
+		return newFakeConnection(fakeDictionary(expressions, "A=ПУШКИН", "A=ТОЛСТОЙ", "A=ЧЕХОВ", "T=X"))
+	}
+	server := NewZ3950Server(pool)
+	client, conn := net.Pipe()
+	go server.serveConnection(conn)
+	return &z3950Client{t: t, conn: client, reader: bufio.NewReader(client)}
+}
+
+func (client *z3950Client) call(request *berNode) *berNode {
+	if _, err := client.conn.Write(request.encode()); err != nil {
+		client.t.Fatal(err)
+	}
+	response, err := readBer(client.reader, z3950MessageSize)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	return response
+}
+
+func (client *z3950Client) init() {
+	response := client.call(berConstructed(berContext, z3950InitRequest,
+		berString(berContext, 2, "ref"),
+		berBits(berContext, 3, 3, 0, 1, 2),
+		berBits(berContext, 4, 16, 0, 1, 7, 14, 15),
+		berInt(berContext, 5, 65536),
+		berInt(berContext, 6, 65536)))
+	if response.tag != z3950InitResponse || !response.find(berContext, 12).boolValue() ||
+		response.find(berContext, 2).stringValue() != "ref" ||
+		!response.find(berContext, 4).bitValue(7) || response.find(berContext, 4).bitValue(15) ||
+		response.find(berContext, 5).intValue() != 65536 {
+		client.t.Fatal(response)
+	}
+}
+
+// rpnTerm Операнд запроса с атрибутом Use и необязательными
+// дополнительными атрибутами (тип, значение).
+func rpnTerm(use int, term string, attributes ...int) *berNode {
+	list := berConstructed(berContext, 44,
+		berSequenceOf(berInt(berContext, 120, 1), berInt(berContext, 121, use)))
+	for i := 0; i+1 < len(attributes); i += 2 {
+		list.children = append(list.children, berSequenceOf(
+			berInt(berContext, 120, attributes[i]), berInt(berContext, 121, attributes[i+1])))
+	}
+	return berConstructed(berContext, 102, list, berString(berContext, 45, term))
+}
+
+func searchPdu(structure *berNode, database string) *berNode {
+	return berConstructed(berContext, z3950SearchRequest,
+		berInt(berContext, 13, 0),
+		berInt(berContext, 14, 1),
+		berInt(berContext, 15, 0),
+		berBool(berContext, 16, true),
+		berString(berContext, 17, "default"),
+		berConstructed(berContext, 18, berString(berContext, 105, database)),
+		berConstructed(berContext, 21, berConstructed(berContext, 1,
+			berObjectId(berUniversal, berOid, Z3950_BIB1_ATTRIBUTES),
+			structure)))
+}
+
+func diagnosticCode(response *berNode) int {
+	diagnostic := response.find(berContext, 130)
+	if diagnostic == nil {
+		return 0
+	}
+	return diagnostic.find(berUniversal, berInteger).intValue()
+}
+
+func TestZ3950Server_Search_1(t *testing.T) {
+	var expressions []string
+	client := newZ3950Client(t, &expressions)
+	defer client.conn.Close()
+	client.init()
+
+	query := berConstructed(berContext, 1,
+		berConstructed(berContext, 0, rpnTerm(1003, "пушкин", 5, 1)),
+		berConstructed(berContext, 0, rpnTerm(4, "евгений онегин")),
+		berConstructed(berContext, 46, berPrimitive(berContext, 0, nil)))
+	response := client.call(searchPdu(query, "IBIS"))
+	if response.tag != z3950SearchResponse || !response.find(berContext, 22).boolValue() ||
+		response.find(berContext, 23).intValue() != 3 || response.find(berContext, 24).intValue() != 0 {
+		t.Fatal(response)
+	}
+	if len(expressions) != 1 || expressions[0] != `(A=пушкин$ * "T=евгений онегин")` {
+		t.Fatal(expressions)
+	}
+
+	response = client.call(berConstructed(berContext, z3950PresentRequest,
+		berString(berContext, 31, "default"),
+		berInt(berContext, 30, 2),
+		berInt(berContext, 29, 5),
+		berObjectId(berContext, 104, Z3950_RUSMARC)))
+	records := response.find(berContext, 28)
+	if response.tag != z3950PresentResponse || response.find(berContext, 24).intValue() != 2 ||
+		response.find(berContext, 25).intValue() != 4 || records == nil || len(records.children) != 2 {
+		t.Fatal(response)
+	}
+	external := records.children[0].find(berContext, 1).first().first()
+	if external.tag != berExternal || external.find(berUniversal, berOid).oidValue() != Z3950_RUSMARC {
+		t.Fatal(external)
+	}
+	iso, err := NewIsoReader(bytes.NewReader(external.find(berContext, 1).value), Utf8Codec).Read()
+	if err != nil || iso.FSM(200, 'a') != "Title 2" {
+		t.Fatal(iso, err)
+	}
+
+	response = client.call(berConstructed(berContext, z3950Close, berInt(berContext, 211, 0)))
+	if response.tag != z3950Close {
+		t.Fatal(response)
+	}
+}
+
+func TestZ3950Server_Search_2(t *testing.T) {
+	var expressions []string
+	client := newZ3950Client(t, &expressions)
+	defer client.conn.Close()
+	client.init()
+
+	for _, item := range []struct {
+		query    *berNode
+		database string
+		code     int
+	}{
+		{berConstructed(berContext, 0, rpnTerm(9999, "x")), "IBIS", BIB1_UNSUPPORTED_USE},
+		{berConstructed(berContext, 0, rpnTerm(4, "x", 2, 5)), "IBIS", BIB1_UNSUPPORTED_RELATION},
+		{berConstructed(berContext, 0, rpnTerm(4, "x", 5, 2)), "IBIS", BIB1_UNSUPPORTED_TRUNCATION},
+		{berConstructed(berContext, 0, rpnTerm(4, "x", 7, 1)), "IBIS", BIB1_UNSUPPORTED_ATTRIBUTE_TYPE},
+		{berConstructed(berContext, 1,
+			berConstructed(berContext, 0, rpnTerm(4, "a")),
+			berConstructed(berContext, 0, rpnTerm(4, "b")),
+			berConstructed(berContext, 46, berPrimitive(berContext, 3, nil))), "IBIS", BIB1_UNSUPPORTED_OPERATOR},
+		{berConstructed(berContext, 0, rpnTerm(4, "x")), "IB\nIS", BIB1_DATABASE_MISSING},
+	} {
+		response := client.call(searchPdu(item.query, item.database))
+		if response.find(berContext, 22).boolValue() || diagnosticCode(response) != item.code {
+			t.Fatal(item.code, response)
+		}
+	}
+	if len(expressions) != 0 {
+		t.Fatal(expressions)
+	}
+
+	// Piggyback: небольшой результат выдаётся сразу
+	request := searchPdu(berConstructed(berContext, 0, rpnTerm(1016, "война мир")), "IBIS")
+	request.children[0] = berInt(berContext, 13, 10)
+	response := client.call(request)
+	if response.find(berContext, 24).intValue() != 3 || len(response.find(berContext, 28).children) != 3 {
+		t.Fatal(response)
+	}
+	if expressions[0] != "(K=война * K=мир)" {
+		t.Fatal(expressions)
+	}
+
+	response = client.call(berConstructed(berContext, z3950PresentRequest,
+		berString(berContext, 31, "other"), berInt(berContext, 30, 1), berInt(berContext, 29, 1)))
+	if diagnosticCode(response) != BIB1_RESULT_SET_MISSING {
+		t.Fatal(response)
+	}
+	response = client.call(berConstructed(berContext, z3950PresentRequest,
+		berInt(berContext, 30, 4), berInt(berContext, 29, 1)))
+	if diagnosticCode(response) != BIB1_PRESENT_OUT_OF_RANGE {
+		t.Fatal(response)
+	}
+	response = client.call(berConstructed(berContext, z3950PresentRequest,
+		berInt(berContext, 30, 1), berInt(berContext, 29, 1),
+		berObjectId(berContext, 104, "1.2.840.10003.5.109.10")))
+	if diagnosticCode(response) != BIB1_UNSUPPORTED_SYNTAX {
+		t.Fatal(response)
+	}
+}
+
+func TestZ3950Server_Scan_1(t *testing.T) {
+	var expressions []string
+	client := newZ3950Client(t, &expressions)
+	defer client.conn.Close()
+	client.init()
+
+	response := client.call(berConstructed(berContext, z3950ScanRequest,
+		berConstructed(berContext, 3, berString(berContext, 105, "IBIS")),
+		berObjectId(berUniversal, berOid, Z3950_BIB1_ATTRIBUTES),
+		rpnTerm(1003, "толстой"),
+		berInt(berContext, 6, 5),
+		berInt(berContext, 7, 2)))
+	entries := response.find(berContext, 7).find(berContext, 1)
+	if response.tag != z3950ScanResponse || response.find(berContext, 4).intValue() != 0 ||
+		response.find(berContext, 6).intValue() != 2 || entries == nil {
+		t.Fatal(response)
+	}
+	var terms []string
+	for _, entry := range entries.children {
+		terms = append(terms, entry.find(berContext, 45).stringValue())
+	}
+	if strings.Join(terms, " ") != "ПУШКИН ТОЛСТОЙ ЧЕХОВ" ||
+		response.find(berContext, 5).intValue() != 3 {
+		t.Fatal(terms)
+	}
+}
+
+func TestZ3950Server_Protocol_1(t *testing.T) {
+	var expressions []string
+	client := newZ3950Client(t, &expressions)
+	defer client.conn.Close()
+
+	// Запрос до инициализации завершает сеанс
+	response := client.call(searchPdu(berConstructed(berContext, 0, rpnTerm(4, "x")), "IBIS"))
+	if response.tag != z3950Close || response.find(berContext, 211).intValue() != z3950CloseProtocolError {
+		t.Fatal(response)
+	}
+}
+
+func TestZ3950Server_Protocol_2(t *testing.T) {
+	var expressions []string
+	client := newZ3950Client(t, &expressions)
+	defer client.conn.Close()
+	client.init()
+
+	// Слишком глубокая вложенность логических операций
+	query := berConstructed(berContext, 0, rpnTerm(4, "x"))
+	for i := 0; i <= z3950MaxQueryDepth; i++ {
+		query = berConstructed(berContext, 1, query,
+			berConstructed(berContext, 0, rpnTerm(4, "y")),
+			berConstructed(berContext, 46, berPrimitive(berContext, 0, nil)))
+	}
+	response := client.call(searchPdu(query, "IBIS"))
+	if diagnosticCode(response) != BIB1_TOO_MANY_OPERATORS || len(expressions) != 0 {
+		t.Fatal(response)
+	}
+
+	// PDU с недопустимой вложенностью BER завершает сеанс
+	pdu := berPrimitive(berContext, 0, nil)
+	for i := 0; i < 1000; i++ {
+		pdu = berConstructed(berContext, z3950SearchRequest, pdu)
+	}
+	go func() { _, _ = client.conn.Write(pdu.encode()) }()
+	if _, err := readBer(client.reader, z3950MessageSize); err != io.EOF {
+		t.Fatal(err)
+	}
+}